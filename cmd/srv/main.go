@@ -4,11 +4,73 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // for -timezone on hosts without a zoneinfo database
 
 	"srv.exe.dev/srv"
 )
 
-var flagListenAddr = flag.String("listen", ":8000", "address to listen on")
+var (
+	flagListenAddr = flag.String("listen", ":8000", `address to listen on, or "unix:/path/to.sock" for a Unix socket`)
+	flagTLSCert    = flag.String("tls-cert", "", "TLS certificate file; serves HTTPS together with -tls-key")
+	flagTLSKey     = flag.String("tls-key", "", "TLS private key file")
+	flagAdmins     = flag.String("admins", "", "comma-separated exe.dev emails allowed to use admin endpoints")
+	flagDebug      = flag.Bool("debug", false, "enable /api/debug diagnostics")
+	flagReload     = flag.Bool("reload-prompts", false, "re-read AI prompt templates from srv/prompts on every request (for development)")
+	flagLocale     = flag.String("locale", "ja", `language for category labels in AI prompts ("ja" or "en")`)
+	flagOrigin     = flag.String("origin-label", "", `name of the start and end stops of routes; empty uses the locale's ("現在地" or "Current location")`)
+	flagExportOrig = flag.Bool("export-origin", true, "include the start and end stops in route polylines and KML (KML requests may override with include_origin)")
+	flagNominatim  = flag.String("nominatim", "", "Nominatim base URL for geocoding new spots (e.g. https://nominatim.openstreetmap.org); empty disables")
+
+	flagEarthRadius       = flag.Float64("earth-radius-km", 6371, "Earth radius used for distance estimates")
+	flagDistanceMode      = flag.String("distance-mode", "great-circle", `distance estimate: "great-circle" or "rhumb" (constant bearing)`)
+	flagMaxHistoryLimit   = flag.Int("max-history-limit", 100, "the most visits GET /api/history returns per page, whatever limit asks for")
+	flagHistoryRetention  = flag.Duration("history-retention", 0, "prune route and recommendation history older than this (e.g. 2160h); 0 keeps everything")
+	flagFreshnessWindow   = flag.Duration("freshness-window", 0, "boost newly added spots in recommendations for this long after creation (e.g. 720h); 0 disables")
+	flagFreshnessBoost    = flag.Float64("freshness-boost", 1.5, "ranking boost for a brand-new spot, fading to 0 over -freshness-window")
+	flagCategoryRating    = flag.Float64("category-rating-weight", 1.5, "ranking boost (or penalty) for spots in categories the user rates 5 (or 1) stars; 0 ignores their ratings")
+	flagRevisitRating     = flag.Int("revisit-min-rating", 0, "recommend visited spots again if the user rated them at least this (1-5) on average and hasn't been back for -revisit-cooldown; 0 never does")
+	flagRecentCategories  = flag.Duration("recent-category-window", 14*24*time.Hour, "how far back routes with diversify_from_history look for the categories the user visited")
+	flagRevisitCooldown   = flag.Duration("revisit-cooldown", 90*24*time.Hour, "how long after a visit a liked spot may be recommended again")
+	flagSpotCap           = flag.Int("spot-recommend-cap", 0, "exclude spots already recommended to the user this many times within -spot-recommend-cap-window; 0 disables")
+	flagSpotCapWindow     = flag.Duration("spot-recommend-cap-window", 30*24*time.Hour, "window -spot-recommend-cap counts recommendations in")
+	flagMinCandidates     = flag.Int("min-candidate-pool", 0, "widen a recommendation's max_distance_km in steps while fewer spots than this pass its filters; 0 disables")
+	flagMaxRelaxedKm      = flag.Float64("max-relaxed-distance-km", 200, "farthest -min-candidate-pool may widen a recommendation's search to")
+	flagRecentPenalty     = flag.Float64("recent-penalty", 3, "ranking penalty for spots recommended to the user in the last week")
+	flagCooldown          = flag.Duration("recommend-cooldown", 0, "repeat a user's last recommendations instead of calling the AI when they ask again for nearly the same place within this long (e.g. 2m); 0 disables")
+	flagCooldownKm        = flag.Float64("recommend-cooldown-km", 0.5, "origins this close count as the same place for -recommend-cooldown")
+	flagDuplicateRadius   = flag.Float64("duplicate-radius-km", 0.1, "reject new spots this close to an existing one unless forced; 0 disables")
+	flagIncludeMeal       = flag.Bool("default-include-restaurant", false, "allow meal stops in routes whose request omits include_restaurant")
+	flagIncludeRest       = flag.Bool("default-include-rest", false, "allow rest stops in routes whose request omits include_rest")
+	flagCacheKeyPrecision = flag.Int("cache-key-precision", 3, "round recommendation origins to this many decimal places so nearby requests count as the same place for -recommend-cooldown; 0 keeps them as given")
+	flagCoordPrecision    = flag.Int("coordinate-precision", 6, "round spot coordinates to this many decimal places when they are saved; 0 stores them as given")
+	flagVerifyCoords      = flag.Bool("verify-coordinates", false, "reverse geocode spot coordinates on create and update and reject those that don't match the spot's name or address unless forced")
+	flagMaxSpotMove       = flag.Float64("max-spot-move-km", 5, "reject spot edits that move it farther than this unless forced; 0 disables")
+	flagAccessStrict      = flag.Bool("accessibility-strict", true, "when a request requires an accessibility attribute, also exclude spots where it is unknown")
+	flagMinRecommend      = flag.Int("min-recommendations", 3, "fill recommendations from ranked candidates when the AI picks fewer than this")
+	flagMaxRecommend      = flag.Int("max-recommendations", 5, "return at most this many recommended spots")
+	flagCandidateOrder    = flag.String("prompt-candidate-order", "score", `which recommendation candidates the AI sees when there are more than 30: "score" (best ranked) or "distance" (nearest)`)
+	flagPastDeparture     = flag.String("past-departure", "as-is", `routes whose departure time has passed today: "as-is", "next-day" (scheduled for tomorrow), "now" (leave now) or "reject"`)
+	flagTimeZone          = flag.String("timezone", "Asia/Tokyo", "IANA time zone that request clock times such as departure_time are in, for -past-departure")
+	flagFallbackOrder     = flag.String("fallback-order", "ranked", `spots that fill recommendations when the AI fails: "ranked", "nearest", "rated" or "diverse" (one category at a time)`)
+	flagStayLimits        = flag.String("stay-limits", "", `clamp AI stay durations per category in minutes, e.g. "rest=10-45,restaurant=30-90"; unset categories keep built-in limits`)
+	flagDefaultStays      = flag.String("default-stays", "", `stay in minutes at stops given no duration, per category, e.g. "drive=60,rest=15"; defaults to drive=40,restaurant=50,rest=20`)
+	flagMaxStops          = flag.String("max-stops", "", `cap route stops per category, e.g. "restaurant=1,rest=2"; defaults to one of each`)
+	flagFuelEfficiency    = flag.Float64("fuel-efficiency-km-l", 0, "vehicle fuel efficiency in km/L for route fuel cost estimates; 0 disables unless a request sets it")
+	flagFuelPrice         = flag.Float64("fuel-price", 0, "fuel price per litre for route fuel cost estimates; 0 disables unless a request sets it")
+	flagMaxCandidateSpots = flag.Int("max-candidate-spots", 5000, "load at most this many spots (nearest first) per recommendation or route; 0 disables the cap")
+	flagPromptDescMax     = flag.Int("prompt-description-max", 80, "truncate candidate descriptions in AI prompts to this many characters; 0 sends them in full")
+	flagMaxPromptChars    = flag.Int("max-prompt-chars", 20000, "trim visit history, then the lowest ranked candidates, from recommendation prompts longer than this many characters; 0 disables")
+	flagAuditLLM          = flag.Bool("audit-llm", false, "record AI prompts and responses in the llm_audit table")
+	flagAuditRedact       = flag.Bool("audit-redact-coords", true, "mask coordinates in recorded AI prompts and responses")
+	flagLLMWindow         = flag.Int("llm-health-window", 50, "how many recent AI calls /api/stats/llm reports the success rate of")
+	flagLLMThreshold      = flag.Float64("llm-success-threshold", 0.8, "warn when the AI success rate over -llm-health-window drops below this (0-1); 0 never warns")
+	flagAuditRetention    = flag.Duration("audit-retention", 0, "prune AI audit records older than this (e.g. 168h); 0 keeps everything")
+	flagRouteReachMode    = flag.String("route-reach-mode", "one-way", `limit route candidates by "one-way" distance from the origin or by their share of the "round-trip", letting clusters of farther spots in`)
+	flagRouteReachDivisor = flag.Float64("route-reach-divisor", 3, "farthest route stop is at most 1/N of the driving distance budget away (N > 0)")
+	flagLatestReturn      = flag.String("latest-return", "", `routes without a return time only offer spots whose round trip fits before this time ("HH:MM", e.g. "21:00"); empty disables`)
+)
 
 func main() {
 	if err := run(); err != nil {
@@ -18,6 +80,84 @@ func main() {
 
 func run() error {
 	flag.Parse()
+	if (*flagTLSCert == "") != (*flagTLSKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	if *flagRouteReachDivisor <= 0 {
+		return fmt.Errorf("-route-reach-divisor must be > 0, got %v", *flagRouteReachDivisor)
+	}
+	if *flagMinCandidates > 0 && *flagMaxRelaxedKm <= 0 {
+		return fmt.Errorf("-max-relaxed-distance-km must be > 0 with -min-candidate-pool, got %v", *flagMaxRelaxedKm)
+	}
+	if *flagRevisitRating < 0 || *flagRevisitRating > 5 {
+		return fmt.Errorf("-revisit-min-rating must be between 0 and 5, got %d", *flagRevisitRating)
+	}
+	if *flagCacheKeyPrecision < 0 || *flagCacheKeyPrecision > 15 {
+		return fmt.Errorf("-cache-key-precision must be between 0 and 15, got %d", *flagCacheKeyPrecision)
+	}
+	if *flagCoordPrecision < 0 || *flagCoordPrecision > 15 {
+		return fmt.Errorf("-coordinate-precision must be between 0 and 15, got %d", *flagCoordPrecision)
+	}
+	if *flagEarthRadius <= 0 {
+		return fmt.Errorf("-earth-radius-km must be > 0, got %v", *flagEarthRadius)
+	}
+	if *flagMinRecommend < 1 || *flagMinRecommend > *flagMaxRecommend {
+		return fmt.Errorf("need 1 <= -min-recommendations <= -max-recommendations, got %d and %d", *flagMinRecommend, *flagMaxRecommend)
+	}
+	stayLimits, err := srv.ParseStayLimits(*flagStayLimits)
+	if err != nil {
+		return fmt.Errorf("-stay-limits: %w", err)
+	}
+	defaultStays, err := srv.ParseDefaultStays(*flagDefaultStays)
+	if err != nil {
+		return fmt.Errorf("-default-stays: %w", err)
+	}
+	maxStops, err := srv.ParseMaxStops(*flagMaxStops)
+	if err != nil {
+		return fmt.Errorf("-max-stops: %w", err)
+	}
+	if *flagMaxHistoryLimit <= 0 {
+		return fmt.Errorf("-max-history-limit must be > 0, got %d", *flagMaxHistoryLimit)
+	}
+	if *flagLLMWindow <= 0 {
+		return fmt.Errorf("-llm-health-window must be > 0, got %d", *flagLLMWindow)
+	}
+	if *flagLLMThreshold < 0 || *flagLLMThreshold > 1 {
+		return fmt.Errorf("-llm-success-threshold must be between 0 and 1, got %v", *flagLLMThreshold)
+	}
+	reachMode := srv.RouteReachMode(*flagRouteReachMode)
+	if reachMode != srv.ReachOneWay && reachMode != srv.ReachRoundTrip {
+		return fmt.Errorf("-route-reach-mode must be one-way or round-trip, got %q", *flagRouteReachMode)
+	}
+	fallback := srv.FallbackOrder(*flagFallbackOrder)
+	switch fallback {
+	case srv.FallbackRanked, srv.FallbackNearest, srv.FallbackRated, srv.FallbackDiverse:
+	default:
+		return fmt.Errorf("-fallback-order must be ranked, nearest, rated or diverse, got %q", *flagFallbackOrder)
+	}
+	pastDeparture := srv.PastDeparture(*flagPastDeparture)
+	switch pastDeparture {
+	case srv.PastDepartureAsIs, srv.PastDepartureNextDay, srv.PastDepartureNow, srv.PastDepartureReject:
+	default:
+		return fmt.Errorf("-past-departure must be as-is, next-day, now or reject, got %q", *flagPastDeparture)
+	}
+	timeZone, err := time.LoadLocation(*flagTimeZone)
+	if err != nil {
+		return fmt.Errorf("-timezone: %w", err)
+	}
+	if *flagLatestReturn != "" {
+		if _, err := time.Parse("15:04", *flagLatestReturn); err != nil {
+			return fmt.Errorf("-latest-return must be HH:MM, got %q", *flagLatestReturn)
+		}
+	}
+	candidateOrder := srv.CandidateOrder(*flagCandidateOrder)
+	if candidateOrder != srv.CandidateByScore && candidateOrder != srv.CandidateByDistance {
+		return fmt.Errorf("-prompt-candidate-order must be score or distance, got %q", *flagCandidateOrder)
+	}
+	mode := srv.DistanceMode(*flagDistanceMode)
+	if mode != srv.GreatCircle && mode != srv.Rhumb {
+		return fmt.Errorf("-distance-mode must be great-circle or rhumb, got %q", *flagDistanceMode)
+	}
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
@@ -26,5 +166,65 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("create server: %w", err)
 	}
+	for _, email := range strings.Split(*flagAdmins, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			server.AdminEmails = append(server.AdminEmails, email)
+		}
+	}
+	if *flagNominatim != "" {
+		server.Geocoder = srv.NewNominatimGeocoder(*flagNominatim)
+	}
+	server.TokenSecret = []byte(os.Getenv("TOKEN_SECRET"))
+	server.DebugMode = *flagDebug
+	server.PromptReload = *flagReload
+	server.Locale = *flagLocale
+	server.OriginLabel = *flagOrigin
+	server.ExcludeOriginInExports = !*flagExportOrig
+	server.TLSCertFile = *flagTLSCert
+	server.TLSKeyFile = *flagTLSKey
+	server.RouteReachDivisor = *flagRouteReachDivisor
+	server.RouteReachMode = reachMode
+	server.LatestReturn = *flagLatestReturn
+	server.FreshnessWindow = *flagFreshnessWindow
+	server.HistoryRetention = *flagHistoryRetention
+	server.MaxHistoryLimit = *flagMaxHistoryLimit
+	server.DuplicateRadiusKm = *flagDuplicateRadius
+	server.MaxSpotMoveKm = *flagMaxSpotMove
+	server.CoordinatePrecision = *flagCoordPrecision
+	server.CacheKeyPrecision = *flagCacheKeyPrecision
+	server.VerifyCoordinates = *flagVerifyCoords
+	server.AccessibilityStrict = *flagAccessStrict
+	server.FreshnessBoost = *flagFreshnessBoost
+	server.RecentPenalty = *flagRecentPenalty
+	server.RevisitMinRating = *flagRevisitRating
+	server.RevisitCooldown = *flagRevisitCooldown
+	server.RecentCategoryWindow = *flagRecentCategories
+	server.SpotRecommendCap = *flagSpotCap
+	server.SpotRecommendCapWindow = *flagSpotCapWindow
+	server.MinCandidatePool = *flagMinCandidates
+	server.MaxRelaxedDistanceKm = *flagMaxRelaxedKm
+	server.CategoryRatingWeight = *flagCategoryRating
+	server.RecommendCooldown = *flagCooldown
+	server.RecommendCooldownKm = *flagCooldownKm
+	server.StayLimits = stayLimits
+	server.DefaultStays = defaultStays
+	server.LLMHealthWindow = *flagLLMWindow
+	server.LLMSuccessThreshold = *flagLLMThreshold
+	server.Audit = srv.AuditConfig{Enabled: *flagAuditLLM, RedactCoordinates: *flagAuditRedact, Retention: *flagAuditRetention}
+	server.MaxCandidateSpots = *flagMaxCandidateSpots
+	server.PromptDescriptionMax = *flagPromptDescMax
+	server.MaxPromptChars = *flagMaxPromptChars
+	server.FuelEfficiencyKmL = *flagFuelEfficiency
+	server.FuelPrice = *flagFuelPrice
+	server.MaxStops = maxStops
+	server.DefaultIncludeRestaurant = *flagIncludeMeal
+	server.DefaultIncludeRest = *flagIncludeRest
+	server.MinRecommendations = *flagMinRecommend
+	server.MaxRecommendations = *flagMaxRecommend
+	server.FallbackOrder = fallback
+	server.PastDeparture = pastDeparture
+	server.TimeZone = timeZone
+	server.PromptCandidateOrder = candidateOrder
+	server.Distance = srv.DistanceEstimator{RadiusKm: *flagEarthRadius, Mode: mode}
 	return server.Serve(*flagListenAddr)
 }
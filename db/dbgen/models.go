@@ -16,6 +16,16 @@ type Favorite struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type LlmAudit struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Prompt    string    `json:"prompt"`
+	Response  *string   `json:"response"`
+	LatencyMs int64     `json:"latency_ms"`
+	Outcome   string    `json:"outcome"`
+	Error     *string   `json:"error"`
+}
+
 type Migration struct {
 	MigrationNumber int64     `json:"migration_number"`
 	MigrationName   string    `json:"migration_name"`
@@ -31,28 +41,54 @@ type RecommendationHistory struct {
 }
 
 type RouteHistory struct {
-	ID        int64     `json:"id"`
-	UserID    string    `json:"user_id"`
-	RouteHash string    `json:"route_hash"`
-	SpotIds   string    `json:"spot_ids"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int64     `json:"id"`
+	UserID      string    `json:"user_id"`
+	RouteHash   string    `json:"route_hash"`
+	SpotIds     string    `json:"spot_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	RouteJson   *string   `json:"route_json"`
+	Explanation *string   `json:"explanation"`
+	RequestJson *string   `json:"request_json"`
 }
 
 type Spot struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description"`
-	Category    string    `json:"category"`
-	Latitude    float64   `json:"latitude"`
-	Longitude   float64   `json:"longitude"`
-	Address     *string   `json:"address"`
-	ImageUrl    *string   `json:"image_url"`
-	Rating      *float64  `json:"rating"`
-	CreatedAt   time.Time `json:"created_at"`
-	CreatedBy   *string   `json:"created_by"`
-	OpeningTime *string   `json:"opening_time"`
-	ClosingTime *string   `json:"closing_time"`
-	ClosedDays  *string   `json:"closed_days"`
+	ID                   int64     `json:"id"`
+	Name                 string    `json:"name"`
+	Description          *string   `json:"description"`
+	Category             string    `json:"category"`
+	Latitude             float64   `json:"latitude"`
+	Longitude            float64   `json:"longitude"`
+	Address              *string   `json:"address"`
+	ImageUrl             *string   `json:"image_url"`
+	Rating               *float64  `json:"rating"`
+	CreatedAt            time.Time `json:"created_at"`
+	CreatedBy            *string   `json:"created_by"`
+	OpeningTime          *string   `json:"opening_time"`
+	ClosingTime          *string   `json:"closing_time"`
+	ClosedDays           *string   `json:"closed_days"`
+	AvgRating            float64   `json:"avg_rating"`
+	RatingCount          int64     `json:"rating_count"`
+	Indoor               *bool     `json:"indoor"`
+	BestTimeStart        *string   `json:"best_time_start"`
+	BestTimeEnd          *string   `json:"best_time_end"`
+	WheelchairAccessible *bool     `json:"wheelchair_accessible"`
+	KidFriendly          *bool     `json:"kid_friendly"`
+	HasRestroom          *bool     `json:"has_restroom"`
+	Difficulty           *int64    `json:"difficulty"`
+	SuggestedStayMin     *int64    `json:"suggested_stay_min"`
+	Status               string    `json:"status"`
+	CoordinatesVerified  *bool     `json:"coordinates_verified"`
+	EntryFee             *int64    `json:"entry_fee"`
+	CrowdByHour          *string   `json:"crowd_by_hour"`
+}
+
+type SpotImage struct {
+	ID        int64     `json:"id"`
+	SpotID    int64     `json:"spot_id"`
+	Url       string    `json:"url"`
+	Caption   *string   `json:"caption"`
+	SortOrder int64     `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type User struct {
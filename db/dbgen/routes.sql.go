@@ -9,19 +9,42 @@ import (
 	"context"
 )
 
-const addRouteHistory = `-- name: AddRouteHistory :exec
-INSERT INTO route_history (user_id, route_hash, spot_ids) VALUES (?, ?, ?)
+const addRouteHistory = `-- name: AddRouteHistory :one
+INSERT INTO route_history (user_id, route_hash, spot_ids, route_json, request_json) VALUES (?, ?, ?, ?, ?)
+RETURNING id
 `
 
 type AddRouteHistoryParams struct {
-	UserID    string `json:"user_id"`
-	RouteHash string `json:"route_hash"`
-	SpotIds   string `json:"spot_ids"`
+	UserID      string  `json:"user_id"`
+	RouteHash   string  `json:"route_hash"`
+	SpotIds     string  `json:"spot_ids"`
+	RouteJson   *string `json:"route_json"`
+	RequestJson *string `json:"request_json"`
 }
 
-func (q *Queries) AddRouteHistory(ctx context.Context, arg AddRouteHistoryParams) error {
-	_, err := q.db.ExecContext(ctx, addRouteHistory, arg.UserID, arg.RouteHash, arg.SpotIds)
-	return err
+func (q *Queries) AddRouteHistory(ctx context.Context, arg AddRouteHistoryParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, addRouteHistory,
+		arg.UserID,
+		arg.RouteHash,
+		arg.SpotIds,
+		arg.RouteJson,
+		arg.RequestJson,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteRouteHistoryBefore = `-- name: DeleteRouteHistoryBefore :execrows
+DELETE FROM route_history WHERE created_at < datetime(CAST(?1 AS TEXT))
+`
+
+func (q *Queries) DeleteRouteHistoryBefore(ctx context.Context, before string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRouteHistoryBefore, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getRecentRouteHashes = `-- name: GetRecentRouteHashes :many
@@ -54,6 +77,31 @@ func (q *Queries) GetRecentRouteHashes(ctx context.Context, userID string) ([]st
 	return items, nil
 }
 
+const getRouteByID = `-- name: GetRouteByID :one
+SELECT id, user_id, route_hash, spot_ids, created_at, route_json, explanation, request_json FROM route_history WHERE id = ? AND user_id = ?
+`
+
+type GetRouteByIDParams struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+func (q *Queries) GetRouteByID(ctx context.Context, arg GetRouteByIDParams) (RouteHistory, error) {
+	row := q.db.QueryRowContext(ctx, getRouteByID, arg.ID, arg.UserID)
+	var i RouteHistory
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RouteHash,
+		&i.SpotIds,
+		&i.CreatedAt,
+		&i.RouteJson,
+		&i.Explanation,
+		&i.RequestJson,
+	)
+	return i, err
+}
+
 const getSpotsWithHours = `-- name: GetSpotsWithHours :many
 SELECT id, name, description, category, latitude, longitude, address, opening_time, closing_time, closed_days
 FROM spots
@@ -105,3 +153,17 @@ func (q *Queries) GetSpotsWithHours(ctx context.Context) ([]GetSpotsWithHoursRow
 	}
 	return items, nil
 }
+
+const setRouteExplanation = `-- name: SetRouteExplanation :exec
+UPDATE route_history SET explanation = ? WHERE id = ?
+`
+
+type SetRouteExplanationParams struct {
+	Explanation *string `json:"explanation"`
+	ID          int64   `json:"id"`
+}
+
+func (q *Queries) SetRouteExplanation(ctx context.Context, arg SetRouteExplanationParams) error {
+	_, err := q.db.ExecContext(ctx, setRouteExplanation, arg.Explanation, arg.ID)
+	return err
+}
@@ -24,22 +24,115 @@ func (q *Queries) AddFavorite(ctx context.Context, arg AddFavoriteParams) error
 	return err
 }
 
+const addSpotImage = `-- name: AddSpotImage :one
+INSERT INTO spot_images (spot_id, url, caption, sort_order) VALUES (?, ?, ?, ?)
+RETURNING id, spot_id, url, caption, sort_order, created_at
+`
+
+type AddSpotImageParams struct {
+	SpotID    int64   `json:"spot_id"`
+	Url       string  `json:"url"`
+	Caption   *string `json:"caption"`
+	SortOrder int64   `json:"sort_order"`
+}
+
+func (q *Queries) AddSpotImage(ctx context.Context, arg AddSpotImageParams) (SpotImage, error) {
+	row := q.db.QueryRowContext(ctx, addSpotImage,
+		arg.SpotID,
+		arg.Url,
+		arg.Caption,
+		arg.SortOrder,
+	)
+	var i SpotImage
+	err := row.Scan(
+		&i.ID,
+		&i.SpotID,
+		&i.Url,
+		&i.Caption,
+		&i.SortOrder,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const addSpotRating = `-- name: AddSpotRating :exec
+UPDATE spots SET
+    avg_rating = (avg_rating * rating_count + CAST(?1 AS REAL)) / (rating_count + 1),
+    rating_count = rating_count + 1
+WHERE id = ?2
+`
+
+type AddSpotRatingParams struct {
+	Rating float64 `json:"rating"`
+	ID     int64   `json:"id"`
+}
+
+func (q *Queries) AddSpotRating(ctx context.Context, arg AddSpotRatingParams) error {
+	_, err := q.db.ExecContext(ctx, addSpotRating, arg.Rating, arg.ID)
+	return err
+}
+
+const countSearchSpots = `-- name: CountSearchSpots :one
+SELECT COUNT(*) FROM spots s
+CROSS JOIN (SELECT CAST(?1 AS TEXT) AS categories) p
+WHERE s.status = 'approved'
+  AND (p.categories = '' OR instr(',' || p.categories || ',', ',' || s.category || ',') > 0)
+  AND s.latitude >= ?2 AND s.latitude <= ?3
+  AND s.longitude >= ?4 AND s.longitude <= ?5
+`
+
+type CountSearchSpotsParams struct {
+	Categories string  `json:"categories"`
+	MinLat     float64 `json:"min_lat"`
+	MaxLat     float64 `json:"max_lat"`
+	MinLng     float64 `json:"min_lng"`
+	MaxLng     float64 `json:"max_lng"`
+}
+
+// How many spots SearchSpots matches before limit and offset.
+func (q *Queries) CountSearchSpots(ctx context.Context, arg CountSearchSpotsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countSearchSpots,
+		arg.Categories,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLng,
+		arg.MaxLng,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createSpot = `-- name: CreateSpot :one
-INSERT INTO spots (name, description, category, latitude, longitude, address, image_url, rating, created_by)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-RETURNING id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by
+INSERT INTO spots (name, description, category, latitude, longitude, address, image_url, rating, created_by, indoor, best_time_start, best_time_end,
+    wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status,
+    coordinates_verified, entry_fee, crowd_by_hour)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour
 `
 
 type CreateSpotParams struct {
-	Name        string   `json:"name"`
-	Description *string  `json:"description"`
-	Category    string   `json:"category"`
-	Latitude    float64  `json:"latitude"`
-	Longitude   float64  `json:"longitude"`
-	Address     *string  `json:"address"`
-	ImageUrl    *string  `json:"image_url"`
-	Rating      *float64 `json:"rating"`
-	CreatedBy   *string  `json:"created_by"`
+	Name                 string   `json:"name"`
+	Description          *string  `json:"description"`
+	Category             string   `json:"category"`
+	Latitude             float64  `json:"latitude"`
+	Longitude            float64  `json:"longitude"`
+	Address              *string  `json:"address"`
+	ImageUrl             *string  `json:"image_url"`
+	Rating               *float64 `json:"rating"`
+	CreatedBy            *string  `json:"created_by"`
+	Indoor               *bool    `json:"indoor"`
+	BestTimeStart        *string  `json:"best_time_start"`
+	BestTimeEnd          *string  `json:"best_time_end"`
+	WheelchairAccessible *bool    `json:"wheelchair_accessible"`
+	KidFriendly          *bool    `json:"kid_friendly"`
+	HasRestroom          *bool    `json:"has_restroom"`
+	Difficulty           *int64   `json:"difficulty"`
+	SuggestedStayMin     *int64   `json:"suggested_stay_min"`
+	Status               string   `json:"status"`
+	CoordinatesVerified  *bool    `json:"coordinates_verified"`
+	EntryFee             *int64   `json:"entry_fee"`
+	CrowdByHour          *string  `json:"crowd_by_hour"`
 }
 
 func (q *Queries) CreateSpot(ctx context.Context, arg CreateSpotParams) (Spot, error) {
@@ -53,6 +146,18 @@ func (q *Queries) CreateSpot(ctx context.Context, arg CreateSpotParams) (Spot, e
 		arg.ImageUrl,
 		arg.Rating,
 		arg.CreatedBy,
+		arg.Indoor,
+		arg.BestTimeStart,
+		arg.BestTimeEnd,
+		arg.WheelchairAccessible,
+		arg.KidFriendly,
+		arg.HasRestroom,
+		arg.Difficulty,
+		arg.SuggestedStayMin,
+		arg.Status,
+		arg.CoordinatesVerified,
+		arg.EntryFee,
+		arg.CrowdByHour,
 	)
 	var i Spot
 	err := row.Scan(
@@ -67,6 +172,23 @@ func (q *Queries) CreateSpot(ctx context.Context, arg CreateSpotParams) (Spot, e
 		&i.Rating,
 		&i.CreatedAt,
 		&i.CreatedBy,
+		&i.OpeningTime,
+		&i.ClosingTime,
+		&i.ClosedDays,
+		&i.AvgRating,
+		&i.RatingCount,
+		&i.Indoor,
+		&i.BestTimeStart,
+		&i.BestTimeEnd,
+		&i.WheelchairAccessible,
+		&i.KidFriendly,
+		&i.HasRestroom,
+		&i.Difficulty,
+		&i.SuggestedStayMin,
+		&i.Status,
+		&i.CoordinatesVerified,
+		&i.EntryFee,
+		&i.CrowdByHour,
 	)
 	return i, err
 }
@@ -80,8 +202,25 @@ func (q *Queries) DeleteSpot(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteSpotImage = `-- name: DeleteSpotImage :execrows
+DELETE FROM spot_images WHERE id = ? AND spot_id = ?
+`
+
+type DeleteSpotImageParams struct {
+	ID     int64 `json:"id"`
+	SpotID int64 `json:"spot_id"`
+}
+
+func (q *Queries) DeleteSpotImage(ctx context.Context, arg DeleteSpotImageParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSpotImage, arg.ID, arg.SpotID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllSpots = `-- name: GetAllSpots :many
-SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by FROM spots ORDER BY created_at DESC
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots ORDER BY created_at DESC
 `
 
 func (q *Queries) GetAllSpots(ctx context.Context) ([]Spot, error) {
@@ -105,6 +244,79 @@ func (q *Queries) GetAllSpots(ctx context.Context) ([]Spot, error) {
 			&i.Rating,
 			&i.CreatedAt,
 			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getApprovedSpots = `-- name: GetApprovedSpots :many
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots WHERE status = 'approved' ORDER BY created_at DESC
+`
+
+func (q *Queries) GetApprovedSpots(ctx context.Context) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, getApprovedSpots)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
 		); err != nil {
 			return nil, err
 		}
@@ -120,7 +332,7 @@ func (q *Queries) GetAllSpots(ctx context.Context) ([]Spot, error) {
 }
 
 const getNearbySpots = `-- name: GetNearbySpots :many
-SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by,
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour,
     (6371 * acos(cos(radians(?)) * cos(radians(latitude)) * cos(radians(longitude) - radians(?)) + sin(radians(?)) * sin(radians(latitude)))) AS distance
 FROM spots
 ORDER BY distance
@@ -135,18 +347,35 @@ type GetNearbySpotsParams struct {
 }
 
 type GetNearbySpotsRow struct {
-	ID          int64       `json:"id"`
-	Name        string      `json:"name"`
-	Description *string     `json:"description"`
-	Category    string      `json:"category"`
-	Latitude    float64     `json:"latitude"`
-	Longitude   float64     `json:"longitude"`
-	Address     *string     `json:"address"`
-	ImageUrl    *string     `json:"image_url"`
-	Rating      *float64    `json:"rating"`
-	CreatedAt   time.Time   `json:"created_at"`
-	CreatedBy   *string     `json:"created_by"`
-	Distance    interface{} `json:"distance"`
+	ID                   int64       `json:"id"`
+	Name                 string      `json:"name"`
+	Description          *string     `json:"description"`
+	Category             string      `json:"category"`
+	Latitude             float64     `json:"latitude"`
+	Longitude            float64     `json:"longitude"`
+	Address              *string     `json:"address"`
+	ImageUrl             *string     `json:"image_url"`
+	Rating               *float64    `json:"rating"`
+	CreatedAt            time.Time   `json:"created_at"`
+	CreatedBy            *string     `json:"created_by"`
+	OpeningTime          *string     `json:"opening_time"`
+	ClosingTime          *string     `json:"closing_time"`
+	ClosedDays           *string     `json:"closed_days"`
+	AvgRating            float64     `json:"avg_rating"`
+	RatingCount          int64       `json:"rating_count"`
+	Indoor               *bool       `json:"indoor"`
+	BestTimeStart        *string     `json:"best_time_start"`
+	BestTimeEnd          *string     `json:"best_time_end"`
+	WheelchairAccessible *bool       `json:"wheelchair_accessible"`
+	KidFriendly          *bool       `json:"kid_friendly"`
+	HasRestroom          *bool       `json:"has_restroom"`
+	Difficulty           *int64      `json:"difficulty"`
+	SuggestedStayMin     *int64      `json:"suggested_stay_min"`
+	Status               string      `json:"status"`
+	CoordinatesVerified  *bool       `json:"coordinates_verified"`
+	EntryFee             *int64      `json:"entry_fee"`
+	CrowdByHour          *string     `json:"crowd_by_hour"`
+	Distance             interface{} `json:"distance"`
 }
 
 func (q *Queries) GetNearbySpots(ctx context.Context, arg GetNearbySpotsParams) ([]GetNearbySpotsRow, error) {
@@ -175,6 +404,23 @@ func (q *Queries) GetNearbySpots(ctx context.Context, arg GetNearbySpotsParams)
 			&i.Rating,
 			&i.CreatedAt,
 			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
 			&i.Distance,
 		); err != nil {
 			return nil, err
@@ -190,8 +436,82 @@ func (q *Queries) GetNearbySpots(ctx context.Context, arg GetNearbySpotsParams)
 	return items, nil
 }
 
+const getNearestSpotsByCategory = `-- name: GetNearestSpotsByCategory :many
+SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by, s.opening_time, s.closing_time, s.closed_days, s.avg_rating, s.rating_count, s.indoor, s.best_time_start, s.best_time_end, s.wheelchair_accessible, s.kid_friendly, s.has_restroom, s.difficulty, s.suggested_stay_min, s.status, s.coordinates_verified, s.entry_fee, s.crowd_by_hour FROM spots s
+CROSS JOIN (SELECT CAST(?1 AS REAL) AS lat, CAST(?2 AS REAL) AS lng) o
+WHERE s.category = ?3 AND s.status = 'approved'
+ORDER BY ABS(s.latitude - o.lat) + ABS(s.longitude - o.lng), s.id
+LIMIT ?4
+`
+
+type GetNearestSpotsByCategoryParams struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	Category string  `json:"category"`
+	Limit    int64   `json:"limit"`
+}
+
+// Approved spots of a category anywhere, roughly nearest to (lat, lng)
+// first; callers measure the exact distances of the first few.
+func (q *Queries) GetNearestSpotsByCategory(ctx context.Context, arg GetNearestSpotsByCategoryParams) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, getNearestSpotsByCategory,
+		arg.Lat,
+		arg.Lng,
+		arg.Category,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSpotByID = `-- name: GetSpotByID :one
-SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by FROM spots WHERE id = ?
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots WHERE id = ?
 `
 
 func (q *Queries) GetSpotByID(ctx context.Context, id int64) (Spot, error) {
@@ -209,12 +529,29 @@ func (q *Queries) GetSpotByID(ctx context.Context, id int64) (Spot, error) {
 		&i.Rating,
 		&i.CreatedAt,
 		&i.CreatedBy,
+		&i.OpeningTime,
+		&i.ClosingTime,
+		&i.ClosedDays,
+		&i.AvgRating,
+		&i.RatingCount,
+		&i.Indoor,
+		&i.BestTimeStart,
+		&i.BestTimeEnd,
+		&i.WheelchairAccessible,
+		&i.KidFriendly,
+		&i.HasRestroom,
+		&i.Difficulty,
+		&i.SuggestedStayMin,
+		&i.Status,
+		&i.CoordinatesVerified,
+		&i.EntryFee,
+		&i.CrowdByHour,
 	)
 	return i, err
 }
 
 const getSpotsByCategory = `-- name: GetSpotsByCategory :many
-SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by FROM spots WHERE category = ? ORDER BY rating DESC
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots WHERE category = ? ORDER BY rating DESC
 `
 
 func (q *Queries) GetSpotsByCategory(ctx context.Context, category string) ([]Spot, error) {
@@ -238,6 +575,235 @@ func (q *Queries) GetSpotsByCategory(ctx context.Context, category string) ([]Sp
 			&i.Rating,
 			&i.CreatedAt,
 			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSpotsByCreator = `-- name: GetSpotsByCreator :many
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots WHERE created_by = ? ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) GetSpotsByCreator(ctx context.Context, createdBy *string) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, getSpotsByCreator, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSpotsInArea = `-- name: GetSpotsInArea :many
+SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by, s.opening_time, s.closing_time, s.closed_days, s.avg_rating, s.rating_count, s.indoor, s.best_time_start, s.best_time_end, s.wheelchair_accessible, s.kid_friendly, s.has_restroom, s.difficulty, s.suggested_stay_min, s.status, s.coordinates_verified, s.entry_fee, s.crowd_by_hour FROM spots s
+CROSS JOIN (SELECT CAST(?1 AS REAL) AS lat, CAST(?2 AS REAL) AS lng) o
+WHERE s.status = 'approved'
+  AND s.latitude >= ?3 AND s.latitude <= ?4
+  AND s.longitude >= ?5 AND s.longitude <= ?6
+ORDER BY ABS(s.latitude - o.lat) + ABS(s.longitude - o.lng), s.id
+LIMIT ?7
+`
+
+type GetSpotsInAreaParams struct {
+	Lat    float64 `json:"lat"`
+	Lng    float64 `json:"lng"`
+	MinLat float64 `json:"min_lat"`
+	MaxLat float64 `json:"max_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLng float64 `json:"max_lng"`
+	Limit  int64   `json:"limit"`
+}
+
+// Spots inside a lat/lng box, roughly nearest to (lat, lng) first, so a
+// LIMIT keeps the most relevant ones. A negative limit means no limit.
+// Only approved spots are candidates.
+func (q *Queries) GetSpotsInArea(ctx context.Context, arg GetSpotsInAreaParams) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, getSpotsInArea,
+		arg.Lat,
+		arg.Lng,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLng,
+		arg.MaxLng,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSpotsInAreaAnyStatus = `-- name: GetSpotsInAreaAnyStatus :many
+SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by, s.opening_time, s.closing_time, s.closed_days, s.avg_rating, s.rating_count, s.indoor, s.best_time_start, s.best_time_end, s.wheelchair_accessible, s.kid_friendly, s.has_restroom, s.difficulty, s.suggested_stay_min, s.status, s.coordinates_verified, s.entry_fee, s.crowd_by_hour FROM spots s
+WHERE s.latitude >= ?1 AND s.latitude <= ?2
+  AND s.longitude >= ?3 AND s.longitude <= ?4
+ORDER BY s.id
+`
+
+type GetSpotsInAreaAnyStatusParams struct {
+	MinLat float64 `json:"min_lat"`
+	MaxLat float64 `json:"max_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// Spots of every status inside a lat/lng box, for duplicate checks: a
+// submission still under review is as much a duplicate as an approved spot.
+func (q *Queries) GetSpotsInAreaAnyStatus(ctx context.Context, arg GetSpotsInAreaAnyStatusParams) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, getSpotsInAreaAnyStatus,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLng,
+		arg.MaxLng,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
 		); err != nil {
 			return nil, err
 		}
@@ -253,7 +819,7 @@ func (q *Queries) GetSpotsByCategory(ctx context.Context, category string) ([]Sp
 }
 
 const getUserFavorites = `-- name: GetUserFavorites :many
-SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by FROM spots s
+SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by, s.opening_time, s.closing_time, s.closed_days, s.avg_rating, s.rating_count, s.indoor, s.best_time_start, s.best_time_end, s.wheelchair_accessible, s.kid_friendly, s.has_restroom, s.difficulty, s.suggested_stay_min, s.status, s.coordinates_verified, s.entry_fee, s.crowd_by_hour FROM spots s
 JOIN favorites f ON s.id = f.spot_id
 WHERE f.user_id = ?
 ORDER BY f.created_at DESC
@@ -280,6 +846,23 @@ func (q *Queries) GetUserFavorites(ctx context.Context, userID string) ([]Spot,
 			&i.Rating,
 			&i.CreatedAt,
 			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
 		); err != nil {
 			return nil, err
 		}
@@ -310,6 +893,138 @@ func (q *Queries) IsFavorite(ctx context.Context, arg IsFavoriteParams) (int64,
 	return count, err
 }
 
+const listSpotImages = `-- name: ListSpotImages :many
+SELECT id, spot_id, url, caption, sort_order, created_at FROM spot_images WHERE spot_id = ? ORDER BY sort_order, id
+`
+
+func (q *Queries) ListSpotImages(ctx context.Context, spotID int64) ([]SpotImage, error) {
+	rows, err := q.db.QueryContext(ctx, listSpotImages, spotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SpotImage{}
+	for rows.Next() {
+		var i SpotImage
+		if err := rows.Scan(
+			&i.ID,
+			&i.SpotID,
+			&i.Url,
+			&i.Caption,
+			&i.SortOrder,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSpotsForModeration = `-- name: ListSpotsForModeration :many
+SELECT id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour FROM spots
+WHERE (CAST(?1 AS TEXT) IS NULL OR created_by = ?1)
+  AND (CAST(?2 AS TEXT) IS NULL OR status = ?2)
+  AND (CAST(?3 AS TEXT) IS NULL OR category = ?3)
+  AND (CAST(?4 AS INTEGER) IS NULL OR (status = 'approved') = CAST(?4 AS INTEGER))
+  AND (CAST(?5 AS TEXT) IS NULL
+    OR instr(lower(name), lower(?5)) > 0
+    OR instr(lower(address), lower(?5)) > 0
+    OR instr(lower(description), lower(?5)) > 0)
+ORDER BY created_at DESC, id DESC
+LIMIT ?7 OFFSET ?6
+`
+
+type ListSpotsForModerationParams struct {
+	CreatedBy *string `json:"created_by"`
+	Status    *string `json:"status"`
+	Category  *string `json:"category"`
+	Active    *int64  `json:"active"`
+	Search    *string `json:"search"`
+	Offset    int64   `json:"offset"`
+	Limit     int64   `json:"limit"`
+}
+
+// Newest spots first. Each filter applies only when set: created_by, the
+// moderation status, category, active (approved or not) and search, text
+// found in the name, address or description regardless of ASCII case.
+func (q *Queries) ListSpotsForModeration(ctx context.Context, arg ListSpotsForModerationParams) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, listSpotsForModeration,
+		arg.CreatedBy,
+		arg.Status,
+		arg.Category,
+		arg.Active,
+		arg.Search,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const nextSpotImageOrder = `-- name: NextSpotImageOrder :one
+SELECT CAST(COALESCE(MAX(sort_order) + 1, 0) AS INTEGER) FROM spot_images WHERE spot_id = ?
+`
+
+func (q *Queries) NextSpotImageOrder(ctx context.Context, spotID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, nextSpotImageOrder, spotID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const removeFavorite = `-- name: RemoveFavorite :exec
 DELETE FROM favorites WHERE user_id = ? AND spot_id = ?
 `
@@ -323,3 +1038,231 @@ func (q *Queries) RemoveFavorite(ctx context.Context, arg RemoveFavoriteParams)
 	_, err := q.db.ExecContext(ctx, removeFavorite, arg.UserID, arg.SpotID)
 	return err
 }
+
+const searchSpots = `-- name: SearchSpots :many
+SELECT s.id, s.name, s.description, s.category, s.latitude, s.longitude, s.address, s.image_url, s.rating, s.created_at, s.created_by, s.opening_time, s.closing_time, s.closed_days, s.avg_rating, s.rating_count, s.indoor, s.best_time_start, s.best_time_end, s.wheelchair_accessible, s.kid_friendly, s.has_restroom, s.difficulty, s.suggested_stay_min, s.status, s.coordinates_verified, s.entry_fee, s.crowd_by_hour FROM spots s
+CROSS JOIN (SELECT CAST(?1 AS TEXT) AS categories, CAST(?2 AS TEXT) AS sort) p
+WHERE s.status = 'approved'
+  AND (p.categories = '' OR instr(',' || p.categories || ',', ',' || s.category || ',') > 0)
+  AND s.latitude >= ?3 AND s.latitude <= ?4
+  AND s.longitude >= ?5 AND s.longitude <= ?6
+ORDER BY
+  CASE WHEN p.sort = 'name' THEN s.name END,
+  CASE WHEN p.sort = 'popularity' THEN s.rating_count END DESC,
+  CASE WHEN p.sort = 'popularity' THEN s.avg_rating END DESC,
+  s.created_at DESC, s.id DESC
+LIMIT ?7 OFFSET ?8
+`
+
+type SearchSpotsParams struct {
+	Categories string  `json:"categories"`
+	Sort       string  `json:"sort"`
+	MinLat     float64 `json:"min_lat"`
+	MaxLat     float64 `json:"max_lat"`
+	MinLng     float64 `json:"min_lng"`
+	MaxLng     float64 `json:"max_lng"`
+	Limit      int64   `json:"limit"`
+	Offset     int64   `json:"offset"`
+}
+
+// Approved spots inside a lat/lng box whose category is in the
+// comma-separated categories (any category when empty), ordered by sort:
+// "name", "popularity" (most ratings, then best rated) or newest first
+// otherwise. A negative limit means no limit.
+func (q *Queries) SearchSpots(ctx context.Context, arg SearchSpotsParams) ([]Spot, error) {
+	rows, err := q.db.QueryContext(ctx, searchSpots,
+		arg.Categories,
+		arg.Sort,
+		arg.MinLat,
+		arg.MaxLat,
+		arg.MinLng,
+		arg.MaxLng,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Spot{}
+	for rows.Next() {
+		var i Spot
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Category,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Address,
+			&i.ImageUrl,
+			&i.Rating,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.OpeningTime,
+			&i.ClosingTime,
+			&i.ClosedDays,
+			&i.AvgRating,
+			&i.RatingCount,
+			&i.Indoor,
+			&i.BestTimeStart,
+			&i.BestTimeEnd,
+			&i.WheelchairAccessible,
+			&i.KidFriendly,
+			&i.HasRestroom,
+			&i.Difficulty,
+			&i.SuggestedStayMin,
+			&i.Status,
+			&i.CoordinatesVerified,
+			&i.EntryFee,
+			&i.CrowdByHour,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setSpotStatus = `-- name: SetSpotStatus :one
+UPDATE spots SET status = ? WHERE id = ?
+RETURNING id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour
+`
+
+type SetSpotStatusParams struct {
+	Status string `json:"status"`
+	ID     int64  `json:"id"`
+}
+
+func (q *Queries) SetSpotStatus(ctx context.Context, arg SetSpotStatusParams) (Spot, error) {
+	row := q.db.QueryRowContext(ctx, setSpotStatus, arg.Status, arg.ID)
+	var i Spot
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Category,
+		&i.Latitude,
+		&i.Longitude,
+		&i.Address,
+		&i.ImageUrl,
+		&i.Rating,
+		&i.CreatedAt,
+		&i.CreatedBy,
+		&i.OpeningTime,
+		&i.ClosingTime,
+		&i.ClosedDays,
+		&i.AvgRating,
+		&i.RatingCount,
+		&i.Indoor,
+		&i.BestTimeStart,
+		&i.BestTimeEnd,
+		&i.WheelchairAccessible,
+		&i.KidFriendly,
+		&i.HasRestroom,
+		&i.Difficulty,
+		&i.SuggestedStayMin,
+		&i.Status,
+		&i.CoordinatesVerified,
+		&i.EntryFee,
+		&i.CrowdByHour,
+	)
+	return i, err
+}
+
+const updateSpot = `-- name: UpdateSpot :one
+UPDATE spots SET
+    name = ?, description = ?, category = ?, latitude = ?, longitude = ?,
+    address = ?, image_url = ?, indoor = ?, best_time_start = ?, best_time_end = ?,
+    wheelchair_accessible = ?, kid_friendly = ?, has_restroom = ?, difficulty = ?,
+    suggested_stay_min = ?, coordinates_verified = ?, entry_fee = ?,
+    crowd_by_hour = ?, status = ?
+WHERE id = ?
+RETURNING id, name, description, category, latitude, longitude, address, image_url, rating, created_at, created_by, opening_time, closing_time, closed_days, avg_rating, rating_count, indoor, best_time_start, best_time_end, wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status, coordinates_verified, entry_fee, crowd_by_hour
+`
+
+type UpdateSpotParams struct {
+	Name                 string  `json:"name"`
+	Description          *string `json:"description"`
+	Category             string  `json:"category"`
+	Latitude             float64 `json:"latitude"`
+	Longitude            float64 `json:"longitude"`
+	Address              *string `json:"address"`
+	ImageUrl             *string `json:"image_url"`
+	Indoor               *bool   `json:"indoor"`
+	BestTimeStart        *string `json:"best_time_start"`
+	BestTimeEnd          *string `json:"best_time_end"`
+	WheelchairAccessible *bool   `json:"wheelchair_accessible"`
+	KidFriendly          *bool   `json:"kid_friendly"`
+	HasRestroom          *bool   `json:"has_restroom"`
+	Difficulty           *int64  `json:"difficulty"`
+	SuggestedStayMin     *int64  `json:"suggested_stay_min"`
+	CoordinatesVerified  *bool   `json:"coordinates_verified"`
+	EntryFee             *int64  `json:"entry_fee"`
+	CrowdByHour          *string `json:"crowd_by_hour"`
+	Status               string  `json:"status"`
+	ID                   int64   `json:"id"`
+}
+
+func (q *Queries) UpdateSpot(ctx context.Context, arg UpdateSpotParams) (Spot, error) {
+	row := q.db.QueryRowContext(ctx, updateSpot,
+		arg.Name,
+		arg.Description,
+		arg.Category,
+		arg.Latitude,
+		arg.Longitude,
+		arg.Address,
+		arg.ImageUrl,
+		arg.Indoor,
+		arg.BestTimeStart,
+		arg.BestTimeEnd,
+		arg.WheelchairAccessible,
+		arg.KidFriendly,
+		arg.HasRestroom,
+		arg.Difficulty,
+		arg.SuggestedStayMin,
+		arg.CoordinatesVerified,
+		arg.EntryFee,
+		arg.CrowdByHour,
+		arg.Status,
+		arg.ID,
+	)
+	var i Spot
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Category,
+		&i.Latitude,
+		&i.Longitude,
+		&i.Address,
+		&i.ImageUrl,
+		&i.Rating,
+		&i.CreatedAt,
+		&i.CreatedBy,
+		&i.OpeningTime,
+		&i.ClosingTime,
+		&i.ClosedDays,
+		&i.AvgRating,
+		&i.RatingCount,
+		&i.Indoor,
+		&i.BestTimeStart,
+		&i.BestTimeEnd,
+		&i.WheelchairAccessible,
+		&i.KidFriendly,
+		&i.HasRestroom,
+		&i.Difficulty,
+		&i.SuggestedStayMin,
+		&i.Status,
+		&i.CoordinatesVerified,
+		&i.EntryFee,
+		&i.CrowdByHour,
+	)
+	return i, err
+}
@@ -67,6 +67,82 @@ func (q *Queries) AddVisitHistory(ctx context.Context, arg AddVisitHistoryParams
 	return i, err
 }
 
+const deleteRecommendationHistoryBefore = `-- name: DeleteRecommendationHistoryBefore :execrows
+DELETE FROM recommendation_history WHERE recommended_at < datetime(CAST(?1 AS TEXT))
+`
+
+func (q *Queries) DeleteRecommendationHistoryBefore(ctx context.Context, before string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRecommendationHistoryBefore, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getCategoryTrends = `-- name: GetCategoryTrends :many
+SELECT
+    CAST((julianday(vh.visited_at) - julianday(CAST(?1 AS TEXT))) / CAST(?2 AS INTEGER) AS INTEGER) AS bucket,
+    s.category,
+    COUNT(*) AS visits,
+    AVG(vh.rating) AS avg_rating
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = ?3
+  AND vh.visited_at >= datetime(CAST(?1 AS TEXT))
+  AND vh.visited_at < datetime(CAST(?4 AS TEXT))
+GROUP BY bucket, s.category
+ORDER BY bucket, s.category
+`
+
+type GetCategoryTrendsParams struct {
+	Since      string `json:"since"`
+	BucketDays int64  `json:"bucket_days"`
+	UserID     string `json:"user_id"`
+	Until      string `json:"until"`
+}
+
+type GetCategoryTrendsRow struct {
+	Bucket    int64    `json:"bucket"`
+	Category  string   `json:"category"`
+	Visits    int64    `json:"visits"`
+	AvgRating *float64 `json:"avg_rating"`
+}
+
+// Visits per category in bucket_days-wide buckets from since (bucket 0)
+// up to until.
+func (q *Queries) GetCategoryTrends(ctx context.Context, arg GetCategoryTrendsParams) ([]GetCategoryTrendsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getCategoryTrends,
+		arg.Since,
+		arg.BucketDays,
+		arg.UserID,
+		arg.Until,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetCategoryTrendsRow{}
+	for rows.Next() {
+		var i GetCategoryTrendsRow
+		if err := rows.Scan(
+			&i.Bucket,
+			&i.Category,
+			&i.Visits,
+			&i.AvgRating,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getOrCreateUser = `-- name: GetOrCreateUser :one
 INSERT INTO users (id, created_at, last_seen)
 VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
@@ -81,6 +157,43 @@ func (q *Queries) GetOrCreateUser(ctx context.Context, id string) (User, error)
 	return i, err
 }
 
+const getOverRecommendedSpotIDs = `-- name: GetOverRecommendedSpotIDs :many
+SELECT spot_id FROM recommendation_history
+WHERE user_id = ?1 AND recommended_at >= datetime(CAST(?2 AS TEXT))
+GROUP BY spot_id
+HAVING COUNT(*) >= CAST(?3 AS INTEGER)
+`
+
+type GetOverRecommendedSpotIDsParams struct {
+	UserID   string `json:"user_id"`
+	Since    string `json:"since"`
+	MaxTimes int64  `json:"max_times"`
+}
+
+// Spots recommended to the user at least max_times times since since.
+func (q *Queries) GetOverRecommendedSpotIDs(ctx context.Context, arg GetOverRecommendedSpotIDsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getOverRecommendedSpotIDs, arg.UserID, arg.Since, arg.MaxTimes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var spot_id int64
+		if err := rows.Scan(&spot_id); err != nil {
+			return nil, err
+		}
+		items = append(items, spot_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRecentRecommendations = `-- name: GetRecentRecommendations :many
 SELECT spot_id FROM recommendation_history
 WHERE user_id = ? AND recommended_at > datetime('now', '-7 days')
@@ -110,6 +223,118 @@ func (q *Queries) GetRecentRecommendations(ctx context.Context, userID string) (
 	return items, nil
 }
 
+const getRecentVisitCategories = `-- name: GetRecentVisitCategories :many
+SELECT DISTINCT s.category FROM visit_history vh
+JOIN spots s ON s.id = vh.spot_id
+WHERE vh.user_id = ?1
+  AND vh.visited_at >= datetime(CAST(?2 AS TEXT))
+`
+
+type GetRecentVisitCategoriesParams struct {
+	UserID string `json:"user_id"`
+	Since  string `json:"since"`
+}
+
+func (q *Queries) GetRecentVisitCategories(ctx context.Context, arg GetRecentVisitCategoriesParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentVisitCategories, arg.UserID, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, err
+		}
+		items = append(items, category)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRevisitableSpotIDs = `-- name: GetRevisitableSpotIDs :many
+SELECT spot_id FROM visit_history
+WHERE user_id = ?1
+GROUP BY spot_id
+HAVING AVG(rating) >= CAST(?2 AS INTEGER)
+   AND MAX(visited_at) < datetime(CAST(?3 AS TEXT))
+`
+
+type GetRevisitableSpotIDsParams struct {
+	UserID    string `json:"user_id"`
+	MinRating int64  `json:"min_rating"`
+	Since     string `json:"since"`
+}
+
+// Visited spots the user rated min_rating or better on average and hasn't
+// visited since since.
+func (q *Queries) GetRevisitableSpotIDs(ctx context.Context, arg GetRevisitableSpotIDsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getRevisitableSpotIDs, arg.UserID, arg.MinRating, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var spot_id int64
+		if err := rows.Scan(&spot_id); err != nil {
+			return nil, err
+		}
+		items = append(items, spot_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserCategoryRatings = `-- name: GetUserCategoryRatings :many
+SELECT s.category, CAST(AVG(vh.rating) AS REAL) AS avg_rating, COUNT(*) AS rating_count
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = ? AND vh.rating BETWEEN 1 AND 5
+GROUP BY s.category
+`
+
+type GetUserCategoryRatingsRow struct {
+	Category    string  `json:"category"`
+	AvgRating   float64 `json:"avg_rating"`
+	RatingCount int64   `json:"rating_count"`
+}
+
+// The user's average rating of the spots they rated, per category.
+func (q *Queries) GetUserCategoryRatings(ctx context.Context, userID string) ([]GetUserCategoryRatingsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserCategoryRatings, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetUserCategoryRatingsRow{}
+	for rows.Next() {
+		var i GetUserCategoryRatingsRow
+		if err := rows.Scan(&i.Category, &i.AvgRating, &i.RatingCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserPreferences = `-- name: GetUserPreferences :one
 SELECT id, user_id, preferred_categories, preferred_distance_km, preferred_time_hours, avoid_categories, updated_at FROM user_preferences WHERE user_id = ?
 `
@@ -218,6 +443,87 @@ func (q *Queries) GetUserVisitHistory(ctx context.Context, arg GetUserVisitHisto
 	return items, nil
 }
 
+const getUserVisitHistoryPage = `-- name: GetUserVisitHistoryPage :many
+SELECT vh.id, vh.user_id, vh.spot_id, vh.visited_at, vh.rating, vh.comment, s.name as spot_name, s.category as spot_category
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = ?1
+  AND (CAST(?2 AS TEXT) IS NULL OR s.category = ?2)
+  AND (CAST(?3 AS TEXT) IS NULL OR vh.visited_at >= datetime(CAST(?3 AS TEXT)))
+  AND (CAST(?4 AS TEXT) IS NULL OR vh.visited_at < datetime(CAST(?4 AS TEXT)))
+  AND (
+    CAST(?5 AS TEXT) IS NULL
+    OR vh.visited_at < datetime(CAST(?5 AS TEXT))
+    OR (vh.visited_at = datetime(CAST(?5 AS TEXT)) AND vh.id < ?6)
+  )
+ORDER BY vh.visited_at DESC, vh.id DESC
+LIMIT ?7
+`
+
+type GetUserVisitHistoryPageParams struct {
+	UserID   string  `json:"user_id"`
+	Category *string `json:"category"`
+	Since    *string `json:"since"`
+	Until    *string `json:"until"`
+	BeforeAt *string `json:"before_at"`
+	BeforeID int64   `json:"before_id"`
+	Limit    int64   `json:"limit"`
+}
+
+type GetUserVisitHistoryPageRow struct {
+	ID           int64     `json:"id"`
+	UserID       string    `json:"user_id"`
+	SpotID       int64     `json:"spot_id"`
+	VisitedAt    time.Time `json:"visited_at"`
+	Rating       *int64    `json:"rating"`
+	Comment      *string   `json:"comment"`
+	SpotName     string    `json:"spot_name"`
+	SpotCategory string    `json:"spot_category"`
+}
+
+// Newest first, keyed on (visited_at, id) so rows inserted while paging
+// don't shift later pages. A NULL before_at starts from the newest visit.
+// category, since and until optionally filter the visits.
+func (q *Queries) GetUserVisitHistoryPage(ctx context.Context, arg GetUserVisitHistoryPageParams) ([]GetUserVisitHistoryPageRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserVisitHistoryPage,
+		arg.UserID,
+		arg.Category,
+		arg.Since,
+		arg.Until,
+		arg.BeforeAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetUserVisitHistoryPageRow{}
+	for rows.Next() {
+		var i GetUserVisitHistoryPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.SpotID,
+			&i.VisitedAt,
+			&i.Rating,
+			&i.Comment,
+			&i.SpotName,
+			&i.SpotCategory,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserVisitedSpotIDs = `-- name: GetUserVisitedSpotIDs :many
 SELECT DISTINCT spot_id FROM visit_history WHERE user_id = ?
 `
@@ -245,6 +551,25 @@ func (q *Queries) GetUserVisitedSpotIDs(ctx context.Context, userID string) ([]i
 	return items, nil
 }
 
+const setRecommendationAccepted = `-- name: SetRecommendationAccepted :execrows
+UPDATE recommendation_history SET was_accepted = ?
+WHERE user_id = ? AND spot_id = ?
+`
+
+type SetRecommendationAcceptedParams struct {
+	WasAccepted *bool  `json:"was_accepted"`
+	UserID      string `json:"user_id"`
+	SpotID      int64  `json:"spot_id"`
+}
+
+func (q *Queries) SetRecommendationAccepted(ctx context.Context, arg SetRecommendationAcceptedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setRecommendationAccepted, arg.WasAccepted, arg.UserID, arg.SpotID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateRecommendationAccepted = `-- name: UpdateRecommendationAccepted :exec
 UPDATE recommendation_history SET was_accepted = TRUE
 WHERE user_id = ? AND spot_id = ?
@@ -0,0 +1,5 @@
+-- Persist generated routes so they can be revisited by ID
+ALTER TABLE route_history ADD COLUMN route_json TEXT;  -- JSON-encoded RouteResponse
+ALTER TABLE route_history ADD COLUMN explanation TEXT; -- cached LLM narrative for the route
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (6, '006-route-details');
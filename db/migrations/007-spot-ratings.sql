@@ -0,0 +1,16 @@
+-- Denormalized rating aggregate on spots, kept up to date by feedback
+ALTER TABLE spots ADD COLUMN avg_rating REAL NOT NULL DEFAULT 0;
+ALTER TABLE spots ADD COLUMN rating_count INTEGER NOT NULL DEFAULT 0;
+
+-- Backfill from existing feedback
+UPDATE spots SET
+    rating_count = (
+        SELECT COUNT(*) FROM visit_history vh
+        WHERE vh.spot_id = spots.id AND vh.rating BETWEEN 1 AND 5
+    ),
+    avg_rating = COALESCE((
+        SELECT AVG(vh.rating) FROM visit_history vh
+        WHERE vh.spot_id = spots.id AND vh.rating BETWEEN 1 AND 5
+    ), 0);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (7, '007-spot-ratings');
@@ -0,0 +1,4 @@
+-- Keep the request a route was generated from so it can be regenerated
+ALTER TABLE route_history ADD COLUMN request_json TEXT; -- JSON-encoded RouteRequest
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (8, '008-route-request');
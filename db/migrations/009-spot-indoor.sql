@@ -0,0 +1,4 @@
+-- Whether a spot is enjoyed indoors; NULL means unknown
+ALTER TABLE spots ADD COLUMN indoor BOOLEAN;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (9, '009-spot-indoor');
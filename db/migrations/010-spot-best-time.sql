@@ -0,0 +1,5 @@
+-- Time of day a spot is best visited, e.g. sunset or night views
+ALTER TABLE spots ADD COLUMN best_time_start TEXT; -- e.g., "16:30"
+ALTER TABLE spots ADD COLUMN best_time_end TEXT;   -- e.g., "18:30"; before start wraps past midnight
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (10, '010-spot-best-time');
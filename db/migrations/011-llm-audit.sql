@@ -0,0 +1,14 @@
+-- Opt-in audit trail of AI calls for debugging recommendation quality
+CREATE TABLE IF NOT EXISTS llm_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    prompt TEXT NOT NULL,
+    response TEXT, -- NULL when the call failed
+    latency_ms INTEGER NOT NULL,
+    outcome TEXT NOT NULL, -- ok, error or timeout
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_audit_created ON llm_audit(created_at);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (11, '011-llm-audit');
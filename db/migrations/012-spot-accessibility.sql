@@ -0,0 +1,6 @@
+-- Accessibility of a spot; NULL means unknown
+ALTER TABLE spots ADD COLUMN wheelchair_accessible BOOLEAN;
+ALTER TABLE spots ADD COLUMN kid_friendly BOOLEAN;
+ALTER TABLE spots ADD COLUMN has_restroom BOOLEAN;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (12, '012-spot-accessibility');
@@ -0,0 +1,14 @@
+-- Photo gallery for spots, shown in sort_order beyond spots.image_url
+CREATE TABLE IF NOT EXISTS spot_images (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    spot_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    caption TEXT,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (spot_id) REFERENCES spots(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_spot_images_spot ON spot_images(spot_id, sort_order);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (13, '013-spot-images');
@@ -0,0 +1,5 @@
+-- How hard the roads to a spot are to drive: 1 easy, 2 moderate (narrow or
+-- winding), 3 hard (steep mountain roads, single lane); NULL means easy
+ALTER TABLE spots ADD COLUMN difficulty INTEGER;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (14, '014-spot-difficulty');
@@ -0,0 +1,4 @@
+-- How long to spend at a spot, in minutes; NULL uses the category default
+ALTER TABLE spots ADD COLUMN suggested_stay_min INTEGER;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (15, '015-spot-suggested-stay');
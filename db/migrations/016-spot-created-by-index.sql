@@ -0,0 +1,4 @@
+-- Look up the spots a user submitted, for "my submissions" and moderation
+CREATE INDEX IF NOT EXISTS idx_spots_created_by ON spots(created_by, created_at);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (16, '016-spot-created-by-index');
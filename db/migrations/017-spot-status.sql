@@ -0,0 +1,6 @@
+-- Moderation status of a spot: 'pending', 'approved' or 'rejected'. Only
+-- approved spots are offered as recommendation and route candidates.
+-- Existing and imported spots are approved; user submissions start pending.
+ALTER TABLE spots ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (17, '017-spot-status');
@@ -0,0 +1,11 @@
+-- Route hashes were the sorted spot IDs formatted like "[1 5 12]"; they are
+-- now length-prefixed and comma-separated like "3:1,5,12". Convert stored
+-- hashes so recent routes are still recognized.
+UPDATE route_history SET route_hash = CASE
+    WHEN route_hash = '[]' THEN '0:'
+    ELSE (length(route_hash) - length(replace(route_hash, ' ', '')) + 1) || ':' ||
+         replace(substr(route_hash, 2, length(route_hash) - 2), ' ', ',')
+END
+WHERE route_hash LIKE '[%]';
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (18, '018-route-hash-format');
@@ -0,0 +1,6 @@
+-- Whether a reverse geocode of the coordinates matched the spot's name or
+-- address: TRUE if it did, FALSE if the submitter forced a mismatch
+-- through, NULL if it wasn't checked.
+ALTER TABLE spots ADD COLUMN coordinates_verified BOOLEAN;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (19, '019-spot-coordinates-verified');
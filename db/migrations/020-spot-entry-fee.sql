@@ -0,0 +1,5 @@
+-- What it costs one adult to get in, in yen: 0 for free spots, NULL when
+-- unknown
+ALTER TABLE spots ADD COLUMN entry_fee INTEGER;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (20, '020-spot-entry-fee');
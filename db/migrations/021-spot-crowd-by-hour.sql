@@ -0,0 +1,6 @@
+-- How crowded the spot usually is at each hour of the day: 24
+-- comma-separated levels from 1 (quiet) to 3 (packed), starting at 00:00;
+-- NULL when unknown
+ALTER TABLE spots ADD COLUMN crowd_by_hour TEXT;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (21, '021-spot-crowd-by-hour');
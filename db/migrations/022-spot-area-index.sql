@@ -0,0 +1,5 @@
+-- Find approved spots in a lat/lng box without scanning the table, for
+-- recommendations and routes (GetSpotsInArea)
+CREATE INDEX IF NOT EXISTS idx_spots_status_location ON spots(status, latitude, longitude);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name) VALUES (22, '022-spot-area-index');
@@ -0,0 +1,14 @@
+-- name: GetActivity :many
+-- spot_id is NULL for routes; db/sqlc.yaml overrides its type to match.
+SELECT activity.kind, activity.id, activity.user_id, activity.spot_id, activity.occurred_at FROM (
+    SELECT 'visit' AS kind, id, user_id, spot_id, visited_at AS occurred_at FROM visit_history
+    UNION ALL
+    SELECT 'recommendation' AS kind, id, user_id, spot_id, recommended_at AS occurred_at FROM recommendation_history
+    UNION ALL
+    SELECT 'route' AS kind, id, user_id, NULL AS spot_id, created_at AS occurred_at FROM route_history
+) activity
+WHERE (CAST(sqlc.narg(user_id) AS TEXT) IS NULL OR activity.user_id = sqlc.narg(user_id))
+  AND (CAST(sqlc.narg(since) AS TEXT) IS NULL OR activity.occurred_at >= datetime(CAST(sqlc.narg(since) AS TEXT)))
+  AND (CAST(sqlc.narg(until) AS TEXT) IS NULL OR activity.occurred_at < datetime(CAST(sqlc.narg(until) AS TEXT)))
+ORDER BY activity.occurred_at DESC, activity.kind, activity.id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
@@ -0,0 +1,6 @@
+-- name: AddLLMAudit :exec
+INSERT INTO llm_audit (prompt, response, latency_ms, outcome, error)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: DeleteLLMAuditBefore :execrows
+DELETE FROM llm_audit WHERE created_at < datetime(CAST(sqlc.arg(before) AS TEXT));
@@ -0,0 +1,26 @@
+-- Queries for GET /api/user/export. The history queries page by id so the
+-- export can stream a page at a time.
+
+-- name: GetUser :one
+SELECT * FROM users WHERE id = ?;
+
+-- name: ExportUserFavorites :many
+SELECT spot_id, created_at FROM favorites WHERE user_id = ? ORDER BY created_at, id;
+
+-- name: ExportUserVisits :many
+SELECT * FROM visit_history
+WHERE user_id = sqlc.arg(user_id) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit);
+
+-- name: ExportUserRecommendations :many
+SELECT * FROM recommendation_history
+WHERE user_id = sqlc.arg(user_id) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit);
+
+-- name: ExportUserRoutes :many
+SELECT * FROM route_history
+WHERE user_id = sqlc.arg(user_id) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit);
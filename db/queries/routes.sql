@@ -1,5 +1,12 @@
--- name: AddRouteHistory :exec
-INSERT INTO route_history (user_id, route_hash, spot_ids) VALUES (?, ?, ?);
+-- name: AddRouteHistory :one
+INSERT INTO route_history (user_id, route_hash, spot_ids, route_json, request_json) VALUES (?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: GetRouteByID :one
+SELECT * FROM route_history WHERE id = ? AND user_id = ?;
+
+-- name: SetRouteExplanation :exec
+UPDATE route_history SET explanation = ? WHERE id = ?;
 
 -- name: GetRecentRouteHashes :many
 SELECT route_hash FROM route_history 
@@ -10,3 +17,6 @@ LIMIT 20;
 -- name: GetSpotsWithHours :many
 SELECT id, name, description, category, latitude, longitude, address, opening_time, closing_time, closed_days
 FROM spots;
+
+-- name: DeleteRouteHistoryBefore :execrows
+DELETE FROM route_history WHERE created_at < datetime(CAST(sqlc.arg(before) AS TEXT));
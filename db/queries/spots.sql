@@ -8,10 +8,48 @@ SELECT * FROM spots WHERE category = ? ORDER BY rating DESC;
 SELECT * FROM spots WHERE id = ?;
 
 -- name: CreateSpot :one
-INSERT INTO spots (name, description, category, latitude, longitude, address, image_url, rating, created_by)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+INSERT INTO spots (name, description, category, latitude, longitude, address, image_url, rating, created_by, indoor, best_time_start, best_time_end,
+    wheelchair_accessible, kid_friendly, has_restroom, difficulty, suggested_stay_min, status,
+    coordinates_verified, entry_fee, crowd_by_hour)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
+-- name: UpdateSpot :one
+UPDATE spots SET
+    name = ?, description = ?, category = ?, latitude = ?, longitude = ?,
+    address = ?, image_url = ?, indoor = ?, best_time_start = ?, best_time_end = ?,
+    wheelchair_accessible = ?, kid_friendly = ?, has_restroom = ?, difficulty = ?,
+    suggested_stay_min = ?, coordinates_verified = ?, entry_fee = ?,
+    crowd_by_hour = ?, status = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: GetSpotsByCreator :many
+SELECT * FROM spots WHERE created_by = ? ORDER BY created_at DESC, id DESC;
+
+-- name: ListSpotsForModeration :many
+-- Newest spots first. Each filter applies only when set: created_by, the
+-- moderation status, category, active (approved or not) and search, text
+-- found in the name, address or description regardless of ASCII case.
+SELECT * FROM spots
+WHERE (CAST(sqlc.narg(created_by) AS TEXT) IS NULL OR created_by = sqlc.narg(created_by))
+  AND (CAST(sqlc.narg(status) AS TEXT) IS NULL OR status = sqlc.narg(status))
+  AND (CAST(sqlc.narg(category) AS TEXT) IS NULL OR category = sqlc.narg(category))
+  AND (CAST(sqlc.narg(active) AS INTEGER) IS NULL OR (status = 'approved') = CAST(sqlc.narg(active) AS INTEGER))
+  AND (CAST(sqlc.narg(search) AS TEXT) IS NULL
+    OR instr(lower(name), lower(sqlc.narg(search))) > 0
+    OR instr(lower(address), lower(sqlc.narg(search))) > 0
+    OR instr(lower(description), lower(sqlc.narg(search))) > 0)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: SetSpotStatus :one
+UPDATE spots SET status = ? WHERE id = ?
+RETURNING *;
+
+-- name: GetApprovedSpots :many
+SELECT * FROM spots WHERE status = 'approved' ORDER BY created_at DESC;
+
 -- name: DeleteSpot :exec
 DELETE FROM spots WHERE id = ?;
 
@@ -36,3 +74,78 @@ ORDER BY f.created_at DESC;
 
 -- name: IsFavorite :one
 SELECT COUNT(*) FROM favorites WHERE user_id = ? AND spot_id = ?;
+
+-- name: AddSpotRating :exec
+UPDATE spots SET
+    avg_rating = (avg_rating * rating_count + CAST(sqlc.arg(rating) AS REAL)) / (rating_count + 1),
+    rating_count = rating_count + 1
+WHERE id = sqlc.arg(id);
+
+-- name: GetSpotsInArea :many
+-- Spots inside a lat/lng box, roughly nearest to (lat, lng) first, so a
+-- LIMIT keeps the most relevant ones. A negative limit means no limit.
+-- Only approved spots are candidates.
+SELECT s.* FROM spots s
+CROSS JOIN (SELECT CAST(sqlc.arg(lat) AS REAL) AS lat, CAST(sqlc.arg(lng) AS REAL) AS lng) o
+WHERE s.status = 'approved'
+  AND s.latitude >= sqlc.arg(min_lat) AND s.latitude <= sqlc.arg(max_lat)
+  AND s.longitude >= sqlc.arg(min_lng) AND s.longitude <= sqlc.arg(max_lng)
+ORDER BY ABS(s.latitude - o.lat) + ABS(s.longitude - o.lng), s.id
+LIMIT sqlc.arg(limit);
+
+-- name: GetSpotsInAreaAnyStatus :many
+-- Spots of every status inside a lat/lng box, for duplicate checks: a
+-- submission still under review is as much a duplicate as an approved spot.
+SELECT s.* FROM spots s
+WHERE s.latitude >= sqlc.arg(min_lat) AND s.latitude <= sqlc.arg(max_lat)
+  AND s.longitude >= sqlc.arg(min_lng) AND s.longitude <= sqlc.arg(max_lng)
+ORDER BY s.id;
+
+-- name: ListSpotImages :many
+SELECT * FROM spot_images WHERE spot_id = ? ORDER BY sort_order, id;
+
+-- name: NextSpotImageOrder :one
+SELECT CAST(COALESCE(MAX(sort_order) + 1, 0) AS INTEGER) FROM spot_images WHERE spot_id = ?;
+
+-- name: AddSpotImage :one
+INSERT INTO spot_images (spot_id, url, caption, sort_order) VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: DeleteSpotImage :execrows
+DELETE FROM spot_images WHERE id = ? AND spot_id = ?;
+
+-- name: SearchSpots :many
+-- Approved spots inside a lat/lng box whose category is in the
+-- comma-separated categories (any category when empty), ordered by sort:
+-- "name", "popularity" (most ratings, then best rated) or newest first
+-- otherwise. A negative limit means no limit.
+SELECT s.* FROM spots s
+CROSS JOIN (SELECT CAST(sqlc.arg(categories) AS TEXT) AS categories, CAST(sqlc.arg(sort) AS TEXT) AS sort) p
+WHERE s.status = 'approved'
+  AND (p.categories = '' OR instr(',' || p.categories || ',', ',' || s.category || ',') > 0)
+  AND s.latitude >= sqlc.arg(min_lat) AND s.latitude <= sqlc.arg(max_lat)
+  AND s.longitude >= sqlc.arg(min_lng) AND s.longitude <= sqlc.arg(max_lng)
+ORDER BY
+  CASE WHEN p.sort = 'name' THEN s.name END,
+  CASE WHEN p.sort = 'popularity' THEN s.rating_count END DESC,
+  CASE WHEN p.sort = 'popularity' THEN s.avg_rating END DESC,
+  s.created_at DESC, s.id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountSearchSpots :one
+-- How many spots SearchSpots matches before limit and offset.
+SELECT COUNT(*) FROM spots s
+CROSS JOIN (SELECT CAST(sqlc.arg(categories) AS TEXT) AS categories) p
+WHERE s.status = 'approved'
+  AND (p.categories = '' OR instr(',' || p.categories || ',', ',' || s.category || ',') > 0)
+  AND s.latitude >= sqlc.arg(min_lat) AND s.latitude <= sqlc.arg(max_lat)
+  AND s.longitude >= sqlc.arg(min_lng) AND s.longitude <= sqlc.arg(max_lng);
+
+-- name: GetNearestSpotsByCategory :many
+-- Approved spots of a category anywhere, roughly nearest to (lat, lng)
+-- first; callers measure the exact distances of the first few.
+SELECT s.* FROM spots s
+CROSS JOIN (SELECT CAST(sqlc.arg(lat) AS REAL) AS lat, CAST(sqlc.arg(lng) AS REAL) AS lng) o
+WHERE s.category = sqlc.arg(category) AND s.status = 'approved'
+ORDER BY ABS(s.latitude - o.lat) + ABS(s.longitude - o.lng), s.id
+LIMIT sqlc.arg(limit);
@@ -31,9 +31,43 @@ WHERE vh.user_id = ?
 ORDER BY vh.visited_at DESC
 LIMIT ?;
 
+-- name: GetUserVisitHistoryPage :many
+-- Newest first, keyed on (visited_at, id) so rows inserted while paging
+-- don't shift later pages. A NULL before_at starts from the newest visit.
+-- category, since and until optionally filter the visits.
+SELECT vh.*, s.name as spot_name, s.category as spot_category
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = sqlc.arg(user_id)
+  AND (CAST(sqlc.narg(category) AS TEXT) IS NULL OR s.category = sqlc.narg(category))
+  AND (CAST(sqlc.narg(since) AS TEXT) IS NULL OR vh.visited_at >= datetime(CAST(sqlc.narg(since) AS TEXT)))
+  AND (CAST(sqlc.narg(until) AS TEXT) IS NULL OR vh.visited_at < datetime(CAST(sqlc.narg(until) AS TEXT)))
+  AND (
+    CAST(sqlc.narg(before_at) AS TEXT) IS NULL
+    OR vh.visited_at < datetime(CAST(sqlc.narg(before_at) AS TEXT))
+    OR (vh.visited_at = datetime(CAST(sqlc.narg(before_at) AS TEXT)) AND vh.id < sqlc.arg(before_id))
+  )
+ORDER BY vh.visited_at DESC, vh.id DESC
+LIMIT sqlc.arg(limit);
+
 -- name: GetUserVisitedSpotIDs :many
 SELECT DISTINCT spot_id FROM visit_history WHERE user_id = ?;
 
+-- name: GetRevisitableSpotIDs :many
+-- Visited spots the user rated min_rating or better on average and hasn't
+-- visited since since.
+SELECT spot_id FROM visit_history
+WHERE user_id = sqlc.arg(user_id)
+GROUP BY spot_id
+HAVING AVG(rating) >= CAST(sqlc.arg(min_rating) AS INTEGER)
+   AND MAX(visited_at) < datetime(CAST(sqlc.arg(since) AS TEXT));
+
+-- name: GetRecentVisitCategories :many
+SELECT DISTINCT s.category FROM visit_history vh
+JOIN spots s ON s.id = vh.spot_id
+WHERE vh.user_id = sqlc.arg(user_id)
+  AND vh.visited_at >= datetime(CAST(sqlc.arg(since) AS TEXT));
+
 -- name: AddRecommendationHistory :one
 INSERT INTO recommendation_history (user_id, spot_id, recommended_at, was_accepted)
 VALUES (?, ?, CURRENT_TIMESTAMP, ?)
@@ -44,10 +78,21 @@ SELECT spot_id FROM recommendation_history
 WHERE user_id = ? AND recommended_at > datetime('now', '-7 days')
 ORDER BY recommended_at DESC;
 
+-- name: GetOverRecommendedSpotIDs :many
+-- Spots recommended to the user at least max_times times since since.
+SELECT spot_id FROM recommendation_history
+WHERE user_id = sqlc.arg(user_id) AND recommended_at >= datetime(CAST(sqlc.arg(since) AS TEXT))
+GROUP BY spot_id
+HAVING COUNT(*) >= CAST(sqlc.arg(max_times) AS INTEGER);
+
 -- name: UpdateRecommendationAccepted :exec
 UPDATE recommendation_history SET was_accepted = TRUE
 WHERE user_id = ? AND spot_id = ?;
 
+-- name: SetRecommendationAccepted :execrows
+UPDATE recommendation_history SET was_accepted = ?
+WHERE user_id = ? AND spot_id = ?;
+
 -- name: GetUserStats :one
 SELECT 
     COUNT(DISTINCT vh.spot_id) as total_visits,
@@ -65,3 +110,30 @@ SELECT
     ) as favorite_category
 FROM visit_history vh
 WHERE vh.user_id = ?;
+
+-- name: DeleteRecommendationHistoryBefore :execrows
+DELETE FROM recommendation_history WHERE recommended_at < datetime(CAST(sqlc.arg(before) AS TEXT));
+
+-- name: GetCategoryTrends :many
+-- Visits per category in bucket_days-wide buckets from since (bucket 0)
+-- up to until.
+SELECT
+    CAST((julianday(vh.visited_at) - julianday(CAST(sqlc.arg(since) AS TEXT))) / CAST(sqlc.arg(bucket_days) AS INTEGER) AS INTEGER) AS bucket,
+    s.category,
+    COUNT(*) AS visits,
+    AVG(vh.rating) AS avg_rating
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = sqlc.arg(user_id)
+  AND vh.visited_at >= datetime(CAST(sqlc.arg(since) AS TEXT))
+  AND vh.visited_at < datetime(CAST(sqlc.arg(until) AS TEXT))
+GROUP BY bucket, s.category
+ORDER BY bucket, s.category;
+
+-- name: GetUserCategoryRatings :many
+-- The user's average rating of the spots they rated, per category.
+SELECT s.category, CAST(AVG(vh.rating) AS REAL) AS avg_rating, COUNT(*) AS rating_count
+FROM visit_history vh
+JOIN spots s ON vh.spot_id = s.id
+WHERE vh.user_id = ? AND vh.rating BETWEEN 1 AND 5
+GROUP BY s.category;
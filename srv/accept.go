@@ -0,0 +1,75 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// maxAcceptBatch caps the number of decisions in one batch request.
+const maxAcceptBatch = 50
+
+// AcceptDecision accepts, or with Reject rejects, one recommended spot.
+type AcceptDecision struct {
+	SpotID int64 `json:"spot_id"`
+	Reject bool  `json:"reject"`
+}
+
+// AcceptResult reports what happened to one decision.
+type AcceptResult struct {
+	SpotID   int64  `json:"spot_id"`
+	Accepted bool   `json:"accepted"`
+	Status   string `json:"status"` // "ok", or "not_recommended" if the spot was never recommended to the user
+}
+
+// HandleAcceptRecommendationBatch records accept/reject decisions for
+// several recommended spots at once. The body is a JSON array of
+// AcceptDecision; the response is an array of AcceptResult in the same
+// order. The decisions are applied in one transaction, so a failure records
+// none of them.
+func (s *Server) HandleAcceptRecommendationBatch(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var decisions []AcceptDecision
+	if err := json.NewDecoder(r.Body).Decode(&decisions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(decisions) == 0 {
+		http.Error(w, "at least one spot is required", http.StatusBadRequest)
+		return
+	}
+	if len(decisions) > maxAcceptBatch {
+		http.Error(w, fmt.Sprintf("too many spots (max %d)", maxAcceptBatch), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]AcceptResult, len(decisions))
+	err := s.WithTx(r.Context(), func(q *dbgen.Queries) error {
+		for i, d := range decisions {
+			accepted := !d.Reject
+			n, err := q.SetRecommendationAccepted(r.Context(), dbgen.SetRecommendationAcceptedParams{
+				WasAccepted: &accepted,
+				UserID:      userID,
+				SpotID:      d.SpotID,
+			})
+			if err != nil {
+				return err
+			}
+			results[i] = AcceptResult{SpotID: d.SpotID, Accepted: accepted, Status: "ok"}
+			if n == 0 {
+				results[i] = AcceptResult{SpotID: d.SpotID, Status: "not_recommended"}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
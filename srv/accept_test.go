@@ -0,0 +1,82 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAcceptRecommendationBatch(t *testing.T) {
+	server, _ := newTestServer(t)
+	a := seedSpot(t, server, "渓谷", "drive", 35.1, 139.0)
+	b := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	c := seedSpot(t, server, "道の駅", "rest", 35.3, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	for _, id := range []int64{a.ID, b.ID, c.ID} {
+		mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id, was_accepted) VALUES ('user-a', ?, FALSE)", id)
+	}
+	accepted := func(spotID int64) bool {
+		t.Helper()
+		var v bool
+		if err := server.DB.QueryRow("SELECT was_accepted FROM recommendation_history WHERE spot_id = ?", spotID).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	w := postJSON(t, server, "/api/accept/batch", "user-a", []AcceptDecision{
+		{SpotID: a.ID},
+		{SpotID: b.ID, Reject: true},
+		{SpotID: 424242},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results []AcceptResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []AcceptResult{
+		{SpotID: a.ID, Accepted: true, Status: "ok"},
+		{SpotID: b.ID, Accepted: false, Status: "ok"},
+		{SpotID: 424242, Status: "not_recommended"},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("want %+v, got %+v", want, results)
+	}
+	if !accepted(a.ID) || accepted(b.ID) || accepted(c.ID) {
+		t.Errorf("expected only %d accepted", a.ID)
+	}
+
+	// Another user's decisions don't touch user-a's history.
+	w = postJSON(t, server, "/api/accept/batch", "user-b", []AcceptDecision{{SpotID: c.ID}})
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || results[0].Status != "not_recommended" || accepted(c.ID) {
+		t.Errorf("expected user-b's decision to find nothing, got %s", w.Body.String())
+	}
+
+	// A failure part way rolls back the whole batch.
+	mustExec(t, server, fmt.Sprintf(`CREATE TRIGGER fail_c BEFORE UPDATE ON recommendation_history
+		WHEN NEW.spot_id = %d BEGIN SELECT RAISE(ABORT, 'injected'); END`, c.ID))
+	w = postJSON(t, server, "/api/accept/batch", "user-a", []AcceptDecision{
+		{SpotID: a.ID, Reject: true},
+		{SpotID: b.ID},
+		{SpotID: c.ID},
+	})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	if !accepted(a.ID) || accepted(b.ID) {
+		t.Errorf("expected the earlier decisions rolled back")
+	}
+
+	for name, body := range map[string]any{
+		"empty":    []AcceptDecision{},
+		"too many": make([]AcceptDecision, maxAcceptBatch+1),
+		"object":   AcceptDecision{SpotID: a.ID},
+	} {
+		if w := postJSON(t, server, "/api/accept/batch", "user-a", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+}
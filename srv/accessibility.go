@@ -0,0 +1,82 @@
+package srv
+
+import (
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// AccessibilityNeeds are the accessibility attributes a recommendation or
+// route requires of every spot.
+type AccessibilityNeeds struct {
+	Wheelchair bool `json:"wheelchair"`
+	Kids       bool `json:"kids"`
+	Restroom   bool `json:"restroom"`
+}
+
+func (n AccessibilityNeeds) any() bool {
+	return n.Wheelchair || n.Kids || n.Restroom
+}
+
+// accessibilityAttrs pairs each need with the spot column it checks and the
+// tag candidates carry in prompts.
+func accessibilityAttrs(n AccessibilityNeeds, spot dbgen.Spot) []struct {
+	need  bool
+	value *bool
+	tag   string
+} {
+	return []struct {
+		need  bool
+		value *bool
+		tag   string
+	}{
+		{n.Wheelchair, spot.WheelchairAccessible, "車椅子可"},
+		{n.Kids, spot.KidFriendly, "子連れ可"},
+		{n.Restroom, spot.HasRestroom, "トイレあり"},
+	}
+}
+
+// meetsAccessibility reports whether spot has every attribute in needs.
+// Spots where an attribute is unknown only pass when AccessibilityStrict is
+// off.
+func (s *Server) meetsAccessibility(spot dbgen.Spot, needs AccessibilityNeeds) bool {
+	for _, a := range accessibilityAttrs(needs, spot) {
+		if !a.need {
+			continue
+		}
+		if a.value == nil {
+			if s.AccessibilityStrict {
+				return false
+			}
+			continue
+		}
+		if !*a.value {
+			return false
+		}
+	}
+	return true
+}
+
+// accessibilityTags lists the spot's known accessibility attributes for a
+// prompt, e.g. " [車椅子可] [トイレあり]".
+func accessibilityTags(spot dbgen.Spot) string {
+	var tags string
+	for _, a := range accessibilityAttrs(AccessibilityNeeds{}, spot) {
+		if a.value != nil && *a.value {
+			tags += " [" + a.tag + "]"
+		}
+	}
+	return tags
+}
+
+// accessibilityRule tells the AI which tags every pick needs, e.g.
+// "[車椅子可][トイレあり]"; empty without needs.
+func accessibilityRule(needs AccessibilityNeeds) string {
+	var tags []string
+	for _, a := range accessibilityAttrs(needs, dbgen.Spot{}) {
+		if a.need {
+			tags = append(tags, "["+a.tag+"]")
+		}
+	}
+	return strings.Join(tags, "")
+}
@@ -0,0 +1,75 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAccessibilityFilter(t *testing.T) {
+	server, llm := newTestServer(t)
+	ramp := seedSpot(t, server, "バリアフリー展望台", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET wheelchair_accessible = 1, has_restroom = 1 WHERE id = ?", ramp.ID)
+	stairs := seedSpot(t, server, "石段の神社", "drive", 35.00, 139.05)
+	mustExec(t, server, "UPDATE spots SET wheelchair_accessible = 0 WHERE id = ?", stairs.ID)
+	unknown := seedSpot(t, server, "謎の滝", "drive", 35.05, 139.05)
+
+	recommended := func(needs AccessibilityNeeds) []int64 {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{"spot_ids": []int64{ramp.ID, stairs.ID, unknown.ID}, "message": "ok"})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, Accessibility: needs})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		var ids []int64
+		for _, sp := range resp.Spots {
+			ids = append(ids, sp.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	t.Run("recommend strict", func(t *testing.T) {
+		if got := recommended(AccessibilityNeeds{Wheelchair: true}); !slices.Equal(got, []int64{ramp.ID}) {
+			t.Errorf("expected only the accessible spot, got %v", got)
+		}
+		prompt := llm.lastPrompt()
+		if !strings.Contains(prompt, "[車椅子可] [トイレあり]") || !strings.Contains(prompt, "同行者のため[車椅子可]のスポットを選ぶ") {
+			t.Errorf("expected accessibility tags and rule in the prompt, got:\n%s", prompt)
+		}
+		if got := recommended(AccessibilityNeeds{}); len(got) != 3 {
+			t.Errorf("expected no filtering without needs, got %v", got)
+		}
+	})
+
+	t.Run("recommend lenient", func(t *testing.T) {
+		server.AccessibilityStrict = false
+		defer func() { server.AccessibilityStrict = true }()
+		want := []int64{ramp.ID, unknown.ID}
+		slices.Sort(want)
+		if got := recommended(AccessibilityNeeds{Wheelchair: true}); !slices.Equal(got, want) {
+			t.Errorf("expected spots of unknown accessibility to pass, got %v", got)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, ramp.ID, unknown.ID)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", Accessibility: AccessibilityNeeds{Restroom: true}})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		if len(resp.Stops) != 3 || resp.Stops[1].ID != ramp.ID {
+			t.Errorf("expected only the spot with a restroom, got %+v", resp.Stops)
+		}
+		prompt := llm.lastPrompt()
+		if strings.Contains(prompt, stairs.Name) || strings.Contains(prompt, unknown.Name) || !strings.Contains(prompt, "候補はすべて[トイレあり]") {
+			t.Errorf("expected only qualifying candidates and the rule, got:\n%s", prompt)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// requireAdmin allows the request through only for exe.dev users listed in
+// Server.AdminEmails. The email header is set by the exe.dev proxy.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(r.Header.Get("X-ExeDev-Email")) == "" {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if !s.isAdmin(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the request comes from an exe.dev account listed
+// in AdminEmails.
+func (s *Server) isAdmin(r *http.Request) bool {
+	email := strings.TrimSpace(r.Header.Get("X-ExeDev-Email"))
+	return email != "" && slices.ContainsFunc(s.AdminEmails, func(admin string) bool {
+		return strings.EqualFold(admin, email)
+	})
+}
+
+// parseDateParam parses an optional YYYY-MM-DD query parameter.
+func parseDateParam(r *http.Request, name string) (time.Time, bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
+
+// parseLimitOffset parses the optional limit and offset query parameters of
+// an admin listing, ignoring invalid values. limit is capped at maxLimit.
+func parseLimitOffset(r *http.Request, defaultLimit, maxLimit int64) (limit, offset int64) {
+	query := r.URL.Query()
+	limit = defaultLimit
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.ParseInt(l, 10, 64); err == nil && parsed > 0 {
+			limit = min(parsed, maxLimit)
+		}
+	}
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.ParseInt(o, 10, 64); err == nil && parsed > 0 {
+			offset = parsed
+		}
+	}
+	return limit, offset
+}
+
+// ActivityResponse is a page of activity events across all users.
+type ActivityResponse struct {
+	Events     []dbgen.GetActivityRow `json:"events"`
+	Limit      int64                  `json:"limit"`
+	Offset     int64                  `json:"offset"`
+	NextOffset *int64                 `json:"next_offset,omitempty"`
+}
+
+// HandleAdminActivity returns recent visits, recommendations and routes for
+// all users, newest first. Optional filters: user_id, from/to (YYYY-MM-DD,
+// inclusive), limit and offset.
+func (s *Server) HandleAdminActivity(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var params dbgen.GetActivityParams
+
+	if userID := query.Get("user_id"); userID != "" {
+		params.UserID = &userID
+	}
+	from, ok, err := parseDateParam(r, "from")
+	if err != nil {
+		http.Error(w, "invalid from date (want YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if ok {
+		since := from.Format(time.DateTime)
+		params.Since = &since
+	}
+	to, ok, err := parseDateParam(r, "to")
+	if err != nil {
+		http.Error(w, "invalid to date (want YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if ok {
+		until := to.AddDate(0, 0, 1).Format(time.DateTime)
+		params.Until = &until
+	}
+	params.Limit, params.Offset = parseLimitOffset(r, 50, 200)
+
+	// Fetch one extra row to know whether there is a next page.
+	limit := params.Limit
+	params.Limit++
+	q := s.Queries
+	events, err := q.GetActivity(r.Context(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ActivityResponse{
+		Events: events,
+		Limit:  limit,
+		Offset: params.Offset,
+	}
+	if int64(len(events)) > limit {
+		resp.Events = events[:limit]
+		next := params.Offset + limit
+		resp.NextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AdminSpotsResponse is a page of spots for moderation.
+type AdminSpotsResponse struct {
+	Spots      []dbgen.Spot `json:"spots"` // with created_by
+	Limit      int64        `json:"limit"`
+	Offset     int64        `json:"offset"`
+	NextOffset *int64       `json:"next_offset,omitempty"`
+}
+
+// HandleAdminSpots lists spots newest first with who submitted them, for
+// moderation. Unlike /api/spots it includes pending and rejected spots.
+// Optional filters: created_by (a user ID), status (e.g. "pending" for the
+// review queue), category, active (true for approved spots, false for the
+// rest), q (text in the name, address or description), limit and offset.
+func (s *Server) HandleAdminSpots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var params dbgen.ListSpotsForModerationParams
+	if createdBy := query.Get("created_by"); createdBy != "" {
+		params.CreatedBy = &createdBy
+	}
+	switch status := query.Get("status"); status {
+	case "":
+	case SpotPending, SpotApproved, SpotRejected:
+		params.Status = &status
+	default:
+		http.Error(w, "invalid status (want pending, approved or rejected)", http.StatusBadRequest)
+		return
+	}
+	if category := query.Get("category"); category != "" {
+		normalized, ok := normalizeCategory(category)
+		if !ok {
+			http.Error(w, "invalid category", http.StatusBadRequest)
+			return
+		}
+		params.Category = &normalized
+	}
+	if query.Get("active") != "" {
+		active, err := boolParam(r, "active", false)
+		if err != nil {
+			http.Error(w, "invalid active", http.StatusBadRequest)
+			return
+		}
+		var v int64
+		if active {
+			v = 1
+		}
+		params.Active = &v
+	}
+	if search := strings.TrimSpace(query.Get("q")); search != "" {
+		params.Search = &search
+	}
+	limit, offset := parseLimitOffset(r, 50, 200)
+	params.Limit, params.Offset = limit+1, offset // one extra to detect a next page
+
+	spots, err := s.Queries.ListSpotsForModeration(r.Context(), params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := AdminSpotsResponse{Spots: spots, Limit: limit, Offset: offset}
+	if resp.Spots == nil {
+		resp.Spots = []dbgen.Spot{}
+	}
+	if int64(len(spots)) > limit {
+		resp.Spots = spots[:limit]
+		next := offset + limit
+		resp.NextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,217 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// adminGet issues a GET to path as the given exe.dev email ("" for anonymous).
+func adminGet(t *testing.T, s *Server, path, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	return adminDo(t, s, http.MethodGet, path, email)
+}
+
+// adminDo issues a bodyless request to path as the given exe.dev email.
+func adminDo(t *testing.T, s *Server, method, path, email string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if email != "" {
+		req.Header.Set("X-ExeDev-Email", email)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+// mustExec runs a seeding statement against the test database.
+func mustExec(t *testing.T, s *Server, query string, args ...any) {
+	t.Helper()
+	if _, err := s.DB.Exec(query, args...); err != nil {
+		t.Fatalf("exec %q: %v", query, err)
+	}
+}
+
+func TestAdminActivity(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	spot := seedSpot(t, server, "城跡", "drive", 35.0, 139.0)
+
+	for _, u := range []string{"alice", "bob"} {
+		mustExec(t, server, "INSERT INTO users (id) VALUES (?)", u)
+	}
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at, rating) VALUES ('alice', ?, '2026-09-01 10:00:00', 5)", spot.ID)
+	mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id, recommended_at) VALUES ('alice', ?, '2026-09-02 10:00:00')", spot.ID)
+	mustExec(t, server, "INSERT INTO route_history (user_id, route_hash, spot_ids, created_at) VALUES ('bob', 'h', '[]', '2026-09-03 23:30:00')")
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES ('bob', ?, '2026-09-05 08:00:00')", spot.ID)
+
+	activity := func(path string) ActivityResponse {
+		t.Helper()
+		w := adminGet(t, server, path, "Admin@example.com")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp ActivityResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	kinds := func(resp ActivityResponse) []string {
+		var out []string
+		for _, e := range resp.Events {
+			out = append(out, e.Kind+":"+e.UserID)
+		}
+		return out
+	}
+
+	t.Run("auth", func(t *testing.T) {
+		if w := adminGet(t, server, "/api/admin/activity", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without identity, got %d", w.Code)
+		}
+		if w := adminGet(t, server, "/api/admin/activity", "someone@example.com"); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for non-admin, got %d", w.Code)
+		}
+	})
+
+	t.Run("all events newest first", func(t *testing.T) {
+		got := kinds(activity("/api/admin/activity"))
+		want := []string{"visit:bob", "route:bob", "recommendation:alice", "visit:alice"}
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("filter by user", func(t *testing.T) {
+		resp := activity("/api/admin/activity?user_id=alice")
+		if len(resp.Events) != 2 {
+			t.Errorf("expected alice's 2 events, got %v", kinds(resp))
+		}
+	})
+
+	t.Run("filter by date range", func(t *testing.T) {
+		// "to" is inclusive of the whole day, so the 23:30 route counts.
+		resp := activity("/api/admin/activity?from=2026-09-02&to=2026-09-03")
+		got := kinds(resp)
+		if len(got) != 2 || got[0] != "route:bob" || got[1] != "recommendation:alice" {
+			t.Errorf("unexpected events in range: %v", got)
+		}
+		if w := adminGet(t, server, "/api/admin/activity?from=9/2", "admin@example.com"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for bad date, got %d", w.Code)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		page1 := activity("/api/admin/activity?limit=3")
+		if len(page1.Events) != 3 || page1.NextOffset == nil || *page1.NextOffset != 3 {
+			t.Fatalf("unexpected first page: %v next=%v", kinds(page1), page1.NextOffset)
+		}
+		page2 := activity("/api/admin/activity?limit=3&offset=3")
+		if len(page2.Events) != 1 || page2.NextOffset != nil {
+			t.Fatalf("unexpected second page: %v next=%v", kinds(page2), page2.NextOffset)
+		}
+		if page2.Events[0].Kind != "visit" || page2.Events[0].UserID != "alice" {
+			t.Errorf("expected alice's visit last, got %v", kinds(page2))
+		}
+	})
+}
+
+func TestAdminSpots(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	for i, user := range []string{"alice", "bob", "alice"} {
+		mustExec(t, server, "INSERT INTO spots (name, category, latitude, longitude, created_by) VALUES (?, 'drive', 35, 139, ?)", fmt.Sprintf("spot-%d", i), user)
+	}
+	seedSpot(t, server, "imported", "drive", 35.0, 139.0)
+
+	list := func(path string) AdminSpotsResponse {
+		t.Helper()
+		w := adminGet(t, server, path, "admin@example.com")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp AdminSpotsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	all := list("/api/admin/spots")
+	if len(all.Spots) != 4 || all.Spots[0].Name != "imported" || all.Spots[0].CreatedBy != nil {
+		t.Fatalf("expected all 4 spots newest first, got %+v", all.Spots)
+	}
+	if all.Spots[1].CreatedBy == nil || *all.Spots[1].CreatedBy != "alice" {
+		t.Errorf("expected the submitter exposed, got %+v", all.Spots[1])
+	}
+
+	alice := list("/api/admin/spots?created_by=alice&limit=1")
+	if len(alice.Spots) != 1 || alice.Spots[0].Name != "spot-2" || alice.NextOffset == nil || *alice.NextOffset != 1 {
+		t.Errorf("expected alice's newest spot and a next page, got %+v", alice)
+	}
+	alice = list("/api/admin/spots?created_by=alice&offset=1")
+	if len(alice.Spots) != 1 || alice.Spots[0].Name != "spot-0" || alice.NextOffset != nil {
+		t.Errorf("expected alice's older spot last, got %+v", alice)
+	}
+
+	if w := adminGet(t, server, "/api/admin/spots", "someone@example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admins, got %d", w.Code)
+	}
+	if w := adminGet(t, server, "/api/admin/spots", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a login, got %d", w.Code)
+	}
+}
+
+func TestAdminSpotsFilters(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	mustExec(t, server, `INSERT INTO spots (name, category, latitude, longitude, address, description, status) VALUES
+		('Lake View', 'drive', 35, 139, '箱根町', NULL, 'approved'),
+		('湖畔カフェ', 'rest', 35, 139, NULL, 'lake side terrace', 'pending'),
+		('峠の茶屋', 'restaurant', 35, 139, '箱根町', NULL, 'rejected'),
+		('展望台', 'drive', 35, 139, NULL, NULL, 'pending')`)
+
+	names := func(path string) string {
+		t.Helper()
+		w := adminGet(t, server, path, "admin@example.com")
+		var resp AdminSpotsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		var got []string
+		for _, spot := range resp.Spots {
+			got = append(got, spot.Name)
+		}
+		return strings.Join(got, ",")
+	}
+
+	for path, want := range map[string]string{
+		"/api/admin/spots?category=drive":                   "展望台,Lake View",
+		"/api/admin/spots?category=食事":                      "峠の茶屋",
+		"/api/admin/spots?active=true":                      "Lake View",
+		"/api/admin/spots?active=false":                     "展望台,峠の茶屋,湖畔カフェ",
+		"/api/admin/spots?q=LAKE":                           "湖畔カフェ,Lake View",
+		"/api/admin/spots?q=箱根":                             "峠の茶屋,Lake View",
+		"/api/admin/spots?q=箱根&active=false":                "峠の茶屋",
+		"/api/admin/spots?category=drive&active=false&q=展望": "展望台",
+		"/api/admin/spots?active=false&limit=2&offset=1":    "峠の茶屋,湖畔カフェ",
+	} {
+		if got := names(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+
+	for _, path := range []string{"/api/admin/spots?category=bar", "/api/admin/spots?active=maybe"} {
+		if w := adminGet(t, server, path, "admin@example.com"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package srv
+
+import (
+	"context"
+	"log/slog"
+	"math"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// defaultMaxCandidateSpots bounds how many spots a recommendation or route
+// loads, however large the spots table grows.
+const defaultMaxCandidateSpots = 5000
+
+// spotArea is a lat/lng box to load spots from, with the point spots are
+// ranked by when the box holds more than MaxCandidateSpots.
+type spotArea struct {
+	Lat, Lng       float64
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// everywhere covers the whole globe.
+var everywhere = spotArea{MinLat: -90, MaxLat: 90, MinLng: -180, MaxLng: 180}
+
+// areaAround returns a box holding every point within km of (lat, lng). It
+// is a cheap prefilter; callers still check distances themselves.
+func (s *Server) areaAround(lat, lng, km float64) spotArea {
+	radius := s.Distance.RadiusKm
+	if radius <= 0 {
+		radius = defaultEarthRadiusKm
+	}
+	// A little slack for rounding; rhumb distances are never shorter than
+	// great-circle ones, so the great-circle box covers both.
+	d := km / radius * 1.01
+	dLat := d * 180 / math.Pi
+	area := spotArea{
+		Lat: lat, Lng: lng,
+		MinLat: lat - dLat, MaxLat: lat + dLat,
+		MinLng: -180, MaxLng: 180,
+	}
+	if area.MinLat <= -90 || area.MaxLat >= 90 {
+		// The circle reaches a pole, so it spans every longitude.
+		area.MinLat, area.MaxLat = max(area.MinLat, -90), min(area.MaxLat, 90)
+		return area
+	}
+	// Widest longitude extent of a spherical cap around (lat, lng).
+	if sinLng := math.Sin(d) / math.Cos(lat*math.Pi/180); sinLng < 1 {
+		dLng := math.Asin(sinLng) * 180 / math.Pi
+		if lng-dLng >= -180 && lng+dLng <= 180 { // don't bother across the antimeridian
+			area.MinLng, area.MaxLng = lng-dLng, lng+dLng
+		}
+	}
+	return area
+}
+
+// intersect returns the box covered by both a and b, ranked from a's
+// origin. An empty intersection has a minimum above its maximum.
+func (a spotArea) intersect(b spotArea) spotArea {
+	return spotArea{
+		Lat: a.Lat, Lng: a.Lng,
+		MinLat: max(a.MinLat, b.MinLat), MaxLat: min(a.MaxLat, b.MaxLat),
+		MinLng: max(a.MinLng, b.MinLng), MaxLng: min(a.MaxLng, b.MaxLng),
+	}
+}
+
+// loadSpots returns the spots in area, at most MaxCandidateSpots of them
+// (nearest first) so huge tables can't exhaust memory. Zero disables the cap.
+func (s *Server) loadSpots(ctx context.Context, q *dbgen.Queries, area spotArea) ([]dbgen.Spot, error) {
+	limit := int64(-1)
+	if s.MaxCandidateSpots > 0 {
+		limit = int64(s.MaxCandidateSpots) + 1 // one extra to detect the cap
+	}
+	spots, err := q.GetSpotsInArea(ctx, dbgen.GetSpotsInAreaParams{
+		Lat:    area.Lat,
+		Lng:    area.Lng,
+		MinLat: area.MinLat,
+		MaxLat: area.MaxLat,
+		MinLng: area.MinLng,
+		MaxLng: area.MaxLng,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.MaxCandidateSpots > 0 && len(spots) > s.MaxCandidateSpots {
+		slog.Warn("candidate spot cap hit; ignoring the farthest spots", "cap", s.MaxCandidateSpots, "lat", area.Lat, "lng", area.Lng)
+		spots = spots[:s.MaxCandidateSpots]
+	}
+	return spots, nil
+}
@@ -0,0 +1,109 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestAreaAroundCoversRadius(t *testing.T) {
+	server, _ := newTestServer(t)
+	for _, origin := range [][2]float64{{35.0, 139.0}, {-33.9, 151.2}, {64.1, -21.9}, {0, 179.5}, {89.5, 0}} {
+		const km = 150
+		area := server.areaAround(origin[0], origin[1], km)
+		// Walk the circle and check every point is inside the box.
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			lat, lng := destination(origin[0], origin[1], bearing, km*0.999)
+			if lat < area.MinLat || lat > area.MaxLat || lng < area.MinLng || lng > area.MaxLng {
+				t.Errorf("origin %v bearing %v: (%.3f, %.3f) outside %+v", origin, bearing, lat, lng, area)
+			}
+		}
+	}
+
+	// Far away points stay out.
+	area := server.areaAround(35.0, 139.0, 50)
+	if 34.0 >= area.MinLat || 140.0 <= area.MaxLng {
+		t.Errorf("expected a tight box around Tokyo, got %+v", area)
+	}
+}
+
+// destination returns the point km away from (lat, lng) along bearing on a
+// sphere of the default radius.
+func destination(lat, lng, bearing, km float64) (float64, float64) {
+	d := km / defaultEarthRadiusKm
+	lat1, lng1, brg := lat*math.Pi/180, lng*math.Pi/180, bearing*math.Pi/180
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(brg))
+	lng2r := lng1 + math.Atan2(math.Sin(brg)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	lng2 := math.Mod(lng2r*180/math.Pi+540, 360) - 180
+	return lat2 * 180 / math.Pi, lng2
+}
+
+// seedGrid inserts n spots on a grid of 0.01° steps starting at (35, 139).
+func seedGrid(tb testing.TB, s *Server, n int) {
+	tb.Helper()
+	_, err := s.DB.Exec(`WITH RECURSIVE seq(i) AS (SELECT 0 UNION ALL SELECT i + 1 FROM seq WHERE i < ? - 1)
+		INSERT INTO spots (name, category, latitude, longitude)
+		SELECT 'spot ' || i, 'drive', 35.0 + (i / 100) * 0.01, 139.0 + (i % 100) * 0.01 FROM seq`, n)
+	if err != nil {
+		tb.Fatalf("seed spots: %v", err)
+	}
+}
+
+func TestLoadSpotsCap(t *testing.T) {
+	server, _ := newTestServer(t)
+	seedGrid(t, server, 400)
+	q := dbgen.New(server.DB)
+
+	server.MaxCandidateSpots = 0
+	spots, err := server.loadSpots(context.Background(), q, everywhere)
+	if err != nil || len(spots) != 400 {
+		t.Fatalf("expected all 400 spots without a cap, got %d, %v", len(spots), err)
+	}
+
+	server.MaxCandidateSpots = 10
+	spots, err = server.loadSpots(context.Background(), q, server.areaAround(35.0, 139.0, 100))
+	if err != nil || len(spots) != 10 {
+		t.Fatalf("expected the cap of 10, got %d, %v", len(spots), err)
+	}
+	for _, sp := range spots {
+		if d := haversine(35.0, 139.0, sp.Latitude, sp.Longitude); d > 5 {
+			t.Errorf("expected the spots nearest the origin, got %s %.1fkm away", sp.Name, d)
+		}
+	}
+
+	// The box alone keeps out spots beyond the radius.
+	server.MaxCandidateSpots = 0
+	spots, _ = server.loadSpots(context.Background(), q, server.areaAround(35.0, 139.0, 2))
+	if len(spots) == 0 || len(spots) > 9 {
+		t.Errorf("expected only the few spots within 2km, got %d", len(spots))
+	}
+}
+
+// BenchmarkLoadSpots shows memory per call staying flat with the cap as the
+// table grows, compared to loading every spot.
+func BenchmarkLoadSpots(b *testing.B) {
+	for _, n := range []int{2000, 20000} {
+		server, err := New(filepath.Join(b.TempDir(), "bench.sqlite3"), "bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		seedGrid(b, server, n)
+		q := dbgen.New(server.DB)
+		for _, limit := range []int{0, 500} {
+			b.Run(fmt.Sprintf("spots=%d/cap=%d", n, limit), func(b *testing.B) {
+				server.MaxCandidateSpots = limit
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := server.loadSpots(context.Background(), q, everywhere); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+		server.DB.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// AuditConfig controls the opt-in audit trail of AI prompts and responses
+// in the llm_audit table. Prompts include the user's visit history and
+// location, so it is off by default.
+type AuditConfig struct {
+	Enabled bool
+	// RedactCoordinates masks latitudes and longitudes before storing.
+	RedactCoordinates bool
+	// Retention prunes records older than this hourly while serving; zero
+	// keeps everything.
+	Retention time.Duration
+}
+
+// coordinatePattern matches the coordinates prompts carry: labelled
+// 緯度/経度 values and bare decimals with four or more places.
+var coordinatePattern = regexp.MustCompile(`((?:緯度|経度|lat|lng)\s*[:=]?\s*)-?\d+(?:\.\d+)?|-?\d{1,3}\.\d{4,}`)
+
+// redactCoordinates masks coordinates in text.
+func redactCoordinates(text string) string {
+	return coordinatePattern.ReplaceAllString(text, "${1}[redacted]")
+}
+
+// auditLLM records one AI call if auditing is enabled. Failures to record
+// are logged and otherwise ignored.
+func (s *Server) auditLLM(ctx context.Context, prompt, response string, callErr error, latency time.Duration) {
+	if !s.Audit.Enabled {
+		return
+	}
+	if s.Audit.RedactCoordinates {
+		prompt, response = redactCoordinates(prompt), redactCoordinates(response)
+	}
+	params := dbgen.AddLLMAuditParams{
+		Prompt:    prompt,
+		LatencyMs: latency.Milliseconds(),
+		Outcome:   "ok",
+	}
+	switch {
+	case errors.Is(callErr, context.DeadlineExceeded):
+		params.Outcome = "timeout"
+	case callErr != nil:
+		params.Outcome = "error"
+	}
+	if callErr != nil {
+		msg := callErr.Error()
+		params.Error = &msg
+	} else {
+		params.Response = &response
+	}
+	if err := s.Queries.AddLLMAudit(context.WithoutCancel(ctx), params); err != nil {
+		slog.Warn("record llm audit", "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLLMAudit(t *testing.T) {
+	server, llm := newTestServer(t)
+	spot := seedSpot(t, server, "展望台", "drive", 35.75, 139.8)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, spot.ID)
+	audits := func() int {
+		var n int
+		if err := server.DB.QueryRow("SELECT COUNT(*) FROM llm_audit").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.6812, Lng: 139.7671})
+	if n := audits(); n != 0 {
+		t.Errorf("expected no audit records when disabled, got %d", n)
+	}
+
+	server.Audit = AuditConfig{Enabled: true}
+	postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.6812, Lng: 139.7671})
+	var prompt, response, outcome string
+	var latency int64
+	err := server.DB.QueryRow("SELECT prompt, response, outcome, latency_ms FROM llm_audit ORDER BY id DESC LIMIT 1").Scan(&prompt, &response, &outcome, &latency)
+	if err != nil {
+		t.Fatalf("expected an audit record: %v", err)
+	}
+	if !strings.Contains(prompt, "緯度35.6812") || response != llm.response || outcome != "ok" || latency < 0 {
+		t.Errorf("unexpected record: outcome %q, latency %d, response %q", outcome, latency, response)
+	}
+
+	server.Audit.RedactCoordinates = true
+	postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.6812, Lng: 139.7671})
+	server.DB.QueryRow("SELECT prompt FROM llm_audit ORDER BY id DESC LIMIT 1").Scan(&prompt)
+	if strings.Contains(prompt, "35.6812") || strings.Contains(prompt, "139.7671") || !strings.Contains(prompt, "緯度[redacted]") {
+		t.Errorf("expected coordinates redacted, got:\n%s", prompt)
+	}
+
+	llm.err = errors.New("gateway down")
+	server.complete(context.Background(), "失敗するプロンプト", 100)
+	var errText string
+	server.DB.QueryRow("SELECT outcome, error FROM llm_audit ORDER BY id DESC LIMIT 1").Scan(&outcome, &errText)
+	if outcome != "error" || errText != "gateway down" {
+		t.Errorf("expected the failure recorded, got %q %q", outcome, errText)
+	}
+	if n := audits(); n != 3 {
+		t.Errorf("expected 3 audit records, got %d", n)
+	}
+}
+
+func TestRedactCoordinates(t *testing.T) {
+	in := "現在地: 緯度35.6812, 経度139.7671 / lat=-33.8688 (12.3km) spot 151.209300"
+	want := "現在地: 緯度[redacted], 経度[redacted] / lat=[redacted] (12.3km) spot [redacted]"
+	if got := redactCoordinates(in); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
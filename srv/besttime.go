@@ -0,0 +1,204 @@
+package srv
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(v string) (int, bool) {
+	h, m, ok := strings.Cut(v, ":")
+	if !ok {
+		return 0, false
+	}
+	hour, err1 := strconv.Atoi(h)
+	min, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+		return 0, false
+	}
+	return hour*60 + min, true
+}
+
+// bestTimeWindow returns the spot's preferred arrival window in minutes
+// after midnight. end < start means the window wraps past midnight.
+func bestTimeWindow(spot dbgen.Spot) (start, end int, ok bool) {
+	if spot.BestTimeStart == nil || spot.BestTimeEnd == nil {
+		return 0, 0, false
+	}
+	start, ok1 := parseClock(*spot.BestTimeStart)
+	end, ok2 := parseClock(*spot.BestTimeEnd)
+	return start, end, ok1 && ok2
+}
+
+// minutesOutside returns how far arrival (minutes after departure day's
+// midnight, possibly past 24:00) is from the window, 0 if inside it.
+func minutesOutside(arrival, start, end int) int {
+	a := arrival % (24 * 60)
+	if end < start {
+		// Wraps past midnight: outside is the gap [end, start]
+		if a >= start || a <= end {
+			return 0
+		}
+		return min(a-end, start-a)
+	}
+	if a >= start && a <= end {
+		return 0
+	}
+	if a < start {
+		return min(start-a, a+24*60-end)
+	}
+	return min(a-end, start+24*60-a)
+}
+
+// arrivals returns the arrival time at each stop of order, in minutes.
+func (s *Server) arrivals(legs *routeLegs, startLat, startLng float64, depMinutes int, order []dbgen.Spot, stays []int) []int {
+	out := make([]int, len(order))
+	t := depMinutes
+	prevLat, prevLng := startLat, startLng
+	for i, spot := range order {
+		t += legs.leg(prevLat, prevLng, spot.Latitude, spot.Longitude).Minutes
+		out[i] = t
+		t += openingWait(spot, t) + stays[i]
+		prevLat, prevLng = spot.Latitude, spot.Longitude
+	}
+	return out
+}
+
+// scheduleBestTimes moves stops that have a best-visited window to where
+// their arrival falls in (or closest to) it, e.g. a sunset spot towards the
+// end of the day, and stops with crowd data to where they are least crowded
+// on arrival. Best times come first; crowds only break ties. Stays move with
+// their stops; missing ones get defaults. Orders rejected by accept (if
+// non-nil) are not considered.
+func (s *Server) scheduleBestTimes(legs *routeLegs, startLat, startLng float64, depMinutes int, routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot, accept func([]dbgen.Spot) bool) ([]int64, []int) {
+	order, stays := s.resolveStops(routeIDs, stayDurations, spotMap)
+	if !slices.ContainsFunc(order, timeSensitive) {
+		return routeIDs, stayDurations
+	}
+
+	penalty := func(order []dbgen.Spot, stays []int) schedulePenalty {
+		var total schedulePenalty
+		for i, at := range s.arrivals(legs, startLat, startLng, depMinutes, order, stays) {
+			if start, end, ok := bestTimeWindow(order[i]); ok {
+				total.outside += minutesOutside(at, start, end)
+			}
+			if level, ok := crowdAt(order[i], at); ok {
+				total.crowd += level - CrowdLow
+			}
+		}
+		return total
+	}
+
+	// Greedily move one time-sensitive stop at a time while it helps; the
+	// penalty strictly decreases, so this terminates.
+	best := penalty(order, stays)
+	for improved := true; improved && best != (schedulePenalty{}); {
+		improved = false
+		for i := range order {
+			if !timeSensitive(order[i]) {
+				continue
+			}
+			for j := range order {
+				if j == i {
+					continue
+				}
+				o, st := moveStop(order, i, j), moveStop(stays, i, j)
+				if hasConsecutiveMealOrRest(o) || (accept != nil && !accept(o)) {
+					continue
+				}
+				if p := penalty(o, st); p.less(best) {
+					order, stays, best, improved = o, st, p, true
+					break
+				}
+			}
+			if improved {
+				break
+			}
+		}
+	}
+
+	return stopIDs(order), stays
+}
+
+// schedulePenalty rates a route's timing for scheduleBestTimes: the total
+// minutes stops arrive outside their best time, then the total crowd level
+// above CrowdLow on arrival.
+type schedulePenalty struct {
+	outside, crowd int
+}
+
+// less reports whether p is a better schedule than q.
+func (p schedulePenalty) less(q schedulePenalty) bool {
+	if p.outside != q.outside {
+		return p.outside < q.outside
+	}
+	return p.crowd < q.crowd
+}
+
+// timeSensitive reports whether when a stop is visited matters: it has a
+// best time or crowd data.
+func timeSensitive(spot dbgen.Spot) bool {
+	_, _, windowed := bestTimeWindow(spot)
+	return windowed || spot.CrowdByHour != nil
+}
+
+// resolveStops looks up the route's spots, dropping unknown IDs, and pairs
+// each with its stay, defaulting missing ones.
+func (s *Server) resolveStops(routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) ([]dbgen.Spot, []int) {
+	var order []dbgen.Spot
+	var stays []int
+	for i, id := range routeIDs {
+		spot, ok := spotMap[id]
+		if !ok {
+			continue
+		}
+		stay := s.spotStay(spot)
+		if i < len(stayDurations) {
+			stay = stayDurations[i]
+		}
+		order = append(order, spot)
+		stays = append(stays, stay)
+	}
+	return order, stays
+}
+
+func stopIDs(order []dbgen.Spot) []int64 {
+	ids := make([]int64, len(order))
+	for i, spot := range order {
+		ids[i] = spot.ID
+	}
+	return ids
+}
+
+// moveStop returns a copy of xs with the element at i moved to index j.
+func moveStop[T any](xs []T, i, j int) []T {
+	out := make([]T, 0, len(xs))
+	out = append(out, xs[:i]...)
+	out = append(out, xs[i+1:]...)
+	out = append(out[:j], append([]T{xs[i]}, out[j:]...)...)
+	return out
+}
+
+// hasConsecutiveMealOrRest reports whether two restaurants or two rest
+// stops follow each other, which validateRouteCategories forbids.
+func hasConsecutiveMealOrRest(order []dbgen.Spot) bool {
+	for i := 1; i < len(order); i++ {
+		c := order[i].Category
+		if c == order[i-1].Category && (c == "restaurant" || c == "rest") {
+			return true
+		}
+	}
+	return false
+}
+
+// bestTimeLabel formats the spot's window as "HH:MM-HH:MM".
+func bestTimeLabel(spot dbgen.Spot) string {
+	if _, _, ok := bestTimeWindow(spot); !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", *spot.BestTimeStart, *spot.BestTimeEnd)
+}
@@ -0,0 +1,96 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMinutesOutside(t *testing.T) {
+	cases := []struct {
+		arrival, start, end, want int
+	}{
+		{17 * 60, 16*60 + 30, 18*60 + 30, 0},
+		{15 * 60, 16*60 + 30, 18*60 + 30, 90},
+		{19 * 60, 16*60 + 30, 18*60 + 30, 30},
+		// 22:00-02:00 wraps past midnight
+		{23 * 60, 22 * 60, 2 * 60, 0},
+		{24*60 + 60, 22 * 60, 2 * 60, 0},
+		{3 * 60, 22 * 60, 2 * 60, 60},
+		{21 * 60, 22 * 60, 2 * 60, 60},
+		// Early morning is closer to the next day's evening window
+		{60, 16 * 60, 20 * 60, 300},
+	}
+	for _, c := range cases {
+		if got := minutesOutside(c.arrival, c.start, c.end); got != c.want {
+			t.Errorf("minutesOutside(%d, %d, %d) = %d, want %d", c.arrival, c.start, c.end, got, c.want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	if m, ok := parseClock("17:45"); !ok || m != 17*60+45 {
+		t.Errorf("parseClock(17:45) = %d, %v", m, ok)
+	}
+	for _, v := range []string{"", "17", "24:00", "12:60", "ab:cd"} {
+		if _, ok := parseClock(v); ok {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestGenerateRouteBestTime(t *testing.T) {
+	server, llm := newTestServer(t)
+	sunset := seedSpot(t, server, "夕日の丘", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET best_time_start = '16:30', best_time_end = '18:30' WHERE id = ?", sunset.ID)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.00, 139.05)
+	falls := seedSpot(t, server, "渓谷の滝", "drive", 35.05, 139.05)
+
+	b, _ := json.Marshal(map[string]any{
+		"route_ids":      []int64{sunset.ID, lake.ID, falls.ID},
+		"stay_durations": []int{30, 60, 60},
+		"message":        "ok",
+	})
+	llm.response = string(b)
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "15:00"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	stops := resp.Stops[1 : len(resp.Stops)-1]
+	if len(stops) != 3 {
+		t.Fatalf("expected 3 stops, got %+v", resp.Stops)
+	}
+	last := stops[len(stops)-1]
+	if last.ID != sunset.ID {
+		t.Fatalf("expected the sunset spot last, got %+v", stops)
+	}
+	if last.BestTime != "16:30-18:30" || last.InBestTime == nil || !*last.InBestTime {
+		t.Errorf("expected arrival within the best time, got %+v", last)
+	}
+	if last.stayMinutes() != 30 {
+		t.Errorf("expected the stay to move with the stop, got %d", last.stayMinutes())
+	}
+	for _, stop := range stops[:2] {
+		if stop.BestTime != "" || stop.InBestTime != nil {
+			t.Errorf("expected no best time on %s, got %+v", stop.Name, stop)
+		}
+	}
+}
+
+func TestCreateSpotBestTimeValidation(t *testing.T) {
+	server, _ := newTestServer(t)
+	lat, lng := 35.0, 139.0
+	start, bad := "16:30", "25:00"
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "夕日", Category: "drive", Latitude: &lat, Longitude: &lng, BestTimeStart: &start, BestTimeEnd: &bad})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad time, got %d", w.Code)
+	}
+	w = postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "夕日", Category: "drive", Latitude: &lat, Longitude: &lng, BestTimeStart: &start})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a half-open window, got %d", w.Code)
+	}
+}
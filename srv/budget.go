@@ -0,0 +1,43 @@
+package srv
+
+import "srv.exe.dev/db/dbgen"
+
+// tripEnd is when a trip leaving at depMinutes through order, staying
+// stays, gets back to the start, in minutes.
+func (s *Server) tripEnd(legs *routeLegs, startLat, startLng float64, depMinutes int, order []dbgen.Spot, stays []int) int {
+	if len(order) == 0 {
+		return depMinutes
+	}
+	arrivals := s.arrivals(legs, startLat, startLng, depMinutes, order, stays)
+	last := len(order) - 1
+	end := arrivals[last] + openingWait(order[last], arrivals[last]) + stays[last]
+	return end + legs.leg(order[last].Latitude, order[last].Longitude, startLat, startLng).Minutes
+}
+
+// fitTimeBudget drops trailing stops until the trip, including the drive
+// back, takes at most budgetMin minutes. It won't drop the route's last
+// drive spot, so overBudget reports a route that still doesn't fit.
+// trimmed is the number of stops dropped. Unknown IDs are dropped and
+// missing stays filled in, as by resolveStops.
+func (s *Server) fitTimeBudget(legs *routeLegs, startLat, startLng float64, depMinutes, budgetMin int, routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) (ids []int64, stays []int, trimmed int, overBudget bool) {
+	order, stays := s.resolveStops(routeIDs, stayDurations, spotMap)
+	for s.tripEnd(legs, startLat, startLng, depMinutes, order, stays)-depMinutes > budgetMin {
+		last := len(order) - 1
+		if order[last].Category == "drive" && countCategory(order[:last], "drive") == 0 {
+			return stopIDs(order), stays, trimmed, true
+		}
+		order, stays = order[:last], stays[:last]
+		trimmed++
+	}
+	return stopIDs(order), stays, trimmed, false
+}
+
+func countCategory(order []dbgen.Spot, category string) int {
+	n := 0
+	for _, spot := range order {
+		if spot.Category == category {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRouteTrimmedToTimeBudget(t *testing.T) {
+	server, llm := newTestServer(t)
+	lookout := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.05)
+	cafe := seedSpot(t, server, "カフェ", "rest", 35.00, 139.05)
+
+	include := true
+	route := func(returnTime string, stays []int) RouteResponse {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{
+			"route_ids":      []int64{lookout.ID, lake.ID, cafe.ID},
+			"stay_durations": stays,
+			"message":        "ok",
+		})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", ReturnTime: returnTime, IncludeRest: &include})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	ids := func(resp RouteResponse) []int64 {
+		var ids []int64
+		for _, stop := range spotStops(resp) {
+			ids = append(ids, stop.ID)
+		}
+		return ids
+	}
+
+	// About 3 hours with all three stops
+	resp := route("12:30", []int{60, 60, 30})
+	if len(ids(resp)) != 3 || resp.TrimmedStops != 0 || resp.OverBudget {
+		t.Errorf("expected the route to fit untouched, got %v trimmed=%d over=%v", ids(resp), resp.TrimmedStops, resp.OverBudget)
+	}
+
+	resp = route("11:30", []int{60, 60, 30})
+	if got := ids(resp); len(got) != 2 || got[0] != lookout.ID || got[1] != lake.ID {
+		t.Errorf("expected the last stop trimmed, got %v", got)
+	}
+	if resp.TrimmedStops != 1 || resp.OverBudget {
+		t.Errorf("expected one stop trimmed, got trimmed=%d over=%v", resp.TrimmedStops, resp.OverBudget)
+	}
+	if resp.EstimatedReturn > "11:30" || resp.TotalTimeMin > 150 {
+		t.Errorf("expected the trimmed route back by 11:30, got %s (%v min)", resp.EstimatedReturn, resp.TotalTimeMin)
+	}
+	if last := resp.Stops[len(resp.Stops)-1]; last.Category != "end" || *last.DistanceFromPrev != *legKm(server.distanceKm(lake.Latitude, lake.Longitude, 35.0, 139.0)) {
+		t.Errorf("expected the return leg from the new last stop, got %+v", last)
+	}
+	if !strings.Contains(resp.Message, "最後の1箇所を省きました") {
+		t.Errorf("expected the trim noted in the message, got %q", resp.Message)
+	}
+
+	// A single drive spot is kept even when it alone runs over
+	resp = route("11:00", []int{180, 60, 30})
+	if got := ids(resp); len(got) != 1 || got[0] != lookout.ID {
+		t.Errorf("expected only the first drive spot left, got %v", got)
+	}
+	if resp.TrimmedStops != 2 || !resp.OverBudget {
+		t.Errorf("expected the route flagged over budget, got trimmed=%d over=%v", resp.TrimmedStops, resp.OverBudget)
+	}
+}
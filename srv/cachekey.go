@@ -0,0 +1,22 @@
+package srv
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// defaultCacheKeyPrecision groups origins within about 110m.
+const defaultCacheKeyPrecision = 3
+
+// recommendCacheKey identifies a recommendation request for caching: the
+// user, the origin rounded to CacheKeyPrecision decimal places (unless
+// zero) and the rest of the request. Requests with the same key may share a
+// response.
+func (s *Server) recommendCacheKey(userID string, req RecommendRequest) string {
+	if s.CacheKeyPrecision > 0 {
+		req.Lat, req.Lng = roundTo(req.Lat, s.CacheKeyPrecision), roundTo(req.Lng, s.CacheKeyPrecision)
+	}
+	// Encoding a struct of plain fields and pointers to them can't fail
+	b, _ := json.Marshal(req)
+	return strconv.Quote(userID) + ":" + string(b)
+}
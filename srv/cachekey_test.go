@@ -0,0 +1,61 @@
+package srv
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecommendCacheKeyPrecision(t *testing.T) {
+	server, _ := newTestServer(t)
+	// About 300m apart
+	a := RecommendRequest{Lat: 35.6581, Lng: 139.7017, MaxDistanceKm: 50}
+	b := RecommendRequest{Lat: 35.6604, Lng: 139.7036, MaxDistanceKm: 50}
+
+	for precision, same := range map[int]bool{0: false, 1: true, 2: true, 3: false, 5: false} {
+		server.CacheKeyPrecision = precision
+		if got := server.recommendCacheKey("user-a", a) == server.recommendCacheKey("user-a", b); got != same {
+			t.Errorf("precision %d: expected same key %v, got %v", precision, same, got)
+		}
+	}
+
+	server.CacheKeyPrecision = 2
+	other := a
+	other.Category = "rest"
+	if server.recommendCacheKey("user-a", a) == server.recommendCacheKey("user-a", other) {
+		t.Error("expected the category in the key")
+	}
+	if server.recommendCacheKey("user-a", a) == server.recommendCacheKey("user-b", a) {
+		t.Error("expected the user in the key")
+	}
+}
+
+func TestRecommendCooldownUsesCacheKey(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.RecommendCooldown = 2 * time.Minute
+	server.RecommendCooldownKm = 0.1
+	spot := seedSpot(t, server, "渓谷", "drive", 35.7, 139.7)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, spot.ID)
+
+	// About 300m apart: too far for RecommendCooldownKm, but the same
+	// place at 2 decimal places
+	a := RecommendRequest{Lat: 35.6581, Lng: 139.7017}
+	b := RecommendRequest{Lat: 35.6604, Lng: 139.7036}
+	for _, tc := range []struct {
+		precision int
+		cooled    bool
+	}{{3, false}, {2, true}} {
+		server.CacheKeyPrecision = tc.precision
+		user := fmt.Sprintf("user-%d", tc.precision)
+		postJSON(t, server, "/api/recommend", user, a)
+		calls := llm.calls()
+		w := postJSON(t, server, "/api/recommend", user, b)
+		if w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		if cooled := llm.calls() == calls; cooled != tc.cooled {
+			t.Errorf("precision %d: expected cooldown %v, got %v", tc.precision, tc.cooled, cooled)
+		}
+	}
+}
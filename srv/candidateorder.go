@@ -0,0 +1,37 @@
+package srv
+
+import (
+	"cmp"
+	"slices"
+)
+
+// maxPromptCandidates is how many recommendation candidates the AI sees.
+const maxPromptCandidates = 30
+
+// CandidateOrder selects which recommendation candidates reach the AI when
+// there are more than maxPromptCandidates, and the order it sees them in.
+type CandidateOrder string
+
+const (
+	// CandidateByScore keeps the best ranked candidates (see
+	// rankCandidates). The default.
+	CandidateByScore CandidateOrder = "score"
+	// CandidateByDistance keeps the nearest candidates, nearest first.
+	// Ties keep the ranking order.
+	CandidateByDistance CandidateOrder = "distance"
+)
+
+// promptCandidates returns the ranked candidates the AI is offered, in
+// s.PromptCandidateOrder, leaving candidates untouched.
+func (s *Server) promptCandidates(candidates []SpotWithDistance) []SpotWithDistance {
+	ordered := slices.Clone(candidates)
+	if s.PromptCandidateOrder == CandidateByDistance {
+		slices.SortStableFunc(ordered, func(a, b SpotWithDistance) int {
+			return cmp.Compare(a.DistanceKm, b.DistanceKm)
+		})
+	}
+	if len(ordered) > maxPromptCandidates {
+		ordered = ordered[:maxPromptCandidates]
+	}
+	return ordered
+}
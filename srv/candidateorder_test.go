@@ -0,0 +1,91 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPromptCandidatesTruncatedByOrder(t *testing.T) {
+	server, llm := newTestServer(t)
+	const n = maxPromptCandidates + 10
+	var ids []int64
+	for i := range n {
+		// Spot i+1 is 1.1km farther out than spot i
+		spot := seedSpot(t, server, fmt.Sprintf("展望台%02d", i+1), "drive", 35.0+0.01*float64(i+1), 139.0)
+		ids = append(ids, spot.ID)
+	}
+	// Favor the farthest spots, which the database lists last
+	server.Scorer = ScorerFunc(func(c SpotWithDistance, sc ScoreContext) float64 { return c.DistanceKm })
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, ids[0])
+
+	offered := func(order CandidateOrder) (in, out []int64) {
+		t.Helper()
+		server.PromptCandidateOrder = order
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		if w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		prompt := llm.lastPrompt()
+		for _, id := range ids {
+			if strings.Contains(prompt, fmt.Sprintf("[ID:%d]", id)) {
+				in = append(in, id)
+			} else {
+				out = append(out, id)
+			}
+		}
+		return in, out
+	}
+
+	in, out := offered(CandidateByScore)
+	if len(in) != maxPromptCandidates || in[0] != ids[10] || out[len(out)-1] != ids[9] {
+		t.Errorf("expected the %d best scored (farthest) spots offered, got %v, left out %v", maxPromptCandidates, in, out)
+	}
+	in, out = offered(CandidateByDistance)
+	if len(in) != maxPromptCandidates || in[len(in)-1] != ids[maxPromptCandidates-1] || out[0] != ids[maxPromptCandidates] {
+		t.Errorf("expected the %d nearest spots offered, got %v, left out %v", maxPromptCandidates, in, out)
+	}
+}
+
+func TestRecommendIncludeCandidates(t *testing.T) {
+	server, llm := newTestServer(t)
+	const n = maxPromptCandidates + 5
+	var ids []int64
+	for i := range n {
+		spot := seedSpot(t, server, fmt.Sprintf("展望台%02d", i+1), "drive", 35.0+0.01*float64(i+1), 139.0)
+		ids = append(ids, spot.ID)
+	}
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, ids[0])
+
+	recommend := func(userID string, include bool) RecommendResponse {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", userID, RecommendRequest{Lat: 35.0, Lng: 139.0, IncludeCandidates: include})
+		if w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), `"candidates"`) != include {
+			t.Errorf("include_candidates=%v: unexpected body %s", include, w.Body.String())
+		}
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if resp := recommend("user-a", false); resp.Candidates != nil || resp.CandidateCount != 0 {
+		t.Errorf("expected no candidates by default, got %d of %d", len(resp.Candidates), resp.CandidateCount)
+	}
+	resp := recommend("user-b", true)
+	if len(resp.Candidates) != maxPromptCandidates || resp.CandidateCount != n {
+		t.Errorf("expected %d of %d candidates, got %d of %d", maxPromptCandidates, n, len(resp.Candidates), resp.CandidateCount)
+	}
+	prompt := llm.lastPrompt()
+	for _, c := range resp.Candidates {
+		if !strings.Contains(prompt, fmt.Sprintf("[ID:%d]", c.ID)) {
+			t.Errorf("candidate %d was not offered to the AI", c.ID)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// defaultMaxRelaxedDistanceKm is how far MinCandidatePool may widen a
+// recommendation's search by default.
+const defaultMaxRelaxedDistanceKm = 200
+
+// relaxStep is how much each widening multiplies the distance by.
+const relaxStep = 1.5
+
+// relaxedDistances is the sequence of MaxDistanceKm values to retry the
+// candidate filter with, widening km up to MaxRelaxedDistanceKm. It is
+// empty when the pool minimum is disabled or km is already at the ceiling.
+func (s *Server) relaxedDistances(km float64) []float64 {
+	if s.MinCandidatePool <= 0 {
+		return nil
+	}
+	var steps []float64
+	for km < s.MaxRelaxedDistanceKm {
+		km = min(km*relaxStep, s.MaxRelaxedDistanceKm)
+		steps = append(steps, km)
+	}
+	return steps
+}
+
+// candidatePool filters in's spots for req, widening req.MaxDistanceKm while
+// fewer than MinCandidatePool spots pass. in only holds the spots within
+// the requested distance (see recommendArea), so the first widening loads
+// those out to the last step. It returns the candidates and the distance
+// they were found within, or 0 if it didn't need widening.
+func (s *Server) candidatePool(ctx context.Context, req RecommendRequest, in recommendInputs) ([]SpotWithDistance, float64) {
+	candidates := s.filterCandidates(req, in)
+	steps := s.relaxedDistances(req.MaxDistanceKm)
+	if len(candidates) >= s.MinCandidatePool || len(steps) == 0 {
+		return candidates, 0
+	}
+	wider, err := s.loadSpots(ctx, s.Queries, s.areaAround(req.Lat, req.Lng, steps[len(steps)-1]))
+	if err != nil {
+		slog.Warn("load spots to widen recommendations", "error", err)
+		return candidates, 0
+	}
+	in.allSpots = wider
+
+	var relaxedKm float64
+	for _, km := range steps {
+		if len(candidates) >= s.MinCandidatePool {
+			break
+		}
+		req.MaxDistanceKm = km
+		candidates = s.filterCandidates(req, in)
+		relaxedKm = km
+	}
+	return candidates, relaxedKm
+}
+
+// relaxedNote tells the user the search went beyond their distance.
+func relaxedNote(km float64) string {
+	return fmt.Sprintf("（近くの候補が少なかったため、%.0fkm圏まで範囲を広げて探しました）", km)
+}
@@ -0,0 +1,89 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMinCandidatePoolRelaxesDistance(t *testing.T) {
+	server, llm := newTestServer(t)
+	near := seedSpot(t, server, "近くの公園", "drive", 35.05, 139.0) // ~6km
+	seedSpot(t, server, "峠の展望台", "drive", 35.30, 139.0)         // ~33km
+	seedSpot(t, server, "遠くの岬", "drive", 35.55, 139.0)          // ~61km
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "おすすめです"}`, near.ID)
+
+	recommend := func(user string) (RecommendResponse, string) {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", user, RecommendRequest{Lat: 35.0, Lng: 139.0, MaxDistanceKm: 10})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		return resp, llm.lastPrompt()
+	}
+	offered := func(prompt string) []string {
+		var names []string
+		for _, name := range []string{"近くの公園", "峠の展望台", "遠くの岬"} {
+			if strings.Contains(prompt, name) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	// Disabled: only the nearby spot, and no note.
+	resp, prompt := recommend("user-a")
+	if got := offered(prompt); len(got) != 1 || strings.Contains(resp.Message, "範囲を広げて") {
+		t.Errorf("expected just the nearby spot without widening, got %v, %q", got, resp.Message)
+	}
+
+	// 10km widens by half each step until 76km brings in the third spot.
+	server.MinCandidatePool = 3
+	resp, prompt = recommend("user-b")
+	if got := offered(prompt); len(got) != 3 {
+		t.Errorf("expected all three spots after widening, got %v", got)
+	}
+	if !strings.HasSuffix(resp.Message, relaxedNote(10*1.5*1.5*1.5*1.5*1.5)) {
+		t.Errorf("expected the widening noted, got %q", resp.Message)
+	}
+
+	// The ceiling stops it short.
+	server.MaxRelaxedDistanceKm = 40
+	resp, prompt = recommend("user-c")
+	if got := offered(prompt); len(got) != 2 {
+		t.Errorf("expected two spots within the 40km ceiling, got %v", got)
+	}
+	if !strings.HasSuffix(resp.Message, relaxedNote(40)) {
+		t.Errorf("expected widening to 40km noted, got %q", resp.Message)
+	}
+}
+
+func TestRelaxedDistances(t *testing.T) {
+	s := &Server{MinCandidatePool: 5, MaxRelaxedDistanceKm: 50}
+	got := s.relaxedDistances(20)
+	if fmt.Sprint(got) != "[30 45 50]" {
+		t.Errorf("unexpected steps %v", got)
+	}
+	if got := s.relaxedDistances(50); len(got) != 0 {
+		t.Errorf("expected no steps at the ceiling, got %v", got)
+	}
+	s.MinCandidatePool = 0
+	if got := s.relaxedDistances(20); len(got) != 0 {
+		t.Errorf("expected no steps when disabled, got %v", got)
+	}
+}
+
+func TestRecommendAreaBeforeWidening(t *testing.T) {
+	server, _ := newTestServer(t)
+	req := RecommendRequest{Lat: 35.0, Lng: 139.0, MaxDistanceKm: 10}
+	want := server.areaAround(req.Lat, req.Lng, 10)
+	for _, pool := range []int{0, 3} {
+		server.MinCandidatePool = pool
+		if got := server.recommendArea(req); got != want {
+			t.Errorf("MinCandidatePool %d: expected the requested 10km area, got %+v", pool, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package srv
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultLocale is used when Server.Locale is empty or unknown.
+const defaultLocale = "ja"
+
+// defaultCategoryLabels maps locale -> category -> display label. It is the
+// single source for labels used in prompts and exposed to the UI.
+var defaultCategoryLabels = map[string]map[string]string{
+	"ja": {
+		"drive":      "ドライブスポット",
+		"restaurant": "食事",
+		"rest":       "休憩所",
+	},
+	"en": {
+		"drive":      "Scenic drive",
+		"restaurant": "Restaurant",
+		"rest":       "Rest stop",
+	},
+}
+
+// categoryLabels returns the label table for the configured locale.
+func (s *Server) categoryLabels() map[string]string {
+	labels := s.CategoryLabels
+	if labels == nil {
+		labels = defaultCategoryLabels
+	}
+	if l, ok := labels[s.Locale]; ok {
+		return l
+	}
+	return labels[defaultLocale]
+}
+
+// categoryLabel returns the display label for category, or the category
+// itself when no label is configured.
+func (s *Server) categoryLabel(category string) string {
+	if label, ok := s.categoryLabels()[category]; ok {
+		return label
+	}
+	return category
+}
+
+// categoryAliases maps spellings seen in imports and client input to their
+// category. Keys are lower case; the locale labels are accepted too.
+var categoryAliases = map[string]string{
+	"scenic":      "drive",
+	"sightseeing": "drive",
+	"viewpoint":   "drive",
+	"ドライブ":        "drive",
+	"景勝地":         "drive",
+	"観光":          "drive",
+	"絶景":          "drive",
+	"food":        "restaurant",
+	"meal":        "restaurant",
+	"dining":      "restaurant",
+	"レストラン":       "restaurant",
+	"グルメ":         "restaurant",
+	"飲食店":         "restaurant",
+	"cafe":        "rest",
+	"café":        "rest",
+	"break":       "rest",
+	"rest area":   "rest",
+	"rest stop":   "rest",
+	"休憩":          "rest",
+	"カフェ":         "rest",
+	"道の駅":         "rest",
+	"サービスエリア":     "rest",
+	"パーキングエリア":    "rest",
+}
+
+// normalizeCategory maps a category as typed or imported ("Drive",
+// "食事", "RESTAURANT", "rest_area") to drive, restaurant or rest. ok is
+// false for anything it doesn't recognize.
+func normalizeCategory(category string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(category))
+	key = strings.Join(strings.FieldsFunc(key, func(r rune) bool {
+		return r == '_' || r == '-' || unicode.IsSpace(r)
+	}), " ")
+	if validCategories[key] {
+		return key, true
+	}
+	if cat, ok := categoryAliases[key]; ok {
+		return cat, true
+	}
+	for _, labels := range defaultCategoryLabels {
+		for cat, label := range labels {
+			if strings.ToLower(label) == key {
+				return cat, true
+			}
+		}
+	}
+	return "", false
+}
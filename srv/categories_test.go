@@ -0,0 +1,93 @@
+package srv
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPromptCategoryLabels(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		want   string
+		absent string
+	}{
+		{locale: "", want: "(ドライブスポット)", absent: "(drive)"},
+		{locale: "ja", want: "(ドライブスポット)", absent: "Scenic drive"},
+		{locale: "en", want: "(Scenic drive)", absent: "(ドライブスポット)"},
+		{locale: "fr", want: "(ドライブスポット)", absent: "Scenic drive"},
+	} {
+		t.Run(tc.locale, func(t *testing.T) {
+			server, llm := newTestServer(t)
+			server.Locale = tc.locale
+			spot := seedSpot(t, server, "峠の展望台", "drive", 35.1, 139.0)
+			llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, spot.ID)
+
+			postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+			prompt := llm.lastPrompt()
+			if !strings.Contains(prompt, tc.want) {
+				t.Errorf("expected prompt to contain %q, got:\n%s", tc.want, prompt)
+			}
+			if strings.Contains(prompt, tc.absent) {
+				t.Errorf("expected prompt not to contain %q", tc.absent)
+			}
+		})
+	}
+
+	t.Run("custom labels", func(t *testing.T) {
+		server, _ := newTestServer(t)
+		server.Locale = "en"
+		server.CategoryLabels = map[string]map[string]string{"en": {"drive": "Joyride"}}
+		if got := server.categoryLabel("drive"); got != "Joyride" {
+			t.Errorf("expected configured label, got %q", got)
+		}
+		if got := server.categoryLabel("rest"); got != "rest" {
+			t.Errorf("expected raw category for missing label, got %q", got)
+		}
+	})
+}
+
+func TestNormalizeCategory(t *testing.T) {
+	for in, want := range map[string]string{
+		"drive":        "drive",
+		" Drive ":      "drive",
+		"RESTAURANT":   "restaurant",
+		"食事":           "restaurant",
+		"Scenic drive": "drive",
+		"rest_area":    "rest",
+		"Rest-Stop":    "rest",
+		"道の駅":          "rest",
+		"休憩所":          "rest",
+	} {
+		if got, ok := normalizeCategory(in); !ok || got != want {
+			t.Errorf("normalizeCategory(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "bar", "hotel", "drive-in"} {
+		if got, ok := normalizeCategory(in); ok {
+			t.Errorf("expected %q to be rejected, got %q", in, got)
+		}
+	}
+}
+
+func TestParseOverpassCategoryTag(t *testing.T) {
+	spots, skipped, err := parseOverpass(strings.NewReader(`{"elements": [
+		{"type": "node", "id": 1, "lat": 35.1, "lon": 139.1, "tags": {"name": "峠", "category": "Drive"}},
+		{"type": "node", "id": 2, "lat": 35.2, "lon": 139.2, "tags": {"name": "そば処", "category": "食事", "tourism": "viewpoint"}},
+		{"type": "node", "id": 3, "lat": 35.3, "lon": 139.3, "tags": {"name": "PA", "category": "REST_AREA"}},
+		{"type": "node", "id": 4, "lat": 35.4, "lon": 139.4, "tags": {"name": "ホテル", "category": "hotel", "tourism": "viewpoint"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("expected the unknown category to be skipped, got %d skipped", skipped)
+	}
+	var got []string
+	for _, sp := range spots {
+		got = append(got, sp.Category)
+	}
+	if strings.Join(got, ",") != "drive,restaurant,rest" {
+		t.Errorf("expected normalized categories, got %v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Defaults applied to requests that leave these fields out.
+const (
+	defaultMaxDistanceKm = 100 // recommend: max one-way distance
+	defaultMaxTimeHours  = 3   // recommend: max one-way driving time
+	defaultDepartureTime = "10:00"
+)
+
+// PublicConfig is the non-sensitive configuration the UI needs to stay in
+// sync with the server. Never add credentials, endpoints or admin lists.
+type PublicConfig struct {
+	Locale         string            `json:"locale"`
+	CategoryLabels map[string]string `json:"category_labels"`
+	Defaults       ConfigDefaults    `json:"defaults"`
+	Units          ConfigUnits       `json:"units"`
+	Features       ConfigFeatures    `json:"features"`
+}
+
+type ConfigDefaults struct {
+	MaxDistanceKm float64 `json:"max_distance_km"`
+	MaxTimeHours  float64 `json:"max_time_hours"`
+	DepartureTime string  `json:"departure_time"`
+}
+
+type ConfigUnits struct {
+	Distance string `json:"distance"`
+	Duration string `json:"duration"`
+}
+
+type ConfigFeatures struct {
+	AI        bool `json:"ai"`        // AI picks spots and builds routes
+	Weather   bool `json:"weather"`   // recommend accepts "weather"
+	Geocoding bool `json:"geocoding"` // new spots may omit coordinates
+}
+
+// HandleConfig returns the PublicConfig.
+func (s *Server) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PublicConfig{
+		Locale:         s.Locale,
+		CategoryLabels: s.categoryLabels(),
+		Defaults: ConfigDefaults{
+			MaxDistanceKm: defaultMaxDistanceKm,
+			MaxTimeHours:  defaultMaxTimeHours,
+			DepartureTime: defaultDepartureTime,
+		},
+		Units: ConfigUnits{Distance: "km", Duration: "min"},
+		Features: ConfigFeatures{
+			AI:        s.LLM != nil,
+			Weather:   true,
+			Geocoding: s.Geocoder != nil,
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublicConfig(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.Locale = "en"
+	server.AdminEmails = []string{"admin@example.com"}
+	server.TLSKeyFile = "/etc/drive/secret-key.pem"
+	server.Geocoder = NewNominatimGeocoder("https://geo.internal.example")
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+
+	var cfg PublicConfig
+	if err := json.Unmarshal([]byte(body), &cfg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cfg.Locale != "en" || cfg.CategoryLabels["drive"] != "Scenic drive" || len(cfg.CategoryLabels) != 3 {
+		t.Errorf("unexpected labels %q %v", cfg.Locale, cfg.CategoryLabels)
+	}
+	if cfg.Defaults.MaxDistanceKm != 100 || cfg.Defaults.MaxTimeHours != 3 || cfg.Defaults.DepartureTime != "10:00" {
+		t.Errorf("unexpected defaults %+v", cfg.Defaults)
+	}
+	if cfg.Units.Distance != "km" || cfg.Units.Duration != "min" {
+		t.Errorf("unexpected units %+v", cfg.Units)
+	}
+	if !cfg.Features.AI || !cfg.Features.Weather || !cfg.Features.Geocoding {
+		t.Errorf("unexpected features %+v", cfg.Features)
+	}
+
+	var raw map[string]any
+	json.Unmarshal([]byte(body), &raw)
+	if len(raw) != 5 {
+		t.Errorf("expected exactly 5 top-level keys, got %v", raw)
+	}
+	for _, secret := range []string{"admin@example.com", "secret-key", "geo.internal", "169.254.169.254", "test-hostname", "sqlite"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config leaks %q: %s", secret, body)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package srv
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRecommendCooldownKm treats origins within 500m as the same place,
+// about the drift of a phone's location while parked.
+const defaultRecommendCooldownKm = 0.5
+
+// cooldownNote is added to a recommendation served again from the cooldown.
+const cooldownNote = "少し前に近い場所でおすすめを出したばかりのため、前回と同じ結果を表示しています。"
+
+// recommendCooldown remembers each user's last recommendation so a repeat
+// request for nearly the same place within Server.RecommendCooldown gets it
+// again instead of another AI call.
+type recommendCooldown struct {
+	mu   sync.Mutex
+	last map[string]cooledRecommendation // by user ID
+}
+
+type cooledRecommendation struct {
+	req  RecommendRequest
+	resp RecommendResponse
+	at   time.Time
+}
+
+// cooledRecommendation returns userID's previous response if req repeats it:
+// the same options from the same place, less than RecommendCooldown ago.
+// Origins are the same place when they share a cache key (see
+// recommendCacheKey) or are within RecommendCooldownKm of each other.
+func (s *Server) cooledRecommendation(userID string, req RecommendRequest) (RecommendResponse, bool) {
+	if s.RecommendCooldown <= 0 {
+		return RecommendResponse{}, false
+	}
+	s.cooldown.mu.Lock()
+	prev, ok := s.cooldown.last[userID]
+	s.cooldown.mu.Unlock()
+	if !ok || time.Since(prev.at) >= s.RecommendCooldown {
+		return RecommendResponse{}, false
+	}
+	if s.recommendCacheKey(userID, prev.req) != s.recommendCacheKey(userID, req) {
+		// Everything but the origin must match exactly; pointers by value,
+		// as each request is decoded separately.
+		moved := s.distanceKm(prev.req.Lat, prev.req.Lng, req.Lat, req.Lng)
+		prevOpts, opts := prev.req, req
+		prevOpts.Lat, prevOpts.Lng, opts.Lat, opts.Lng = 0, 0, 0, 0
+		prevOpts.MaxSpotFee, opts.MaxSpotFee = nil, nil
+		if prevOpts != opts || !equalPtr(prev.req.MaxSpotFee, req.MaxSpotFee) || moved > s.RecommendCooldownKm {
+			return RecommendResponse{}, false
+		}
+	}
+
+	resp := prev.resp
+	resp.Note = cooldownNote
+	return resp, true
+}
+
+// rememberRecommendation records resp as userID's latest recommendation,
+// dropping other users' expired ones.
+func (s *Server) rememberRecommendation(userID string, req RecommendRequest, resp RecommendResponse) {
+	if s.RecommendCooldown <= 0 {
+		return
+	}
+	now := time.Now()
+	s.cooldown.mu.Lock()
+	defer s.cooldown.mu.Unlock()
+	if s.cooldown.last == nil {
+		s.cooldown.last = make(map[string]cooledRecommendation)
+	}
+	for id, prev := range s.cooldown.last {
+		if now.Sub(prev.at) >= s.RecommendCooldown {
+			delete(s.cooldown.last, id)
+		}
+	}
+	s.cooldown.last[userID] = cooledRecommendation{req: req, resp: resp, at: now}
+}
@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecommendCooldown(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.RecommendCooldown = 2 * time.Minute
+	a := seedSpot(t, server, "渓谷", "drive", 35.1, 139.0)
+	b := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, %d], "message": "おすすめです"}`, a.ID, b.ID)
+
+	recommend := func(user string, req RecommendRequest) RecommendResponse {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", user, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	origin := RecommendRequest{Lat: 35.0, Lng: 139.0}
+
+	first := recommend("user-a", origin)
+	if first.Note != "" || llm.calls() != 1 {
+		t.Fatalf("expected a fresh recommendation, got note %q after %d calls", first.Note, llm.calls())
+	}
+
+	// ~200m away, a moment later: the same set again without the AI.
+	nearby := RecommendRequest{Lat: 35.0018, Lng: 139.0}
+	again := recommend("user-a", nearby)
+	if llm.calls() != 1 {
+		t.Errorf("expected no AI call within the cooldown, got %d calls", llm.calls())
+	}
+	if again.Note != cooldownNote || len(again.Spots) != len(first.Spots) || again.Spots[0].ID != first.Spots[0].ID || again.Message != first.Message {
+		t.Errorf("expected the previous set with a note, got %+v", again)
+	}
+
+	// Options behind pointers match by value.
+	fee := int64(500)
+	recommend("user-c", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxSpotFee: &fee})
+	calls := llm.calls()
+	sameFee := fee
+	if resp := recommend("user-c", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxSpotFee: &sameFee}); resp.Note != cooldownNote || llm.calls() != calls {
+		t.Errorf("expected the same max_spot_fee to hit the cooldown, got note %q", resp.Note)
+	}
+	otherFee := int64(1000)
+	if resp := recommend("user-c", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxSpotFee: &otherFee}); resp.Note != "" || llm.calls() != calls+1 {
+		t.Errorf("expected a different max_spot_fee to be a new request, got note %q", resp.Note)
+	}
+
+	// A different place, different options or a different user is a new request.
+	for _, tc := range []struct {
+		user string
+		req  RecommendRequest
+	}{
+		{"user-a", RecommendRequest{Lat: 35.01, Lng: 139.0}}, // ~1.1km away
+		{"user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, Category: "drive"}},
+		{"user-b", origin},
+	} {
+		calls := llm.calls()
+		if resp := recommend(tc.user, tc.req); resp.Note != "" || llm.calls() != calls+1 {
+			t.Errorf("%s %+v: expected a fresh recommendation, got note %q", tc.user, tc.req, resp.Note)
+		}
+	}
+
+	// Outside the cooldown the AI is asked again.
+	recommend("user-a", origin)
+	server.cooldown.mu.Lock()
+	prev := server.cooldown.last["user-a"]
+	prev.at = prev.at.Add(-server.RecommendCooldown)
+	server.cooldown.last["user-a"] = prev
+	server.cooldown.mu.Unlock()
+	calls = llm.calls()
+	if resp := recommend("user-a", origin); resp.Note != "" || llm.calls() != calls+1 {
+		t.Errorf("expected a fresh recommendation after the cooldown, got note %q", resp.Note)
+	}
+
+	// Zero disables the cooldown.
+	server.RecommendCooldown = 0
+	calls = llm.calls()
+	recommend("user-a", origin)
+	if resp := recommend("user-a", origin); resp.Note != "" || llm.calls() != calls+2 {
+		t.Errorf("expected every request to reach the AI without a cooldown, got note %q", resp.Note)
+	}
+}
@@ -0,0 +1,23 @@
+package srv
+
+import "math"
+
+// defaultCoordinatePrecision keeps about 10cm of precision, well below
+// DuplicateRadiusKm.
+const defaultCoordinatePrecision = 6
+
+// roundCoords rounds a spot's coordinates to CoordinatePrecision decimal
+// places before they are stored, so the same place typed with different
+// precision is stored the same way.
+func (s *Server) roundCoords(lat, lng float64) (float64, float64) {
+	if s.CoordinatePrecision <= 0 {
+		return lat, lng
+	}
+	return roundTo(lat, s.CoordinatePrecision), roundTo(lng, s.CoordinatePrecision)
+}
+
+// roundTo rounds v to places decimal places.
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow10(places)
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,65 @@
+package srv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Crowd levels, as stored per hour in a spot's crowd_by_hour.
+const (
+	CrowdLow      = 1
+	CrowdModerate = 2
+	CrowdHigh     = 3
+)
+
+// crowdLabels name the crowd levels for RouteStop.CrowdLevel.
+var crowdLabels = map[int]string{
+	CrowdLow:      "low",
+	CrowdModerate: "moderate",
+	CrowdHigh:     "high",
+}
+
+// parseCrowdByHour parses 24 comma-separated crowd levels, the first for
+// 00:00-01:00.
+func parseCrowdByHour(v string) ([24]int, error) {
+	var levels [24]int
+	parts := strings.Split(v, ",")
+	if len(parts) != len(levels) {
+		return levels, fmt.Errorf("crowd_by_hour must have %d comma-separated levels, got %d", len(levels), len(parts))
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < CrowdLow || n > CrowdHigh {
+			return levels, fmt.Errorf("crowd_by_hour level %q at %02d:00 must be %d to %d", part, i, CrowdLow, CrowdHigh)
+		}
+		levels[i] = n
+	}
+	return levels, nil
+}
+
+// crowdAt returns how crowded spot usually is at arrival (minutes after the
+// departure day's midnight, possibly past 24:00). ok is false for spots
+// without crowd data.
+func crowdAt(spot dbgen.Spot, arrival int) (level int, ok bool) {
+	if spot.CrowdByHour == nil {
+		return 0, false
+	}
+	levels, err := parseCrowdByHour(*spot.CrowdByHour)
+	if err != nil {
+		return 0, false
+	}
+	return levels[arrival%(24*60)/60], true
+}
+
+// crowdLabel is the crowd level expected at spot on arrival, empty without
+// crowd data.
+func crowdLabel(spot dbgen.Spot, arrival int) string {
+	level, ok := crowdAt(spot, arrival)
+	if !ok {
+		return ""
+	}
+	return crowdLabels[level]
+}
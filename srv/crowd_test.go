@@ -0,0 +1,68 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRouteAvoidsCrowds(t *testing.T) {
+	server, llm := newTestServer(t)
+	// Packed all morning, quiet from noon
+	crowds := strings.Repeat("3,", 12) + strings.TrimSuffix(strings.Repeat("1,", 12), ",")
+	market := seedSpot(t, server, "朝市", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET crowd_by_hour = ? WHERE id = ?", crowds, market.ID)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.00, 139.05)
+	falls := seedSpot(t, server, "渓谷の滝", "drive", 35.05, 139.05)
+
+	b, _ := json.Marshal(map[string]any{
+		"route_ids":      []int64{market.ID, lake.ID, falls.ID},
+		"stay_durations": []int{30, 60, 60},
+		"message":        "ok",
+	})
+	llm.response = string(b)
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "10:00"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	stops := resp.Stops[1 : len(resp.Stops)-1]
+	if len(stops) != 3 {
+		t.Fatalf("expected 3 stops, got %+v", resp.Stops)
+	}
+	last := stops[len(stops)-1]
+	if last.ID != market.ID {
+		t.Fatalf("expected the crowded spot moved to the afternoon, got %+v", stops)
+	}
+	if last.CrowdLevel != "low" || last.ArrivalTime < "12:00" {
+		t.Errorf("expected a quiet afternoon arrival, got %+v", last)
+	}
+	if last.stayMinutes() != 30 {
+		t.Errorf("expected the stay to move with the stop, got %d", last.stayMinutes())
+	}
+	for _, stop := range stops[:2] {
+		if stop.CrowdLevel != "" {
+			t.Errorf("expected no crowd level on %s, got %+v", stop.Name, stop)
+		}
+	}
+}
+
+func TestCreateSpotCrowdValidation(t *testing.T) {
+	server, _ := newTestServer(t)
+	lat, lng := 35.0, 139.0
+	for _, bad := range []string{"1,2,3", strings.Repeat("4,", 23) + "4", strings.Repeat("x,", 23) + "1"} {
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "朝市", Category: "drive", Latitude: &lat, Longitude: &lng, CrowdByHour: &bad})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("crowd_by_hour %q: expected 400, got %d", bad, w.Code)
+		}
+	}
+	good := strings.TrimSuffix(strings.Repeat("2,", 24), ",")
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "朝市", Category: "drive", Latitude: &lat, Longitude: &lng, CrowdByHour: &good})
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected valid crowd data accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// dbRetryAttempts and dbRetryDelay bound how long a request waits out a
+	// busy database: tries at 0, 50 and 150ms on top of busy_timeout.
+	dbRetryAttempts = 3
+	dbRetryDelay    = 50 * time.Millisecond
+
+	// dbRetryAfter is the Retry-After hint, in seconds, once retries fail.
+	dbRetryAfter = 5
+)
+
+// SQLite result codes for another connection holding a lock.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// isTransientDBError reports whether err is SQLite being busy or locked,
+// which clears up once the other writer finishes.
+func isTransientDBError(err error) bool {
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return false
+	}
+	// Extended codes carry the primary code in the low byte.
+	code := coded.Code() & 0xff
+	return code == sqliteBusy || code == sqliteLocked
+}
+
+// retryTransient calls fn until it succeeds, fails permanently, or has
+// failed transiently dbRetryAttempts times.
+func retryTransient[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var v T
+	var err error
+	for attempt := 1; ; attempt++ {
+		v, err = fn()
+		if err == nil || !isTransientDBError(err) || attempt == dbRetryAttempts {
+			return v, err
+		}
+		slog.Info("database busy; retrying", "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return v, err
+		case <-time.After(time.Duration(attempt) * dbRetryDelay):
+		}
+	}
+}
+
+// Unavailable is the 503 response when the database is temporarily busy.
+type Unavailable struct {
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retry_after"` // seconds
+}
+
+// writeDBError responds to a failed query: 503 with Retry-After for a busy
+// database, 500 otherwise.
+func writeDBError(w http.ResponseWriter, err error) {
+	if !isTransientDBError(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Warn("database unavailable", "error", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(dbRetryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(Unavailable{
+		Error:      "混み合っています。しばらくしてからもう一度お試しください。",
+		RetryAfter: dbRetryAfter,
+	})
+}
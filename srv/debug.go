@@ -0,0 +1,69 @@
+package srv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+)
+
+// requireDebug hides next behind a 404 unless Server.DebugMode is set.
+func (s *Server) requireDebug(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.DebugMode {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PayloadSizes reports how large a spots listing is on the wire.
+type PayloadSizes struct {
+	SpotCount int     `json:"spot_count"`
+	RawBytes  int     `json:"raw_bytes"`
+	GzipBytes int     `json:"gzip_bytes"`
+	GzipRatio float64 `json:"gzip_ratio"`
+}
+
+// HandleDebugSizes reports the serialized size of GET /api/spots with the
+// same query string, raw and gzipped, to help decide whether pagination or
+// compression is worthwhile.
+func (s *Server) HandleDebugSizes(w http.ResponseWriter, r *http.Request) {
+	search, err := s.parseSpotSearch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spots, n, _, err := s.searchSpots(r.Context(), search)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Encode exactly as HandleGetSpots does
+	var raw bytes.Buffer
+	if err := json.NewEncoder(&raw).Encode(spots); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(raw.Bytes())
+	if err := zw.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sizes := PayloadSizes{
+		SpotCount: n,
+		RawBytes:  raw.Len(),
+		GzipBytes: gz.Len(),
+	}
+	if sizes.RawBytes > 0 {
+		sizes.GzipRatio = float64(sizes.GzipBytes) / float64(sizes.RawBytes)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sizes)
+}
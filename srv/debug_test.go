@@ -0,0 +1,57 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugSizes(t *testing.T) {
+	server, _ := newTestServer(t)
+	for i := 0; i < 50; i++ {
+		seedSpot(t, server, fmt.Sprintf("スポット%d", i), "drive", 35+float64(i)/100, 139)
+	}
+	// Not listed, so not measured either.
+	pending := seedSpot(t, server, "審査中のスポット", "drive", 36, 139)
+	mustExec(t, server, "UPDATE spots SET status = ? WHERE id = ?", SpotPending, pending.ID)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/api/debug/sizes"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 outside debug mode, got %d", w.Code)
+	}
+
+	server.DebugMode = true
+	w := get("/api/debug/sizes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var sizes PayloadSizes
+	if err := json.Unmarshal(w.Body.Bytes(), &sizes); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	raw := get("/api/spots").Body.Len()
+	if sizes.SpotCount != 50 || sizes.RawBytes != raw {
+		t.Errorf("expected 50 spots / %d raw bytes, got %+v", raw, sizes)
+	}
+	// Repetitive JSON compresses well.
+	if sizes.GzipBytes <= 0 || sizes.GzipBytes >= sizes.RawBytes/2 {
+		t.Errorf("implausible gzip size %d for %d raw bytes", sizes.GzipBytes, sizes.RawBytes)
+	}
+	if sizes.GzipRatio <= 0 || sizes.GzipRatio >= 0.5 {
+		t.Errorf("implausible gzip ratio %v", sizes.GzipRatio)
+	}
+
+	// The query string filters and pages the listing as for GET /api/spots.
+	w = get("/api/debug/sizes?category=drive&limit=10")
+	if err := json.Unmarshal(w.Body.Bytes(), &sizes); err != nil || sizes.SpotCount != 10 {
+		t.Errorf("expected 10 spots, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+package srv
+
+import (
+	"fmt"
+	"time"
+)
+
+// PastDeparture selects what happens to a route request whose departure
+// time has already passed today.
+type PastDeparture string
+
+const (
+	// PastDepartureAsIs schedules the route at the requested time anyway.
+	// The default.
+	PastDepartureAsIs PastDeparture = "as-is"
+	// PastDepartureNextDay schedules the route at the requested time
+	// tomorrow; the response says so with departs_next_day.
+	PastDepartureNextDay PastDeparture = "next-day"
+	// PastDepartureNow moves the departure up to the current time.
+	PastDepartureNow PastDeparture = "now"
+	// PastDepartureReject refuses the request with 400.
+	PastDepartureReject PastDeparture = "reject"
+)
+
+// defaultTimeZone is Japan's, where the app's users drive. Japan has no
+// daylight saving time, so a fixed offset stands in when the time zone
+// database is missing.
+var defaultTimeZone = func() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Tokyo"); err == nil {
+		return loc
+	}
+	return time.FixedZone("Asia/Tokyo", 9*60*60)
+}()
+
+// now is the current time in s.TimeZone, from s.Now if set.
+func (s *Server) now() time.Time {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	loc := s.TimeZone
+	if loc == nil {
+		loc = defaultTimeZone
+	}
+	return now.In(loc)
+}
+
+// resolvePastDeparture applies s.PastDeparture to req's departure time if
+// it is earlier in the day than now in s.TimeZone, where departure times
+// are wall-clock times. Requests without a departure time are left alone.
+func (s *Server) resolvePastDeparture(req RouteRequest) (RouteRequest, error) {
+	dep, ok := parseClock(req.DepartureTime)
+	if !ok {
+		return req, nil
+	}
+	now := s.now()
+	nowMin := now.Hour()*60 + now.Minute()
+	if dep >= nowMin {
+		return req, nil
+	}
+	switch s.PastDeparture {
+	case PastDepartureNextDay:
+		req.nextDay = true
+	case PastDepartureNow:
+		req.DepartureTime = minutesToTime(nowMin)
+	case PastDepartureReject:
+		return req, fmt.Errorf("departure_time %s has already passed (now %s)", req.DepartureTime, minutesToTime(nowMin))
+	}
+	return req, nil
+}
@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPastDeparture(t *testing.T) {
+	server, llm := newTestServer(t)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.00)
+	// 13:20 in Japan, on a host keeping UTC
+	server.Now = func() time.Time { return time.Date(2026, 5, 1, 4, 20, 0, 0, time.UTC) }
+
+	route := func(mode PastDeparture, dep string) (RouteResponse, int) {
+		t.Helper()
+		server.PastDeparture = mode
+		llm.response = fmt.Sprintf(`{"route_ids": [%d], "message": "ok"}`, lake.ID)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: dep})
+		var resp RouteResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return resp, w.Code
+	}
+
+	for _, tc := range []struct {
+		mode     PastDeparture
+		wantCode int
+		wantDep  string
+		nextDay  bool
+	}{
+		{PastDepartureAsIs, http.StatusOK, "09:00", false},
+		{PastDepartureNextDay, http.StatusOK, "09:00", true},
+		{PastDepartureNow, http.StatusOK, "13:20", false},
+		{PastDepartureReject, http.StatusBadRequest, "", false},
+	} {
+		resp, code := route(tc.mode, "09:00")
+		if code != tc.wantCode {
+			t.Errorf("%s: expected %d, got %d", tc.mode, tc.wantCode, code)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if resp.DepartureTime != tc.wantDep || resp.Stops[0].DepartureTime != tc.wantDep || resp.DepartsNextDay != tc.nextDay {
+			t.Errorf("%s: expected departure %s (next day %v), got %s (next day %v)", tc.mode, tc.wantDep, tc.nextDay, resp.DepartureTime, resp.DepartsNextDay)
+		}
+	}
+
+	// A departure still to come is left alone
+	resp, code := route(PastDepartureReject, "15:00")
+	if code != http.StatusOK || resp.DepartureTime != "15:00" || resp.DepartsNextDay {
+		t.Errorf("expected a later departure kept, got %d %+v", code, resp)
+	}
+
+	// Departure times are read in the configured time zone, not the host's:
+	// at 08:00 in Japan a 09:00 departure is still to come.
+	server.Now = func() time.Time { return time.Date(2026, 4, 30, 23, 0, 0, 0, time.UTC) }
+	if _, code := route(PastDepartureReject, "09:00"); code != http.StatusOK {
+		t.Errorf("expected 09:00 still to come at 08:00 JST, got %d", code)
+	}
+	server.TimeZone = time.UTC
+	if _, code := route(PastDepartureReject, "09:00"); code != http.StatusBadRequest {
+		t.Errorf("expected 09:00 passed at 23:00 UTC, got %d", code)
+	}
+}
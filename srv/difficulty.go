@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"fmt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Driving difficulty of the roads to a spot. Spots without one are easy.
+const (
+	DifficultyEasy     = 1
+	DifficultyModerate = 2 // narrow or winding roads
+	DifficultyHard     = 3 // steep mountain roads, single lane
+)
+
+// difficultyLabels name the levels in prompts.
+var difficultyLabels = map[int]string{
+	DifficultyEasy:     "易",
+	DifficultyModerate: "中",
+	DifficultyHard:     "難",
+}
+
+func validateDifficulty(name string, level int) error {
+	if level < DifficultyEasy || level > DifficultyHard {
+		return fmt.Errorf("%s must be %d (easy), %d (moderate) or %d (hard), got %d", name, DifficultyEasy, DifficultyModerate, DifficultyHard, level)
+	}
+	return nil
+}
+
+// validateMaxDifficulty accepts a request's max_difficulty; zero means any.
+func validateMaxDifficulty(max int) error {
+	if max == 0 {
+		return nil
+	}
+	return validateDifficulty("max_difficulty", max)
+}
+
+// spotDifficulty is the spot's difficulty, easy when unknown.
+func spotDifficulty(spot dbgen.Spot) int {
+	if spot.Difficulty == nil {
+		return DifficultyEasy
+	}
+	return int(*spot.Difficulty)
+}
+
+// withinDifficulty reports whether spot is no harder than max; zero allows
+// any spot.
+func withinDifficulty(spot dbgen.Spot, max int) bool {
+	return max == 0 || spotDifficulty(spot) <= max
+}
+
+// difficultyTag marks spots harder than easy in a prompt, e.g.
+// " [運転難度:難]".
+func difficultyTag(spot dbgen.Spot) string {
+	if d := spotDifficulty(spot); d > DifficultyEasy {
+		return " [運転難度:" + difficultyLabels[d] + "]"
+	}
+	return ""
+}
+
+// difficultyRule tells the AI the hardest roads the driver accepts; empty
+// without a limit or when every spot is allowed.
+func difficultyRule(max int) string {
+	if max == 0 || max >= DifficultyHard {
+		return ""
+	}
+	if max == DifficultyEasy {
+		return "運転に不慣れなため、[運転難度]の付いたスポットは選ばない"
+	}
+	return "運転に不慣れなため、[運転難度:" + difficultyLabels[DifficultyHard] + "]のスポットは選ばない"
+}
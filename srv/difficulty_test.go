@@ -0,0 +1,89 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDifficultyFilter(t *testing.T) {
+	server, llm := newTestServer(t)
+	flat := seedSpot(t, server, "海辺の公園", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET difficulty = 1 WHERE id = ?", flat.ID)
+	winding := seedSpot(t, server, "つづら折りの峠", "drive", 35.00, 139.05)
+	mustExec(t, server, "UPDATE spots SET difficulty = 2 WHERE id = ?", winding.ID)
+	pass := seedSpot(t, server, "酷道の秘境", "drive", 35.05, 139.05)
+	mustExec(t, server, "UPDATE spots SET difficulty = 3 WHERE id = ?", pass.ID)
+	unknown := seedSpot(t, server, "謎の滝", "drive", 35.02, 139.02)
+	server.MaxRecommendations = 4
+
+	recommended := func(max int) []int64 {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{"spot_ids": []int64{flat.ID, winding.ID, pass.ID, unknown.ID}, "message": "ok"})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxDifficulty: max})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		var ids []int64
+		for _, sp := range resp.Spots {
+			ids = append(ids, sp.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	sorted := func(ids ...int64) []int64 {
+		slices.Sort(ids)
+		return ids
+	}
+
+	t.Run("recommend", func(t *testing.T) {
+		if got := recommended(DifficultyEasy); !slices.Equal(got, sorted(flat.ID, unknown.ID)) {
+			t.Errorf("expected only easy spots and those of unknown difficulty, got %v", got)
+		}
+		prompt := llm.lastPrompt()
+		if strings.Contains(prompt, winding.Name) || strings.Contains(prompt, pass.Name) || !strings.Contains(prompt, "[運転難度]の付いたスポットは選ばない") {
+			t.Errorf("expected only easy candidates and the rule, got:\n%s", prompt)
+		}
+		if got := recommended(DifficultyModerate); !slices.Equal(got, sorted(flat.ID, winding.ID, unknown.ID)) {
+			t.Errorf("expected the hard spot excluded, got %v", got)
+		}
+		if prompt := llm.lastPrompt(); !strings.Contains(prompt, "[運転難度:中]") {
+			t.Errorf("expected the moderate spot tagged, got:\n%s", prompt)
+		}
+		if got := recommended(0); len(got) != 4 {
+			t.Errorf("expected no filtering without a limit, got %v", got)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, flat.ID, pass.ID)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MaxDifficulty: DifficultyModerate})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		for _, stop := range resp.Stops {
+			if stop.ID == pass.ID {
+				t.Errorf("expected the hard spot left out of the route, got %+v", resp.Stops)
+			}
+		}
+		prompt := llm.lastPrompt()
+		if strings.Contains(prompt, pass.Name) || !strings.Contains(prompt, "【道の難しさ】") {
+			t.Errorf("expected the hard spot left out of the prompt and the rule, got:\n%s", prompt)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		if w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxDifficulty: 4}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for max_difficulty 4, got %d", w.Code)
+		}
+		if w := postJSON(t, server, "/api/spots", "user-a", map[string]any{"name": "崖", "category": "drive", "latitude": 35.1, "longitude": 139.1, "difficulty": 0}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for difficulty 0, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package srv
+
+import "math"
+
+// DistanceMode selects how DistanceEstimator measures straight-line distance.
+type DistanceMode string
+
+const (
+	// GreatCircle is the shortest path over the sphere (haversine).
+	GreatCircle DistanceMode = "great-circle"
+	// Rhumb follows a constant compass bearing; it is never shorter than
+	// the great-circle distance.
+	Rhumb DistanceMode = "rhumb"
+)
+
+// defaultEarthRadiusKm is the mean Earth radius.
+const defaultEarthRadiusKm = 6371
+
+// DistanceEstimator computes distances in km between coordinates. The zero
+// value is a great-circle estimator with the mean Earth radius.
+type DistanceEstimator struct {
+	RadiusKm float64
+	Mode     DistanceMode
+}
+
+// Km returns the distance between (lat1, lon1) and (lat2, lon2).
+func (e DistanceEstimator) Km(lat1, lon1, lat2, lon2 float64) float64 {
+	r := e.RadiusKm
+	if r <= 0 {
+		r = defaultEarthRadiusKm
+	}
+	if e.Mode == Rhumb {
+		return rhumbDistance(r, lat1, lon1, lat2, lon2)
+	}
+	return greatCircleDistance(r, lat1, lon1, lat2, lon2)
+}
+
+// distanceKm measures with the server's configured estimator.
+func (s *Server) distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	return s.Distance.Km(lat1, lon1, lat2, lon2)
+}
+
+// haversine is the great-circle distance in km on the mean Earth radius.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	return greatCircleDistance(defaultEarthRadiusKm, lat1, lon1, lat2, lon2)
+}
+
+func greatCircleDistance(r, lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return r * c
+}
+
+func rhumbDistance(r, lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := phi2 - phi1
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	// Take the shorter way round across the antimeridian
+	if math.Abs(dLambda) > math.Pi {
+		if dLambda > 0 {
+			dLambda -= 2 * math.Pi
+		} else {
+			dLambda += 2 * math.Pi
+		}
+	}
+	// Stretched latitude difference on the Mercator projection
+	dPsi := math.Log(math.Tan(math.Pi/4+phi2/2) / math.Tan(math.Pi/4+phi1/2))
+	q := math.Cos(phi1) // east-west lines have no stretch
+	if math.Abs(dPsi) > 1e-12 {
+		q = dPhi / dPsi
+	}
+	return r * math.Sqrt(dPhi*dPhi+q*q*dLambda*dLambda)
+}
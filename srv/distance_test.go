@@ -0,0 +1,57 @@
+package srv
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceEstimator(t *testing.T) {
+	gc := DistanceEstimator{}
+	rhumb := DistanceEstimator{Mode: Rhumb}
+
+	for _, tc := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		wantGC, wantRhumb      float64
+	}{
+		// Land's End to John o' Groats runs nearly north-south
+		{"lands end", 50.0664, -5.7147, 58.6439, -3.0700, 968.9, 968.9},
+		// Along a meridian and along the equator the two modes agree
+		{"meridian", 35.0, 139.0, 36.0, 139.0, 111.2, 111.2},
+		{"equator", 0, 10, 0, 11, 111.2, 111.2},
+		// Due east along 60N: the great circle cuts across a 41.4 degree arc,
+		// the rhumb line follows the parallel (R * cos 60 * pi/2)
+		{"east at 60N", 60, 0, 60, 90, 4604.5, 5003.8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := gc.Km(tc.lat1, tc.lon1, tc.lat2, tc.lon2); math.Abs(got-tc.wantGC) > 0.1 {
+				t.Errorf("great-circle = %.2f, want %.1f", got, tc.wantGC)
+			}
+			if got := rhumb.Km(tc.lat1, tc.lon1, tc.lat2, tc.lon2); math.Abs(got-tc.wantRhumb) > 0.1 {
+				t.Errorf("rhumb = %.2f, want %.1f", got, tc.wantRhumb)
+			}
+		})
+	}
+
+	t.Run("antimeridian", func(t *testing.T) {
+		if got := rhumb.Km(0, 179.5, 0, -179.5); math.Abs(got-111.2) > 0.1 {
+			t.Errorf("expected the short way round, got %.2f", got)
+		}
+	})
+
+	t.Run("radius", func(t *testing.T) {
+		wgs84 := DistanceEstimator{RadiusKm: 6378.137}
+		got := wgs84.Km(35.0, 139.0, 36.0, 139.0)
+		want := gc.Km(35.0, 139.0, 36.0, 139.0) * 6378.137 / 6371
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("expected distance to scale with radius: got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		server, _ := newTestServer(t)
+		if got, want := server.distanceKm(35.0, 139.0, 35.5, 139.5), haversine(35.0, 139.0, 35.5, 139.5); got != want {
+			t.Errorf("expected great-circle R=6371 by default, got %v want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package srv
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// SpotETA is how long it takes to drive from an origin to a spot.
+type SpotETA struct {
+	SpotID         int64   `json:"spot_id"`
+	DistanceKm     float64 `json:"distance_km"`
+	DrivingTimeMin int     `json:"driving_time_min"`
+	DepartureTime  string  `json:"departure_time"`
+	ArrivalTime    string  `json:"arrival_time"`
+	WaitMinutes    int     `json:"wait_minutes,omitempty"` // arriving before the spot opens
+}
+
+// HandleSpotETA serves
+// GET /api/spots/{id}/eta?lat=&lng=[&depart=HH:MM][&routing_profile=],
+// estimating the drive to one spot the way route legs are estimated.
+// depart defaults to the usual departure time.
+func (s *Server) HandleSpotETA(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || math.Abs(lat) > 90 {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil || math.Abs(lng) > 180 {
+		http.Error(w, "invalid lng", http.StatusBadRequest)
+		return
+	}
+	depart := query.Get("depart")
+	if depart == "" {
+		depart = defaultDepartureTime
+	}
+	depMinutes, ok := parseClock(depart)
+	if !ok {
+		http.Error(w, "depart must be HH:MM", http.StatusBadRequest)
+		return
+	}
+	profile := query.Get("routing_profile")
+	if err := validateRoutingProfile(profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spot, ok := s.loadSpot(w, r)
+	if !ok {
+		return
+	}
+
+	leg := s.estimateLeg(r.Context(), lat, lng, spot.Latitude, spot.Longitude, profile)
+	arrival := depMinutes + leg.Minutes
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SpotETA{
+		SpotID:         spot.ID,
+		DistanceKm:     math.Round(leg.Km*10) / 10,
+		DrivingTimeMin: leg.Minutes,
+		DepartureTime:  minutesToTime(depMinutes),
+		ArrivalTime:    minutesToTime(arrival),
+		WaitMinutes:    openingWait(spot, arrival),
+	})
+}
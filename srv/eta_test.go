@@ -0,0 +1,68 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpotETA(t *testing.T) {
+	server, _ := newTestServer(t)
+	spot := seedSpot(t, server, "岬の灯台", "drive", 35.18, 139.0) // ~20km due north
+
+	eta := func(path string) (*httptest.ResponseRecorder, SpotETA) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp SpotETA
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w, resp
+	}
+	base := fmt.Sprintf("/api/spots/%d/eta?lat=35.0&lng=139.0", spot.ID)
+
+	km := haversine(35.0, 139.0, 35.18, 139.0)
+	w, resp := eta(base + "&depart=09:45")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// 20km at 40km/h is 30 minutes
+	if resp.DistanceKm != 20 || resp.DrivingTimeMin != 30 || resp.DrivingTimeMin != drivingMinutes(km) {
+		t.Errorf("expected 20km and 30 minutes, got %+v", resp)
+	}
+	if resp.DepartureTime != "09:45" || resp.ArrivalTime != "10:15" || resp.WaitMinutes != 0 {
+		t.Errorf("expected to arrive at 10:15, got %+v", resp)
+	}
+
+	_, resp = eta(base)
+	if resp.DepartureTime != defaultDepartureTime || resp.ArrivalTime != "10:30" {
+		t.Errorf("expected the default departure, got %+v", resp)
+	}
+
+	mustExec(t, server, "UPDATE spots SET opening_time = '10:45' WHERE id = ?", spot.ID)
+	if _, resp = eta(base); resp.WaitMinutes != 15 {
+		t.Errorf("expected a 15 minute wait for opening, got %+v", resp)
+	}
+
+	router := &stubEstimator{}
+	server.Router = router
+	if _, resp = eta(base + "&depart=08:00&routing_profile=scenic"); resp.DistanceKm != 10 || resp.ArrivalTime != "08:30" || fmt.Sprint(router.profiles) != "[scenic]" {
+		t.Errorf("expected the router's scenic estimate, got %+v via %v", resp, router.profiles)
+	}
+
+	for path, want := range map[string]int{
+		base + "&depart=25:00":                    http.StatusBadRequest,
+		base + "&routing_profile=offroad":         http.StatusBadRequest,
+		fmt.Sprintf("/api/spots/%d/eta", spot.ID): http.StatusBadRequest,
+		"/api/spots/9999/eta?lat=35.0&lng=139.0":  http.StatusNotFound,
+	} {
+		if w, _ := eta(path); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package srv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// exportPageSize is how many history rows HandleExportUser loads at a time.
+const exportPageSize = 500
+
+// ExportedRoute is a saved route in a user export, with its stored route
+// and request as JSON rather than strings.
+type ExportedRoute struct {
+	dbgen.RouteHistory
+	RouteJson   json.RawMessage `json:"route_json,omitempty"`
+	RequestJson json.RawMessage `json:"request_json,omitempty"`
+}
+
+func exportedRoute(r dbgen.RouteHistory) ExportedRoute {
+	e := ExportedRoute{RouteHistory: r}
+	if r.RouteJson != nil {
+		e.RouteJson = json.RawMessage(*r.RouteJson)
+	}
+	if r.RequestJson != nil {
+		e.RequestJson = json.RawMessage(*r.RequestJson)
+	}
+	return e
+}
+
+// HandleExportUser streams everything stored about the requesting user as
+// one JSON object:
+//
+//	{"user_id", "exported_at", "profile", "settings", "favorites",
+//	 "visits", "recommendations", "routes"}
+//
+// profile and settings are null if the user has none. History is written
+// a page at a time, oldest first, so large histories aren't held in memory.
+func (s *Server) HandleExportUser(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+	ctx := r.Context()
+	q := s.Queries
+
+	// Load the small sections before the first byte goes out, so a database
+	// error can still get a proper status.
+	var profile *dbgen.User
+	if u, err := q.GetUser(ctx, userID); err == nil {
+		profile = &u
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		writeDBError(w, err)
+		return
+	}
+	var settings *dbgen.UserPreference
+	if p, err := q.GetUserPreferences(ctx, userID); err == nil {
+		settings = &p
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		writeDBError(w, err)
+		return
+	}
+	favorites, err := q.ExportUserFavorites(ctx, userID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="drive-app-export.json"`)
+	ew := &exportWriter{w: w}
+	ew.printf(`{"user_id":`)
+	ew.value(userID)
+	ew.field("exported_at", time.Now().UTC())
+	ew.field("profile", profile)
+	ew.field("settings", settings)
+	ew.field("favorites", favorites)
+	exportPages(ew, "visits", func(after int64) ([]dbgen.VisitHistory, error) {
+		return q.ExportUserVisits(ctx, dbgen.ExportUserVisitsParams{UserID: userID, AfterID: after, Limit: exportPageSize})
+	}, func(v dbgen.VisitHistory) (int64, any) { return v.ID, v })
+	exportPages(ew, "recommendations", func(after int64) ([]dbgen.RecommendationHistory, error) {
+		return q.ExportUserRecommendations(ctx, dbgen.ExportUserRecommendationsParams{UserID: userID, AfterID: after, Limit: exportPageSize})
+	}, func(v dbgen.RecommendationHistory) (int64, any) { return v.ID, v })
+	exportPages(ew, "routes", func(after int64) ([]dbgen.RouteHistory, error) {
+		return q.ExportUserRoutes(ctx, dbgen.ExportUserRoutesParams{UserID: userID, AfterID: after, Limit: exportPageSize})
+	}, func(v dbgen.RouteHistory) (int64, any) { return v.ID, exportedRoute(v) })
+	ew.printf("}\n")
+
+	if ew.err != nil {
+		// Too late for an error status; the client gets truncated JSON.
+		slog.Error("export user data", "user", userID, "error", ew.err)
+	}
+}
+
+// exportWriter writes a JSON object piece by piece, remembering the first
+// error so callers can check once at the end.
+type exportWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *exportWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+func (ew *exportWriter) value(v any) {
+	if ew.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		ew.err = err
+		return
+	}
+	_, ew.err = ew.w.Write(b)
+}
+
+// field writes `,"name":v`.
+func (ew *exportWriter) field(name string, v any) {
+	ew.printf(",%q:", name)
+	ew.value(v)
+}
+
+// exportPages writes the field name as an array of every row fetch returns,
+// fetching the rows after the last one's ID until a short page. item
+// returns a row's ID and what to write for it.
+func exportPages[T any](ew *exportWriter, name string, fetch func(after int64) ([]T, error), item func(T) (int64, any)) {
+	ew.printf(",%q:[", name)
+	var after int64
+	first := true
+	for ew.err == nil {
+		rows, err := fetch(after)
+		if err != nil {
+			ew.err = err
+			return
+		}
+		for _, row := range rows {
+			id, v := item(row)
+			if !first {
+				ew.printf(",")
+			}
+			ew.value(v)
+			first = false
+			after = id
+		}
+		if len(rows) < exportPageSize {
+			break
+		}
+		if f, ok := ew.w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	ew.printf("]")
+}
@@ -0,0 +1,106 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportUser(t *testing.T) {
+	server, _ := newTestServer(t)
+	lookout := seedSpot(t, server, "展望台", "drive", 35.1, 139.0)
+	cafe := seedSpot(t, server, "カフェ", "rest", 35.2, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a'), ('user-b')")
+	mustExec(t, server, "INSERT INTO user_preferences (user_id, preferred_distance_km) VALUES ('user-a', 42), ('user-b', 7)")
+	mustExec(t, server, "INSERT INTO favorites (user_id, spot_id) VALUES ('user-a', ?), ('user-b', ?)", lookout.ID, cafe.ID)
+	// More visits than fit in one page
+	mustExec(t, server, `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+		INSERT INTO visit_history (user_id, spot_id, comment) SELECT 'user-a', ?, 'visit ' || i FROM n`, exportPageSize+20, lookout.ID)
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, comment) VALUES ('user-b', ?, 'not mine')", cafe.ID)
+	mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id) VALUES ('user-a', ?), ('user-b', ?), ('user-a', ?)", lookout.ID, lookout.ID, cafe.ID)
+	mustExec(t, server, `INSERT INTO route_history (user_id, route_hash, spot_ids, route_json) VALUES
+		('user-a', 'a1', '[1]', '{"message": "mine"}'), ('user-b', 'b1', '[2]', '{"message": "theirs"}')`)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/user/export", nil), "user-a")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected a download, got Content-Disposition %q", w.Header().Get("Content-Disposition"))
+	}
+	var export struct {
+		UserID  string `json:"user_id"`
+		Profile *struct {
+			ID string `json:"id"`
+		} `json:"profile"`
+		Settings *struct {
+			UserID              string   `json:"user_id"`
+			PreferredDistanceKm *float64 `json:"preferred_distance_km"`
+		} `json:"settings"`
+		Favorites []struct {
+			SpotID int64 `json:"spot_id"`
+		} `json:"favorites"`
+		Visits []struct {
+			UserID  string `json:"user_id"`
+			Comment string `json:"comment"`
+		} `json:"visits"`
+		Recommendations []struct {
+			UserID string `json:"user_id"`
+			SpotID int64  `json:"spot_id"`
+		} `json:"recommendations"`
+		Routes []struct {
+			UserID    string `json:"user_id"`
+			RouteJSON struct {
+				Message string `json:"message"`
+			} `json:"route_json"`
+		} `json:"routes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("decode: %v\n%s", err, w.Body.String())
+	}
+
+	if export.UserID != "user-a" || export.Profile == nil || export.Profile.ID != "user-a" {
+		t.Errorf("expected user-a's profile, got %q %+v", export.UserID, export.Profile)
+	}
+	if export.Settings == nil || export.Settings.UserID != "user-a" || *export.Settings.PreferredDistanceKm != 42 {
+		t.Errorf("expected user-a's settings, got %+v", export.Settings)
+	}
+	if len(export.Favorites) != 1 || export.Favorites[0].SpotID != lookout.ID {
+		t.Errorf("expected user-a's favorite only, got %+v", export.Favorites)
+	}
+	if len(export.Visits) != exportPageSize+20 || export.Visits[0].Comment != "visit 1" || export.Visits[exportPageSize].Comment != "visit 501" {
+		t.Errorf("expected all %d of user-a's visits in order, got %d", exportPageSize+20, len(export.Visits))
+	}
+	for _, v := range export.Visits {
+		if v.UserID != "user-a" {
+			t.Fatalf("expected only user-a's visits, got %+v", v)
+		}
+	}
+	if len(export.Recommendations) != 2 || export.Recommendations[0].UserID != "user-a" || export.Recommendations[1].SpotID != cafe.ID {
+		t.Errorf("expected user-a's two recommendations, got %+v", export.Recommendations)
+	}
+	if len(export.Routes) != 1 || export.Routes[0].RouteJSON.Message != "mine" {
+		t.Errorf("expected user-a's route with its JSON inline, got %+v", export.Routes)
+	}
+	if body := w.Body.String(); strings.Contains(body, "user-b") || strings.Contains(body, "theirs") || strings.Contains(body, "not mine") {
+		t.Errorf("expected nothing of user-b's in the export")
+	}
+
+	// A user with no data gets empty sections
+	req = asUser(httptest.NewRequest(http.MethodGet, "/api/user/export", nil), "user-c")
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	var empty map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &empty); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("export for a new user: %d %s", w.Code, w.Body.String())
+	}
+	for _, section := range []string{"favorites", "visits", "recommendations", "routes"} {
+		if got, ok := empty[section].([]any); !ok || len(got) != 0 {
+			t.Errorf("expected an empty %s list, got %v", section, empty[section])
+		}
+	}
+}
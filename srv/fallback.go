@@ -0,0 +1,74 @@
+package srv
+
+import (
+	"cmp"
+	"slices"
+)
+
+// FallbackOrder selects which candidates fill a recommendation when the AI
+// fails or picks too few.
+type FallbackOrder string
+
+const (
+	// FallbackRanked keeps the ranking order (weather, ratings, freshness
+	// and recent picks; see rankCandidates). The default.
+	FallbackRanked FallbackOrder = "ranked"
+	// FallbackNearest takes the nearest candidates first.
+	FallbackNearest FallbackOrder = "nearest"
+	// FallbackRated takes the best rated candidates first; unrated spots
+	// come last.
+	FallbackRated FallbackOrder = "rated"
+	// FallbackDiverse takes the best ranked candidate of each category in
+	// turn, so one category can't fill the whole list.
+	FallbackDiverse FallbackOrder = "diverse"
+)
+
+// fallbackOrder returns the ranked candidates in the order of
+// s.FallbackOrder, leaving candidates untouched. Ties keep the ranking order.
+func (s *Server) fallbackOrder(candidates []SpotWithDistance) []SpotWithDistance {
+	ordered := slices.Clone(candidates)
+	switch s.FallbackOrder {
+	case FallbackNearest:
+		slices.SortStableFunc(ordered, func(a, b SpotWithDistance) int {
+			return cmp.Compare(a.DistanceKm, b.DistanceKm)
+		})
+	case FallbackRated:
+		slices.SortStableFunc(ordered, func(a, b SpotWithDistance) int {
+			return cmp.Compare(spotRating(b), spotRating(a))
+		})
+	case FallbackDiverse:
+		ordered = roundRobinCategories(ordered)
+	}
+	return ordered
+}
+
+// spotRating is a spot's average user rating, or -1 if nobody rated it.
+func spotRating(c SpotWithDistance) float64 {
+	if c.RatingCount == 0 {
+		return -1
+	}
+	return c.AvgRating
+}
+
+// roundRobinCategories interleaves candidates by category, taking the next
+// of each category in turn, categories in order of their first candidate.
+func roundRobinCategories(candidates []SpotWithDistance) []SpotWithDistance {
+	var categories []string
+	byCategory := make(map[string][]SpotWithDistance)
+	for _, c := range candidates {
+		if _, ok := byCategory[c.Category]; !ok {
+			categories = append(categories, c.Category)
+		}
+		byCategory[c.Category] = append(byCategory[c.Category], c)
+	}
+	result := make([]SpotWithDistance, 0, len(candidates))
+	for len(result) < len(candidates) {
+		for _, cat := range categories {
+			if queue := byCategory[cat]; len(queue) > 0 {
+				result = append(result, queue[0])
+				byCategory[cat] = queue[1:]
+			}
+		}
+	}
+	return result
+}
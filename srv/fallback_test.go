@@ -0,0 +1,83 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestFallbackOrder(t *testing.T) {
+	server, llm := newTestServer(t)
+	spot := func(id int64, category string, km, rating float64, ratings int64) SpotWithDistance {
+		return SpotWithDistance{
+			Spot:       dbgen.Spot{ID: id, Category: category, AvgRating: rating, RatingCount: ratings},
+			DistanceKm: km,
+		}
+	}
+	// In ranking order.
+	candidates := []SpotWithDistance{
+		spot(1, "drive", 30, 3.5, 4),
+		spot(2, "drive", 10, 0, 0),
+		spot(3, "drive", 20, 4.8, 10),
+		spot(4, "restaurant", 5, 4.2, 3),
+		spot(5, "rest", 40, 3.5, 2),
+		spot(6, "restaurant", 10, 2.0, 5),
+	}
+	ids := func(spots []SpotWithDistance) string {
+		var ids []int64
+		for _, s := range spots {
+			ids = append(ids, s.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	for _, tc := range []struct {
+		order FallbackOrder
+		want  string
+	}{
+		{FallbackRanked, "[1 2 3 4 5 6]"},
+		{FallbackNearest, "[4 2 6 3 1 5]"}, // 2 and 6 tie at 10km and keep their rank
+		{FallbackRated, "[3 4 1 5 6 2]"},   // unrated last
+		{FallbackDiverse, "[1 4 5 2 6 3]"},
+		{"", "[1 2 3 4 5 6]"},
+	} {
+		server.FallbackOrder = tc.order
+		if got := ids(server.fallbackOrder(candidates)); got != tc.want {
+			t.Errorf("%q: want %s, got %s", tc.order, tc.want, got)
+		}
+	}
+	if got := ids(candidates); got != "[1 2 3 4 5 6]" {
+		t.Errorf("expected the candidates left in ranking order, got %s", got)
+	}
+
+	t.Run("recommend", func(t *testing.T) {
+		near := seedSpot(t, server, "近所の峠", "drive", 35.05, 139.0)
+		far := seedSpot(t, server, "遠くの湖", "drive", 35.3, 139.0)
+		mustExec(t, server, "UPDATE spots SET avg_rating = 4.9, rating_count = 12 WHERE id = ?", far.ID)
+		llm.response = "not json"
+		server.MinRecommendations, server.MaxRecommendations = 1, 1
+
+		first := func() int64 {
+			t.Helper()
+			w := postJSON(t, server, "/api/recommend", "user-"+string(server.FallbackOrder), RecommendRequest{Lat: 35.0, Lng: 139.0})
+			var resp RecommendResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(resp.Spots) != 1 {
+				t.Fatalf("expected 1 spot, got %+v", resp.Spots)
+			}
+			return resp.Spots[0].ID
+		}
+		server.FallbackOrder = FallbackNearest
+		if got := first(); got != near.ID {
+			t.Errorf("nearest: expected %d, got %d", near.ID, got)
+		}
+		server.FallbackOrder = FallbackRated
+		if got := first(); got != far.ID {
+			t.Errorf("rated: expected %d, got %d", far.ID, got)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package srv
+
+import (
+	"errors"
+	"fmt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// validateMaxSpotFee accepts a request's max_spot_fee; nil means any fee.
+func validateMaxSpotFee(max *int64) error {
+	if max != nil && *max < 0 {
+		return errors.New("max_spot_fee must be >= 0")
+	}
+	return nil
+}
+
+// withinFee reports whether spot's entry fee is at most max. Spots with an
+// unknown fee pass, as does everything when max is nil.
+func withinFee(spot dbgen.Spot, max *int64) bool {
+	return max == nil || spot.EntryFee == nil || *spot.EntryFee <= *max
+}
+
+// feeTag marks spots with an entry fee in a prompt, e.g. " [入場料500円]".
+func feeTag(spot dbgen.Spot) string {
+	switch {
+	case spot.EntryFee == nil:
+		return ""
+	case *spot.EntryFee == 0:
+		return " [入場無料]"
+	}
+	return fmt.Sprintf(" [入場料%d円]", *spot.EntryFee)
+}
+
+// routeEntryFees totals the known entry fees of a route's stops and counts
+// the stops whose fee is unknown.
+func routeEntryFees(stops []RouteStop) (total int64, unknown int) {
+	for _, stop := range stops {
+		switch {
+		case stop.ID == 0:
+		case stop.EntryFee == nil:
+			unknown++
+		default:
+			total += *stop.EntryFee
+		}
+	}
+	return total, unknown
+}
@@ -0,0 +1,85 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestSpotEntryFee(t *testing.T) {
+	server, llm := newTestServer(t)
+	fee := func(yen int64) *int64 { return &yen }
+
+	lat, lng := 35.05, 139.0
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "美術館", Category: "drive", Latitude: &lat, Longitude: &lng, EntryFee: fee(1500)})
+	var museum dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &museum); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if museum.EntryFee == nil || *museum.EntryFee != 1500 {
+		t.Errorf("expected the fee stored, got %v", museum.EntryFee)
+	}
+	mustExec(t, server, "UPDATE spots SET status = 'approved'")
+	if w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "謎の館", Category: "drive", Latitude: &lat, Longitude: &lng, EntryFee: fee(-1), Force: true}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative fee, got %d", w.Code)
+	}
+
+	garden := seedSpot(t, server, "庭園", "drive", 35.06, 139.0)
+	park := seedSpot(t, server, "公園", "drive", 35.07, 139.0)
+	unknown := seedSpot(t, server, "古い城", "drive", 35.08, 139.0)
+	mustExec(t, server, "UPDATE spots SET entry_fee = 500 WHERE id = ?", garden.ID)
+	mustExec(t, server, "UPDATE spots SET entry_fee = 0 WHERE id = ?", park.ID)
+
+	t.Run("recommend", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, park.ID)
+		offered := func(max *int64) string {
+			t.Helper()
+			w := postJSON(t, server, "/api/recommend", "user-b", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxSpotFee: max})
+			if w.Code != http.StatusOK {
+				t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+			}
+			return llm.lastPrompt()
+		}
+		p := offered(fee(1000))
+		if strings.Contains(p, "美術館") || !strings.Contains(p, "庭園") || !strings.Contains(p, "古い城") {
+			t.Errorf("expected only the museum left out under 1000 yen, got:\n%s", p)
+		}
+		if !strings.Contains(p, "[入場料500円]") || !strings.Contains(p, "[入場無料]") {
+			t.Errorf("expected fees tagged in the prompt, got:\n%s", p)
+		}
+		if p := offered(fee(0)); strings.Contains(p, "庭園") || !strings.Contains(p, "公園") || !strings.Contains(p, "古い城") {
+			t.Errorf("expected free and unknown spots only, got:\n%s", p)
+		}
+		if p := offered(nil); !strings.Contains(p, "美術館") {
+			t.Errorf("expected every spot without a limit")
+		}
+		if w := postJSON(t, server, "/api/recommend", "user-b", RecommendRequest{Lat: 35.0, Lng: 139.0, MaxSpotFee: fee(-5)}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for a negative max_spot_fee, got %d", w.Code)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"route_ids": [%d, %d, %d], "stay_durations": [30, 30, 30], "message": "ok"}`, garden.ID, park.ID, unknown.ID)
+		w := postJSON(t, server, "/api/route", "user-c", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MaxSpotFee: fee(1000)})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(llm.lastPrompt(), "美術館") {
+			t.Errorf("expected the museum left out of the route candidates")
+		}
+		if len(resp.Stops) != 5 {
+			t.Fatalf("expected 3 stops, got %+v", resp.Stops)
+		}
+		if resp.TotalEntryFee != 500 || resp.UnknownFeeStops != 1 {
+			t.Errorf("expected 500 yen with one unknown fee, got %d and %d", resp.TotalEntryFee, resp.UnknownFeeStops)
+		}
+		if fee := resp.Stops[1].EntryFee; fee == nil || *fee != 500 {
+			t.Errorf("expected the garden's fee on its stop, got %v", fee)
+		}
+	})
+}
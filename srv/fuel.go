@@ -0,0 +1,20 @@
+package srv
+
+import "math"
+
+// fuelCost estimates the fuel cost of driving km, in the currency of the
+// fuel price per litre. Zero request values fall back to the server's
+// FuelEfficiencyKmL and FuelPrice. It returns nil unless both end up set.
+func (s *Server) fuelCost(km, efficiencyKmL, pricePerL float64) *float64 {
+	if efficiencyKmL <= 0 {
+		efficiencyKmL = s.FuelEfficiencyKmL
+	}
+	if pricePerL <= 0 {
+		pricePerL = s.FuelPrice
+	}
+	if efficiencyKmL <= 0 || pricePerL <= 0 {
+		return nil
+	}
+	cost := math.Round(km / efficiencyKmL * pricePerL)
+	return &cost
+}
@@ -0,0 +1,68 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestFuelCost(t *testing.T) {
+	server, _ := newTestServer(t)
+	if c := server.fuelCost(100, 0, 0); c != nil {
+		t.Errorf("expected no estimate without configuration, got %v", *c)
+	}
+
+	server.FuelEfficiencyKmL, server.FuelPrice = 15, 170
+	for _, tc := range []struct {
+		km, kmL, price, want float64
+	}{
+		{150, 0, 0, 1700},
+		{300, 0, 0, 3400}, // twice the distance, twice the cost
+		{150, 10, 0, 2550},
+		{150, 0, 200, 2000},
+		{0, 0, 0, 0},
+	} {
+		c := server.fuelCost(tc.km, tc.kmL, tc.price)
+		if c == nil || *c != tc.want {
+			t.Errorf("fuelCost(%v, %v, %v) = %v, want %v", tc.km, tc.kmL, tc.price, c, tc.want)
+		}
+	}
+}
+
+func TestGenerateRouteFuelCost(t *testing.T) {
+	server, llm := newTestServer(t)
+	spot := seedSpot(t, server, "展望台", "drive", 35.2, 139.0)
+	b, _ := json.Marshal(map[string]any{"route_ids": []int64{spot.ID}, "stay_durations": []int{30}, "message": "ok"})
+	llm.response = string(b)
+
+	route := func(req RouteRequest) RouteResponse {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	base := RouteRequest{Lat: 35.0, Lng: 139.0}
+	if resp := route(base); resp.EstimatedFuelCost != nil {
+		t.Errorf("expected no fuel cost by default, got %v", *resp.EstimatedFuelCost)
+	}
+
+	server.FuelEfficiencyKmL, server.FuelPrice = 20, 160
+	resp := route(base)
+	if resp.EstimatedFuelCost == nil || *resp.EstimatedFuelCost != *server.fuelCost(resp.TotalDistanceKm, 0, 0) {
+		t.Fatalf("expected the configured estimate for %vkm, got %v", resp.TotalDistanceKm, resp.EstimatedFuelCost)
+	}
+
+	// A thirstier vehicle for this request costs more.
+	thirsty := base
+	thirsty.FuelEfficiencyKmL = 10
+	if got := route(thirsty).EstimatedFuelCost; got == nil || *got != *server.fuelCost(resp.TotalDistanceKm, 10, 0) {
+		t.Errorf("expected the per-request efficiency to apply, got %v", got)
+	}
+}
@@ -0,0 +1,120 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrPlaceNotFound is returned by a Geocoder when nothing matches the query.
+var ErrPlaceNotFound = errors.New("place not found")
+
+// Geocoder resolves a place name or address to coordinates.
+type Geocoder interface {
+	Geocode(ctx context.Context, query string) (lat, lng float64, err error)
+}
+
+// NominatimGeocoder geocodes with an OpenStreetMap Nominatim instance.
+type NominatimGeocoder struct {
+	BaseURL   string // e.g. https://nominatim.openstreetmap.org
+	UserAgent string // required by the Nominatim usage policy
+	Client    *http.Client
+}
+
+func NewNominatimGeocoder(baseURL string) *NominatimGeocoder {
+	return &NominatimGeocoder{
+		BaseURL:   baseURL,
+		UserAgent: "drive-app/1.0",
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *NominatimGeocoder) Geocode(ctx context.Context, query string) (float64, float64, error) {
+	u := g.BaseURL + "/search?" + url.Values{
+		"q":      {query},
+		"format": {"json"},
+		"limit":  {"1"},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("User-Agent", g.UserAgent)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("nominatim: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("nominatim: status %d", resp.StatusCode)
+	}
+
+	// Nominatim returns coordinates as strings
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return 0, 0, fmt.Errorf("nominatim: parse response: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, 0, ErrPlaceNotFound
+	}
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("nominatim: parse lat: %w", err)
+	}
+	lng, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("nominatim: parse lon: %w", err)
+	}
+	return lat, lng, nil
+}
+
+// ReverseGeocoder names the place at some coordinates. Geocoders that also
+// implement it let Server.VerifyCoordinates check new spots.
+type ReverseGeocoder interface {
+	ReverseGeocode(ctx context.Context, lat, lng float64) (place string, err error)
+}
+
+// ReverseGeocode returns Nominatim's display name for (lat, lng), its
+// comma-separated components from the most to the least specific.
+func (g *NominatimGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	u := g.BaseURL + "/reverse?" + url.Values{
+		"lat":    {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon":    {strconv.FormatFloat(lng, 'f', -1, 64)},
+		"format": {"json"},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", g.UserAgent)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("nominatim: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nominatim: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("nominatim: parse response: %w", err)
+	}
+	if result.DisplayName == "" {
+		return "", ErrPlaceNotFound
+	}
+	return result.DisplayName, nil
+}
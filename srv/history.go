@@ -0,0 +1,45 @@
+package srv
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// HistoryPage is a page of the user's visits, newest first. NextCursor is
+// passed back as ?cursor= to fetch the following page; it is omitted on
+// the last page.
+type HistoryPage struct {
+	Visits     []dbgen.GetUserVisitHistoryPageRow `json:"visits"`
+	NextCursor string                             `json:"next_cursor,omitempty"`
+}
+
+// encodeHistoryCursor returns an opaque cursor positioned after the visit
+// at visitedAt with the given id.
+func encodeHistoryCursor(visitedAt time.Time, id int64) string {
+	raw := visitedAt.UTC().Format(time.DateTime) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(cursor string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	at, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return "", 0, errors.New("invalid cursor")
+	}
+	if _, err := time.Parse(time.DateTime, at); err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	return at, id, nil
+}
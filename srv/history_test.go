@@ -0,0 +1,190 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestHistoryCursorPagination(t *testing.T) {
+	server, _ := newTestServer(t)
+	spot := seedSpot(t, server, "展望台", "drive", 35.1, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	for _, at := range []string{
+		"2026-09-01 10:00:00",
+		"2026-09-02 10:00:00",
+		"2026-09-03 10:00:00", // two visits in the same second
+		"2026-09-03 10:00:00",
+		"2026-09-04 10:00:00",
+	} {
+		mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES ('user-a', ?, ?)", spot.ID, at)
+	}
+
+	page := func(query string) HistoryPage {
+		t.Helper()
+		req := asUser(httptest.NewRequest(http.MethodGet, "/api/history"+query, nil), "user-a")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var p HistoryPage
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return p
+	}
+
+	seen := map[int64]bool{}
+	var order []int64
+	p := page("?limit=2")
+	for i := 0; ; i++ {
+		for _, v := range p.Visits {
+			if seen[v.ID] {
+				t.Errorf("visit %d returned twice", v.ID)
+			}
+			seen[v.ID] = true
+			order = append(order, v.ID)
+		}
+		if i == 0 {
+			// A new visit arrives between page fetches; it would shift an
+			// offset-based page and repeat the last row.
+			mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES ('user-a', ?, '2026-09-05 10:00:00')", spot.ID)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		p = page("?limit=2&cursor=" + p.NextCursor)
+	}
+	if len(order) != 5 {
+		t.Fatalf("expected the 5 original visits across pages, got %v", order)
+	}
+	// Newest first; the same-second pair comes out by descending id.
+	want := []int64{5, 4, 3, 2, 1}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, order)
+		}
+	}
+
+	if got := page("").Visits; len(got) != 6 || got[0].ID != 6 {
+		t.Errorf("expected a fresh first page to include the new visit, got %d visits", len(got))
+	}
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/history?cursor=bogus!", nil), "user-a")
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad cursor, got %d", w.Code)
+	}
+}
+
+func TestHistoryFilters(t *testing.T) {
+	server, _ := newTestServer(t)
+	drive := seedSpot(t, server, "展望台", "drive", 35.1, 139.0)
+	meal := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a'), ('user-b')")
+	visit := func(user string, spot int64, at string) {
+		mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES (?, ?, ?)", user, spot, at)
+	}
+	visit("user-a", drive.ID, "2026-08-20 10:00:00") // 1
+	visit("user-a", meal.ID, "2026-09-01 12:00:00")  // 2
+	visit("user-a", drive.ID, "2026-09-15 09:00:00") // 3
+	visit("user-a", meal.ID, "2026-09-30 23:30:00")  // 4
+	visit("user-a", meal.ID, "2026-10-01 12:00:00")  // 5
+	visit("user-b", meal.ID, "2026-09-10 12:00:00")  // 6
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/api/history"+query, nil), "user-a")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+	for _, tc := range []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{5, 4, 3, 2, 1}},
+		{"?category=restaurant", []int64{5, 4, 2}},
+		{"?category=食事", []int64{5, 4, 2}},
+		{"?from=2026-09-01", []int64{5, 4, 3, 2}},
+		{"?to=2026-09-30", []int64{4, 3, 2, 1}},
+		{"?from=2026-09-01&to=2026-09-30", []int64{4, 3, 2}},
+		{"?category=restaurant&from=2026-09-01&to=2026-09-30", []int64{4, 2}},
+		{"?category=drive&from=2026-10-01", nil},
+	} {
+		w := get(tc.query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.query, w.Code, w.Body.String())
+		}
+		var p HistoryPage
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []int64
+		for _, v := range p.Visits {
+			got = append(got, v.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: expected visits %v, got %v", tc.query, tc.want, got)
+		}
+	}
+
+	// Filters carry across pages
+	w := get("?category=restaurant&limit=2")
+	var p HistoryPage
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.NextCursor == "" {
+		t.Fatalf("expected a next page, got %s", w.Body.String())
+	}
+	w = get("?category=restaurant&limit=2&cursor=" + p.NextCursor)
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || len(p.Visits) != 1 || p.Visits[0].ID != 2 {
+		t.Errorf("expected the last restaurant visit on page two, got %s", w.Body.String())
+	}
+
+	for _, query := range []string{"?from=2026/09/01", "?to=yesterday", "?from=2026-09-30&to=2026-09-01", "?category=museum"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	server, _ := newTestServer(t)
+	spot := seedSpot(t, server, "展望台", "drive", 35.1, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	mustExec(t, server, `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 30)
+		INSERT INTO visit_history (user_id, spot_id) SELECT 'user-a', ? FROM n`, spot.ID)
+
+	count := func(query string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, asUser(httptest.NewRequest(http.MethodGet, "/api/history"+query, nil), "user-a"))
+		var p HistoryPage
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return len(p.Visits)
+	}
+
+	server.MaxHistoryLimit = 25
+	for query, want := range map[string]int{
+		"":               20,
+		"?limit=5":       5,
+		"?limit=1000000": 25, // capped
+		"?limit=0":       20,
+		"?limit=-3":      20,
+		"?limit=abc":     20,
+	} {
+		if got := count(query); got != want {
+			t.Errorf("%q: expected %d visits, got %d", query, want, got)
+		}
+	}
+
+	// A cap below the default lowers the default too
+	server.MaxHistoryLimit = 10
+	if got := count(""); got != 10 {
+		t.Errorf("expected the default capped at 10, got %d", got)
+	}
+}
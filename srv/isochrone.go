@@ -0,0 +1,104 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultIsochroneSamples = 36 // every 10 degrees
+	maxIsochroneMinutes     = 24 * 60
+)
+
+// Isochrone approximates the area reachable from an origin within a time
+// budget. Today every bearing reaches the same distance at avgSpeedKmh, so
+// the polygon is a circle; Samples keep per-bearing distances so a road-aware
+// estimate can replace it without changing the shape of the response.
+type Isochrone struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	Minutes  int     `json:"minutes"`
+	RadiusKm float64 `json:"radius_km"` // farthest sample
+
+	Samples []IsochroneSample `json:"samples"`
+	// Polygon is the closed ring through the samples as GeoJSON
+	// [lng, lat] positions.
+	Polygon [][2]float64 `json:"polygon"`
+}
+
+// IsochroneSample is how far one can drive in one direction.
+type IsochroneSample struct {
+	Bearing    float64 `json:"bearing"` // degrees clockwise from north
+	DistanceKm float64 `json:"distance_km"`
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+}
+
+// HandleIsochrone serves GET /api/isochrone?lat=&lng=&minutes=[&samples=].
+func (s *Server) HandleIsochrone(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || math.Abs(lat) > 90 {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil || math.Abs(lng) > 180 {
+		http.Error(w, "invalid lng", http.StatusBadRequest)
+		return
+	}
+	minutes, err := intParam(r, "minutes", 0)
+	if err != nil || minutes <= 0 || minutes > maxIsochroneMinutes {
+		http.Error(w, fmt.Sprintf("minutes must be between 1 and %d", maxIsochroneMinutes), http.StatusBadRequest)
+		return
+	}
+	samples, err := intParam(r, "samples", defaultIsochroneSamples)
+	if err != nil || samples < 8 || samples > 360 {
+		http.Error(w, "samples must be between 8 and 360", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.isochrone(lat, lng, minutes, samples))
+}
+
+// isochrone samples the reachable distance at n evenly spaced bearings.
+func (s *Server) isochrone(lat, lng float64, minutes, n int) Isochrone {
+	iso := Isochrone{Lat: lat, Lng: lng, Minutes: minutes}
+	for i := range n {
+		bearing := 360 * float64(i) / float64(n)
+		km := s.reachKm(minutes)
+		pLat, pLng := s.destination(lat, lng, bearing, km)
+		iso.Samples = append(iso.Samples, IsochroneSample{Bearing: bearing, DistanceKm: km, Lat: pLat, Lng: pLng})
+		iso.Polygon = append(iso.Polygon, [2]float64{pLng, pLat})
+		iso.RadiusKm = max(iso.RadiusKm, km)
+	}
+	iso.Polygon = append(iso.Polygon, iso.Polygon[0])
+	return iso
+}
+
+// reachKm is how far one drives in minutes at avgSpeedKmh, the inverse of
+// drivingMinutes.
+func (s *Server) reachKm(minutes int) float64 {
+	return float64(minutes) / 60 * avgSpeedKmh
+}
+
+// destination returns the point km from (lat, lng) along the great circle
+// leaving at bearing degrees.
+func (s *Server) destination(lat, lng, bearing, km float64) (float64, float64) {
+	radius := s.Distance.RadiusKm
+	if radius <= 0 {
+		radius = defaultEarthRadiusKm
+	}
+	const rad = math.Pi / 180
+	d := km / radius
+	φ1, λ1, θ := lat*rad, lng*rad, bearing*rad
+	φ2 := math.Asin(math.Sin(φ1)*math.Cos(d) + math.Cos(φ1)*math.Sin(d)*math.Cos(θ))
+	λ2 := λ1 + math.Atan2(math.Sin(θ)*math.Sin(d)*math.Cos(φ1), math.Cos(d)-math.Sin(φ1)*math.Sin(φ2))
+	// Normalize to [-180, 180)
+	lng2 := math.Mod(λ2/rad+540, 360) - 180
+	return φ2 / rad, lng2
+}
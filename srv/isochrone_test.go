@@ -0,0 +1,58 @@
+package srv
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsochrone(t *testing.T) {
+	server, _ := newTestServer(t)
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/isochrone"+query, nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("?lat=35.68&lng=139.76&minutes=30")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var iso Isochrone
+	if err := json.NewDecoder(w.Body).Decode(&iso); err != nil {
+		t.Fatal(err)
+	}
+	want := 30.0 / 60 * avgSpeedKmh
+	if math.Abs(iso.RadiusKm-want) > 1e-9 {
+		t.Errorf("radius = %v km, want %v", iso.RadiusKm, want)
+	}
+	if len(iso.Samples) != defaultIsochroneSamples {
+		t.Fatalf("got %d samples, want %d", len(iso.Samples), defaultIsochroneSamples)
+	}
+	for _, p := range iso.Samples {
+		if got := server.distanceKm(35.68, 139.76, p.Lat, p.Lng); math.Abs(got-want) > 1e-6 {
+			t.Errorf("bearing %v: vertex is %v km away, want %v", p.Bearing, got, want)
+		}
+	}
+	if len(iso.Polygon) != len(iso.Samples)+1 || iso.Polygon[0] != iso.Polygon[len(iso.Polygon)-1] {
+		t.Errorf("polygon is not a closed ring: %v", iso.Polygon)
+	}
+	if north := iso.Samples[0]; north.Lat <= 35.68 || math.Abs(north.Lng-139.76) > 1e-9 {
+		t.Errorf("bearing 0 should point north, got %+v", north)
+	}
+
+	for _, query := range []string{
+		"?lng=139.76&minutes=30",
+		"?lat=95&lng=139.76&minutes=30",
+		"?lat=35.68&lng=139.76",
+		"?lat=35.68&lng=139.76&minutes=0",
+		"?lat=35.68&lng=139.76&minutes=30&samples=3",
+	} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package srv
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// kmlContentType is the registered media type for KML documents.
+const kmlContentType = "application/vnd.google-earth.kml+xml"
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document kmlFolder
+}
+
+type kmlFolder struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Placemarks  []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Category    *kmlData       `xml:"ExtendedData>Data,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlCoord formats a point as KML's "lng,lat".
+func kmlCoord(lat, lng float64) string {
+	return strconv.FormatFloat(lng, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+}
+
+// routeKML is route as a KML document: a LineString through the stops from
+// start to return, then a Placemark per stop with its category. Without
+// includeOrigin, both leave out the start and return.
+func routeKML(route RouteResponse, includeOrigin bool) kmlDocument {
+	stops := exportStops(route.Stops, includeOrigin)
+	doc := kmlDocument{Document: kmlFolder{
+		Name:        fmt.Sprintf("ドライブルート %s-%s", route.DepartureTime, route.EstimatedReturn),
+		Description: route.Message,
+	}}
+
+	coords := make([]string, len(stops))
+	for i, stop := range stops {
+		coords[i] = kmlCoord(stop.Lat, stop.Lng)
+	}
+	doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+		Name:       "ルート",
+		LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coords, " ")},
+	})
+
+	for _, stop := range stops {
+		desc := stop.ArrivalTime
+		if stay := stop.stayMinutes(); stay > 0 {
+			desc += fmt.Sprintf(" (滞在%d分)", stay)
+		}
+		if stop.Description != "" {
+			desc += " " + stop.Description
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:        stop.Name,
+			Description: desc,
+			Category:    &kmlData{Name: "category", Value: stop.Category},
+			Point:       &kmlPoint{Coordinates: kmlCoord(stop.Lat, stop.Lng)},
+		})
+	}
+	return doc
+}
+
+// HandleRouteKML serves a saved route as KML for Google Earth and other
+// mapping tools. include_origin=false leaves out the start and return;
+// it defaults to the opposite of Server.ExcludeOriginInExports.
+func (s *Server) HandleRouteKML(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+	includeOrigin, err := boolParam(r, "include_origin", !s.ExcludeOriginInExports)
+	if err != nil {
+		http.Error(w, "invalid include_origin", http.StatusBadRequest)
+		return
+	}
+	saved, route, ok := s.loadSavedRoute(w, r, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", kmlContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="route-%d.kml"`, saved.ID))
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(routeKML(route, includeOrigin))
+}
@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteKML(t *testing.T) {
+	server, _ := newTestServer(t)
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.20, 139.02)
+	cafe := seedSpot(t, server, "湖畔カフェ & 売店", "rest", 35.21, 139.03)
+	routeID := saveRoute(t, server, "user-a", sampleRoute(lake, cafe))
+
+	get := func(userID string) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/route/%d/kml", routeID), nil), userID)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("user-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != kmlContentType {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	var doc struct {
+		XMLName  xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+		Document struct {
+			Placemarks []struct {
+				Name     string `xml:"name"`
+				Category string `xml:"ExtendedData>Data>value"`
+				Point    *struct {
+					Coordinates string `xml:"coordinates"`
+				} `xml:"Point"`
+				LineString *struct {
+					Coordinates string `xml:"coordinates"`
+				} `xml:"LineString"`
+			} `xml:"Placemark"`
+		}
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("parse KML: %v\n%s", err, w.Body.String())
+	}
+
+	// One path plus start, two spots and return.
+	marks := doc.Document.Placemarks
+	if len(marks) != 5 {
+		t.Fatalf("expected 5 placemarks, got %d:\n%s", len(marks), w.Body.String())
+	}
+	if marks[0].LineString == nil || len(strings.Fields(marks[0].LineString.Coordinates)) != 4 {
+		t.Errorf("expected a 4 point path first, got %+v", marks[0])
+	}
+	stop := marks[2]
+	if stop.Name != "芦ノ湖" || stop.Category != "drive" || stop.Point == nil || stop.Point.Coordinates != "139.02,35.2" {
+		t.Errorf("unexpected placemark %+v", stop)
+	}
+	if marks[3].Name != "湖畔カフェ & 売店" || marks[3].Category != "rest" {
+		t.Errorf("unexpected placemark %+v", marks[3])
+	}
+
+	if w := get("user-b"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's route, got %d", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LLM completes a single-turn prompt and returns the model's text reply.
+// The server talks to the exe.dev gateway by default; tests substitute a stub.
+type LLM interface {
+	Complete(ctx context.Context, prompt string, maxTokens int) (string, error)
+}
+
+const (
+	defaultLLMURL   = "http://169.254.169.254/gateway/llm/_/gateway/anthropic/v1/messages"
+	defaultLLMModel = "claude-sonnet-4-20250514"
+)
+
+// gatewayLLM calls the Anthropic messages API through the exe.dev LLM gateway.
+type gatewayLLM struct {
+	URL    string
+	Model  string
+	Client *http.Client
+}
+
+func newGatewayLLM() *gatewayLLM {
+	return &gatewayLLM{
+		URL:    defaultLLMURL,
+		Model:  defaultLLMModel,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *gatewayLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	reqBody := map[string]interface{}{
+		"model":      g.Model,
+		"max_tokens": maxTokens,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.URL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("call gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parse response %q: %w", body, err)
+	}
+	if len(result.Content) == 0 {
+		return "", fmt.Errorf("no content in response %q", body)
+	}
+	return result.Content[0].Text, nil
+}
+
+// llmCallTimeout bounds a shared LLM call, which outlives the request that
+// started it.
+const llmCallTimeout = 60 * time.Second
+
+// complete sends prompt to s.LLM, sharing one call among concurrent callers
+// with the same prompt (ignoring whitespace differences) and maxTokens. The
+// shared call isn't tied to any one caller's context, so the first caller
+// giving up doesn't fail the others; each caller still returns as soon as
+// its own context is done.
+func (s *Server) complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	key := strconv.Itoa(maxTokens) + "\x00" + strings.Join(strings.Fields(prompt), " ")
+	ch := s.llmCalls.DoChan(key, func() (any, error) {
+		callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), llmCallTimeout)
+		defer cancel()
+		start := time.Now()
+		text, err := s.LLM.Complete(callCtx, prompt, maxTokens)
+		s.auditLLM(callCtx, prompt, text, err, time.Since(start))
+		s.recordLLMOutcome(err)
+		return text, err
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// extractJSONObject returns the outermost {...} span of text, which is where
+// the model puts its JSON answer when it wraps it in prose.
+func extractJSONObject(text string) (string, bool) {
+	start := -1
+	end := -1
+	for i, c := range text {
+		if c == '{' && start == -1 {
+			start = i
+		}
+		if c == '}' {
+			end = i + 1
+		}
+	}
+	if start == -1 || end == -1 || end <= start {
+		return "", false
+	}
+	return text[start:end], true
+}
@@ -0,0 +1,114 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedLLM blocks every call until release is closed.
+type gatedLLM struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGatedLLM() *gatedLLM {
+	return &gatedLLM{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (l *gatedLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	l.calls.Add(1)
+	l.started <- struct{}{}
+	select {
+	case <-l.release:
+		return "reply to " + prompt, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestCompleteCoalescesIdenticalPrompts(t *testing.T) {
+	server, _ := newTestServer(t)
+	llm := newGatedLLM()
+	server.LLM = llm
+
+	const callers = 8
+	var wg sync.WaitGroup
+	replies := make([]string, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Whitespace differences still count as the same prompt.
+			prompt := "おすすめを選んで"
+			if i%2 == 1 {
+				prompt = "  おすすめを選んで\n"
+			}
+			replies[i], errs[i] = server.complete(context.Background(), prompt, 500)
+		}()
+	}
+	<-llm.started
+	time.Sleep(50 * time.Millisecond) // let the other callers join
+	close(llm.release)
+	wg.Wait()
+
+	if n := llm.calls.Load(); n != 1 {
+		t.Errorf("expected 1 LLM call, got %d", n)
+	}
+	for i := range callers {
+		if errs[i] != nil || replies[i] != replies[0] {
+			t.Errorf("caller %d: got %q, %v; want %q", i, replies[i], errs[i], replies[0])
+		}
+	}
+
+	// Different max tokens are separate calls.
+	server.complete(context.Background(), "おすすめを選んで", 500)
+	server.complete(context.Background(), "おすすめを選んで", 600)
+	if n := llm.calls.Load(); n != 3 {
+		t.Errorf("expected 3 LLM calls after two sequential ones, got %d", n)
+	}
+}
+
+func TestCompleteCallerCancelDoesNotFailOthers(t *testing.T) {
+	server, _ := newTestServer(t)
+	llm := newGatedLLM()
+	server.LLM = llm
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := server.complete(firstCtx, "prompt", 500)
+		firstErr <- err
+	}()
+	<-llm.started
+
+	second := make(chan string, 1)
+	go func() {
+		reply, err := server.complete(context.Background(), "prompt", 500)
+		if err != nil {
+			t.Errorf("second caller: %v", err)
+		}
+		second <- reply
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The caller that started the call gives up; it returns right away.
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the first caller to see its cancellation, got %v", err)
+	}
+
+	// The shared call keeps going for the second caller.
+	close(llm.release)
+	if reply := <-second; reply != "reply to prompt" {
+		t.Errorf("expected the shared reply, got %q", reply)
+	}
+	if n := llm.calls.Load(); n != 1 {
+		t.Errorf("expected 1 LLM call, got %d", n)
+	}
+}
@@ -0,0 +1,111 @@
+package srv
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// defaultLLMHealthWindow is how many recent AI calls the success rate
+// covers.
+const defaultLLMHealthWindow = 50
+
+// defaultLLMSuccessThreshold warns when more than one AI call in five
+// fails.
+const defaultLLMSuccessThreshold = 0.8
+
+// minLLMHealthCalls is how many calls the window must hold before a low
+// success rate is worth a warning.
+const minLLMHealthCalls = 10
+
+// LLMHealth is the outcome of the most recent AI calls.
+type LLMHealth struct {
+	Window      int     `json:"window"` // how many calls are kept
+	Calls       int     `json:"calls"`
+	Successes   int     `json:"successes"`
+	Failures    int     `json:"failures"`
+	SuccessRate float64 `json:"success_rate"` // 1 before any calls
+}
+
+// llmHealth keeps the outcomes of the last calls in a ring buffer.
+type llmHealth struct {
+	mu       sync.Mutex
+	outcomes []bool
+	next     int
+	full     bool
+	degraded bool // below the threshold since the last warning
+}
+
+// record adds one call's outcome to a window of size calls. degraded is
+// true only for the call that took the success rate below threshold, once
+// the window holds minLLMHealthCalls calls; the rate must recover before it
+// reports again.
+func (h *llmHealth) record(ok bool, size int, threshold float64) (health LLMHealth, degraded bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size <= 0 {
+		size = defaultLLMHealthWindow
+	}
+	if len(h.outcomes) != size {
+		// The window was resized; start over.
+		h.outcomes, h.next, h.full = make([]bool, size), 0, false
+	}
+	h.outcomes[h.next] = ok
+	h.next = (h.next + 1) % size
+	h.full = h.full || h.next == 0
+
+	health = h.snapshot()
+	below := health.Calls >= min(minLLMHealthCalls, size) && health.SuccessRate < threshold
+	degraded = below && !h.degraded
+	h.degraded = below
+	return health, degraded
+}
+
+// stats returns the current window.
+func (h *llmHealth) stats(size int) LLMHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.outcomes) == 0 {
+		if size <= 0 {
+			size = defaultLLMHealthWindow
+		}
+		return LLMHealth{Window: size, SuccessRate: 1}
+	}
+	return h.snapshot()
+}
+
+func (h *llmHealth) snapshot() LLMHealth {
+	calls := h.next
+	if h.full {
+		calls = len(h.outcomes)
+	}
+	health := LLMHealth{Window: len(h.outcomes), Calls: calls, SuccessRate: 1}
+	for _, ok := range h.outcomes[:calls] {
+		if ok {
+			health.Successes++
+		}
+	}
+	health.Failures = calls - health.Successes
+	if calls > 0 {
+		health.SuccessRate = float64(health.Successes) / float64(calls)
+	}
+	return health
+}
+
+// recordLLMOutcome adds an AI call to the success rate, warning when the
+// rate drops below LLMSuccessThreshold.
+func (s *Server) recordLLMOutcome(err error) {
+	health, degraded := s.llmHealth.record(err == nil, s.LLMHealthWindow, s.LLMSuccessThreshold)
+	if degraded {
+		slog.Warn("AI success rate below threshold",
+			"rate", health.SuccessRate, "threshold", s.LLMSuccessThreshold,
+			"failures", health.Failures, "calls", health.Calls)
+	}
+}
+
+// HandleLLMStats reports the success rate of the most recent AI calls.
+func (s *Server) HandleLLMStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.llmHealth.stats(s.LLMHealthWindow))
+}
@@ -0,0 +1,83 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLLMHealthWindow(t *testing.T) {
+	var h llmHealth
+	feed := func(outcomes string) (LLMHealth, []int) {
+		t.Helper()
+		var health LLMHealth
+		var warned []int
+		for i, c := range outcomes {
+			var degraded bool
+			health, degraded = h.record(c == '+', 10, 0.8)
+			if degraded {
+				warned = append(warned, i)
+			}
+		}
+		return health, warned
+	}
+
+	// Too few calls to judge, however they went
+	if health, warned := feed("+--"); health.Calls != 3 || health.Failures != 2 || len(warned) != 0 {
+		t.Errorf("expected 3 calls and no warning yet, got %+v, warnings at %v", health, warned)
+	}
+	// The 10th call fills the window at 8/10; the 11th slides the first
+	// success out and drops to 7/10: one warning, not one per call
+	health, warned := feed("+++++++---")
+	if health.Calls != 10 || health.SuccessRate != 0.7 || len(warned) != 1 || warned[0] != 7 {
+		t.Errorf("expected a single warning at the 11th call, got %+v, warnings at %v", health, warned)
+	}
+	// Old outcomes slide out of the window
+	health, warned = feed("+++++++++")
+	if health.Calls != 10 || health.Successes != 9 || health.SuccessRate != 0.9 || len(warned) != 0 {
+		t.Errorf("expected the failures to slide out, got %+v, warnings at %v", health, warned)
+	}
+	// Recovered, so a new drop warns again
+	if _, warned := feed("---"); len(warned) != 1 || warned[0] != 2 {
+		t.Errorf("expected another warning after recovering, got %v", warned)
+	}
+
+	var empty llmHealth
+	if got := empty.stats(20); got.Window != 20 || got.Calls != 0 || got.SuccessRate != 1 {
+		t.Errorf("expected an empty window, got %+v", got)
+	}
+}
+
+func TestLLMStats(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.LLMHealthWindow = 10
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	for i := range 12 {
+		llm.err = nil
+		if i%2 == 1 {
+			llm.err = errors.New("gateway unavailable")
+		}
+		server.complete(t.Context(), strings.Repeat("prompt ", i+1), 10)
+	}
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/stats/llm", nil))
+	var health LLMHealth
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("stats: %d %s", w.Code, w.Body.String())
+	}
+	if health != (LLMHealth{Window: 10, Calls: 10, Successes: 5, Failures: 5, SuccessRate: 0.5}) {
+		t.Errorf("expected half of the last 10 calls to succeed, got %+v", health)
+	}
+	if n := strings.Count(logs.String(), "AI success rate below threshold"); n != 1 {
+		t.Errorf("expected one warning, got %d:\n%s", n, logs.String())
+	}
+}
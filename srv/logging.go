@@ -0,0 +1,42 @@
+package srv
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// LogConfig selects the level and output format of the server's logs.
+type LogConfig struct {
+	Level  slog.Level
+	Format string // "text" or "json"
+}
+
+// logConfigFromEnv reads LOG_LEVEL (debug, info, warn or error; default
+// info) and LOG_FORMAT (text or json; default text).
+func logConfigFromEnv() (LogConfig, error) {
+	cfg := LogConfig{Level: slog.LevelInfo, Format: "text"}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	if v := strings.ToLower(os.Getenv("LOG_FORMAT")); v != "" {
+		if v != "text" && v != "json" {
+			return cfg, fmt.Errorf("LOG_FORMAT must be text or json, got %q", v)
+		}
+		cfg.Format = v
+	}
+	return cfg, nil
+}
+
+// newLogHandler returns a handler writing logs to w as configured.
+func newLogHandler(w io.Writer, cfg LogConfig) slog.Handler {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.Format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
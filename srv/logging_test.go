@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogConfig(t *testing.T) {
+	t.Run("debug suppressed at info", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(newLogHandler(&buf, LogConfig{Level: slog.LevelInfo, Format: "text"}))
+		logger.Debug("noisy detail")
+		logger.Info("server started")
+		if strings.Contains(buf.String(), "noisy detail") {
+			t.Errorf("expected debug logs to be suppressed, got %q", buf.String())
+		}
+		if !strings.Contains(buf.String(), "server started") {
+			t.Errorf("expected info logs, got %q", buf.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		slog.New(newLogHandler(&buf, LogConfig{Level: slog.LevelDebug, Format: "json"})).Debug("detail", "spot", 7)
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("expected a JSON log line, got %q: %v", buf.String(), err)
+		}
+		if entry["msg"] != "detail" || entry["spot"] != float64(7) {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "warn")
+		t.Setenv("LOG_FORMAT", "JSON")
+		cfg, err := logConfigFromEnv()
+		if err != nil || cfg.Level != slog.LevelWarn || cfg.Format != "json" {
+			t.Errorf("unexpected config %+v, err %v", cfg, err)
+		}
+
+		t.Setenv("LOG_LEVEL", "loud")
+		if _, err := logConfigFromEnv(); err == nil {
+			t.Error("expected an error for an unknown level")
+		}
+		t.Setenv("LOG_LEVEL", "")
+		t.Setenv("LOG_FORMAT", "xml")
+		if _, err := logConfigFromEnv(); err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "")
+		t.Setenv("LOG_FORMAT", "")
+		cfg, err := logConfigFromEnv()
+		if err != nil || cfg.Level != slog.LevelInfo || cfg.Format != "text" {
+			t.Errorf("unexpected defaults %+v, err %v", cfg, err)
+		}
+	})
+}
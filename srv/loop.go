@@ -0,0 +1,99 @@
+package srv
+
+import (
+	"math"
+	"sort"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// minLoopAngle is the smallest angle in degrees, seen from the origin,
+// between the first and last stop for a route to count as a loop rather
+// than an out-and-back that retraces its way home.
+const minLoopAngle = 45.0
+
+// loopInfeasibleMessage explains why a require_loop route is out-and-back.
+const loopInfeasibleMessage = "候補スポットが一方向に集中しているため、周回ルートを作れませんでした。往復ルートをご案内します。"
+
+// bearingDeg returns the compass bearing from (lat1, lon1) to (lat2, lon2)
+// in degrees [0, 360), using the same flat approximation as getDirection.
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	angle := math.Atan2(lon2-lon1, lat2-lat1) * 180 / math.Pi
+	if angle < 0 {
+		angle += 360
+	}
+	return angle
+}
+
+// loopAngle returns the angle between the outbound leg (origin to the first
+// stop) and the return leg (last stop to origin). It is 0 for a route that
+// leaves and comes back the same way, including single-stop routes.
+func loopAngle(lat, lng float64, stops []dbgen.Spot) float64 {
+	if len(stops) < 2 {
+		return 0
+	}
+	first, last := stops[0], stops[len(stops)-1]
+	d := math.Abs(bearingDeg(lat, lng, first.Latitude, first.Longitude) - bearingDeg(lat, lng, last.Latitude, last.Longitude))
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// loopOrder orders stops by bearing around the origin, starting just after
+// the widest empty sector, so the route sweeps out one way and comes back
+// another.
+func loopOrder(lat, lng float64, stops []dbgen.Spot) []dbgen.Spot {
+	sorted := append([]dbgen.Spot(nil), stops...)
+	bearing := func(sp dbgen.Spot) float64 { return bearingDeg(lat, lng, sp.Latitude, sp.Longitude) }
+	sort.SliceStable(sorted, func(i, j int) bool { return bearing(sorted[i]) < bearing(sorted[j]) })
+	if len(sorted) < 2 {
+		return sorted
+	}
+
+	// The gap from the last stop back round to the first one wraps past 360
+	start, widest := 0, bearing(sorted[0])+360-bearing(sorted[len(sorted)-1])
+	for i := 1; i < len(sorted); i++ {
+		if gap := bearing(sorted[i]) - bearing(sorted[i-1]); gap > widest {
+			start, widest = i, gap
+		}
+	}
+	return append(sorted[start:], sorted[:start]...)
+}
+
+// requireLoop reorders routeIDs (and their stay durations) into a loop if
+// the given order would retrace the outbound leg. ok is false if no
+// ordering of these stops forms a loop; the route is then left as is.
+func requireLoop(lat, lng float64, routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) ([]int64, []int, bool) {
+	var stops []dbgen.Spot
+	stay := make(map[int64]int)
+	for i, id := range routeIDs {
+		if sp, ok := spotMap[id]; ok {
+			stops = append(stops, sp)
+			if i < len(stayDurations) {
+				stay[id] = stayDurations[i]
+			}
+		}
+	}
+	if loopAngle(lat, lng, stops) >= minLoopAngle {
+		return routeIDs, stayDurations, true
+	}
+	ordered := loopOrder(lat, lng, stops)
+	if loopAngle(lat, lng, ordered) < minLoopAngle {
+		return routeIDs, stayDurations, false
+	}
+
+	ids := make([]int64, len(ordered))
+	for i, sp := range ordered {
+		ids[i] = sp.ID
+	}
+	// Durations the AI didn't give fall back to the category defaults
+	if len(stay) < len(ordered) {
+		return ids, nil, true
+	}
+	stays := make([]int, len(ordered))
+	for i, sp := range ordered {
+		stays[i] = stay[sp.ID]
+	}
+	return ids, stays, true
+}
@@ -0,0 +1,97 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestLoopOrdering(t *testing.T) {
+	const lat, lng = 35.0, 139.0
+	north := dbgen.Spot{ID: 1, Latitude: 35.3, Longitude: 139.0}
+	nearNorth := dbgen.Spot{ID: 2, Latitude: 35.1, Longitude: 139.0}
+	northeast := dbgen.Spot{ID: 3, Latitude: 35.2, Longitude: 139.2}
+	east := dbgen.Spot{ID: 4, Latitude: 35.0, Longitude: 139.3}
+
+	outAndBack := []dbgen.Spot{nearNorth, north, east, nearNorth}
+	if a := loopAngle(lat, lng, []dbgen.Spot{nearNorth, north}); a != 0 {
+		t.Errorf("expected 0 for an out-and-back along one bearing, got %v", a)
+	}
+	if a := loopAngle(lat, lng, outAndBack); a >= minLoopAngle {
+		t.Errorf("expected returning via the first stop's bearing to retrace, got %v", a)
+	}
+	if a := loopAngle(lat, lng, []dbgen.Spot{north, northeast, east}); a != 90 {
+		t.Errorf("expected a 90 degree loop, got %v", a)
+	}
+
+	got := loopOrder(lat, lng, []dbgen.Spot{east, north, northeast, nearNorth})
+	var ids []int64
+	for _, sp := range got {
+		ids = append(ids, sp.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint([]int64{north.ID, nearNorth.ID, northeast.ID, east.ID}) {
+		t.Errorf("expected a sweep from north to east, got %v", ids)
+	}
+
+	// With stops west, north and east the widest empty sector is the south,
+	// so the sweep starts after it in the west and goes round via north.
+	west := dbgen.Spot{ID: 5, Latitude: 35.0, Longitude: 138.7}
+	got = loopOrder(lat, lng, []dbgen.Spot{north, east, west})
+	if got[0].ID != west.ID || got[1].ID != north.ID || got[2].ID != east.ID {
+		t.Errorf("expected west, north, east; got %d, %d, %d", got[0].ID, got[1].ID, got[2].ID)
+	}
+}
+
+func TestGenerateRouteRequireLoop(t *testing.T) {
+	server, llm := newTestServer(t)
+	north := seedSpot(t, server, "北の高原", "drive", 35.30, 139.00)
+	nearNorth := seedSpot(t, server, "北の滝", "drive", 35.10, 139.00)
+	east := seedSpot(t, server, "東の岬", "drive", 35.00, 139.30)
+
+	route := func(ids []int64, loop bool) RouteResponse {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{"route_ids": ids, "stay_durations": []int{30, 31, 32}, "message": "ok"})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, RequireLoop: loop})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	stopIDs := func(resp RouteResponse) []int64 {
+		var ids []int64
+		for _, stop := range resp.Stops {
+			if stop.ID > 0 {
+				ids = append(ids, stop.ID)
+			}
+		}
+		return ids
+	}
+
+	// The AI's order goes north, east, then back via the waterfall north.
+	aiOrder := []int64{north.ID, east.ID, nearNorth.ID}
+	if got := stopIDs(route(aiOrder, false)); fmt.Sprint(got) != fmt.Sprint(aiOrder) {
+		t.Errorf("expected the AI order without require_loop, got %v", got)
+	}
+
+	resp := route(aiOrder, true)
+	want := []int64{north.ID, nearNorth.ID, east.ID}
+	if got := stopIDs(resp); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected loop order %v, got %v", want, got)
+	}
+	if resp.Stops[1].stayMinutes() != 30 || resp.Stops[2].stayMinutes() != 32 {
+		t.Errorf("expected stay durations to follow their stops, got %+v", resp.Stops)
+	}
+	if resp.Message == loopInfeasibleMessage {
+		t.Errorf("expected a feasible loop")
+	}
+
+	// Everything due north: no ordering avoids retracing.
+	resp = route([]int64{north.ID, nearNorth.ID}, true)
+	if resp.Message != loopInfeasibleMessage {
+		t.Errorf("expected the infeasible-loop message, got %q", resp.Message)
+	}
+}
@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Spot moderation statuses. Only approved spots are offered as
+// recommendation and route candidates.
+const (
+	SpotPending  = "pending"
+	SpotApproved = "approved"
+	SpotRejected = "rejected"
+)
+
+// submissionStatus is the status of a spot added by r's user: admins'
+// spots are approved straight away, everyone else's await review.
+func (s *Server) submissionStatus(r *http.Request) string {
+	if s.isAdmin(r) {
+		return SpotApproved
+	}
+	return SpotPending
+}
+
+// editedStatus is the status of spot after r's user edits it: admins'
+// edits keep it, everyone else's send it back for review.
+func (s *Server) editedStatus(r *http.Request, spot dbgen.Spot) string {
+	if s.isAdmin(r) {
+		return spot.Status
+	}
+	return s.submissionStatus(r)
+}
+
+// HandleApproveSpot makes a spot a candidate for recommendations and routes.
+func (s *Server) HandleApproveSpot(w http.ResponseWriter, r *http.Request) {
+	s.setSpotStatus(w, r, SpotApproved)
+}
+
+// HandleRejectSpot keeps a spot out of recommendations and routes.
+func (s *Server) HandleRejectSpot(w http.ResponseWriter, r *http.Request) {
+	s.setSpotStatus(w, r, SpotRejected)
+}
+
+// setSpotStatus moderates the spot named by the {id} path value and
+// responds with the updated spot.
+func (s *Server) setSpotStatus(w http.ResponseWriter, r *http.Request, status string) {
+	spot, ok := s.loadSpot(w, r)
+	if !ok {
+		return
+	}
+	spot, err := s.Queries.SetSpotStatus(r.Context(), dbgen.SetSpotStatusParams{
+		Status: status,
+		ID:     spot.ID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spot)
+}
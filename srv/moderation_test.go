@@ -0,0 +1,207 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestSpotModeration(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	seedSpot(t, server, "昔からの展望台", "drive", 35.1, 139.0)
+
+	lat, lng := 35.05, 139.05
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "秘密の滝", Category: "drive", Latitude: &lat, Longitude: &lng})
+	var submitted dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if submitted.Status != SpotPending {
+		t.Errorf("expected a pending submission, got %q", submitted.Status)
+	}
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, submitted.ID)
+
+	offered := func(user string) bool {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", user, RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		for _, spot := range resp.Spots {
+			if spot.ID == submitted.ID {
+				return true
+			}
+		}
+		return strings.Contains(llm.lastPrompt(), "秘密の滝")
+	}
+	listed := func() bool {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/spots", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list spots: %d %s", w.Code, w.Body.String())
+		}
+		return strings.Contains(w.Body.String(), "秘密の滝")
+	}
+	moderate := func(action, email string) *httptest.ResponseRecorder {
+		t.Helper()
+		return adminDo(t, server, http.MethodPost, fmt.Sprintf("/api/admin/spots/%d/%s", submitted.ID, action), email)
+	}
+
+	if offered("user-b") {
+		t.Error("expected the pending spot left out of recommendations")
+	}
+	if listed() {
+		t.Error("expected the pending spot left out of GET /api/spots")
+	}
+	if w := adminGet(t, server, "/api/admin/spots?status=pending", "admin@example.com"); !strings.Contains(w.Body.String(), "秘密の滝") || strings.Contains(w.Body.String(), "昔からの展望台") {
+		t.Errorf("expected only the submission in the review queue, got %s", w.Body.String())
+	}
+
+	if w := moderate("approve", "someone@example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admins, got %d", w.Code)
+	}
+	if w := moderate("approve", "admin@example.com"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"approved"`) {
+		t.Fatalf("approve: %d %s", w.Code, w.Body.String())
+	}
+	if !offered("user-c") {
+		t.Error("expected the approved spot among the candidates")
+	}
+	if !listed() {
+		t.Error("expected the approved spot in GET /api/spots")
+	}
+
+	if w := moderate("reject", "admin@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("reject: %d %s", w.Code, w.Body.String())
+	}
+	if offered("user-d") {
+		t.Error("expected the rejected spot left out of recommendations")
+	}
+	if listed() {
+		t.Error("expected the rejected spot left out of GET /api/spots")
+	}
+	if w := adminDo(t, server, http.MethodPost, "/api/admin/spots/9999/approve", "admin@example.com"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown spot, got %d", w.Code)
+	}
+
+	// Admins' own spots skip the queue.
+	req := httptest.NewRequest(http.MethodPost, "/api/spots", strings.NewReader(`{"name": "公式の駐車場", "category": "rest", "latitude": 35.2, "longitude": 139.2}`))
+	req.Header.Set("X-ExeDev-Email", "admin@example.com")
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"status":"approved"`) {
+		t.Errorf("expected an admin's spot approved, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUnapprovedSpotsNotRoutable(t *testing.T) {
+	server, _ := newTestServer(t)
+	lookout := seedSpot(t, server, "展望台", "drive", 35.02, 139.0)
+	pending := seedSpot(t, server, "秘密の滝", "drive", 35.03, 139.0)
+	rejected := seedSpot(t, server, "閉鎖した峠", "drive", 35.04, 139.0)
+	mustExec(t, server, "UPDATE spots SET status = ? WHERE id = ?", SpotPending, pending.ID)
+	mustExec(t, server, "UPDATE spots SET status = ? WHERE id = ?", SpotRejected, rejected.ID)
+
+	w := postJSON(t, server, "/api/reachable", "user-a", ReachableRequest{
+		Lat: 35.0, Lng: 139.0, SpotIDs: []int64{lookout.ID, pending.ID, rejected.ID},
+	})
+	var results []SpotReachability
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("reachable: %d %s", w.Code, w.Body.String())
+	}
+	if len(results) != 3 || !results[0].Reachable || results[1].Reason != "not_found" || results[2].Reason != "not_found" {
+		t.Errorf("expected only the approved spot reachable, got %+v", results)
+	}
+
+	for _, id := range []int64{pending.ID, rejected.ID} {
+		w := postJSON(t, server, "/api/route/modify", "user-a", map[string]any{
+			"lat": 35.0, "lng": 139.0, "departure_time": "09:00", "action": "replace", "target_id": lookout.ID, "new_id": id,
+			"current_route": []map[string]any{{"id": lookout.ID, "stay_duration": 30}},
+		})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("modify: %d %s", w.Code, w.Body.String())
+		}
+		for _, stop := range resp.Stops {
+			if stop.ID == id {
+				t.Errorf("expected unapproved spot %d kept out of the route, got %+v", id, resp.Stops)
+			}
+		}
+	}
+}
+
+func TestEditedSpotNeedsReview(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	server.MaxSpotMoveKm = 0
+
+	lat, lng := 35.05, 139.05
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "秘密の滝", Category: "drive", Latitude: &lat, Longitude: &lng})
+	var spot dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, spot.ID)
+	path := fmt.Sprintf("/api/spots/%d", spot.ID)
+
+	approve := func() {
+		t.Helper()
+		if w := adminDo(t, server, http.MethodPost, fmt.Sprintf("/api/admin/spots/%d/approve", spot.ID), "admin@example.com"); w.Code != http.StatusOK {
+			t.Fatalf("approve: %d %s", w.Code, w.Body.String())
+		}
+	}
+	offered := func(user string) bool {
+		t.Helper()
+		calls := llm.calls()
+		w := postJSON(t, server, "/api/recommend", user, RecommendRequest{Lat: 35.0, Lng: 139.0})
+		if w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		// The spot is the only one, so the AI is asked only when it's a candidate.
+		return llm.calls() > calls
+	}
+	edit := func(name, email string) dbgen.Spot {
+		t.Helper()
+		req := asUser(httptest.NewRequest(http.MethodPut, path, strings.NewReader(fmt.Sprintf(`{"name": %q, "category": "drive"}`, name))), "user-a")
+		if email != "" {
+			req.Header.Set("X-ExeDev-Email", email)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		var got dbgen.Spot
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("edit: %d %s", w.Code, w.Body.String())
+		}
+		return got
+	}
+
+	approve()
+	if got := edit("怪しい滝", ""); got.Status != SpotPending {
+		t.Errorf("expected the creator's edit to go back for review, got %q", got.Status)
+	}
+	if offered("user-b") {
+		t.Error("expected the edited spot left out of recommendations until re-approved")
+	}
+	approve()
+	if !offered("user-c") {
+		t.Error("expected the re-approved spot among the candidates")
+	}
+	if got := edit("秘密の滝", "admin@example.com"); got.Status != SpotApproved {
+		t.Errorf("expected an admin's edit to keep the spot approved, got %q", got.Status)
+	}
+
+	w = postJSON(t, server, path+"/images", "user-a", AddSpotImageRequest{URL: "https://example.com/falls.jpg"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add image: %d %s", w.Code, w.Body.String())
+	}
+	if offered("user-d") {
+		t.Error("expected a spot with a new photo left out of recommendations until re-approved")
+	}
+}
@@ -0,0 +1,115 @@
+package srv
+
+import (
+	"fmt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Route objectives for RouteRequest.Objective.
+const (
+	ObjectiveDistance = "distance" // fewest kilometres
+	ObjectiveTime     = "time"     // back soonest, counting waits for opening
+)
+
+// maxOptimizeStops bounds the exhaustive reordering; 7 stops is 5040 orders.
+const maxOptimizeStops = 7
+
+func validateObjective(objective string) error {
+	switch objective {
+	case "", ObjectiveDistance, ObjectiveTime:
+		return nil
+	}
+	return fmt.Errorf("objective must be %q or %q, got %q", ObjectiveDistance, ObjectiveTime, objective)
+}
+
+// openingWait is how long a visitor arriving at minute at waits for the
+// spot to open; 0 without opening hours or once open.
+func openingWait(spot dbgen.Spot, at int) int {
+	if spot.OpeningTime == nil {
+		return 0
+	}
+	open, ok := parseClock(*spot.OpeningTime)
+	if !ok {
+		return 0
+	}
+	if day := at % (24 * 60); day < open {
+		return open - day
+	}
+	return 0
+}
+
+// routeCost is the objective's cost of visiting order from (startLat,
+// startLng) and driving back: kilometres, or minutes from departure to
+// return including stays and waits for opening.
+func (s *Server) routeCost(legs *routeLegs, objective string, startLat, startLng float64, depMinutes int, order []dbgen.Spot, stays []int) float64 {
+	km, t := 0.0, depMinutes
+	prevLat, prevLng := startLat, startLng
+	for i, spot := range order {
+		leg := legs.leg(prevLat, prevLng, spot.Latitude, spot.Longitude)
+		km += leg.Km
+		t += leg.Minutes
+		t += openingWait(spot, t) + stays[i]
+		prevLat, prevLng = spot.Latitude, spot.Longitude
+	}
+	leg := legs.leg(prevLat, prevLng, startLat, startLng)
+	km += leg.Km
+	t += leg.Minutes
+	if objective == ObjectiveTime {
+		return float64(t - depMinutes)
+	}
+	return km
+}
+
+// optimizeOrder reorders the route's stops to minimize the objective,
+// keeping stays with their stops. Orders that put two meal or rest stops
+// together, or that accept (if non-nil) rejects, are skipped; ties keep the
+// AI's order. Routes longer than maxOptimizeStops are left alone.
+func (s *Server) optimizeOrder(legs *routeLegs, objective string, startLat, startLng float64, depMinutes int, routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot, accept func([]dbgen.Spot) bool) ([]int64, []int) {
+	order, stays := s.resolveStops(routeIDs, stayDurations, spotMap)
+	if objective == "" || len(order) < 2 || len(order) > maxOptimizeStops {
+		return routeIDs, stayDurations
+	}
+
+	best := s.routeCost(legs, objective, startLat, startLng, depMinutes, order, stays)
+	bestOrder, bestStays := order, stays
+	if hasConsecutiveMealOrRest(order) || (accept != nil && !accept(order)) {
+		bestOrder = nil // the AI's order doesn't qualify either
+	}
+
+	n := len(order)
+	perm := make([]int, 0, n)
+	used := make([]bool, n)
+	var visit func()
+	visit = func() {
+		if len(perm) == n {
+			o := make([]dbgen.Spot, n)
+			st := make([]int, n)
+			for i, j := range perm {
+				o[i], st[i] = order[j], stays[j]
+			}
+			if hasConsecutiveMealOrRest(o) || (accept != nil && !accept(o)) {
+				return
+			}
+			if c := s.routeCost(legs, objective, startLat, startLng, depMinutes, o, st); bestOrder == nil || c < best-1e-9 {
+				best, bestOrder, bestStays = c, o, st
+			}
+			return
+		}
+		for j := range n {
+			if !used[j] {
+				used[j] = true
+				perm = append(perm, j)
+				visit()
+				perm = perm[:len(perm)-1]
+				used[j] = false
+			}
+		}
+	}
+	visit()
+
+	if bestOrder == nil {
+		return routeIDs, stayDurations
+	}
+	return stopIDs(bestOrder), bestStays
+}
@@ -0,0 +1,60 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGenerateRouteObjective(t *testing.T) {
+	server, llm := newTestServer(t)
+	// The market is nearest but doesn't open until noon.
+	market := seedSpot(t, server, "朝市", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET opening_time = '12:00' WHERE id = ?", market.ID)
+	pass := seedSpot(t, server, "峠", "drive", 35.10, 139.00)
+	coast := seedSpot(t, server, "海岸線", "drive", 35.10, 139.05)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d, %d], "stay_durations": [60, 60, 60], "message": "ok"}`, market.ID, pass.ID, coast.ID)
+
+	generate := func(objective string) RouteResponse {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "10:00", Objective: objective})
+		if w.Code != http.StatusOK {
+			t.Fatalf("objective %q: expected 200, got %d: %s", objective, w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+	order := func(resp RouteResponse) string {
+		return fmt.Sprint(resp.Stops[1].ID, resp.Stops[2].ID, resp.Stops[3].ID)
+	}
+
+	ai := generate("")
+	if ai.Stops[1].WaitMinutes == 0 {
+		t.Errorf("expected a wait for the market to open, got %+v", ai.Stops[1])
+	}
+	// Visiting in reverse is just as short, so the AI's order stands.
+	byDistance := generate(ObjectiveDistance)
+	if got, want := order(byDistance), order(ai); got != want {
+		t.Errorf("expected the distance objective to keep %s, got %s", want, got)
+	}
+	byTime := generate(ObjectiveTime)
+	if order(byTime) == order(byDistance) {
+		t.Errorf("expected the time objective to reorder %s", order(byDistance))
+	}
+	if byTime.TotalTimeMin >= byDistance.TotalTimeMin {
+		t.Errorf("expected the time objective to return sooner: %v vs %v minutes", byTime.TotalTimeMin, byDistance.TotalTimeMin)
+	}
+	for _, stop := range byTime.Stops {
+		if stop.WaitMinutes != 0 {
+			t.Errorf("expected no waiting when ordered by time, got %+v", stop)
+		}
+	}
+
+	if w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, Objective: "scenery"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown objective, got %d", w.Code)
+	}
+}
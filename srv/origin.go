@@ -0,0 +1,34 @@
+package srv
+
+// defaultOriginLabels names the start and end stops of a route per locale.
+var defaultOriginLabels = map[string]string{
+	"ja": "現在地",
+	"en": "Current location",
+}
+
+// originLabel is the name of a route's start and end stops: OriginLabel if
+// set, else the label for the configured locale.
+func (s *Server) originLabel() string {
+	if s.OriginLabel != "" {
+		return s.OriginLabel
+	}
+	if label, ok := defaultOriginLabels[s.Locale]; ok {
+		return label
+	}
+	return defaultOriginLabels[defaultLocale]
+}
+
+// exportStops are the stops a route export (KML, the polyline) covers: all
+// of them, or only the spots without the origin at either end.
+func exportStops(stops []RouteStop, includeOrigin bool) []RouteStop {
+	if includeOrigin {
+		return stops
+	}
+	return spotStops(RouteResponse{Stops: stops})
+}
+
+// routePolyline encodes the route's path for RouteResponse.Polyline,
+// leaving out the origin if ExcludeOriginInExports is set.
+func (s *Server) routePolyline(stops []RouteStop) string {
+	return encodePolyline(exportStops(stops, !s.ExcludeOriginInExports))
+}
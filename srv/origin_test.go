@@ -0,0 +1,74 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteOriginLabelAndExports(t *testing.T) {
+	server, llm := newTestServer(t)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.0)
+	pass := seedSpot(t, server, "峠", "drive", 35.05, 139.05)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, lake.ID, pass.ID)
+
+	route := func() RouteResponse {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || len(resp.Stops) != 4 {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return resp
+	}
+	kmlPlacemarks := func(routeID int64, query string) int {
+		t.Helper()
+		req := asUser(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/route/%d/kml%s", routeID, query), nil), "user-a")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("kml%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return strings.Count(w.Body.String(), "<Placemark>")
+	}
+
+	// Defaults: the Japanese label, and the origin in every export.
+	resp := route()
+	if resp.Stops[0].Name != "現在地" || resp.Stops[3].Name != "現在地" {
+		t.Errorf("expected the default origin label, got %q and %q", resp.Stops[0].Name, resp.Stops[3].Name)
+	}
+	if resp.Polyline != encodePolyline(resp.Stops) {
+		t.Error("expected the polyline to start and end at the origin")
+	}
+	if got := kmlPlacemarks(resp.RouteID, ""); got != 5 {
+		t.Errorf("expected the path and 4 stops in KML, got %d placemarks", got)
+	}
+	if got := kmlPlacemarks(resp.RouteID, "?include_origin=false"); got != 3 {
+		t.Errorf("expected the path and 2 spots without the origin, got %d placemarks", got)
+	}
+
+	// Localized, and the origin left out of exports by default.
+	server.Locale = "en"
+	server.ExcludeOriginInExports = true
+	resp = route()
+	if resp.Stops[0].Name != "Current location" {
+		t.Errorf("expected the English origin label, got %q", resp.Stops[0].Name)
+	}
+	if resp.Polyline != encodePolyline(resp.Stops[1:3]) {
+		t.Error("expected the polyline to cover only the spots")
+	}
+	if got := kmlPlacemarks(resp.RouteID, ""); got != 3 {
+		t.Errorf("expected the origin left out of KML, got %d placemarks", got)
+	}
+	if got := kmlPlacemarks(resp.RouteID, "?include_origin=true"); got != 5 {
+		t.Errorf("expected include_origin to override, got %d placemarks", got)
+	}
+
+	server.OriginLabel = "自宅"
+	if resp := route(); resp.Stops[0].Name != "自宅" || resp.Stops[3].Name != "自宅" {
+		t.Errorf("expected the configured origin label, got %q", resp.Stops[0].Name)
+	}
+}
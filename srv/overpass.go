@@ -0,0 +1,211 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// maxOverpassBody bounds an uploaded Overpass result.
+const maxOverpassBody = 10 << 20
+
+// overpassCategories maps OSM "key=value" tags to spot categories. The
+// first matching tag in overpassTagOrder wins. Values that are also
+// category aliases map the same way (see categoryAliases).
+var overpassCategories = map[string]string{
+	"tourism=viewpoint":   "drive",
+	"tourism=attraction":  "drive",
+	"tourism=museum":      "drive",
+	"tourism=picnic_site": "rest",
+	"amenity=restaurant":  "restaurant",
+	"amenity=cafe":        "rest",
+	"amenity=fast_food":   "restaurant",
+	"amenity=food_court":  "restaurant",
+	"highway=rest_area":   "rest",
+	"highway=services":    "rest",
+}
+
+var overpassTagOrder = []string{"tourism", "amenity", "highway"}
+
+// overpassResponse is the subset of Overpass API JSON ([out:json]) we use.
+// Ways carry their coordinates either inline ("out geom"), as references
+// to nodes in the same result ("out body; >; out skel"), or as a
+// precomputed center ("out center").
+type overpassResponse struct {
+	Elements []overpassElement `json:"elements"`
+}
+
+type overpassElement struct {
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Lat      float64           `json:"lat"`
+	Lon      float64           `json:"lon"`
+	Center   *overpassPoint    `json:"center"`
+	Geometry []overpassPoint   `json:"geometry"`
+	Nodes    []int64           `json:"nodes"`
+	Tags     map[string]string `json:"tags"`
+}
+
+type overpassPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// parseOverpass maps named, categorized nodes and ways in an Overpass result
+// to new spots. It returns how many tagged elements it skipped because they
+// had no name, no mapped category or no coordinates. Hand-prepared data may
+// set a "category" tag, which is normalized and wins over the OSM tags.
+func parseOverpass(r io.Reader) ([]dbgen.CreateSpotParams, int, error) {
+	var resp overpassResponse
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, 0, fmt.Errorf("parse overpass json: %w", err)
+	}
+
+	nodes := make(map[int64]overpassPoint)
+	for _, el := range resp.Elements {
+		if el.Type == "node" {
+			nodes[el.ID] = overpassPoint{Lat: el.Lat, Lon: el.Lon}
+		}
+	}
+
+	var spots []dbgen.CreateSpotParams
+	skipped := 0
+	for _, el := range resp.Elements {
+		if len(el.Tags) == 0 {
+			continue // bare geometry node
+		}
+		name := strings.TrimSpace(el.Tags["name"])
+		category := overpassCategory(el.Tags)
+		var pt overpassPoint
+		ok := false
+		switch el.Type {
+		case "node":
+			pt, ok = overpassPoint{Lat: el.Lat, Lon: el.Lon}, true
+		case "way":
+			pt, ok = wayCentroid(el, nodes)
+		}
+		if name == "" || category == "" || !ok {
+			skipped++
+			continue
+		}
+
+		spot := dbgen.CreateSpotParams{
+			Name:      name,
+			Category:  category,
+			Latitude:  pt.Lat,
+			Longitude: pt.Lon,
+			Status:    SpotApproved, // imported by an admin
+		}
+		if d := el.Tags["description"]; d != "" {
+			spot.Description = &d
+		}
+		if a := el.Tags["addr:full"]; a != "" {
+			spot.Address = &a
+		}
+		spots = append(spots, spot)
+	}
+	return spots, skipped, nil
+}
+
+func overpassCategory(tags map[string]string) string {
+	if c, ok := tags["category"]; ok {
+		category, _ := normalizeCategory(c)
+		return category
+	}
+	for _, key := range overpassTagOrder {
+		if cat, ok := overpassCategories[key+"="+tags[key]]; ok {
+			return cat
+		}
+	}
+	return ""
+}
+
+// wayCentroid returns the mean of a way's distinct vertices, which is close
+// enough to the middle for the small areas spots cover. A closed way repeats
+// its first vertex at the end; that copy is ignored.
+func wayCentroid(el overpassElement, nodes map[int64]overpassPoint) (overpassPoint, bool) {
+	pts := el.Geometry
+	if len(pts) == 0 {
+		for _, id := range el.Nodes {
+			if n, ok := nodes[id]; ok {
+				pts = append(pts, n)
+			}
+		}
+	}
+	if len(pts) > 1 && pts[0] == pts[len(pts)-1] {
+		pts = pts[:len(pts)-1]
+	}
+	if len(pts) == 0 {
+		if el.Center != nil {
+			return *el.Center, true
+		}
+		return overpassPoint{}, false
+	}
+	var c overpassPoint
+	for _, p := range pts {
+		c.Lat += p.Lat
+		c.Lon += p.Lon
+	}
+	c.Lat /= float64(len(pts))
+	c.Lon /= float64(len(pts))
+	return c, true
+}
+
+// ImportResult summarizes an Overpass import.
+type ImportResult struct {
+	Imported   []dbgen.Spot `json:"imported"`
+	Duplicates int          `json:"duplicates"` // near an existing or earlier imported spot
+	Skipped    int          `json:"skipped"`    // unnamed, unmapped or without coordinates
+}
+
+// HandleAdminImportOverpass serves POST /api/admin/import/overpass. The body
+// is an Overpass API JSON result; spots within DuplicateRadiusKm (or
+// defaultDuplicateRadiusKm when the check is disabled) of an existing spot
+// are skipped.
+func (s *Server) HandleAdminImportOverpass(w http.ResponseWriter, r *http.Request) {
+	params, skipped, err := parseOverpass(http.MaxBytesReader(w, r.Body, maxOverpassBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	radius := s.DuplicateRadiusKm
+	if radius <= 0 {
+		radius = defaultDuplicateRadiusKm
+	}
+	// All or nothing, so a failed import can simply be sent again.
+	res := ImportResult{Imported: []dbgen.Spot{}, Skipped: skipped}
+	err = s.WithTx(r.Context(), func(q *dbgen.Queries) error {
+		existing, err := q.GetAllSpots(r.Context())
+		if err != nil {
+			return err
+		}
+		for _, p := range params {
+			p.Latitude, p.Longitude = s.roundCoords(p.Latitude, p.Longitude)
+			if _, d, ok := s.nearestSpot(existing, p.Latitude, p.Longitude); ok && d <= radius {
+				res.Duplicates++
+				continue
+			}
+			spot, err := q.CreateSpot(r.Context(), p)
+			if err != nil {
+				return err
+			}
+			existing = append(existing, spot)
+			res.Imported = append(res.Imported, spot)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("admin imported overpass spots", "imported", len(res.Imported), "duplicates", res.Duplicates, "skipped", res.Skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
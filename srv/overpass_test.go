@@ -0,0 +1,132 @@
+package srv
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const overpassFixture = `{
+  "version": 0.6,
+  "elements": [
+    {"type": "node", "id": 1, "lat": 35.3606, "lon": 138.7274, "tags": {"tourism": "viewpoint", "name": "富士見台", "description": "富士山の眺め"}},
+    {"type": "node", "id": 2, "lat": 35.10, "lon": 139.10, "tags": {"amenity": "cafe", "name": "湖畔カフェ"}},
+    {"type": "node", "id": 3, "lat": 35.20, "lon": 139.20, "tags": {"amenity": "bench"}},
+    {"type": "node", "id": 4, "lat": 35.21, "lon": 139.21, "tags": {"tourism": "viewpoint"}},
+    {"type": "way", "id": 10, "nodes": [101, 102, 103, 104, 101], "tags": {"highway": "rest_area", "name": "山中PA"}},
+    {"type": "node", "id": 101, "lat": 35.00, "lon": 139.00},
+    {"type": "node", "id": 102, "lat": 35.00, "lon": 139.02},
+    {"type": "node", "id": 103, "lat": 35.02, "lon": 139.02},
+    {"type": "node", "id": 104, "lat": 35.02, "lon": 139.00},
+    {"type": "way", "id": 11, "geometry": [{"lat": 35.5, "lon": 139.5}, {"lat": 35.5, "lon": 139.6}, {"lat": 35.6, "lon": 139.6}], "tags": {"amenity": "restaurant", "name": "峠の茶屋", "addr:full": "山梨県"}},
+    {"type": "way", "id": 12, "center": {"lat": 35.7, "lon": 139.7}, "tags": {"tourism": "attraction", "name": "滝"}}
+  ]
+}`
+
+func TestParseOverpass(t *testing.T) {
+	spots, skipped, err := parseOverpass(strings.NewReader(overpassFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 { // the bench and the unnamed viewpoint
+		t.Errorf("expected 2 skipped elements, got %d", skipped)
+	}
+	if len(spots) != 5 {
+		t.Fatalf("expected 5 spots, got %+v", spots)
+	}
+
+	want := []struct {
+		name, category string
+		lat, lng       float64
+	}{
+		{"富士見台", "drive", 35.3606, 138.7274},
+		{"湖畔カフェ", "rest", 35.10, 139.10},
+		{"山中PA", "rest", 35.01, 139.01},           // closed way: the repeated node is not double-counted
+		{"峠の茶屋", "restaurant", 35.5333, 139.5667}, // inline geometry
+		{"滝", "drive", 35.7, 139.7},               // center only
+	}
+	for i, w := range want {
+		got := spots[i]
+		if got.Name != w.name || got.Category != w.category {
+			t.Errorf("spot %d: expected %s (%s), got %s (%s)", i, w.name, w.category, got.Name, got.Category)
+		}
+		if math.Abs(got.Latitude-w.lat) > 1e-4 || math.Abs(got.Longitude-w.lng) > 1e-4 {
+			t.Errorf("%s: expected (%v, %v), got (%v, %v)", w.name, w.lat, w.lng, got.Latitude, got.Longitude)
+		}
+	}
+	if spots[0].Description == nil || *spots[0].Description != "富士山の眺め" {
+		t.Errorf("expected the description tag, got %v", spots[0].Description)
+	}
+	if spots[3].Address == nil || *spots[3].Address != "山梨県" {
+		t.Errorf("expected the address tag, got %v", spots[3].Address)
+	}
+
+	if _, _, err := parseOverpass(strings.NewReader("not json")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestOverpassCategoriesMatchAliases(t *testing.T) {
+	for tag, want := range overpassCategories {
+		_, value, _ := strings.Cut(tag, "=")
+		if got, ok := normalizeCategory(value); ok && got != want {
+			t.Errorf("%s imports as %s, but %q is an alias of %s", tag, want, value, got)
+		}
+	}
+}
+
+func TestAdminImportOverpass(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	seedSpot(t, server, "湖畔のカフェ", "rest", 35.1001, 139.1001) // ~15m from the imported cafe
+
+	importOverpass := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/import/overpass", strings.NewReader(overpassFixture))
+		if email != "" {
+			req.Header.Set("X-ExeDev-Email", email)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := importOverpass("someone@example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin, got %d", w.Code)
+	}
+
+	// A failure partway through imports nothing.
+	mustExec(t, server, `CREATE TRIGGER fail_import BEFORE INSERT ON spots WHEN (SELECT COUNT(*) FROM spots) >= 3
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END`)
+	if w := importOverpass("admin@example.com"); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a failed insert, got %d", w.Code)
+	}
+	var count int
+	if err := server.DB.QueryRow("SELECT COUNT(*) FROM spots").Scan(&count); err != nil || count != 1 {
+		t.Errorf("expected the failed import rolled back, got %d spots (%v)", count, err)
+	}
+	mustExec(t, server, "DROP TRIGGER fail_import")
+
+	w := importOverpass("admin@example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var res ImportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(res.Imported) != 4 || res.Duplicates != 1 || res.Skipped != 2 {
+		t.Errorf("expected 4 imported, 1 duplicate, 2 skipped; got %d, %d, %d", len(res.Imported), res.Duplicates, res.Skipped)
+	}
+
+	// Importing the same result again only finds duplicates.
+	w = importOverpass("admin@example.com")
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(res.Imported) != 0 || res.Duplicates != 5 {
+		t.Errorf("expected everything to be a duplicate, got %d imported, %d duplicates", len(res.Imported), res.Duplicates)
+	}
+}
@@ -0,0 +1,33 @@
+package srv
+
+import (
+	"math"
+	"strings"
+)
+
+// encodePolyline encodes the stops' coordinates with Google's encoded
+// polyline algorithm (1e-5 precision), in order.
+func encodePolyline(stops []RouteStop) string {
+	var b strings.Builder
+	var prevLat, prevLng int64
+	for _, stop := range stops {
+		lat := int64(math.Round(stop.Lat * 1e5))
+		lng := int64(math.Round(stop.Lng * 1e5))
+		encodePolylineValue(&b, lat-prevLat)
+		encodePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodePolylineValue(b *strings.Builder, v int64) {
+	u := uint64(v) << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte(0x20|(u&0x1f)) + 63)
+		u >>= 5
+	}
+	b.WriteByte(byte(u) + 63)
+}
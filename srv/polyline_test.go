@@ -0,0 +1,81 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// decodePolyline is the inverse of encodePolyline.
+func decodePolyline(t *testing.T, s string) [][2]float64 {
+	t.Helper()
+	var points [][2]float64
+	var lat, lng int64
+	for i := 0; i < len(s); {
+		var deltas [2]int64
+		for k := range deltas {
+			var result uint64
+			for shift := 0; ; shift += 5 {
+				if i >= len(s) {
+					t.Fatalf("truncated polyline %q", s)
+				}
+				c := uint64(s[i]) - 63
+				i++
+				result |= (c & 0x1f) << shift
+				if c < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[k] = ^int64(result >> 1)
+			} else {
+				deltas[k] = int64(result >> 1)
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, [2]float64{float64(lat) / 1e5, float64(lng) / 1e5})
+	}
+	return points
+}
+
+func TestEncodePolyline(t *testing.T) {
+	// Example from Google's polyline algorithm documentation.
+	stops := []RouteStop{{Lat: 38.5, Lng: -120.2}, {Lat: 40.7, Lng: -120.95}, {Lat: 43.252, Lng: -126.453}}
+	if got, want := encodePolyline(stops), "_p~iF~ps|U_ulLnnqC_mqNvxq`@"; got != want {
+		t.Errorf("encodePolyline = %q, want %q", got, want)
+	}
+	if got := encodePolyline(nil); got != "" {
+		t.Errorf("expected empty polyline for no stops, got %q", got)
+	}
+}
+
+func TestGenerateRoutePolyline(t *testing.T) {
+	server, llm := newTestServer(t)
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.20481, 139.02512)
+	pass := seedSpot(t, server, "大観山", "drive", 35.18123, 139.08456)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, lake.ID, pass.ID)
+
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.25641, Lng: 139.15526})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Stops) != 4 {
+		t.Fatalf("expected start, 2 stops and return, got %+v", resp.Stops)
+	}
+
+	points := decodePolyline(t, resp.Polyline)
+	if len(points) != len(resp.Stops) {
+		t.Fatalf("expected %d points, got %d", len(resp.Stops), len(points))
+	}
+	for i, stop := range resp.Stops {
+		if math.Abs(points[i][0]-stop.Lat) > 1e-5 || math.Abs(points[i][1]-stop.Lng) > 1e-5 {
+			t.Errorf("point %d: got %v, want (%v, %v)", i, points[i], stop.Lat, stop.Lng)
+		}
+	}
+	if points[0] != points[len(points)-1] {
+		t.Errorf("expected the route to return to its start, got %v", points)
+	}
+}
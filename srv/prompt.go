@@ -0,0 +1,173 @@
+package srv
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// defaultPromptDescriptionMax keeps a candidate's description to about two
+// sentences in prompts.
+const defaultPromptDescriptionMax = 80
+
+// promptDescription shortens a spot description for a prompt to
+// PromptDescriptionMax characters, marking the cut with an ellipsis.
+func (s *Server) promptDescription(desc *string) string {
+	if desc == nil {
+		return ""
+	}
+	return truncateRunes(*desc, s.PromptDescriptionMax)
+}
+
+// truncateRunes cuts text to at most max characters including a trailing
+// "…" when it was cut. max <= 0 leaves text alone.
+func truncateRunes(text string, max int) string {
+	if max <= 0 {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// promptFuncs are available to prompt templates.
+var promptFuncs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+}
+
+// loadPrompts parses the prompt templates in PromptsDir.
+func (s *Server) loadPrompts() (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(promptFuncs).ParseGlob(filepath.Join(s.PromptsDir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("parse prompts: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderPrompt executes the prompt template name (e.g. "route.tmpl") with
+// data. With PromptReload set the templates are re-read first, so prompt
+// edits apply without a restart.
+func (s *Server) renderPrompt(name string, data any) (string, error) {
+	tmpl := s.prompts
+	if s.PromptReload || tmpl == nil {
+		var err error
+		if tmpl, err = s.loadPrompts(); err != nil {
+			return "", err
+		}
+	}
+	var b strings.Builder
+	if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", fmt.Errorf("render prompt %s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// defaultMaxPromptChars leaves plenty of room for a full recommendation
+// prompt with 30 candidates and 20 visits.
+const defaultMaxPromptChars = 20000
+
+// renderRecommendPrompt renders recommend.tmpl with data, trimming the
+// least important sections until it fits in MaxPromptChars characters:
+// the visit history oldest first, then the candidates lowest ranked first,
+// down to one candidate. What was trimmed is logged.
+func (s *Server) renderRecommendPrompt(data recommendPromptData) (string, error) {
+	prompt, err := s.renderPrompt("recommend.tmpl", data)
+	if err != nil || s.MaxPromptChars <= 0 {
+		return prompt, err
+	}
+	full := utf8.RuneCountInString(prompt)
+	size := full
+	var history, candidates int
+	for size > s.MaxPromptChars {
+		switch {
+		case len(data.History) > 0:
+			// History is newest first
+			data.History = data.History[:len(data.History)-1]
+			history++
+		case len(data.Candidates) > 1:
+			// Candidates are ranked best first
+			data.Candidates = data.Candidates[:len(data.Candidates)-1]
+			candidates++
+		default:
+			slog.Warn("recommend prompt over budget with nothing left to trim", "chars", size, "max", s.MaxPromptChars)
+			return prompt, nil
+		}
+		if prompt, err = s.renderPrompt("recommend.tmpl", data); err != nil {
+			return "", err
+		}
+		size = utf8.RuneCountInString(prompt)
+	}
+	if size < full {
+		slog.Warn("trimmed recommend prompt to budget", "chars", full, "trimmed_chars", size, "max", s.MaxPromptChars,
+			"history_dropped", history, "candidates_dropped", candidates)
+	}
+	return prompt, nil
+}
+
+// recommendPromptData is the data for prompts/recommend.tmpl.
+type recommendPromptData struct {
+	Count      string // how many to pick, e.g. "3〜5件"
+	Preference *promptPreference
+	History    []promptVisit
+	Candidates []recommendCandidate
+	Rules      []string // selection rules after the fixed ones
+}
+
+type promptPreference struct {
+	Label  string // favorite category
+	Visits int
+}
+
+type promptVisit struct {
+	Name     string
+	Category string
+	Rating   int64 // 0 when unrated
+}
+
+type recommendCandidate struct {
+	ID          int64
+	Name        string
+	Category    string // label
+	DistanceKm  float64
+	DrivingMin  int
+	Description string
+	Tags        string // e.g. " [屋内] [新着]"
+}
+
+// routePromptData is the data for prompts/route.tmpl.
+type routePromptData struct {
+	Lat, Lng        float64
+	DepartureTime   string
+	Hours           float64
+	Seed            int64
+	ReturnTime      string // empty without a return deadline
+	AvoidRecent     bool
+	AvoidUrban      bool
+	Extra           string // request-specific sections, e.g. category weights
+	RequireLoop     bool
+	CandidateGroups []routeCandidateGroup
+	NumDrive        int
+	IncludeMeal     bool
+	IncludeRest     bool
+	DriveStay       int // default stays in minutes, by category
+	MealStay        int
+	RestStay        int
+}
+
+type routeCandidateGroup struct {
+	Label string
+	Spots []routeCandidate
+}
+
+type routeCandidate struct {
+	ID          int64
+	Name        string
+	DistanceKm  float64
+	Direction   string
+	Description string // with tags appended
+}
@@ -0,0 +1,228 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	cases := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"湖畔の絶景", 10, "湖畔の絶景"},
+		{"湖畔の絶景", 5, "湖畔の絶景"},
+		{"湖畔の絶景スポット", 5, "湖畔の絶…"},
+		{"abcdef", 3, "ab…"},
+		{"湖畔の絶景スポット", 0, "湖畔の絶景スポット"},
+	}
+	for _, c := range cases {
+		if got := truncateRunes(c.text, c.max); got != c.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", c.text, c.max, got, c.want)
+		}
+	}
+}
+
+func TestPromptDescriptionTruncated(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.PromptDescriptionMax = 10
+	spot := seedSpot(t, server, "芦ノ湖", "drive", 35.05, 139.0)
+	full := strings.Repeat("湖と富士山が見える", 10)
+	mustExec(t, server, "UPDATE spots SET description = ? WHERE id = ?", full, spot.ID)
+	cut := truncateRunes(full, 10)
+
+	t.Run("recommend", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, spot.ID)
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		if prompt := llm.lastPrompt(); !strings.Contains(prompt, cut) || strings.Contains(prompt, full) {
+			t.Errorf("expected the truncated description in the prompt, got:\n%s", prompt)
+		}
+		if len(resp.Spots) == 0 || resp.Spots[0].Description == nil || *resp.Spots[0].Description != full {
+			t.Errorf("expected the full description in the response, got %+v", resp.Spots)
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		llm.response = fmt.Sprintf(`{"route_ids": [%d], "message": "ok"}`, spot.ID)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00"})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		if prompt := llm.lastPrompt(); !strings.Contains(prompt, cut) || strings.Contains(prompt, full) {
+			t.Errorf("expected the truncated description in the prompt, got:\n%s", prompt)
+		}
+		if len(resp.Stops) != 3 || resp.Stops[1].Description != full {
+			t.Errorf("expected the full description in the response, got %+v", resp.Stops)
+		}
+	})
+}
+
+func TestRenderPrompts(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	rec, err := server.renderPrompt("recommend.tmpl", recommendPromptData{
+		Count:      "3〜5件",
+		Preference: &promptPreference{Label: "ドライブスポット", Visits: 12},
+		History:    []promptVisit{{Name: "芦ノ湖", Category: "drive", Rating: 5}, {Name: "道の駅", Category: "rest"}},
+		Candidates: []recommendCandidate{{ID: 7, Name: "大観山", Category: "ドライブスポット", DistanceKm: 12.34, DrivingMin: 19, Description: "富士山の眺め", Tags: " [新着]"}},
+		Rules:      []string{"[新着]のスポットを積極的に含める"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"ドライブスポットを3〜5件選んでください",
+		"ユーザーの好み: ドライブスポットを好む傾向があります（12箇所訪問済み）",
+		"- 芦ノ湖 (drive): 5点\n- 道の駅 (rest): 未評価\n",
+		"1. [ID:7] 大観山 (ドライブスポット) - 12.3km/片道19分 - 富士山の眺め [新着]\n",
+		"4. 距離と所要時間のバランス\n5. [新着]のスポットを積極的に含める\n",
+	} {
+		if !strings.Contains(rec, want) {
+			t.Errorf("recommend prompt is missing %q:\n%s", want, rec)
+		}
+	}
+
+	route, err := server.renderPrompt("route.tmpl", routePromptData{
+		Lat: 35.1, Lng: 139.2, DepartureTime: "09:00", Hours: 6, Seed: 42,
+		ReturnTime: "15:00",
+		AvoidUrban: true,
+		Extra:      "\n【総距離の指定】\n- 出発から帰着までの総距離を30km以上にすること\n",
+		CandidateGroups: []routeCandidateGroup{
+			{Label: "ドライブスポット", Spots: []routeCandidate{{ID: 1, Name: "峠", DistanceKm: 5.55, Direction: "北", Description: "眺め"}}},
+			{Label: "食事", Spots: []routeCandidate{{ID: 2, Name: "そば処", DistanceKm: 8, Direction: "東"}}},
+		},
+		NumDrive: 2, IncludeMeal: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"現在地: 緯度35.1000, 経度139.2000",
+		"**15:00までに必ず帰着すること！**",
+		"合計が6.0時間以内",
+		"【重要】都市部を避けるモード",
+		"総距離を30km以上",
+		"ドライブスポット:\n  [ID:1] 峠 (5.5km, 北) - 眺め\n\n食事:\n  [ID:2] そば処 (8.0km, 東) - \n",
+		"ドライブスポットを **2箇所以上** 選ぶ",
+		"食事スポットを **1箇所含める**",
+		"休憩・カフェスポットを **含めない**",
+	} {
+		if !strings.Contains(route, want) {
+			t.Errorf("route prompt is missing %q:\n%s", want, route)
+		}
+	}
+	for _, unwanted := range []string{"周回ルート必須", "最近提案したルート"} {
+		if strings.Contains(route, unwanted) {
+			t.Errorf("route prompt has %q though not requested", unwanted)
+		}
+	}
+}
+
+func TestPromptReload(t *testing.T) {
+	server, _ := newTestServer(t)
+	dir := t.TempDir()
+	write := func(text string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "recommend.tmpl"), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("v1 {{.Count}}")
+	server.PromptsDir = dir
+
+	// Without reload the templates loaded at startup stay in use.
+	if got, _ := server.renderPrompt("recommend.tmpl", recommendPromptData{Count: "3件"}); strings.HasPrefix(got, "v1") {
+		t.Errorf("expected the startup templates, got %q", got)
+	}
+
+	server.PromptReload = true
+	if got, err := server.renderPrompt("recommend.tmpl", recommendPromptData{Count: "3件"}); err != nil || got != "v1 3件" {
+		t.Errorf("expected the edited template, got %q (%v)", got, err)
+	}
+	write("v2 {{.Count}}")
+	if got, _ := server.renderPrompt("recommend.tmpl", recommendPromptData{Count: "3件"}); got != "v2 3件" {
+		t.Errorf("expected the edit to apply without a restart, got %q", got)
+	}
+	write("{{.Missing")
+	if _, err := server.renderPrompt("recommend.tmpl", recommendPromptData{}); err == nil {
+		t.Error("expected a broken template to fail")
+	}
+}
+
+func TestRecommendPromptTrimmedToBudget(t *testing.T) {
+	server, _ := newTestServer(t)
+	data := recommendPromptData{Count: "3〜5件"}
+	for i := range 5 {
+		data.History = append(data.History, promptVisit{Name: fmt.Sprintf("訪問%d", i), Category: "ドライブ"})
+		data.Candidates = append(data.Candidates, recommendCandidate{ID: int64(i + 1), Name: fmt.Sprintf("候補%d", i), Category: "ドライブ", Description: strings.Repeat("眺め", 20)})
+	}
+	size := func(d recommendPromptData) int {
+		t.Helper()
+		prompt, err := server.renderPrompt("recommend.tmpl", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len([]rune(prompt))
+	}
+	// contains reports which of the names prefix0..prefix4 are in prompt.
+	contains := func(prompt, prefix string) []bool {
+		var in []bool
+		for i := range 5 {
+			in = append(in, strings.Contains(prompt, fmt.Sprintf("%s%d", prefix, i)))
+		}
+		return in
+	}
+	render := func(max int) string {
+		t.Helper()
+		server.MaxPromptChars = max
+		prompt, err := server.renderRecommendPrompt(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prompt
+	}
+	all := []bool{true, true, true, true, true}
+
+	prompt := render(size(data))
+	if !slices.Equal(contains(prompt, "訪問"), all) || !slices.Equal(contains(prompt, "候補"), all) {
+		t.Errorf("expected nothing trimmed within budget, got:\n%s", prompt)
+	}
+
+	twoVisits := data
+	twoVisits.History = data.History[:2]
+	prompt = render(size(twoVisits))
+	if got := contains(prompt, "訪問"); !slices.Equal(got, []bool{true, true, false, false, false}) {
+		t.Errorf("expected the oldest visits trimmed first, got %v", got)
+	}
+	if !slices.Equal(contains(prompt, "候補"), all) {
+		t.Errorf("expected candidates kept while history is left, got:\n%s", prompt)
+	}
+
+	threeCandidates := recommendPromptData{Count: data.Count, Candidates: data.Candidates[:3]}
+	prompt = render(size(threeCandidates))
+	if got := contains(prompt, "訪問"); !slices.Equal(got, []bool{false, false, false, false, false}) {
+		t.Errorf("expected the history gone before candidates, got %v", got)
+	}
+	if got := contains(prompt, "候補"); !slices.Equal(got, []bool{true, true, true, false, false}) {
+		t.Errorf("expected the lowest ranked candidates trimmed, got %v", got)
+	}
+
+	if prompt = render(10); !strings.Contains(prompt, "候補0") || strings.Contains(prompt, "候補1") {
+		t.Errorf("expected the best candidate kept however small the budget, got:\n%s", prompt)
+	}
+	if prompt = render(0); !slices.Equal(contains(prompt, "訪問"), all) {
+		t.Errorf("expected no trimming without a budget, got:\n%s", prompt)
+	}
+}
@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pruneInterval is how often the background job prunes old history.
+const pruneInterval = time.Hour
+
+// PruneResult reports what a history prune removed.
+type PruneResult struct {
+	Before                 string `json:"before"`
+	RoutesDeleted          int64  `json:"routes_deleted"`
+	RecommendationsDeleted int64  `json:"recommendations_deleted"`
+}
+
+// pruneHistory deletes route and recommendation history recorded before
+// the given time. Visit history is kept; it backs ratings and stats.
+func (s *Server) pruneHistory(ctx context.Context, before time.Time) (PruneResult, error) {
+	res := PruneResult{Before: before.UTC().Format(time.DateTime)}
+	q := s.Queries
+	var err error
+	if res.RoutesDeleted, err = q.DeleteRouteHistoryBefore(ctx, res.Before); err != nil {
+		return res, err
+	}
+	if res.RecommendationsDeleted, err = q.DeleteRecommendationHistoryBefore(ctx, res.Before); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// runHistoryPruner prunes history older than HistoryRetention and AI
+// audit records older than Audit.Retention every interval until ctx is done.
+func (s *Server) runHistoryPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if s.HistoryRetention > 0 {
+			res, err := s.pruneHistory(ctx, time.Now().Add(-s.HistoryRetention))
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("prune history", "error", err)
+			} else if res.RoutesDeleted+res.RecommendationsDeleted > 0 {
+				slog.Info("pruned history", "before", res.Before, "routes", res.RoutesDeleted, "recommendations", res.RecommendationsDeleted)
+			}
+		}
+		if s.Audit.Retention > 0 {
+			before := time.Now().Add(-s.Audit.Retention).UTC().Format(time.DateTime)
+			n, err := s.Queries.DeleteLLMAuditBefore(ctx, before)
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("prune llm audit", "error", err)
+			} else if n > 0 {
+				slog.Info("pruned llm audit", "before", before, "records", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleAdminPrune deletes route and recommendation history older than
+// older_than_days (default: the configured HistoryRetention).
+func (s *Server) HandleAdminPrune(w http.ResponseWriter, r *http.Request) {
+	retention := s.HistoryRetention
+	if d := r.URL.Query().Get("older_than_days"); d != "" {
+		days, err := strconv.Atoi(d)
+		if err != nil || days < 1 {
+			http.Error(w, "older_than_days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	if retention <= 0 {
+		http.Error(w, "older_than_days is required when no retention is configured", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.pruneHistory(r.Context(), time.Now().Add(-retention))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("admin pruned history", "before", res.Before, "routes", res.RoutesDeleted, "recommendations", res.RecommendationsDeleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
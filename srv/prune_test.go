@@ -0,0 +1,116 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// seedHistory inserts one old (100 days) and one recent (1 day) route and
+// recommendation for user-a.
+func seedHistory(t *testing.T, s *Server) {
+	t.Helper()
+	spot := seedSpot(t, s, "岬の灯台", "drive", 35.0, 139.0)
+	mustExec(t, s, "INSERT INTO users (id) VALUES ('user-a')")
+	for _, age := range []string{"-100 days", "-1 day"} {
+		mustExec(t, s, "INSERT INTO route_history (user_id, route_hash, spot_ids, created_at) VALUES ('user-a', ?, '[]', datetime('now', ?))", age, age)
+		mustExec(t, s, "INSERT INTO recommendation_history (user_id, spot_id, recommended_at) VALUES ('user-a', ?, datetime('now', ?))", spot.ID, age)
+	}
+	mustExec(t, s, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES ('user-a', ?, datetime('now', '-100 days'))", spot.ID)
+}
+
+func countRows(t *testing.T, s *Server, table string) int {
+	t.Helper()
+	var n int
+	if err := s.DB.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestAdminPrune(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	seedHistory(t, server)
+
+	prune := func(path string) (int, PruneResult) {
+		t.Helper()
+		w := adminDo(t, server, http.MethodPost, path, "admin@example.com")
+		var res PruneResult
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w.Code, res
+	}
+
+	if code, _ := prune("/api/admin/prune"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a retention, got %d", code)
+	}
+	if code, _ := prune("/api/admin/prune?older_than_days=0"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for zero days, got %d", code)
+	}
+	if w := adminDo(t, server, http.MethodPost, "/api/admin/prune?older_than_days=30", "someone@example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admin, got %d", w.Code)
+	}
+
+	code, res := prune("/api/admin/prune?older_than_days=30")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if res.RoutesDeleted != 1 || res.RecommendationsDeleted != 1 {
+		t.Errorf("expected one old route and recommendation pruned, got %+v", res)
+	}
+	if countRows(t, server, "route_history") != 1 || countRows(t, server, "recommendation_history") != 1 {
+		t.Errorf("expected the recent rows to be kept")
+	}
+	if countRows(t, server, "visit_history") != 1 {
+		t.Errorf("expected visit history to be untouched")
+	}
+
+	// The configured retention is the default.
+	server.HistoryRetention = 12 * time.Hour
+	if _, res := prune("/api/admin/prune"); res.RoutesDeleted != 1 || res.RecommendationsDeleted != 1 {
+		t.Errorf("expected the remaining day-old rows pruned with 12h retention, got %+v", res)
+	}
+}
+
+func TestHistoryPrunerStopsOnShutdown(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.HistoryRetention = 30 * 24 * time.Hour
+	seedHistory(t, server)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.serveListener(ctx, ln) }()
+
+	// The pruner runs once at startup.
+	deadline := time.Now().Add(5 * time.Second)
+	for countRows(t, server, "route_history") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pruner")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if countRows(t, server, "recommendation_history") != 1 {
+		t.Errorf("expected the old recommendation pruned")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
@@ -0,0 +1,35 @@
+package srv
+
+import (
+	"math/rand/v2"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// intN returns a random int in [0, n) from s.Rand, or from the shared
+// time-seeded source if it is nil. n must be > 0.
+func (s *Server) intN(n int) int {
+	if s.Rand == nil {
+		return rand.IntN(n)
+	}
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+	return s.Rand.IntN(n)
+}
+
+// routeIntN is intN for building req's route: from a source seeded with
+// req.Seed if it has one, so the same seed and inputs give the same route.
+func (s *Server) routeIntN(req RouteRequest, n int) int {
+	if req.rand == nil {
+		return s.intN(n)
+	}
+	return req.rand.IntN(n)
+}
+
+// shuffleSpots puts spots in random order.
+func (s *Server) shuffleSpots(req RouteRequest, spots []dbgen.Spot) {
+	for i := len(spots) - 1; i > 0; i-- {
+		j := s.routeIntN(req, i+1)
+		spots[i], spots[j] = spots[j], spots[i]
+	}
+}
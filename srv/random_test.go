@@ -0,0 +1,90 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSeededRandFixesRoute(t *testing.T) {
+	server, llm := newTestServer(t)
+	for i := range 5 {
+		seedSpot(t, server, fmt.Sprintf("展望台%d", i+1), "drive", 35.0+0.02*float64(i+1), 139.0)
+	}
+	llm.response = "no route today" // the fallback picks a random drive spot
+
+	route := func(user string) (RouteResponse, string) {
+		t.Helper()
+		server.Rand = rand.New(rand.NewPCG(1, 2))
+		w := postJSON(t, server, "/api/route", user, RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00"})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return resp, llm.lastPrompt()
+	}
+
+	resp, prompt := route("user-a")
+	if !strings.Contains(prompt, "ランダムシード: 234") {
+		t.Errorf("expected the seeded prompt seed, got:\n%s", prompt)
+	}
+	var order []string
+	for _, line := range strings.Split(prompt, "\n") {
+		if _, name, ok := strings.Cut(line, "] "); ok && strings.HasPrefix(name, "展望台") {
+			order = append(order, name[:len("展望台")+1])
+		}
+	}
+	if got := strings.Join(order, ","); got != "展望台2,展望台5,展望台3,展望台1,展望台4" {
+		t.Errorf("expected the seeded candidate order, got %s", got)
+	}
+	if len(resp.Stops) != 3 || resp.Stops[1].Name != "展望台2" || resp.Stops[1].ArrivalTime != "09:06" || resp.EstimatedReturn != "09:52" {
+		t.Errorf("expected the seeded fallback route to 展望台2 back at 09:52, got %+v back at %s", resp.Stops, resp.EstimatedReturn)
+	}
+
+	// A second user, so the first route isn't in the history to avoid
+	again, againPrompt := route("user-b")
+	if againPrompt != prompt || again.Stops[1].ID != resp.Stops[1].ID {
+		t.Errorf("expected the same seed to give the same route, got %+v", again.Stops)
+	}
+}
+
+func TestRouteRequestSeed(t *testing.T) {
+	server, llm := newTestServer(t)
+	for i := range 8 {
+		seedSpot(t, server, fmt.Sprintf("展望台%d", i+1), "drive", 35.0+0.02*float64(i+1), 139.0)
+	}
+	llm.response = "no route today" // the fallback picks a random drive spot
+
+	route := func(user string, seed uint64) (RouteResponse, string) {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", user, RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", Seed: &seed})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		resp.RouteID = 0
+		return resp, llm.lastPrompt()
+	}
+
+	// Different users, so neither route is in the other's history to avoid.
+	// server.Rand is unseeded: only the request's seed fixes the route.
+	first, firstPrompt := route("user-a", 42)
+	for _, user := range []string{"user-b", "user-c"} {
+		again, againPrompt := route(user, 42)
+		if againPrompt != firstPrompt {
+			t.Errorf("%s: expected the same prompt for the same seed", user)
+		}
+		a, _ := json.Marshal(first)
+		b, _ := json.Marshal(again)
+		if string(a) != string(b) {
+			t.Errorf("%s: expected the same route for the same seed, got\n%s\nthen\n%s", user, a, b)
+		}
+	}
+
+	if _, other := route("user-d", 7); other == firstPrompt {
+		t.Errorf("expected another seed to shuffle the candidates differently")
+	}
+}
@@ -0,0 +1,122 @@
+package srv
+
+import (
+	"sort"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// freshness returns the boost for a spot created at createdAt: the full
+// FreshnessBoost when brand new, fading linearly to zero at the end of
+// FreshnessWindow.
+func (s *Server) freshness(createdAt, now time.Time) float64 {
+	if s.FreshnessWindow <= 0 || s.FreshnessBoost <= 0 {
+		return 0
+	}
+	age := now.Sub(createdAt)
+	if age < 0 {
+		age = 0
+	}
+	if age >= s.FreshnessWindow {
+		return 0
+	}
+	return s.FreshnessBoost * (1 - float64(age)/float64(s.FreshnessWindow))
+}
+
+// isFresh reports whether the spot is still inside the freshness window.
+func (s *Server) isFresh(spot SpotWithDistance, now time.Time) bool {
+	return s.freshness(spot.CreatedAt, now) > 0
+}
+
+// minCategoryRatings is how many ratings of a category it takes before they
+// affect ranking, so one bad meal doesn't bury every restaurant.
+const minCategoryRatings = 2
+
+// defaultCategoryRatingWeight lets a category rated 5 (or 1) outrank (or
+// sink below) a weather-suited spot, but not a recent recommendation.
+const defaultCategoryRatingWeight = 1.5
+
+// categoryRatings maps each category with at least minCategoryRatings
+// ratings to its average.
+func categoryRatings(rows []dbgen.GetUserCategoryRatingsRow) map[string]float64 {
+	ratings := make(map[string]float64)
+	for _, row := range rows {
+		if row.RatingCount >= minCategoryRatings {
+			ratings[row.Category] = row.AvgRating
+		}
+	}
+	return ratings
+}
+
+// categoryAffinity scores a category from the user's average rating of it:
+// +CategoryRatingWeight at 5 stars, -CategoryRatingWeight at 1 and zero
+// for a neutral 3 or an unrated category.
+func (s *Server) categoryAffinity(ratings map[string]float64, category string) float64 {
+	avg, ok := ratings[category]
+	if !ok {
+		return 0
+	}
+	return (avg - 3) / 2 * s.CategoryRatingWeight
+}
+
+// Scorer scores a recommendation candidate; higher scores rank first, ahead
+// of the AI candidate cap and in the fallback picks. Set Server.Scorer to
+// experiment with ranking without touching the handlers.
+type Scorer interface {
+	Score(c SpotWithDistance, sc ScoreContext) float64
+}
+
+// ScorerFunc adapts a function to a Scorer.
+type ScorerFunc func(c SpotWithDistance, sc ScoreContext) float64
+
+func (f ScorerFunc) Score(c SpotWithDistance, sc ScoreContext) float64 { return f(c, sc) }
+
+// ScoreContext is what a Scorer knows besides the candidate.
+type ScoreContext struct {
+	Request   RecommendRequest
+	UserStats *UserStatsInfo // nil for a new user
+	History   []dbgen.GetUserVisitHistoryRow
+
+	// Recent holds the spots recommended to the user in the last week.
+	Recent map[int64]bool
+
+	// CategoryRatings is the user's average rating per category (see
+	// categoryRatings).
+	CategoryRatings map[string]float64
+
+	Now time.Time
+}
+
+// HeuristicScorer returns the built-in scorer, used when Server.Scorer is
+// nil. It rates how well a candidate suits the request (weather), how the
+// user rates its category (see categoryAffinity), how recently it was added
+// and whether it was recommended lately (down-weighted by RecentPenalty).
+// It reads the server's settings when scoring, not when created.
+func (s *Server) HeuristicScorer() Scorer {
+	return ScorerFunc(func(c SpotWithDistance, sc ScoreContext) float64 {
+		score := float64(weatherScore(c, sc.Request.Weather)) + s.freshness(c.CreatedAt, sc.Now)
+		score += s.categoryAffinity(sc.CategoryRatings, c.Category)
+		if sc.Recent[c.ID] {
+			score -= s.RecentPenalty
+		}
+		return score
+	})
+}
+
+// rankCandidates stably orders candidates by Server.Scorer (by default
+// HeuristicScorer), so the best ones survive the AI candidate cap and are
+// listed first. Ties keep their original order.
+func (s *Server) rankCandidates(candidates []SpotWithDistance, sc ScoreContext) {
+	scorer := s.Scorer
+	if scorer == nil {
+		scorer = s.HeuristicScorer()
+	}
+	scores := make(map[int64]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c.ID] = scorer.Score(c, sc)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].ID] > scores[candidates[j].ID]
+	})
+}
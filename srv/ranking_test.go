@@ -0,0 +1,217 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestFreshnessBoost(t *testing.T) {
+	server, llm := newTestServer(t)
+	now := time.Now()
+	old := SpotWithDistance{Spot: dbgen.Spot{ID: 1, Name: "老舗の峠", CreatedAt: now.AddDate(-1, 0, 0)}, DistanceKm: 20}
+	fresh := SpotWithDistance{Spot: dbgen.Spot{ID: 2, Name: "新しい展望台", CreatedAt: now.Add(-time.Hour)}, DistanceKm: 20}
+
+	rank := func() []int64 {
+		candidates := []SpotWithDistance{old, fresh}
+		server.rankCandidates(candidates, ScoreContext{Now: now})
+		return []int64{candidates[0].ID, candidates[1].ID}
+	}
+
+	if got := rank(); got[0] != old.ID {
+		t.Errorf("expected the original order without a freshness window, got %v", got)
+	}
+
+	server.FreshnessWindow = 30 * 24 * time.Hour
+	if got := rank(); got[0] != fresh.ID {
+		t.Errorf("expected the new spot first with the boost enabled, got %v", got)
+	}
+
+	// The boost fades out over the window.
+	if b := server.freshness(now.Add(-15*24*time.Hour), now); b <= 0 || b >= server.FreshnessBoost {
+		t.Errorf("expected a partial boost halfway through the window, got %v", b)
+	}
+	if b := server.freshness(now.Add(-31*24*time.Hour), now); b != 0 {
+		t.Errorf("expected no boost after the window, got %v", b)
+	}
+
+	t.Run("prompt", func(t *testing.T) {
+		newSpot := seedSpot(t, server, "新しい展望台", "drive", 35.1, 139.0)
+		oldSpot := seedSpot(t, server, "老舗の峠", "drive", 35.1, 139.0)
+		mustExec(t, server, "UPDATE spots SET created_at = datetime('now', '-1 year') WHERE id = ?", oldSpot.ID)
+		llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, newSpot.ID)
+
+		postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		prompt := llm.lastPrompt()
+		if !strings.Contains(prompt, "新しい展望台 (") || !strings.Contains(prompt, "[新着]") {
+			t.Fatalf("expected the new spot tagged as new, got:\n%s", prompt)
+		}
+		if strings.Index(prompt, newSpot.Name) > strings.Index(prompt, oldSpot.Name) {
+			t.Errorf("expected the new spot listed before the old one")
+		}
+		if strings.Count(prompt, "[新着]") != 2 { // the tag and the rule
+			t.Errorf("expected only the new spot to be tagged, got:\n%s", prompt)
+		}
+	})
+}
+
+func TestRecentPenalty(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.MinRecommendations, server.MaxRecommendations = 1, 1
+	near := seedSpot(t, server, "近くの展望台", "drive", 35.05, 139.0)
+	far := seedSpot(t, server, "遠くの峠", "drive", 35.2, 139.0)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id) VALUES ('user-a', ?)", near.ID)
+	llm.response = `{"spot_ids": [], "message": ""}` // leave the pick to the ranked fallback
+
+	pick := func() int64 {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Spots) != 1 {
+			t.Fatalf("expected 1 spot, got %+v", resp.Spots)
+		}
+		return resp.Spots[0].ID
+	}
+
+	// Without a penalty the nearer spot still comes first.
+	server.RecentPenalty = 0
+	if got := pick(); got != near.ID {
+		t.Errorf("expected the recently recommended near spot with no penalty, got %d", got)
+	}
+
+	server.RecentPenalty = 3
+	if got := pick(); got != far.ID {
+		t.Errorf("expected the penalty to prefer the far spot, got %d", got)
+	}
+
+	// Now both were recommended recently; they're down-weighted, not banned.
+	if got := pick(); got != near.ID {
+		t.Errorf("expected a recommendation even when everything is recent, got %d", got)
+	}
+}
+
+func TestCategoryRatingRanking(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.MinRecommendations, server.MaxRecommendations = 3, 3
+	// The AI picks nothing, so the ranked candidates are served.
+	llm.response = `{"spot_ids": [], "message": ""}`
+
+	// Restaurants are nearest, so they lead without any ratings.
+	var meals, drives []int64
+	for i := range 3 {
+		meals = append(meals, seedSpot(t, server, fmt.Sprintf("食堂%d", i), "restaurant", 35.01+0.01*float64(i), 139.0).ID)
+	}
+	for i := range 3 {
+		drives = append(drives, seedSpot(t, server, fmt.Sprintf("展望台%d", i), "drive", 35.1+0.01*float64(i), 139.0).ID)
+	}
+	// Already visited, so never candidates themselves.
+	pastMeal := seedSpot(t, server, "昔の定食屋", "restaurant", 36.0, 139.0)
+	pastMeal2 := seedSpot(t, server, "昔のラーメン屋", "restaurant", 36.0, 139.1)
+	pastDrive := seedSpot(t, server, "昔の峠", "drive", 36.0, 139.2)
+	for _, u := range []string{"picky", "picky2", "fan", "once"} {
+		mustExec(t, server, "INSERT INTO users (id) VALUES (?)", u)
+	}
+	rate := func(user string, spotID int64, rating int) {
+		mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, rating) VALUES (?, ?, ?)", user, spotID, rating)
+	}
+	rate("picky", pastMeal.ID, 1)
+	rate("picky", pastMeal2.ID, 2)
+	rate("picky", pastDrive.ID, 3)
+	rate("picky2", pastMeal.ID, 1)
+	rate("picky2", pastMeal2.ID, 1)
+	rate("fan", pastMeal.ID, 5)
+	rate("fan", pastMeal2.ID, 4)
+	rate("once", pastMeal.ID, 1) // a single rating isn't enough to judge
+
+	restaurants := func(user string) int {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", user, RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		n := 0
+		for _, sp := range resp.Spots {
+			if sp.Category == "restaurant" {
+				n++
+			}
+		}
+		return n
+	}
+
+	if got := restaurants("picky"); got != 0 {
+		t.Errorf("expected a user who rates restaurants poorly to get none, got %d", got)
+	}
+	if got := restaurants("fan"); got != 3 {
+		t.Errorf("expected a user who rates restaurants highly to get them first, got %d", got)
+	}
+	if got := restaurants("once"); got != 3 {
+		t.Errorf("expected one rating to leave the order alone, got %d", got)
+	}
+
+	server.CategoryRatingWeight = 0
+	if got := restaurants("picky2"); got != 3 {
+		t.Errorf("expected ratings ignored with a zero weight, got %d", got)
+	}
+}
+
+func TestCustomScorer(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.MinRecommendations, server.MaxRecommendations = 3, 3
+	llm.response = "not json" // fall back to the ranked candidates
+	var ids []int64
+	for i := range 3 {
+		ids = append(ids, seedSpot(t, server, fmt.Sprintf("展望台%d", i), "drive", 35.05+0.05*float64(i), 139.0).ID)
+	}
+	recommend := func() []int64 {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, Weather: "rain"})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []int64
+		for _, sp := range resp.Spots {
+			got = append(got, sp.ID)
+		}
+		return got
+	}
+
+	if got, want := fmt.Sprint(recommend()), fmt.Sprint(ids); got != want {
+		t.Errorf("expected the heuristic to keep the nearest first, want %s, got %s", want, got)
+	}
+
+	// Farthest first, and see what the scorer is told.
+	var seen ScoreContext
+	server.Scorer = ScorerFunc(func(c SpotWithDistance, sc ScoreContext) float64 {
+		seen = sc
+		return c.DistanceKm
+	})
+	if got, want := fmt.Sprint(recommend()), fmt.Sprint([]int64{ids[2], ids[1], ids[0]}); got != want {
+		t.Errorf("expected the custom scorer to order the fallback, want %s, got %s", want, got)
+	}
+	if seen.Request.Weather != "rain" || seen.Now.IsZero() || !seen.Recent[ids[0]] {
+		t.Errorf("expected the request, time and recent picks in the context, got %+v", seen)
+	}
+
+	// Experiments can build on the heuristic: here, sink one spot.
+	heuristic := server.HeuristicScorer()
+	server.Scorer = ScorerFunc(func(c SpotWithDistance, sc ScoreContext) float64 {
+		score := heuristic.Score(c, sc)
+		if c.ID == ids[0] {
+			score -= 100
+		}
+		return score
+	})
+	if got := recommend(); len(got) != 3 || got[2] != ids[0] {
+		t.Errorf("expected %d last, got %v", ids[0], got)
+	}
+}
@@ -0,0 +1,166 @@
+package srv
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// maxReachableSpots caps how many spots one reachability request may check.
+const maxReachableSpots = 200
+
+// ReachableRequest asks which of SpotIDs can be reached from the origin
+// within the same distance/time limits HandleRecommend applies.
+type ReachableRequest struct {
+	Lat           float64 `json:"lat"`
+	Lng           float64 `json:"lng"`
+	SpotIDs       []int64 `json:"spot_ids"`
+	MaxDistanceKm float64 `json:"max_distance_km"`
+	MaxTimeHours  float64 `json:"max_time_hours"`
+}
+
+// SpotReachability reports whether one spot is reachable and why not.
+type SpotReachability struct {
+	SpotID         int64   `json:"spot_id"`
+	Reachable      bool    `json:"reachable"`
+	DistanceKm     float64 `json:"distance_km"`
+	DrivingTimeMin int     `json:"driving_time_min"`
+	Reason         string  `json:"reason,omitempty"` // "not_found", "too_far" or "too_long"
+}
+
+// HandleReachable reports per-spot reachability from an origin so the UI
+// can gray out spots before the user commits to a request.
+func (s *Server) HandleReachable(w http.ResponseWriter, r *http.Request) {
+	var req ReachableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.SpotIDs) > maxReachableSpots {
+		http.Error(w, "too many spot_ids", http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxDistanceKm == 0 {
+		req.MaxDistanceKm = defaultMaxDistanceKm
+	}
+	if req.MaxTimeHours == 0 {
+		req.MaxTimeHours = defaultMaxTimeHours
+	}
+
+	// Spots still under moderation, or rejected, are reported not_found.
+	q := s.Queries
+	allSpots, err := q.GetApprovedSpots(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	spotMap := make(map[int64]dbgen.Spot, len(allSpots))
+	for _, sp := range allSpots {
+		spotMap[sp.ID] = sp
+	}
+
+	results := make([]SpotReachability, 0, len(req.SpotIDs))
+	for _, id := range req.SpotIDs {
+		spot, ok := spotMap[id]
+		if !ok {
+			results = append(results, SpotReachability{SpotID: id, Reason: "not_found"})
+			continue
+		}
+
+		dist := s.distanceKm(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
+		est := newSpotWithDistance(spot, dist)
+		reason := unreachableReason(est, dist, req.MaxDistanceKm, req.MaxTimeHours)
+		results = append(results, SpotReachability{
+			SpotID:         id,
+			Reachable:      reason == "",
+			DistanceKm:     est.DistanceKm,
+			DrivingTimeMin: est.DrivingTimeMin,
+			Reason:         reason,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// unreachableReason is why est, dist km from the origin, falls outside the
+// limits HandleRecommend applies: "too_far", "too_long", or "" if it's
+// reachable.
+func unreachableReason(est SpotWithDistance, dist, maxDistanceKm, maxTimeHours float64) string {
+	switch {
+	case dist > maxDistanceKm:
+		return "too_far"
+	case float64(est.DrivingTimeMin)/60 > maxTimeHours:
+		return "too_long"
+	}
+	return ""
+}
+
+// ReachableSummary counts the spots reachable from an origin per category.
+type ReachableSummary struct {
+	Lat           float64        `json:"lat"`
+	Lng           float64        `json:"lng"`
+	MaxDistanceKm float64        `json:"max_distance_km"`
+	MaxTimeHours  float64        `json:"max_time_hours"`
+	Total         int            `json:"total"`
+	Categories    map[string]int `json:"categories"` // every known category, even if 0
+}
+
+// HandleReachableSummary serves
+// GET /api/reachable/summary?lat=&lng=[&max_time_hours=][&max_distance_km=],
+// counting the spots HandleReachable would report reachable, so users can
+// see what's around before planning.
+func (s *Server) HandleReachableSummary(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || math.Abs(lat) > 90 {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil || math.Abs(lng) > 180 {
+		http.Error(w, "invalid lng", http.StatusBadRequest)
+		return
+	}
+	maxDistanceKm, err := floatParam(r, "max_distance_km", defaultMaxDistanceKm)
+	if err != nil || maxDistanceKm <= 0 {
+		http.Error(w, "max_distance_km must be > 0", http.StatusBadRequest)
+		return
+	}
+	maxTimeHours, err := floatParam(r, "max_time_hours", defaultMaxTimeHours)
+	if err != nil || maxTimeHours <= 0 {
+		http.Error(w, "max_time_hours must be > 0", http.StatusBadRequest)
+		return
+	}
+	sum := ReachableSummary{
+		Lat:           lat,
+		Lng:           lng,
+		MaxDistanceKm: maxDistanceKm,
+		MaxTimeHours:  maxTimeHours,
+		Categories:    make(map[string]int, len(validCategories)),
+	}
+
+	spots, err := s.loadSpots(r.Context(), s.Queries, s.areaAround(lat, lng, sum.MaxDistanceKm))
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	for category := range validCategories {
+		sum.Categories[category] = 0
+	}
+	for _, spot := range spots {
+		dist := s.distanceKm(lat, lng, spot.Latitude, spot.Longitude)
+		if unreachableReason(newSpotWithDistance(spot, dist), dist, sum.MaxDistanceKm, sum.MaxTimeHours) != "" {
+			continue
+		}
+		sum.Categories[spot.Category]++
+		sum.Total++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sum)
+}
@@ -0,0 +1,103 @@
+package srv
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReachable(t *testing.T) {
+	server, _ := newTestServer(t)
+	near := seedSpot(t, server, "近くの滝", "drive", 35.1, 139.0)          // ~11km
+	far := seedSpot(t, server, "遠くの湖", "drive", 36.5, 139.0)           // ~167km
+	slow := seedSpot(t, server, "山奥の温泉", "rest", 35.0+90/111.2, 139.0) // 90km, 135 min
+
+	w := postJSON(t, server, "/api/reachable", "user-a", ReachableRequest{
+		Lat:           35.0,
+		Lng:           139.0,
+		SpotIDs:       []int64{near.ID, far.ID, slow.ID, 9999},
+		MaxDistanceKm: 100,
+		MaxTimeHours:  2,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var results []SpotReachability
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	want := []struct {
+		id        int64
+		reachable bool
+		reason    string
+	}{
+		{near.ID, true, ""},
+		{far.ID, false, "too_far"},
+		{slow.ID, false, "too_long"},
+		{9999, false, "not_found"},
+	}
+	for i, wr := range want {
+		got := results[i]
+		if got.SpotID != wr.id || got.Reachable != wr.reachable || got.Reason != wr.reason {
+			t.Errorf("result %d: expected %+v, got %+v", i, wr, got)
+		}
+	}
+	if results[0].DrivingTimeMin != drivingMinutes(haversine(35.0, 139.0, near.Latitude, near.Longitude)) {
+		t.Errorf("unexpected driving time %d", results[0].DrivingTimeMin)
+	}
+	if results[2].DistanceKm < 89.5 || results[2].DistanceKm > 90.5 {
+		t.Errorf("expected ~90km, got %v", results[2].DistanceKm)
+	}
+}
+
+func TestReachableSummary(t *testing.T) {
+	server, _ := newTestServer(t)
+	seedSpot(t, server, "近くの滝", "drive", 35.1, 139.0)               // ~11km
+	seedSpot(t, server, "海辺の道", "drive", 34.9, 139.0)               // ~11km
+	seedSpot(t, server, "峠の茶屋", "restaurant", 35.0+45/111.2, 139.0) // 45km, 67 min
+	seedSpot(t, server, "山奥の温泉", "rest", 35.0+90/111.2, 139.0)      // 90km, 135 min
+	seedSpot(t, server, "遠くの湖", "drive", 36.5, 139.0)               // ~167km
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/reachable/summary"+query, nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  map[string]int
+	}{
+		{"?lat=35&lng=139&max_time_hours=2", map[string]int{"drive": 2, "restaurant": 1, "rest": 0}},
+		{"?lat=35&lng=139&max_time_hours=0.5", map[string]int{"drive": 2, "restaurant": 0, "rest": 0}},
+		{"?lat=35&lng=139&max_time_hours=5&max_distance_km=200", map[string]int{"drive": 3, "restaurant": 1, "rest": 1}},
+	} {
+		w := get(tc.query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.query, w.Code, w.Body.String())
+		}
+		var sum ReachableSummary
+		if err := json.Unmarshal(w.Body.Bytes(), &sum); err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, n := range tc.want {
+			total += n
+		}
+		if !maps.Equal(sum.Categories, tc.want) || sum.Total != total {
+			t.Errorf("%s: expected %v (%d total), got %v (%d total)", tc.query, tc.want, total, sum.Categories, sum.Total)
+		}
+	}
+
+	for _, query := range []string{"?lng=139", "?lat=35&lng=139&max_time_hours=0", "?lat=35&lng=139&max_distance_km=x"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package srv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"srv.exe.dev/db/dbgen"
+)
+
+// recommendQueryConcurrency bounds how many enrichment queries
+// HandleRecommend runs at once.
+const recommendQueryConcurrency = 4
+
+// recommendInputs is everything HandleRecommend reads before filtering.
+type recommendInputs struct {
+	visitedSet map[int64]bool
+	recentSet  map[int64]bool
+	cappedSet  map[int64]bool // recommended SpotRecommendCap times already
+	userStats  *UserStatsInfo
+	history    []dbgen.GetUserVisitHistoryRow
+	allSpots   []dbgen.Spot
+
+	// categoryRatings is the user's average rating per category, for
+	// categories they rated at least minCategoryRatings times.
+	categoryRatings map[string]float64
+}
+
+// loadRecommendInputs runs the independent read queries for userID with at
+// most limit in flight, loading spots in area. Only the spot list is
+// required; the per-user queries personalize the result and are skipped on
+// error.
+func (s *Server) loadRecommendInputs(ctx context.Context, q *dbgen.Queries, userID string, area spotArea, limit int) (recommendInputs, error) {
+	in := recommendInputs{
+		visitedSet: make(map[int64]bool),
+		recentSet:  make(map[int64]bool),
+		cappedSet:  make(map[int64]bool),
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+
+	// Get user's visit history
+	g.Go(func() error {
+		visitedIDs, err := q.GetUserVisitedSpotIDs(ctx, userID)
+		if err != nil {
+			slog.Warn("load visited spots", "user", userID, "error", err)
+		}
+		for _, id := range visitedIDs {
+			in.visitedSet[id] = true
+		}
+		return nil
+	})
+
+	// Get visited spots the user liked enough to be offered again
+	revisitable := make(map[int64]bool)
+	if s.RevisitMinRating > 0 {
+		g.Go(func() error {
+			ids, err := q.GetRevisitableSpotIDs(ctx, dbgen.GetRevisitableSpotIDsParams{
+				UserID:    userID,
+				MinRating: int64(s.RevisitMinRating),
+				Since:     time.Now().Add(-s.RevisitCooldown).UTC().Format(time.DateTime),
+			})
+			if err != nil {
+				slog.Warn("load revisitable spots", "user", userID, "error", err)
+			}
+			for _, id := range ids {
+				revisitable[id] = true
+			}
+			return nil
+		})
+	}
+
+	// Get recent recommendations to avoid repetition
+	g.Go(func() error {
+		recentRecs, err := q.GetRecentRecommendations(ctx, userID)
+		if err != nil {
+			slog.Warn("load recent recommendations", "user", userID, "error", err)
+		}
+		for _, id := range recentRecs {
+			in.recentSet[id] = true
+		}
+		return nil
+	})
+
+	// Get spots recommended to the user too often
+	if s.SpotRecommendCap > 0 {
+		g.Go(func() error {
+			capped, err := q.GetOverRecommendedSpotIDs(ctx, dbgen.GetOverRecommendedSpotIDsParams{
+				UserID:   userID,
+				Since:    time.Now().Add(-s.SpotRecommendCapWindow).UTC().Format(time.DateTime),
+				MaxTimes: int64(s.SpotRecommendCap),
+			})
+			if err != nil {
+				slog.Warn("load over-recommended spots", "user", userID, "error", err)
+			}
+			for _, id := range capped {
+				in.cappedSet[id] = true
+			}
+			return nil
+		})
+	}
+
+	// Get user stats for personalization
+	g.Go(func() error {
+		stats, err := q.GetUserStats(ctx, userID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				slog.Warn("load user stats", "user", userID, "error", err)
+			}
+			return nil
+		}
+		if stats.TotalVisits > 0 {
+			in.userStats = &UserStatsInfo{
+				TotalVisits:      int(stats.TotalVisits),
+				FavoriteCategory: stats.FavoriteCategory,
+			}
+		}
+		return nil
+	})
+
+	// Get visit history for AI context
+	g.Go(func() error {
+		history, err := q.GetUserVisitHistory(ctx, dbgen.GetUserVisitHistoryParams{
+			UserID: userID,
+			Limit:  20,
+		})
+		if err != nil {
+			slog.Warn("load visit history", "user", userID, "error", err)
+		}
+		in.history = history
+		return nil
+	})
+
+	// Get the user's ratings per category for ranking
+	g.Go(func() error {
+		rows, err := q.GetUserCategoryRatings(ctx, userID)
+		if err != nil {
+			slog.Warn("load category ratings", "user", userID, "error", err)
+		}
+		in.categoryRatings = categoryRatings(rows)
+		return nil
+	})
+
+	// Get the spots around the origin
+	g.Go(func() error {
+		allSpots, err := s.loadSpots(ctx, q, area)
+		in.allSpots = allSpots
+		return err
+	})
+
+	if err := g.Wait(); err != nil {
+		return recommendInputs{}, err
+	}
+	for id := range revisitable {
+		delete(in.visitedSet, id)
+	}
+	return in, nil
+}
+
+// recommendArea is where req's candidates can be before any widening for
+// MinCandidatePool, which candidatePool loads itself.
+func (s *Server) recommendArea(req RecommendRequest) spotArea {
+	km := req.MaxDistanceKm
+	if km == 0 {
+		km = defaultMaxDistanceKm
+	}
+	return s.areaAround(req.Lat, req.Lng, km)
+}
+
+// maxRecommendBatch caps the number of origins in one batch request.
+const maxRecommendBatch = 10
+
+// HandleRecommendBatch recommends spots for several candidate origins at
+// once. The body is a JSON array of RecommendRequest; the response is an
+// array of RecommendResponse in the same order.
+func (s *Server) HandleRecommendBatch(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var reqs []RecommendRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(reqs) == 0 {
+		http.Error(w, "at least one origin is required", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > maxRecommendBatch {
+		http.Error(w, fmt.Sprintf("too many origins (max %d)", maxRecommendBatch), http.StatusBadRequest)
+		return
+	}
+	for _, req := range reqs {
+		if err := validateMaxDifficulty(req.MaxDifficulty); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateMaxSpotFee(req.MaxSpotFee); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resps, err := s.recommendBatch(r.Context(), s.Queries, userID, reqs)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resps)
+}
+
+// recommendBatch loads the user's history once and runs the
+// recommendation pipeline for each request against it. Spots are loaded
+// per origin, so the MaxCandidateSpots cap keeps those nearest each one
+// rather than those between them.
+func (s *Server) recommendBatch(ctx context.Context, q *dbgen.Queries, userID string, reqs []RecommendRequest) ([]RecommendResponse, error) {
+	// Ensure user exists
+	_, _ = q.GetOrCreateUser(ctx, userID)
+
+	in, err := retryTransient(ctx, func() (recommendInputs, error) {
+		return s.loadRecommendInputs(ctx, q, userID, s.recommendArea(reqs[0]), recommendQueryConcurrency)
+	})
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]RecommendResponse, len(reqs))
+	for i, req := range reqs {
+		if i > 0 {
+			in.allSpots, err = retryTransient(ctx, func() ([]dbgen.Spot, error) {
+				return s.loadSpots(ctx, q, s.recommendArea(req))
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		resps[i] = s.recommend(ctx, userID, req, in)
+	}
+	return resps, nil
+}
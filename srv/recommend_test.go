@@ -0,0 +1,486 @@
+package srv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// slowDB delays every query and fails those containing failOn.
+type slowDB struct {
+	dbgen.DBTX
+	delay  time.Duration
+	failOn string
+}
+
+func (d slowDB) wrap(ctx context.Context, query string) context.Context {
+	time.Sleep(d.delay)
+	if d.failOn != "" && strings.Contains(query, d.failOn) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		return ctx
+	}
+	return ctx
+}
+
+func (d slowDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DBTX.QueryContext(d.wrap(ctx, query), query, args...)
+}
+
+func (d slowDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DBTX.QueryRowContext(d.wrap(ctx, query), query, args...)
+}
+
+// countingDB counts queries by their sqlc name.
+type countingDB struct {
+	dbgen.DBTX
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (d *countingDB) count(query string) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(query, "-- name: "), " ")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = make(map[string]int)
+	}
+	d.counts[name]++
+}
+
+func (d *countingDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	d.count(query)
+	return d.DBTX.ExecContext(ctx, query, args...)
+}
+
+func (d *countingDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	d.count(query)
+	return d.DBTX.QueryContext(ctx, query, args...)
+}
+
+func (d *countingDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	d.count(query)
+	return d.DBTX.QueryRowContext(ctx, query, args...)
+}
+
+func TestLoadRecommendInputs(t *testing.T) {
+	server, _ := newTestServer(t)
+	visited := seedSpot(t, server, "旧道の峠", "drive", 35.1, 139.0)
+	recent := seedSpot(t, server, "港の食堂", "restaurant", 35.0, 139.1)
+	seedSpot(t, server, "道の駅", "rest", 35.2, 139.2)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, rating) VALUES ('user-a', ?, 4)", visited.ID)
+	mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id) VALUES ('user-a', ?)", recent.ID)
+
+	for _, limit := range []int{1, recommendQueryConcurrency} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			in, err := server.loadRecommendInputs(context.Background(), dbgen.New(server.DB), "user-a", everywhere, limit)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if !in.visitedSet[visited.ID] || len(in.visitedSet) != 1 {
+				t.Errorf("unexpected visited set %v", in.visitedSet)
+			}
+			if !in.recentSet[recent.ID] || len(in.recentSet) != 1 {
+				t.Errorf("unexpected recent set %v", in.recentSet)
+			}
+			if in.userStats == nil || in.userStats.TotalVisits != 1 || in.userStats.FavoriteCategory != "drive" {
+				t.Errorf("unexpected stats %+v", in.userStats)
+			}
+			if len(in.history) != 1 || len(in.allSpots) != 3 {
+				t.Errorf("expected 1 history row and 3 spots, got %d and %d", len(in.history), len(in.allSpots))
+			}
+		})
+	}
+
+	t.Run("optional query fails", func(t *testing.T) {
+		q := dbgen.New(slowDB{DBTX: server.DB, failOn: "GetUserStats"})
+		in, err := server.loadRecommendInputs(context.Background(), q, "user-a", everywhere, recommendQueryConcurrency)
+		if err != nil {
+			t.Fatalf("expected stats failure to be tolerated, got %v", err)
+		}
+		if in.userStats != nil || len(in.allSpots) != 3 || !in.visitedSet[visited.ID] {
+			t.Errorf("expected everything but stats, got %+v", in)
+		}
+	})
+
+	t.Run("spots query fails", func(t *testing.T) {
+		q := dbgen.New(slowDB{DBTX: server.DB, failOn: "GetSpotsInArea"})
+		if _, err := server.loadRecommendInputs(context.Background(), q, "user-a", everywhere, recommendQueryConcurrency); err == nil {
+			t.Error("expected an error when spots can't be loaded")
+		}
+	})
+}
+
+func BenchmarkLoadRecommendInputs(b *testing.B) {
+	server, err := New(filepath.Join(b.TempDir(), "bench.sqlite3"), "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer server.DB.Close()
+	q := dbgen.New(slowDB{DBTX: server.DB, delay: 2 * time.Millisecond})
+
+	for _, limit := range []int{1, recommendQueryConcurrency} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := server.loadRecommendInputs(context.Background(), q, "user-a", everywhere, limit); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommendBatch(t *testing.T) {
+	server, llm := newTestServer(t)
+	tokyo := seedSpot(t, server, "東京タワー", "drive", 35.6586, 139.7454)
+	osaka := seedSpot(t, server, "大阪城", "drive", 34.6873, 135.5262)
+	// The stub suggests both spots for every origin; each origin may only
+	// keep the spot within its own range.
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, %d], "message": "ok"}`, tokyo.ID, osaka.ID)
+	reqs := []RecommendRequest{
+		{Lat: 35.68, Lng: 139.76},
+		{Lat: 34.70, Lng: 135.50},
+	}
+
+	db := &countingDB{DBTX: server.DB}
+	resps, err := server.recommendBatch(context.Background(), dbgen.New(db), "user-a", reqs)
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(resps))
+	}
+	for i, want := range []dbgen.Spot{tokyo, osaka} {
+		got := resps[i].Spots
+		if len(got) != 1 || got[0].ID != want.ID {
+			t.Errorf("origin %d: expected only %s, got %+v", i, want.Name, got)
+			continue
+		}
+		if got[0].DistanceKm > 10 {
+			t.Errorf("origin %d: expected distance from its own origin, got %.1fkm", i, got[0].DistanceKm)
+		}
+	}
+	if llm.calls() != 2 {
+		t.Errorf("expected one LLM call per origin, got %d", llm.calls())
+	}
+	for _, name := range []string{"GetUserVisitHistory", "GetUserStats"} {
+		if n := db.counts[name]; n != 1 {
+			t.Errorf("expected %s to run once for the batch, ran %d times", name, n)
+		}
+	}
+	if n := db.counts["GetSpotsInArea"]; n != len(reqs) {
+		t.Errorf("expected GetSpotsInArea to run once per origin, ran %d times", n)
+	}
+
+	t.Run("limits", func(t *testing.T) {
+		if w := postJSON(t, server, "/api/recommend/batch", "user-a", []RecommendRequest{}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for an empty batch, got %d", w.Code)
+		}
+		if w := postJSON(t, server, "/api/recommend/batch", "user-a", make([]RecommendRequest, maxRecommendBatch+1)); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for an oversized batch, got %d", w.Code)
+		}
+		w := postJSON(t, server, "/api/recommend/batch", "user-a", reqs)
+		var got []RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 2 {
+			t.Errorf("expected 2 responses over HTTP, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("capped per origin", func(t *testing.T) {
+		// Spots halfway between the origins mustn't use up the cap.
+		server.MaxCandidateSpots = 2
+		seedSpot(t, server, "中間の湖", "drive", 35.18, 137.63)
+		seedSpot(t, server, "中間の峠", "drive", 35.18, 137.64)
+		resps, err := server.recommendBatch(context.Background(), server.Queries, "user-b", reqs)
+		if err != nil {
+			t.Fatalf("batch: %v", err)
+		}
+		for i, want := range []dbgen.Spot{tokyo, osaka} {
+			if got := resps[i].Spots; len(got) != 1 || got[0].ID != want.ID {
+				t.Errorf("origin %d: expected %s, got %+v", i, want.Name, got)
+			}
+		}
+	})
+}
+
+func TestRecommendCountThresholds(t *testing.T) {
+	server, llm := newTestServer(t)
+	var spots []dbgen.Spot
+	for i := range 6 {
+		spots = append(spots, seedSpot(t, server, fmt.Sprintf("スポット%d", i), "drive", 35.0+0.05*float64(i+1), 139.0))
+	}
+	recommend := func(aiIDs ...int64) RecommendResponse {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{"spot_ids": aiIDs, "message": "ok"})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	// Defaults: one pick is topped up to the maximum of 5.
+	if got := recommend(spots[0].ID); len(got.Spots) != 5 || got.Spots[0].ID != spots[0].ID {
+		t.Errorf("expected the AI pick plus fallback up to 5, got %+v", got.Spots)
+	}
+
+	// A single-card UI: exactly one, even when the AI picks more.
+	server.MinRecommendations, server.MaxRecommendations = 1, 1
+	if got := recommend(spots[1].ID, spots[2].ID); len(got.Spots) != 1 || got.Spots[0].ID != spots[1].ID {
+		t.Errorf("expected only the first AI pick, got %+v", got.Spots)
+	}
+	if got := recommend(); len(got.Spots) != 1 {
+		t.Errorf("expected one fallback spot, got %+v", got.Spots)
+	}
+	if !strings.Contains(llm.lastPrompt(), "1件選んで") {
+		t.Errorf("expected the prompt to ask for one spot, got %q", llm.lastPrompt())
+	}
+
+	// Two picks satisfy min=2, so no fallback is added.
+	server.MinRecommendations, server.MaxRecommendations = 2, 4
+	if got := recommend(spots[3].ID, spots[4].ID); len(got.Spots) != 2 {
+		t.Errorf("expected the 2 AI picks without fallback, got %+v", got.Spots)
+	}
+}
+
+func TestRecommendRecordsAllOrNothing(t *testing.T) {
+	server, llm := newTestServer(t)
+	var ids []int64
+	for i := range 3 {
+		ids = append(ids, seedSpot(t, server, fmt.Sprintf("スポット%d", i), "drive", 35.0+0.05*float64(i+1), 139.0).ID)
+	}
+	b, _ := json.Marshal(map[string]any{"spot_ids": ids, "message": "ok"})
+	llm.response = string(b)
+	recommend := func() {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Fail the second insert of the response.
+	mustExec(t, server, fmt.Sprintf(`CREATE TRIGGER fail_second BEFORE INSERT ON recommendation_history
+		WHEN NEW.spot_id = %d BEGIN SELECT RAISE(ABORT, 'injected'); END`, ids[1]))
+	recommend()
+	if n := countRows(t, server, "recommendation_history"); n != 0 {
+		t.Errorf("expected no partial history after a failed insert, got %d rows", n)
+	}
+
+	mustExec(t, server, "DROP TRIGGER fail_second")
+	recommend()
+	if n := countRows(t, server, "recommendation_history"); n != 3 {
+		t.Errorf("expected all 3 picks recorded, got %d rows", n)
+	}
+}
+
+// sqliteError mimics the driver's error with a result code.
+type sqliteError int
+
+func (e sqliteError) Error() string { return fmt.Sprintf("sqlite error %d", int(e)) }
+func (e sqliteError) Code() int     { return int(e) }
+
+// flakyDB fails the first fails queries containing failOn with err.
+type flakyDB struct {
+	dbgen.DBTX
+	failOn string
+	fails  int
+	err    error
+	mu     sync.Mutex
+	calls  int
+}
+
+func (d *flakyDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if strings.Contains(query, d.failOn) {
+		d.mu.Lock()
+		d.calls++
+		fail := d.calls <= d.fails
+		d.mu.Unlock()
+		if fail {
+			return nil, d.err
+		}
+	}
+	return d.DBTX.QueryContext(ctx, query, args...)
+}
+
+func TestIsTransientDBError(t *testing.T) {
+	for err, want := range map[error]bool{
+		sqliteError(5):                         true,
+		sqliteError(6):                         true,
+		sqliteError(5 | 2<<8):                  true, // SQLITE_BUSY_SNAPSHOT
+		fmt.Errorf("load: %w", sqliteError(5)): true,
+		sqliteError(1):                         false,
+		sqliteError(19):                        false, // constraint
+		sql.ErrNoRows:                          false,
+	} {
+		if got := isTransientDBError(err); got != want {
+			t.Errorf("isTransientDBError(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestRecommendBusyDatabase(t *testing.T) {
+	server, llm := newTestServer(t)
+	spot := seedSpot(t, server, "峠", "drive", 35.05, 139.0)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, spot.ID)
+	recommend := func(db *flakyDB) *httptest.ResponseRecorder {
+		t.Helper()
+		db.DBTX, db.failOn = server.DB, "GetSpotsInArea"
+		server.Queries = dbgen.New(db)
+		return postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+	}
+
+	t.Run("recovers", func(t *testing.T) {
+		db := &flakyDB{fails: dbRetryAttempts - 1, err: sqliteError(sqliteBusy)}
+		w := recommend(db)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 once the database frees up, got %d: %s", w.Code, w.Body.String())
+		}
+		if db.calls != dbRetryAttempts {
+			t.Errorf("expected %d attempts, got %d", dbRetryAttempts, db.calls)
+		}
+	})
+
+	t.Run("stays busy", func(t *testing.T) {
+		db := &flakyDB{fails: 100, err: sqliteError(sqliteLocked)}
+		w := recommend(db)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("expected Retry-After 5, got %q", got)
+		}
+		var body Unavailable
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RetryAfter != dbRetryAfter || body.Error == "" {
+			t.Errorf("expected a structured 503 body, got %s", w.Body.String())
+		}
+		if db.calls != dbRetryAttempts {
+			t.Errorf("expected %d attempts, got %d", dbRetryAttempts, db.calls)
+		}
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		db := &flakyDB{fails: 100, err: sqliteError(1)}
+		if w := recommend(db); w.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500, got %d", w.Code)
+		}
+		if db.calls != 1 {
+			t.Errorf("expected no retries for a permanent error, got %d attempts", db.calls)
+		}
+	})
+}
+
+func TestSpotRecommendCap(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.SpotRecommendCap = 3
+	often := seedSpot(t, server, "いつもの展望台", "drive", 35.1, 139.0)
+	other := seedSpot(t, server, "湖畔のカフェ", "restaurant", 35.0, 139.1)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, %d], "message": "おすすめです"}`, often.ID, other.ID)
+
+	recommended := func(user string) bool {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", user, RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		inResp := false
+		for _, spot := range resp.Spots {
+			inResp = inResp || spot.ID == often.ID
+		}
+		if inPrompt := strings.Contains(llm.lastPrompt(), often.Name); inPrompt != inResp {
+			t.Errorf("%s: spot in prompt %v but in response %v", user, inPrompt, inResp)
+		}
+		return inResp
+	}
+	seed := func(user string, n int, age string) {
+		mustExec(t, server, "INSERT INTO users (id) VALUES (?)", user)
+		for range n {
+			mustExec(t, server, "INSERT INTO recommendation_history (user_id, spot_id, recommended_at) VALUES (?, ?, datetime('now', ?))", user, often.ID, age)
+		}
+	}
+
+	seed("user-a", 2, "-10 days")
+	if !recommended("user-a") {
+		t.Error("expected the spot below the cap")
+	}
+	// That recommendation was the third within the window.
+	if recommended("user-a") {
+		t.Error("expected the spot excluded once the cap is reached")
+	}
+
+	// Recommendations outside the window don't count.
+	seed("user-b", 5, "-40 days")
+	if !recommended("user-b") {
+		t.Error("expected old recommendations to be ignored")
+	}
+
+	server.SpotRecommendCap = 0
+	if !recommended("user-a") {
+		t.Error("expected no cap when disabled")
+	}
+}
+
+func TestRevisitHighlyRatedSpots(t *testing.T) {
+	server, llm := newTestServer(t)
+	loved := seedSpot(t, server, "お気に入りの岬", "drive", 35.1, 139.0)
+	disliked := seedSpot(t, server, "混んでいた公園", "drive", 35.0, 139.1)
+	recent := seedSpot(t, server, "先週の展望台", "drive", 35.1, 139.1)
+	fresh := seedSpot(t, server, "新しい湖", "drive", 35.2, 139.0)
+	// The AI asks for every spot; those that aren't candidates are dropped.
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, %d, %d, %d], "message": "ok"}`, loved.ID, disliked.ID, recent.ID, fresh.ID)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	for _, v := range []struct {
+		spot   int64
+		rating int
+		age    string
+	}{{loved.ID, 5, "-120 days"}, {disliked.ID, 1, "-120 days"}, {recent.ID, 5, "-10 days"}} {
+		mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, rating, visited_at) VALUES ('user-a', ?, ?, datetime('now', ?))", v.spot, v.rating, v.age)
+	}
+
+	offered := func() map[string]bool {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("recommend: %d %s", w.Code, w.Body.String())
+		}
+		got := make(map[string]bool)
+		for _, spot := range resp.Spots {
+			got[spot.Name] = true
+		}
+		return got
+	}
+
+	if got := offered(); got[loved.Name] || got[disliked.Name] || got[recent.Name] || !got[fresh.Name] {
+		t.Errorf("expected every visited spot excluded by default, got %v", got)
+	}
+
+	server.RevisitMinRating = 4
+	got := offered()
+	if !got[loved.Name] {
+		t.Error("expected the 5-rated spot eligible again after the cooldown")
+	}
+	if got[disliked.Name] {
+		t.Error("expected the 1-rated spot to stay out")
+	}
+	if got[recent.Name] {
+		t.Error("expected a recently visited spot to stay out during the cooldown")
+	}
+}
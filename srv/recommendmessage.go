@@ -0,0 +1,94 @@
+package srv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// RecommendMessageRequest names spots already recommended to the user
+// whose explanation should be rewritten.
+type RecommendMessageRequest struct {
+	SpotIDs []int64 `json:"spot_ids"`
+
+	// PreviousMessage is the explanation the user didn't like; the new
+	// one takes a different angle.
+	PreviousMessage string `json:"previous_message"`
+}
+
+// RecommendMessageResponse is the new explanation.
+type RecommendMessageResponse struct {
+	Message string `json:"message"`
+}
+
+// HandleRecommendMessage writes a new explanation for a set of recommended
+// spots without choosing spots again. Nothing is recorded.
+func (s *Server) HandleRecommendMessage(w http.ResponseWriter, r *http.Request) {
+	var req RecommendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.SpotIDs) == 0 {
+		http.Error(w, "spot_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.SpotIDs) > s.MaxRecommendations {
+		http.Error(w, fmt.Sprintf("too many spots (max %d)", s.MaxRecommendations), http.StatusBadRequest)
+		return
+	}
+
+	spots := make([]dbgen.Spot, 0, len(req.SpotIDs))
+	for _, id := range req.SpotIDs {
+		spot, err := s.Queries.GetSpotByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("spot %d not found", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		spots = append(spots, spot)
+	}
+
+	text, err := s.complete(r.Context(), s.buildRecommendMessagePrompt(spots, req.PreviousMessage), 300)
+	if err != nil {
+		slog.Error("recommend message", "error", err)
+		http.Error(w, "おすすめの説明を生成できませんでした", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecommendMessageResponse{Message: strings.TrimSpace(text)})
+}
+
+func (s *Server) buildRecommendMessagePrompt(spots []dbgen.Spot, previous string) string {
+	var spotList strings.Builder
+	for i, spot := range spots {
+		fmt.Fprintf(&spotList, "%d. %s (%s)", i+1, spot.Name, s.categoryLabel(spot.Category))
+		if desc := s.promptDescription(spot.Description); desc != "" {
+			fmt.Fprintf(&spotList, " - %s", desc)
+		}
+		spotList.WriteString("\n")
+	}
+
+	var avoid string
+	if previous = strings.TrimSpace(previous); previous != "" {
+		avoid = fmt.Sprintf("\n前回の説明とは違う切り口で書いてください。\n前回の説明: %s\n", previous)
+	}
+
+	return fmt.Sprintf(`あなたはドライブスポットのおすすめAIです。
+以下のスポットはすでにユーザーにおすすめしたものです。スポットは変更せず、おすすめ理由の説明文だけを書き直してください。
+
+【おすすめしたスポット】
+%s%s
+2〜3文の簡潔な日本語で、JSONではなくプレーンテキストで回答してください。
+`, spotList.String(), avoid)
+}
@@ -0,0 +1,48 @@
+package srv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRecommendMessage(t *testing.T) {
+	server, llm := newTestServer(t)
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.2, 139.0)
+	cafe := seedSpot(t, server, "湖畔カフェ", "rest", 35.21, 139.01)
+	seedSpot(t, server, "関係ない峠", "drive", 35.3, 139.1)
+	llm.response = "  湖の景色とカフェの休憩で、のんびりした一日を。\n"
+
+	w := postJSON(t, server, "/api/recommend/message", "user-a", RecommendMessageRequest{
+		SpotIDs:         []int64{lake.ID, cafe.ID},
+		PreviousMessage: "景色が最高です",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, want := strings.TrimSpace(w.Body.String()), `{"message":"湖の景色とカフェの休憩で、のんびりした一日を。"}`; got != want {
+		t.Errorf("expected just the message, got %s", got)
+	}
+
+	prompt := llm.lastPrompt()
+	for _, want := range []string{"芦ノ湖", "湖畔カフェ", "景色が最高です"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "関係ない峠") || strings.Contains(prompt, "spot_ids") {
+		t.Errorf("expected no other spots and no selection in the prompt, got:\n%s", prompt)
+	}
+	if n := countRows(t, server, "recommendation_history"); n != 0 {
+		t.Errorf("expected nothing recorded, got %d recommendations", n)
+	}
+
+	for _, ids := range [][]int64{nil, {lake.ID, 9999}, {1, 2, 3, 4, 5, 6}} {
+		if w := postJSON(t, server, "/api/recommend/message", "user-a", RecommendMessageRequest{SpotIDs: ids}); w.Code == http.StatusOK {
+			t.Errorf("%v: expected an error, got 200", ids)
+		}
+	}
+	if llm.calls() != 1 {
+		t.Errorf("expected one AI call, got %d", llm.calls())
+	}
+}
@@ -0,0 +1,79 @@
+package srv
+
+import (
+	"fmt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// returnDeadline is the clock time in minutes by which a route leaving at
+// depMinutes must be back: the request's return time, or else
+// Server.LatestReturn if that is later in the day than the departure. ok is
+// false when neither applies, e.g. without a LatestReturn or for a night
+// drive leaving after it.
+func (s *Server) returnDeadline(req RouteRequest, depMinutes int) (deadline int, ok bool) {
+	if req.ReturnTime != "" {
+		if ret := parseTimeToMinutes(req.ReturnTime); ret > depMinutes {
+			return ret, true
+		}
+	}
+	if latest, ok := parseClock(s.LatestReturn); ok && latest > depMinutes {
+		return latest, true
+	}
+	return 0, false
+}
+
+// returnsInTime reports whether a trip from depMinutes out to spot and
+// straight back to (startLat, startLng) is home by deadline.
+func (s *Server) returnsInTime(legs *routeLegs, startLat, startLng float64, spot dbgen.Spot, depMinutes, deadline int) bool {
+	return depMinutes+s.roundTripMinutes(legs, startLat, startLng, spot) <= deadline
+}
+
+// roundTripMinutes is how long a trip from (startLat, startLng) out to spot
+// and straight back takes, staying the spot's usual time.
+func (s *Server) roundTripMinutes(legs *routeLegs, startLat, startLng float64, spot dbgen.Spot) int {
+	out := legs.leg(startLat, startLng, spot.Latitude, spot.Longitude)
+	back := legs.leg(spot.Latitude, spot.Longitude, startLat, startLng)
+	return out.Minutes + s.spotStay(spot) + back.Minutes
+}
+
+// validateMustReturnBy checks req's hard return deadline, if any, is a
+// clock time after the departure.
+func validateMustReturnBy(req RouteRequest) error {
+	if req.MustReturnBy == "" {
+		return nil
+	}
+	by, ok := parseClock(req.MustReturnBy)
+	if !ok {
+		return fmt.Errorf("must_return_by %q must be HH:MM", req.MustReturnBy)
+	}
+	dep := req.DepartureTime
+	if dep == "" {
+		dep = defaultDepartureTime
+	}
+	if by <= parseTimeToMinutes(dep) {
+		return fmt.Errorf("must_return_by (%s) must be after departure_time (%s)", req.MustReturnBy, dep)
+	}
+	return nil
+}
+
+// withMustReturnBy returns req with ReturnTime no later than MustReturnBy,
+// so candidates, the prompt and trimming all work to the deadline.
+func (req RouteRequest) withMustReturnBy() RouteRequest {
+	if req.MustReturnBy == "" {
+		return req
+	}
+	by := parseTimeToMinutes(req.MustReturnBy)
+	if req.ReturnTime == "" || parseTimeToMinutes(req.ReturnTime) > by {
+		req.ReturnTime = req.MustReturnBy
+	}
+	return req
+}
+
+// missesMustReturnBy reports whether route, leaving at depMinutes, gets back
+// after req's hard deadline, which trimming can't prevent when even one
+// drive spot takes too long.
+func (req RouteRequest) missesMustReturnBy(depMinutes int, route builtRoute) bool {
+	return req.MustReturnBy != "" && len(route.Stops) > 0 &&
+		depMinutes+int(route.TotalTimeMin) > parseTimeToMinutes(req.MustReturnBy)
+}
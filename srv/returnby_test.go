@@ -0,0 +1,119 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLateDepartureExcludesFarSpots(t *testing.T) {
+	server, llm := newTestServer(t)
+	near := seedSpot(t, server, "近所の公園", "drive", 35.02, 139.00)
+	far := seedSpot(t, server, "遠くの高原", "drive", 35.225, 139.00) // 25km away
+
+	route := func(req RouteRequest) (RouteResponse, string) {
+		t.Helper()
+		llm.response = fmt.Sprintf(`{"route_ids": [%d], "message": "ok"}`, near.ID)
+		req.Lat, req.Lng = 35.0, 139.0
+		w := postJSON(t, server, "/api/route", "user-a", req)
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return resp, llm.lastPrompt()
+	}
+
+	// Off by default
+	if _, prompt := route(RouteRequest{DepartureTime: "19:30"}); !strings.Contains(prompt, far.Name) {
+		t.Errorf("expected no filtering by default, got:\n%s", prompt)
+	}
+
+	server.LatestReturn = "21:00"
+	if _, prompt := route(RouteRequest{DepartureTime: "09:00"}); !strings.Contains(prompt, far.Name) {
+		t.Errorf("expected the far spot offered for a morning start, got:\n%s", prompt)
+	}
+	if _, prompt := route(RouteRequest{DepartureTime: "19:30"}); strings.Contains(prompt, far.Name) || !strings.Contains(prompt, near.Name) {
+		t.Errorf("expected only the near spot offered for a late start, got:\n%s", prompt)
+	}
+	if _, prompt := route(RouteRequest{DepartureTime: "19:30", ReturnTime: "23:30"}); !strings.Contains(prompt, far.Name) {
+		t.Errorf("expected a later return time to bring the far spot back, got:\n%s", prompt)
+	}
+
+	server.LatestReturn = ""
+	if _, prompt := route(RouteRequest{DepartureTime: "19:30"}); !strings.Contains(prompt, far.Name) {
+		t.Errorf("expected no filtering without a latest return, got:\n%s", prompt)
+	}
+}
+
+func TestLateDepartureSuggestsReturnTime(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.LatestReturn = "21:00"
+	seedSpot(t, server, "遠くの高原", "drive", 35.225, 139.00)
+
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "19:30"})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("route: %d %s", w.Code, w.Body.String())
+	}
+	if llm.calls() != 0 {
+		t.Errorf("expected no AI call without candidates, got %d", llm.calls())
+	}
+	if resp.Suggestion == nil || resp.Suggestion.ReturnTime != "23:30" {
+		t.Errorf("expected a 23:30 return suggested, got %+v", resp.Suggestion)
+	}
+}
+
+func TestMustReturnBy(t *testing.T) {
+	server, llm := newTestServer(t)
+	lookout := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.05)
+	falls := seedSpot(t, server, "滝", "drive", 35.00, 139.05)
+
+	route := func(req RouteRequest, stays []int) RouteResponse {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{
+			"route_ids":      []int64{lookout.ID, lake.ID, falls.ID},
+			"stay_durations": stays,
+			"message":        "ok",
+		})
+		llm.response = string(b)
+		req.Lat, req.Lng, req.DepartureTime = 35.0, 139.0, "09:00"
+		w := postJSON(t, server, "/api/route", "user-a", req)
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return resp
+	}
+
+	for _, req := range []RouteRequest{
+		{MustReturnBy: "11:30"},
+		{MustReturnBy: "11:30", ReturnTime: "15:00"},
+	} {
+		resp := route(req, []int{60, 60, 60})
+		if len(resp.Stops) < 3 || resp.EstimatedReturn > "11:30" || resp.TrimmedStops == 0 {
+			t.Errorf("%+v: expected a trimmed route back by 11:30, got %s with %d stops trimmed", req, resp.EstimatedReturn, resp.TrimmedStops)
+		}
+		if prompt := llm.lastPrompt(); !strings.Contains(prompt, "11:30までに必ず帰着") {
+			t.Errorf("%+v: expected the deadline in the prompt, got:\n%s", req, prompt)
+		}
+	}
+
+	if resp := route(RouteRequest{MustReturnBy: "15:00", ReturnTime: "11:30"}, []int{30, 30, 30}); resp.EstimatedReturn > "11:30" {
+		t.Errorf("expected an earlier return_time to still apply, got %s", resp.EstimatedReturn)
+	}
+
+	resp := route(RouteRequest{MustReturnBy: "10:30"}, []int{180, 60, 60})
+	if len(resp.Stops) != 0 || !strings.Contains(resp.Message, "10:30までに帰れるルートを作れませんでした") {
+		t.Errorf("expected an infeasible deadline to return no route, got %+v", resp)
+	}
+
+	for _, by := range []string{"25:00", "soon", "09:00", "08:00"} {
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MustReturnBy: by})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("must_return_by %q: expected 400, got %d", by, w.Code)
+		}
+	}
+}
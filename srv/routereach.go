@@ -0,0 +1,125 @@
+package srv
+
+import (
+	"math"
+	"slices"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// RouteReachMode selects how route candidates are limited by their distance
+// from the origin.
+type RouteReachMode string
+
+const (
+	// ReachOneWay keeps spots within the route's reach (see
+	// RouteReachDivisor) of the origin. The default.
+	ReachOneWay RouteReachMode = "one-way"
+	// ReachRoundTrip judges a spot by its share of the round trip: the
+	// drive out and back is shared by the spots within routeClusterKm of
+	// it, so a cluster of farther spots can still make a route. Spots
+	// with no neighbors keep the one-way reach, and no spot is farther
+	// than half the driving budget, so that it can be visited alone.
+	ReachRoundTrip RouteReachMode = "round-trip"
+)
+
+// routeClusterKm is how close spots must be to share the drive out to them.
+const routeClusterKm = 10
+
+// maxReachFactor is how far past the one-way reach ReachRoundTrip may go:
+// half the driving budget.
+func (s *Server) maxReachFactor() float64 {
+	return math.Max(1, s.routeReachDivisor()/2)
+}
+
+// loadReach is how far from the origin route candidates are loaded from.
+func (s *Server) loadReach(reach float64) float64 {
+	if s.RouteReachMode != ReachRoundTrip {
+		return reach
+	}
+	return reach * s.maxReachFactor()
+}
+
+// spotReaches returns how far from the origin each of spots may be to be
+// a route candidate. Under ReachRoundTrip, a spot with n of spots (itself
+// included) within routeClusterKm shares its round trip n ways, so it may
+// be up to n times the one-way reach away, within the cap of
+// maxReachFactor. Callers pass only spots that pass the route's other
+// filters, so spots that can't be visited don't share the drive.
+func (s *Server) spotReaches(spots []dbgen.Spot, reach float64) map[int64]float64 {
+	reaches := make(map[int64]float64, len(spots))
+	if s.RouteReachMode != ReachRoundTrip {
+		for _, spot := range spots {
+			reaches[spot.ID] = reach
+		}
+		return reaches
+	}
+	for id, n := range s.clusterSizes(spots) {
+		reaches[id] = reach * math.Min(float64(n), s.maxReachFactor())
+	}
+	return reaches
+}
+
+// gridCell is a cell of the grid clusterSizes buckets spots in.
+type gridCell struct{ row, col int }
+
+// clusterSizes returns how many of spots (itself included) are within
+// routeClusterKm of each spot, by ID. Spots are bucketed in a grid of cells
+// at least routeClusterKm across, so each is only measured against those in
+// its own and the eight surrounding cells. Columns wrap at the
+// antimeridian.
+func (s *Server) clusterSizes(spots []dbgen.Spot) map[int64]int {
+	radius := s.Distance.RadiusKm
+	if radius <= 0 {
+		radius = defaultEarthRadiusKm
+	}
+	// The same slack as areaAround, so rhumb distances are covered too.
+	cellLat := routeClusterKm / radius * 1.01 * 180 / math.Pi
+	maxLat := 0.0
+	for _, spot := range spots {
+		maxLat = math.Max(maxLat, math.Abs(spot.Latitude))
+	}
+	// Longitude degrees shrink towards the poles, so size columns for the
+	// highest latitude a neighbor can be at; near a pole one column spans
+	// every longitude.
+	cols := 1
+	if edge := maxLat + cellLat; edge < 90 {
+		cols = max(1, int(360/(cellLat/math.Cos(edge*math.Pi/180))))
+	}
+	cellLng := 360 / float64(cols)
+	cellOf := func(spot dbgen.Spot) gridCell {
+		return gridCell{
+			row: int(math.Floor((spot.Latitude + 90) / cellLat)),
+			col: int(math.Floor((spot.Longitude+180)/cellLng)) % cols,
+		}
+	}
+
+	grid := make(map[gridCell][]dbgen.Spot)
+	for _, spot := range spots {
+		c := cellOf(spot)
+		grid[c] = append(grid[c], spot)
+	}
+
+	sizes := make(map[int64]int, len(spots))
+	for _, spot := range spots {
+		c := cellOf(spot)
+		var seen []gridCell // with few columns, neighbors can repeat
+		n := 0
+		for dr := -1; dr <= 1; dr++ {
+			for dc := -1; dc <= 1; dc++ {
+				nc := gridCell{c.row + dr, ((c.col+dc)%cols + cols) % cols}
+				if slices.Contains(seen, nc) {
+					continue
+				}
+				seen = append(seen, nc)
+				for _, other := range grid[nc] {
+					if s.distanceKm(spot.Latitude, spot.Longitude, other.Latitude, other.Longitude) <= routeClusterKm {
+						n++
+					}
+				}
+			}
+		}
+		sizes[spot.ID] = n
+	}
+	return sizes
+}
@@ -0,0 +1,106 @@
+package srv
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestRouteReachModes(t *testing.T) {
+	server, llm := newTestServer(t)
+	// With the default 8 hours the driving budget is 160km, so the one-way
+	// reach is 53km and no spot may be more than 80km away.
+	near := seedSpot(t, server, "近所の展望台", "drive", 35.0, 139.11) // 10km east
+	seedSpot(t, server, "高原の牧場", "drive", 35.6, 139.0)           // 67km north
+	seedSpot(t, server, "高原の滝", "drive", 35.62, 139.0)           // 69km north
+	seedSpot(t, server, "高原の湖", "drive", 35.64, 139.0)           // 71km north
+	seedSpot(t, server, "一軒だけの岬", "drive", 34.415, 139.0)        // 65km south
+	seedSpot(t, server, "遠い温泉街", "drive", 35.9, 139.0)           // 100km north
+	seedSpot(t, server, "遠い温泉宿", "drive", 35.91, 139.0)          // 101km north
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, near.ID)
+
+	candidates := func(mode RouteReachMode) string {
+		t.Helper()
+		server.RouteReachMode = mode
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", mode, w.Code, w.Body.String())
+		}
+		var names []string
+		for _, line := range strings.Split(llm.lastPrompt(), "\n") {
+			if _, rest, ok := strings.Cut(line, "] "); ok {
+				name, _, _ := strings.Cut(rest, " (")
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		return strings.Join(names, ",")
+	}
+
+	if got := candidates(ReachOneWay); got != "近所の展望台" {
+		t.Errorf("one-way: expected only the spot within 53km, got %s", got)
+	}
+	if got := candidates(ReachRoundTrip); got != "近所の展望台,高原の湖,高原の滝,高原の牧場" {
+		t.Errorf("round-trip: expected the cluster 70km out but not the lone cape or spots past 80km, got %s", got)
+	}
+}
+
+func TestClusterSizesMatchesPairwise(t *testing.T) {
+	server, _ := newTestServer(t)
+	rng := rand.New(rand.NewPCG(1, 2))
+	var spots []dbgen.Spot
+	add := func(lat, lng float64) {
+		spots = append(spots, dbgen.Spot{ID: int64(len(spots) + 1), Latitude: lat, Longitude: lng})
+	}
+	for range 300 {
+		add(35+rng.Float64(), 139+rng.Float64())
+	}
+	// Neighbors across the antimeridian and near a pole
+	add(10, 179.97)
+	add(10, -179.97)
+	add(89.96, 0)
+	add(89.96, 180)
+
+	got := server.clusterSizes(spots)
+	for _, spot := range spots {
+		want := 0
+		for _, other := range spots {
+			if server.distanceKm(spot.Latitude, spot.Longitude, other.Latitude, other.Longitude) <= routeClusterKm {
+				want++
+			}
+		}
+		if got[spot.ID] != want {
+			t.Errorf("spot %d at %v,%v: expected %d within %dkm, got %d", spot.ID, spot.Latitude, spot.Longitude, want, routeClusterKm, got[spot.ID])
+		}
+	}
+}
+
+func TestRouteReachCountsOnlyEligibleNeighbors(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.RouteReachMode = ReachRoundTrip
+	near := seedSpot(t, server, "近所の展望台", "drive", 35.0, 139.11)
+	seedSpot(t, server, "岬", "drive", 34.415, 139.0) // 65km south
+	lighthouse := seedSpot(t, server, "岬の灯台", "drive", 34.42, 139.0)
+	mustExec(t, server, "UPDATE spots SET difficulty = ? WHERE id = ?", DifficultyHard, lighthouse.ID)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, near.ID)
+
+	offered := func(maxDifficulty int) bool {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MaxDifficulty: maxDifficulty})
+		if w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return strings.Contains(llm.lastPrompt(), "] 岬 (")
+	}
+	if !offered(0) {
+		t.Error("expected the cape offered with the lighthouse sharing the drive")
+	}
+	if offered(DifficultyEasy) {
+		t.Error("expected the cape left out when the lighthouse is filtered out")
+	}
+}
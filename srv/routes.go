@@ -0,0 +1,306 @@
+package srv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// loadSavedRoute looks up the route named by the {id} path value for userID.
+// It writes an error response and returns ok=false if the route can't be used.
+func (s *Server) loadSavedRoute(w http.ResponseWriter, r *http.Request, userID string) (dbgen.RouteHistory, RouteResponse, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid route id", http.StatusBadRequest)
+		return dbgen.RouteHistory{}, RouteResponse{}, false
+	}
+	return s.loadRoute(w, r, userID, id)
+}
+
+// loadRoute is loadSavedRoute for a route ID from elsewhere in the request.
+func (s *Server) loadRoute(w http.ResponseWriter, r *http.Request, userID string, id int64) (dbgen.RouteHistory, RouteResponse, bool) {
+	q := s.Queries
+	saved, err := q.GetRouteByID(r.Context(), dbgen.GetRouteByIDParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "route not found", http.StatusNotFound)
+		return dbgen.RouteHistory{}, RouteResponse{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return dbgen.RouteHistory{}, RouteResponse{}, false
+	}
+	if saved.RouteJson == nil {
+		// Routes saved before 006-route-details only have their spot IDs.
+		http.Error(w, "route details not available", http.StatusNotFound)
+		return dbgen.RouteHistory{}, RouteResponse{}, false
+	}
+
+	var route RouteResponse
+	if err := json.Unmarshal([]byte(*saved.RouteJson), &route); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return dbgen.RouteHistory{}, RouteResponse{}, false
+	}
+	route.RouteID = saved.ID
+	return saved, route, true
+}
+
+// HandleExplainRoute asks the LLM for a richer narrative of a saved route
+// without regenerating the route itself. The text is cached on the route.
+func (s *Server) HandleExplainRoute(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+	saved, route, ok := s.loadSavedRoute(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if saved.Explanation != nil && *saved.Explanation != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, *saved.Explanation)
+		return
+	}
+
+	text, err := s.complete(r.Context(), buildExplainPrompt(route), 800)
+	if err != nil {
+		slog.Error("explain route", "route", saved.ID, "error", err)
+		http.Error(w, "ルートの説明を生成できませんでした", http.StatusBadGateway)
+		return
+	}
+	text = strings.TrimSpace(text)
+
+	q := s.Queries
+	if err := q.SetRouteExplanation(r.Context(), dbgen.SetRouteExplanationParams{
+		Explanation: &text,
+		ID:          saved.ID,
+	}); err != nil {
+		slog.Warn("cache route explanation", "route", saved.ID, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text)
+}
+
+// RegenerateRouteRequest tweaks the request a saved route was generated
+// from. Unset fields keep their original values.
+type RegenerateRouteRequest struct {
+	DepartureTime     *string `json:"departure_time"`
+	ReturnTime        *string `json:"return_time"`
+	IncludeRestaurant *bool   `json:"include_restaurant"`
+	IncludeRest       *bool   `json:"include_rest"`
+	AvoidUrban        *bool   `json:"avoid_urban"`
+}
+
+// apply returns req with the tweaks applied.
+func (d RegenerateRouteRequest) apply(req RouteRequest) RouteRequest {
+	if d.DepartureTime != nil {
+		req.DepartureTime = *d.DepartureTime
+	}
+	if d.ReturnTime != nil {
+		req.ReturnTime = *d.ReturnTime
+	}
+	if d.IncludeRestaurant != nil {
+		req.IncludeRestaurant = d.IncludeRestaurant
+	}
+	if d.IncludeRest != nil {
+		req.IncludeRest = d.IncludeRest
+	}
+	if d.AvoidUrban != nil {
+		req.AvoidUrban = *d.AvoidUrban
+	}
+	return req
+}
+
+// HandleRegenerateRoute generates a new route from a saved route's original
+// request with the tweaks in the body applied, avoiding the saved route.
+func (s *Server) HandleRegenerateRoute(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+	saved, _, ok := s.loadSavedRoute(w, r, userID)
+	if !ok {
+		return
+	}
+	if saved.RequestJson == nil {
+		// Routes saved before 008-route-request don't know their request.
+		http.Error(w, "route request not available", http.StatusNotFound)
+		return
+	}
+
+	var diff RegenerateRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&diff); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req RouteRequest
+	if err := json.Unmarshal([]byte(*saved.RequestJson), &req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req, err := s.resolvePastDeparture(diff.apply(req))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRouteRequest(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.generateRoute(r.Context(), userID, req, saved.RouteHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CompareRoutesRequest names two saved routes to compare.
+type CompareRoutesRequest struct {
+	RouteA int64 `json:"route_a"`
+	RouteB int64 `json:"route_b"`
+}
+
+// RouteSummary is one side of a RouteComparison.
+type RouteSummary struct {
+	RouteID         int64   `json:"route_id"`
+	TotalDistanceKm float64 `json:"total_distance_km"`
+	TotalTimeMin    float64 `json:"total_time_min"`
+	Stops           int     `json:"stops"` // spots visited, not counting start and return
+}
+
+// RouteComparison is the difference between two saved routes. Diffs are
+// B minus A, so a negative DistanceDiffKm means B is shorter.
+type RouteComparison struct {
+	A              RouteSummary `json:"a"`
+	B              RouteSummary `json:"b"`
+	DistanceDiffKm float64      `json:"distance_diff_km"`
+	TimeDiffMin    float64      `json:"time_diff_min"`
+	StopsDiff      int          `json:"stops_diff"`
+	SharedSpots    []RouteStop  `json:"shared_spots"` // in A's order
+	OnlyA          []RouteStop  `json:"only_a"`
+	OnlyB          []RouteStop  `json:"only_b"`
+}
+
+// spotStops returns the route's stops at spots, without start and return.
+func spotStops(route RouteResponse) []RouteStop {
+	var stops []RouteStop
+	for _, stop := range route.Stops {
+		if stop.ID > 0 {
+			stops = append(stops, stop)
+		}
+	}
+	return stops
+}
+
+func summarizeRoute(route RouteResponse) RouteSummary {
+	return RouteSummary{
+		RouteID:         route.RouteID,
+		TotalDistanceKm: route.TotalDistanceKm,
+		TotalTimeMin:    route.TotalTimeMin,
+		Stops:           len(spotStops(route)),
+	}
+}
+
+// compareRoutes diffs two saved routes.
+func compareRoutes(a, b RouteResponse) RouteComparison {
+	c := RouteComparison{
+		A:           summarizeRoute(a),
+		B:           summarizeRoute(b),
+		SharedSpots: []RouteStop{},
+		OnlyA:       []RouteStop{},
+		OnlyB:       []RouteStop{},
+	}
+	c.DistanceDiffKm = math.Round((c.B.TotalDistanceKm-c.A.TotalDistanceKm)*10) / 10
+	c.TimeDiffMin = c.B.TotalTimeMin - c.A.TotalTimeMin
+	c.StopsDiff = c.B.Stops - c.A.Stops
+
+	inA := make(map[int64]bool)
+	inB := make(map[int64]bool)
+	for _, stop := range spotStops(a) {
+		inA[stop.ID] = true
+	}
+	for _, stop := range spotStops(b) {
+		inB[stop.ID] = true
+		if !inA[stop.ID] {
+			c.OnlyB = append(c.OnlyB, stop)
+		}
+	}
+	for _, stop := range spotStops(a) {
+		if inB[stop.ID] {
+			c.SharedSpots = append(c.SharedSpots, stop)
+		} else {
+			c.OnlyA = append(c.OnlyA, stop)
+		}
+	}
+	return c
+}
+
+// HandleCompareRoutes compares two of the user's saved routes.
+func (s *Server) HandleCompareRoutes(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var req CompareRoutesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RouteA <= 0 || req.RouteB <= 0 {
+		http.Error(w, "route_a and route_b are required", http.StatusBadRequest)
+		return
+	}
+
+	_, a, ok := s.loadRoute(w, r, userID, req.RouteA)
+	if !ok {
+		return
+	}
+	_, b, ok := s.loadRoute(w, r, userID, req.RouteB)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(compareRoutes(a, b))
+}
+
+func buildExplainPrompt(route RouteResponse) string {
+	var stopList string
+	for i, stop := range route.Stops {
+		switch stop.Category {
+		case "start":
+			stopList += fmt.Sprintf("%d. %s %s（出発）\n", i+1, stop.ArrivalTime, stop.Name)
+		case "end":
+			stopList += fmt.Sprintf("%d. %s %s（帰着）\n", i+1, stop.ArrivalTime, stop.Name)
+		default:
+			stopList += fmt.Sprintf("%d. %s %s (%s, 滞在%d分) - %s\n",
+				i+1, stop.ArrivalTime, stop.Name, stop.Category, stop.stayMinutes(), stop.Description)
+		}
+	}
+
+	return fmt.Sprintf(`あなたはドライブルートのガイドAIです。
+以下のドライブルートについて、ユーザーが出かけたくなるような詳しい紹介文を書いてください。
+ルート自体は変更しないでください。
+
+【ルート】
+出発時刻: %s / 帰着予定: %s / 総距離: %.1fkm
+%s
+【含めてほしい内容】
+- ルート全体と各スポットの見どころ
+- 持っていくと良いもの
+- おすすめの写真スポット
+
+JSONではなく、プレーンテキストで回答してください。
+`, route.DepartureTime, route.EstimatedReturn, route.TotalDistanceKm, stopList)
+}
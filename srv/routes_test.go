@@ -0,0 +1,325 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// saveRoute persists route for userID the way HandleGenerateRoute does and
+// returns its ID.
+func saveRoute(t *testing.T, s *Server, userID string, route RouteResponse) int64 {
+	t.Helper()
+	q := dbgen.New(s.DB)
+	if _, err := q.GetOrCreateUser(context.Background(), userID); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	var ids []int64
+	for _, stop := range route.Stops {
+		if stop.ID > 0 {
+			ids = append(ids, stop.ID)
+		}
+	}
+	idsJSON, _ := json.Marshal(ids)
+	routeJSON, _ := json.Marshal(route)
+	routeJSONStr := string(routeJSON)
+	id, err := q.AddRouteHistory(context.Background(), dbgen.AddRouteHistoryParams{
+		UserID:    userID,
+		RouteHash: computeRouteHash(ids),
+		SpotIds:   string(idsJSON),
+		RouteJson: &routeJSONStr,
+	})
+	if err != nil {
+		t.Fatalf("save route: %v", err)
+	}
+	return id
+}
+
+func sampleRoute(spots ...dbgen.Spot) RouteResponse {
+	route := RouteResponse{
+		DepartureTime:   "10:00",
+		EstimatedReturn: "15:30",
+		TotalDistanceKm: 84.2,
+		Message:         "いいルートです",
+	}
+	route.Stops = append(route.Stops, RouteStop{Name: "現在地", Category: "start", Lat: 35.0, Lng: 139.0, ArrivalTime: "10:00"})
+	stay := 40
+	for _, sp := range spots {
+		route.Stops = append(route.Stops, RouteStop{
+			ID:           sp.ID,
+			Name:         sp.Name,
+			Category:     sp.Category,
+			Lat:          sp.Latitude,
+			Lng:          sp.Longitude,
+			ArrivalTime:  "11:00",
+			StayDuration: &stay,
+		})
+	}
+	route.Stops = append(route.Stops, RouteStop{Name: "現在地", Category: "end", Lat: 35.0, Lng: 139.0, ArrivalTime: "15:30"})
+	return route
+}
+
+func TestExplainRoute(t *testing.T) {
+	server, llm := newTestServer(t)
+	llm.response = "  海沿いの絶景ルートです。カメラをお忘れなく。\n"
+	handler := server.Handler()
+
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.20, 139.02)
+	cafe := seedSpot(t, server, "湖畔カフェ", "rest", 35.21, 139.03)
+	routeID := saveRoute(t, server, "user-a", sampleRoute(lake, cafe))
+
+	explain := func(userID string) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/route/%d/explain", routeID), nil), userID)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := explain("user-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Body.String(); got != "海沿いの絶景ルートです。カメラをお忘れなく。" {
+		t.Errorf("unexpected explanation %q", got)
+	}
+	prompt := llm.lastPrompt()
+	for _, name := range []string{"芦ノ湖", "湖畔カフェ", "10:00", "15:30"} {
+		if !strings.Contains(prompt, name) {
+			t.Errorf("expected prompt to contain %q, got:\n%s", name, prompt)
+		}
+	}
+
+	// The second request is served from the cache.
+	llm.response = "別の説明"
+	w = explain("user-a")
+	if w.Code != http.StatusOK || w.Body.String() != "海沿いの絶景ルートです。カメラをお忘れなく。" {
+		t.Errorf("expected cached explanation, got %d %q", w.Code, w.Body.String())
+	}
+	if llm.calls() != 1 {
+		t.Errorf("expected 1 LLM call, got %d", llm.calls())
+	}
+
+	// Routes are private to the user who generated them.
+	if w := explain("user-b"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's route, got %d", w.Code)
+	}
+}
+
+func TestRegenerateRoute(t *testing.T) {
+	server, llm := newTestServer(t)
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.10, 139.00)
+	pass := seedSpot(t, server, "峠の茶屋", "drive", 35.12, 139.02)
+	diner := seedSpot(t, server, "湖畔食堂", "restaurant", 35.11, 139.01)
+	routeJSON := func(ids ...int64) string {
+		b, _ := json.Marshal(map[string]any{"route_ids": ids, "message": "ok"})
+		return string(b)
+	}
+
+	llm.responses = []string{routeJSON(lake.ID, pass.ID)}
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00"})
+	var original RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &original); err != nil || original.RouteID == 0 {
+		t.Fatalf("expected a saved route, got %d: %s", w.Code, w.Body.String())
+	}
+
+	regenerate := func(userID string, diff map[string]any) (*httptest.ResponseRecorder, RouteResponse) {
+		t.Helper()
+		w := postJSON(t, server, fmt.Sprintf("/api/route/%d/regenerate", original.RouteID), userID, diff)
+		var resp RouteResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	t.Run("add a restaurant", func(t *testing.T) {
+		// The first answer repeats the original route and is retried.
+		before := llm.calls()
+		llm.responses = []string{routeJSON(lake.ID, pass.ID), routeJSON(lake.ID, diner.ID, pass.ID)}
+		w, resp := regenerate("user-a", map[string]any{"include_restaurant": true})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := llm.calls() - before; got != 2 {
+			t.Errorf("expected 2 LLM calls, got %d", got)
+		}
+		if resp.RouteID == 0 || resp.RouteID == original.RouteID {
+			t.Errorf("expected a new saved route, got id %d", resp.RouteID)
+		}
+		var hasDiner bool
+		for _, stop := range resp.Stops {
+			hasDiner = hasDiner || stop.ID == diner.ID
+		}
+		if !hasDiner {
+			t.Errorf("expected the restaurant in the regenerated route, got %+v", resp.Stops)
+		}
+		// Untouched fields come from the original request.
+		if resp.DepartureTime != "09:00" {
+			t.Errorf("expected original departure time, got %q", resp.DepartureTime)
+		}
+		if !strings.Contains(llm.lastPrompt(), diner.Name) {
+			t.Errorf("expected the restaurant among the candidates")
+		}
+	})
+
+	t.Run("shorter", func(t *testing.T) {
+		llm.responses = []string{routeJSON(pass.ID)}
+		w, resp := regenerate("user-a", map[string]any{"return_time": "11:00"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(llm.lastPrompt(), "約2.0時間") {
+			t.Errorf("expected the shorter time budget in the prompt, got:\n%s", llm.lastPrompt())
+		}
+		if len(resp.Stops) != 3 {
+			t.Errorf("expected a single-stop route, got %+v", resp.Stops)
+		}
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		if w, _ := regenerate("user-b", nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for another user's route, got %d", w.Code)
+		}
+	})
+
+	t.Run("invalid once applied", func(t *testing.T) {
+		llm.responses = []string{routeJSON(lake.ID)}
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MustReturnBy: "12:00"})
+		var saved RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &saved); err != nil || saved.RouteID == 0 {
+			t.Fatalf("expected a saved route, got %d: %s", w.Code, w.Body.String())
+		}
+		// Leaving after the saved must_return_by is as invalid as in a new request.
+		w = postJSON(t, server, fmt.Sprintf("/api/route/%d/regenerate", saved.RouteID), "user-a", map[string]any{"departure_time": "13:00"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestCompareRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+	lake := seedSpot(t, server, "芦ノ湖", "drive", 35.20, 139.02)
+	pass := seedSpot(t, server, "峠の茶屋", "rest", 35.12, 139.02)
+	coast := seedSpot(t, server, "海岸線", "drive", 35.05, 139.10)
+	diner := seedSpot(t, server, "湖畔食堂", "restaurant", 35.11, 139.01)
+
+	a := sampleRoute(lake, pass, coast)
+	a.TotalDistanceKm, a.TotalTimeMin = 84.2, 330
+	b := sampleRoute(coast, diner)
+	b.TotalDistanceKm, b.TotalTimeMin = 61.9, 270
+	idA := saveRoute(t, server, "user-a", a)
+	idB := saveRoute(t, server, "user-a", b)
+
+	w := postJSON(t, server, "/api/route/compare", "user-a", CompareRoutesRequest{RouteA: idA, RouteB: idB})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got RouteComparison
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := RouteSummary{RouteID: idA, TotalDistanceKm: 84.2, TotalTimeMin: 330, Stops: 3}
+	if got.A != want {
+		t.Errorf("expected A %+v, got %+v", want, got.A)
+	}
+	if got.B.RouteID != idB || got.B.Stops != 2 {
+		t.Errorf("unexpected B %+v", got.B)
+	}
+	if got.DistanceDiffKm != -22.3 || got.TimeDiffMin != -60 || got.StopsDiff != -1 {
+		t.Errorf("expected diffs -22.3km, -60min, -1 stop, got %vkm, %vmin, %d", got.DistanceDiffKm, got.TimeDiffMin, got.StopsDiff)
+	}
+	ids := func(stops []RouteStop) string {
+		var parts []string
+		for _, stop := range stops {
+			parts = append(parts, fmt.Sprint(stop.ID))
+		}
+		return strings.Join(parts, ",")
+	}
+	if ids(got.SharedSpots) != fmt.Sprint(coast.ID) {
+		t.Errorf("expected only the coast shared, got %s", ids(got.SharedSpots))
+	}
+	if want := fmt.Sprintf("%d,%d", lake.ID, pass.ID); ids(got.OnlyA) != want {
+		t.Errorf("expected %s only in A, got %s", want, ids(got.OnlyA))
+	}
+	if ids(got.OnlyB) != fmt.Sprint(diner.ID) {
+		t.Errorf("expected the diner only in B, got %s", ids(got.OnlyB))
+	}
+
+	if w := postJSON(t, server, "/api/route/compare", "user-b", CompareRoutesRequest{RouteA: idA, RouteB: idB}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's routes, got %d", w.Code)
+	}
+	if w := postJSON(t, server, "/api/route/compare", "user-a", CompareRoutesRequest{RouteA: idA}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without route_b, got %d", w.Code)
+	}
+}
+
+func TestComputeRouteHash(t *testing.T) {
+	for _, tc := range []struct {
+		ids  []int64
+		want string
+	}{
+		{nil, "0:"},
+		{[]int64{7}, "1:7"},
+		{[]int64{12, 3, 5}, "3:3,5,12"},
+		{[]int64{1, 23}, "2:1,23"},
+		{[]int64{12, 3}, "2:3,12"},
+		{[]int64{123}, "1:123"},
+	} {
+		if got := computeRouteHash(tc.ids); got != tc.want {
+			t.Errorf("computeRouteHash(%v) = %q, want %q", tc.ids, got, tc.want)
+		}
+	}
+
+	// Order doesn't matter, but anything else does.
+	if computeRouteHash([]int64{5, 1, 9}) != computeRouteHash([]int64{9, 5, 1}) {
+		t.Error("expected the same hash for the same spots in another order")
+	}
+	distinct := [][]int64{{1, 23}, {12, 3}, {123}, {1, 2, 3}, {12}, {3}, {1, 1, 23}}
+	seen := make(map[string][]int64)
+	for _, ids := range distinct {
+		h := computeRouteHash(ids)
+		if prev, ok := seen[h]; ok {
+			t.Errorf("%v and %v share hash %q", prev, ids, h)
+		}
+		seen[h] = ids
+	}
+}
+
+func TestRouteHashMigration(t *testing.T) {
+	server, _ := newTestServer(t)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	for _, old := range []string{"[]", "[7]", "[3 5 12]", "h"} {
+		mustExec(t, server, "INSERT INTO route_history (user_id, route_hash, spot_ids) VALUES ('user-a', ?, '[]')", old)
+	}
+	migration, err := os.ReadFile("../db/migrations/018-route-hash-format.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, server, string(migration))
+
+	rows, err := server.DB.Query("SELECT route_hash FROM route_history ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var h string
+		rows.Scan(&h)
+		got = append(got, h)
+	}
+	want := []string{computeRouteHash(nil), computeRouteHash([]int64{7}), computeRouteHash([]int64{3, 5, 12}), "h"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected converted hashes %q, got %q", want, got)
+	}
+}
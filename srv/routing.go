@@ -0,0 +1,90 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Routing profiles for RouteRequest.RoutingProfile.
+const (
+	ProfileFastest   = "fastest"    // the default
+	ProfileScenic    = "scenic"     // prefer scenic roads over quick ones
+	ProfileNoHighway = "no-highway" // avoid expressways
+)
+
+func validateRoutingProfile(profile string) error {
+	switch profile {
+	case "", ProfileFastest, ProfileScenic, ProfileNoHighway:
+		return nil
+	}
+	return fmt.Errorf("routing_profile must be %q, %q or %q, got %q", ProfileFastest, ProfileScenic, ProfileNoHighway, profile)
+}
+
+// LegEstimate is the driving distance and time of one route leg.
+type LegEstimate struct {
+	Km      float64
+	Minutes int
+}
+
+// RouteEstimator estimates route legs over the road network. profile is
+// one of the Profile constants; estimators that can't honor it may ignore
+// it.
+type RouteEstimator interface {
+	EstimateLeg(ctx context.Context, fromLat, fromLng, toLat, toLng float64, profile string) (LegEstimate, error)
+}
+
+// straightLineEstimator is the default RouteEstimator: the server's
+// straight-line distance at avgSpeedKmh, whatever the profile.
+type straightLineEstimator struct {
+	distance DistanceEstimator
+}
+
+func (e straightLineEstimator) EstimateLeg(ctx context.Context, fromLat, fromLng, toLat, toLng float64, profile string) (LegEstimate, error) {
+	km := e.distance.Km(fromLat, fromLng, toLat, toLng)
+	return LegEstimate{Km: km, Minutes: drivingMinutes(km)}, nil
+}
+
+// estimateLeg estimates a leg of a route with the configured Router,
+// falling back to the straight-line estimate if it fails.
+func (s *Server) estimateLeg(ctx context.Context, fromLat, fromLng, toLat, toLng float64, profile string) LegEstimate {
+	if profile == "" {
+		profile = ProfileFastest
+	}
+	fallback := straightLineEstimator{distance: s.Distance}
+	if s.Router == nil {
+		leg, _ := fallback.EstimateLeg(ctx, fromLat, fromLng, toLat, toLng, profile)
+		return leg
+	}
+	leg, err := s.Router.EstimateLeg(ctx, fromLat, fromLng, toLat, toLng, profile)
+	if err != nil {
+		slog.Warn("estimate route leg; using straight-line distance", "profile", profile, "error", err)
+		leg, _ = fallback.EstimateLeg(ctx, fromLat, fromLng, toLat, toLng, profile)
+	}
+	return leg
+}
+
+// routeLegs estimates the legs of one request's routes with estimateLeg,
+// remembering each so reordering and trimming stops doesn't ask the Router
+// for the same leg again. It isn't safe for concurrent use.
+type routeLegs struct {
+	s       *Server
+	ctx     context.Context
+	profile string
+	known   map[[4]float64]LegEstimate
+}
+
+func (s *Server) routeLegs(ctx context.Context, profile string) *routeLegs {
+	return &routeLegs{s: s, ctx: ctx, profile: profile, known: map[[4]float64]LegEstimate{}}
+}
+
+// leg estimates the drive from (fromLat, fromLng) to (toLat, toLng).
+func (l *routeLegs) leg(fromLat, fromLng, toLat, toLng float64) LegEstimate {
+	key := [4]float64{fromLat, fromLng, toLat, toLng}
+	leg, ok := l.known[key]
+	if !ok {
+		leg = l.s.estimateLeg(l.ctx, fromLat, fromLng, toLat, toLng, l.profile)
+		l.known[key] = leg
+	}
+	return leg
+}
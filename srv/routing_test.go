@@ -0,0 +1,117 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// stubEstimator makes every leg 10km and 30 minutes, recording the
+// profiles it was asked for.
+type stubEstimator struct {
+	mu       sync.Mutex
+	profiles []string
+	err      error
+}
+
+func (e *stubEstimator) EstimateLeg(ctx context.Context, fromLat, fromLng, toLat, toLng float64, profile string) (LegEstimate, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.profiles = append(e.profiles, profile)
+	return LegEstimate{Km: 10, Minutes: 30}, e.err
+}
+
+func TestRoutingProfileReachesEstimator(t *testing.T) {
+	server, llm := newTestServer(t)
+	router := &stubEstimator{}
+	server.Router = router
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.0)
+	pass := seedSpot(t, server, "峠", "drive", 35.05, 139.05)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "stay_durations": [30, 30], "message": "ok"}`, lake.ID, pass.ID)
+
+	route := func(profile string) RouteResponse {
+		t.Helper()
+		router.profiles = nil
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", RoutingProfile: profile})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
+		}
+		return resp
+	}
+
+	resp := route(ProfileScenic)
+	if fmt.Sprint(router.profiles) != "[scenic scenic scenic]" {
+		t.Errorf("expected the profile on all 3 legs, got %v", router.profiles)
+	}
+	// Three 10km, 30 minute legs and two 30 minute stays
+	if resp.TotalDistanceKm != 30 || resp.EstimatedReturn != "11:30" {
+		t.Errorf("expected the estimator's legs, got %vkm back at %s", resp.TotalDistanceKm, resp.EstimatedReturn)
+	}
+
+	route("")
+	if len(router.profiles) == 0 || router.profiles[0] != ProfileFastest {
+		t.Errorf("expected fastest by default, got %v", router.profiles)
+	}
+
+	// A failing estimator falls back to straight-line legs
+	router.err = errors.New("routing service down")
+	if resp := route(ProfileNoHighway); resp.TotalDistanceKm == 30 || len(resp.Stops) != 4 {
+		t.Errorf("expected a straight-line route, got %+v", resp)
+	}
+
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, RoutingProfile: "offroad"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown profile, got %d", w.Code)
+	}
+}
+
+func TestStraightLineEstimatorIgnoresProfile(t *testing.T) {
+	e := straightLineEstimator{}
+	fastest, _ := e.EstimateLeg(context.Background(), 35.0, 139.0, 35.5, 139.5, ProfileFastest)
+	scenic, _ := e.EstimateLeg(context.Background(), 35.0, 139.0, 35.5, 139.5, ProfileScenic)
+	if fastest != scenic || fastest.Minutes != drivingMinutes(fastest.Km) {
+		t.Errorf("expected the same straight-line estimate, got %+v and %+v", fastest, scenic)
+	}
+}
+
+func TestRouterTimesTrimRoutes(t *testing.T) {
+	server, llm := newTestServer(t)
+	router := &stubEstimator{}
+	server.Router = router
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.0)
+	pass := seedSpot(t, server, "峠", "drive", 35.05, 139.05)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "stay_durations": [30, 30], "message": "ok"}`, lake.ID, pass.ID)
+
+	// In a straight line both stops are back by 11:00, but with 30 minute
+	// legs only the first one is.
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", MustReturnBy: "11:00"})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("route: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Stops) != 3 || resp.TrimmedStops != 1 || resp.EstimatedReturn != "10:30" {
+		t.Errorf("expected the route trimmed to one stop back at 10:30, got %d stops, %d trimmed, back at %s", len(resp.Stops), resp.TrimmedStops, resp.EstimatedReturn)
+	}
+
+	router.profiles = nil
+	w = postJSON(t, server, "/api/route/modify", "user-a", map[string]any{
+		"lat": 35.0, "lng": 139.0, "departure_time": "09:00", "action": "skip", "target_id": pass.ID, "routing_profile": ProfileScenic,
+		"current_route": []map[string]any{{"id": lake.ID, "stay_duration": 30}, {"id": pass.ID, "stay_duration": 30}},
+	})
+	resp = RouteResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("modify: %d %s", w.Code, w.Body.String())
+	}
+	if resp.TotalDistanceKm != 20 || resp.EstimatedReturn != "10:30" || fmt.Sprint(router.profiles) != "[scenic scenic]" {
+		t.Errorf("expected the estimator's scenic legs, got %vkm back at %s with %v", resp.TotalDistanceKm, resp.EstimatedReturn, router.profiles)
+	}
+	w = postJSON(t, server, "/api/route/modify", "user-a", map[string]any{"lat": 35.0, "lng": 139.0, "routing_profile": "offroad"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown profile, got %d", w.Code)
+	}
+}
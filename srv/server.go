@@ -1,39 +1,376 @@
 package srv
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io"
 	"log/slog"
 	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	texttemplate "text/template"
 	"time"
 
+	"golang.org/x/sync/singleflight"
 	"srv.exe.dev/db"
 	"srv.exe.dev/db/dbgen"
 )
 
 type Server struct {
 	DB           *sql.DB
+	Queries      *dbgen.Queries // queries on DB; handlers that write more than once use WithTx
 	Hostname     string
 	TemplatesDir string
+	PromptsDir   string // text/template AI prompts, read at startup
 	StaticDir    string
+	LLM          LLM
+
+	// llmCalls coalesces concurrent identical prompts; see complete.
+	llmCalls singleflight.Group
+
+	// LLMHealthWindow is how many recent AI calls GET /api/stats/llm
+	// reports the success rate of. A rate below LLMSuccessThreshold (0-1)
+	// is logged as a warning; zero never warns.
+	LLMHealthWindow     int
+	LLMSuccessThreshold float64
+	llmHealth           llmHealth
+
+	// Log is the logging configuration read from the environment by New.
+	Log LogConfig
+
+	// Audit optionally records every AI prompt and response.
+	Audit AuditConfig
+
+	// Distance estimates straight-line distances for filtering and routing.
+	Distance DistanceEstimator
+
+	// Router estimates the legs of generated routes, honoring the
+	// request's routing profile. Nil uses Distance at avgSpeedKmh. Planning
+	// (reach, trimming, reordering) still uses straight-line estimates.
+	Router RouteEstimator
+
+	// Geocoder resolves addresses for spots created without coordinates.
+	// Nil disables geocoding.
+	Geocoder Geocoder
+
+	// TokenSecret signs bearer tokens identifying users who can't keep
+	// cookies (see HandleMintToken). Empty disables tokens.
+	TokenSecret []byte
+
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Locale selects the category labels used in prompts ("ja" or "en").
+	// CategoryLabels overrides the built-in locale -> category -> label table.
+	Locale         string
+	CategoryLabels map[string]map[string]string
+
+	// OriginLabel names the start and end stops of routes; empty uses the
+	// locale's label ("現在地" or "Current location").
+	OriginLabel string
+
+	// ExcludeOriginInExports leaves the start and end stops out of route
+	// polylines and KML by default, so they only cover the spots.
+	ExcludeOriginInExports bool
+
+	// DebugMode exposes internal diagnostics under /api/debug.
+	DebugMode bool
+
+	// PromptReload re-reads the templates in PromptsDir for every prompt,
+	// for iterating on prompts without restarting.
+	PromptReload bool
+	prompts      *texttemplate.Template
+
+	// AdminEmails lists the exe.dev accounts allowed to use /api/admin.
+	AdminEmails []string
+
+	// MaxHistoryLimit caps the page size a client may ask GET /api/history
+	// for. Defaults to defaultMaxHistoryLimit.
+	MaxHistoryLimit int
+
+	// HistoryRetention is how long route and recommendation history is
+	// kept; older rows are pruned hourly while serving. Zero keeps everything.
+	HistoryRetention time.Duration
+
+	// FreshnessWindow is how long a newly added spot gets a ranking boost
+	// of up to FreshnessBoost, fading out over the window. Zero disables it.
+	FreshnessWindow time.Duration
+	FreshnessBoost  float64
+
+	// RecentPenalty is subtracted from the ranking score of spots
+	// recommended to the user in the last week, so they sink below fresher
+	// picks without being excluded.
+	RecentPenalty float64
+
+	// RevisitMinRating lets visited spots be recommended again once the
+	// user's average rating of them is at least this (1-5) and they
+	// haven't been back for RevisitCooldown. Zero always excludes visited
+	// spots.
+	RevisitMinRating int
+	RevisitCooldown  time.Duration
+
+	// RecentCategoryWindow is how far back a route request with
+	// diversify_from_history looks for the categories the user visited.
+	RecentCategoryWindow time.Duration
+
+	// SpotRecommendCap excludes spots already recommended to the user this
+	// many times within the last SpotRecommendCapWindow, unlike
+	// RecentPenalty which only demotes them. Zero disables the cap.
+	SpotRecommendCap       int
+	SpotRecommendCapWindow time.Duration
+
+	// MinCandidatePool widens a recommendation's max_distance_km step by
+	// step, up to MaxRelaxedDistanceKm, while fewer spots than this pass
+	// its filters. Zero disables the widening.
+	MinCandidatePool     int
+	MaxRelaxedDistanceKm float64
+
+	// RecommendCooldown serves a user's previous recommendation again when
+	// they repeat the request within this long from within
+	// RecommendCooldownKm of the previous origin, instead of asking the AI
+	// again. Zero disables the cooldown.
+	RecommendCooldown   time.Duration
+	RecommendCooldownKm float64
+	cooldown            recommendCooldown
+
+	// Scorer ranks recommendation candidates. Nil uses HeuristicScorer.
+	Scorer Scorer
+
+	// CategoryRatingWeight is how much the user's own ratings of a category
+	// move its spots up or down the ranking (see categoryAffinity). Zero
+	// ignores them.
+	CategoryRatingWeight float64
+
+	// DuplicateRadiusKm rejects new spots this close to an existing one,
+	// of any status, unless the request sets force. Zero disables the
+	// check.
+	DuplicateRadiusKm float64
+
+	// CoordinatePrecision is how many decimal places spot coordinates are
+	// rounded to when created, edited or imported. Zero stores them as
+	// given.
+	CoordinatePrecision int
+
+	// VerifyCoordinates reverse geocodes spots' coordinates on create and
+	// update, when Geocoder supports it, and rejects those whose place
+	// doesn't match the spot's name or address unless the request sets
+	// force. The result is stored as the spot's coordinates_verified.
+	VerifyCoordinates bool
+
+	// CacheKeyPrecision is how many decimal places the origin is rounded
+	// to in recommendation cache keys, which the recommendation cooldown
+	// treats as the same place, trading hit rate for accuracy: each place
+	// is ten times finer. Latitude degrees are 111km, so 1 place groups
+	// origins within about 11km, 2 within 1.1km, 3 within 110m and 4
+	// within 11m; longitude degrees shrink with the cosine of the latitude
+	// (about 91km at Tokyo). Zero keeps the origin as given.
+	CacheKeyPrecision int
+
+	// MaxSpotMoveKm rejects spot updates that move it farther than this,
+	// likely a data entry error, unless the request sets force. Zero
+	// disables the check.
+	MaxSpotMoveKm float64
+
+	// AccessibilityStrict excludes spots whose accessibility is unknown when
+	// a request requires it; otherwise only spots known to lack it are
+	// excluded. Defaults to true.
+	AccessibilityStrict bool
+
+	// MinRecommendations and MaxRecommendations bound how many spots a
+	// recommendation returns: the AI is asked for that many, candidates fill
+	// in when it picks fewer than the minimum, and extras are cut. Set both
+	// to 1 for a single-card UI. Default to 3 and 5.
+	MinRecommendations int
+	MaxRecommendations int
+
+	// PromptCandidateOrder picks the candidates offered to the AI when
+	// there are too many to list. Defaults to CandidateByScore.
+	PromptCandidateOrder CandidateOrder
+
+	// FallbackOrder picks the candidates that fill a recommendation when
+	// the AI fails or picks too few. Defaults to FallbackRanked.
+	FallbackOrder FallbackOrder
+
+	// DefaultStays overrides the per-category stay, in minutes, at stops
+	// the AI or a route edit gave no duration and whose spot has no
+	// suggested stay (see defaultStays).
+	DefaultStays map[string]int
+
+	// StayLimits overrides the per-category range AI-supplied stay
+	// durations are clamped to (see defaultStayLimits).
+	StayLimits map[string]StayRange
+
+	// MaxStops overrides how many stops of a category a route may have
+	// (see defaultMaxStops). Drive spots are never capped.
+	MaxStops map[string]int
+
+	// FuelEfficiencyKmL and FuelPrice (per litre) estimate each route's fuel
+	// cost. Either being zero leaves the estimate out unless the request
+	// supplies it.
+	FuelEfficiencyKmL float64
+	FuelPrice         float64
+
+	// MaxCandidateSpots caps how many spots one recommendation or route
+	// loads, keeping those nearest the origin. Zero disables the cap.
+	MaxCandidateSpots int
+
+	// PromptDescriptionMax caps how many characters of each candidate's
+	// description go into AI prompts; responses keep the full text. Zero
+	// disables the cap.
+	PromptDescriptionMax int
+
+	// MaxPromptChars caps the length of recommendation prompts in
+	// characters. Longer prompts lose their oldest visits, then their
+	// lowest ranked candidates (see renderRecommendPrompt). Zero disables
+	// the cap.
+	MaxPromptChars int
+
+	// DefaultIncludeRestaurant and DefaultIncludeRest apply when a route
+	// request omits include_restaurant or include_rest.
+	DefaultIncludeRestaurant bool
+	DefaultIncludeRest       bool
+
+	// MinLegKm is the minimum distance between consecutive route stops;
+	// closer stops are dropped. Zero disables the check.
+	MinLegKm float64
+
+	// RouteReachDivisor limits how far from the origin route candidates may
+	// be: the farthest stop is at most 1/RouteReachDivisor of the total
+	// driving distance budget away. 2 allows a single out-and-back trip to
+	// use the whole budget; larger values keep routes closer to home.
+	// Must be > 0; defaults to 3.
+	RouteReachDivisor float64
+
+	// RouteReachMode decides whether route candidates are limited by their
+	// one-way distance from the origin or by their share of the round trip.
+	// Defaults to ReachOneWay.
+	RouteReachMode RouteReachMode
+
+	// Rand is the source of every random choice, such as the order route
+	// candidates are offered in, unless a route request sets its own seed.
+	// Nil uses a time-seeded source; tests set a seeded one for repeatable
+	// routes.
+	Rand   *rand.Rand
+	randMu sync.Mutex
+
+	// LatestReturn ("HH:MM") is when routes without a return time should be
+	// back: spots whose round trip from the departure doesn't fit before
+	// it are not offered to the AI, e.g. "21:00". Empty, the default,
+	// disables it.
+	LatestReturn string
+
+	// PastDeparture decides how routes whose departure time has already
+	// passed today are scheduled. Defaults to PastDepartureAsIs.
+	PastDeparture PastDeparture
+
+	// TimeZone is where requests' clock times, such as departure_time,
+	// are read, for PastDeparture. Defaults to Asia/Tokyo.
+	TimeZone *time.Location
+
+	// Now is the current time for PastDeparture. Nil uses time.Now; tests
+	// set a fixed clock.
+	Now func() time.Time
 }
 
+const defaultRouteReachDivisor = 3
+
+const (
+	defaultMinRecommendations = 3
+	defaultMaxRecommendations = 5
+)
+
+// defaultDuplicateRadiusKm treats spots within 100m as likely duplicates.
+const defaultDuplicateRadiusKm = 0.1
+
+// defaultMaxSpotMoveKm allows correcting a misplaced pin within a town.
+const defaultMaxSpotMoveKm = 5
+
+// defaultFreshnessBoost is the boost for a brand-new spot; for comparison,
+// an indoor spot in bad weather scores 1.
+const defaultFreshnessBoost = 1.5
+
+// defaultRecentPenalty outweighs both the weather score and a full
+// freshness boost.
+const defaultRecentPenalty = 3
+
+// defaultHistoryLimit and defaultMaxHistoryLimit are the page size of GET
+// /api/history when unset and its default cap.
+const (
+	defaultHistoryLimit    = 20
+	defaultMaxHistoryLimit = 100
+)
+
+// defaultRevisitCooldown is how long a liked spot rests after a visit.
+const defaultRevisitCooldown = 90 * 24 * time.Hour
+
+// defaultRecentCategoryWindow covers about the last outing or two.
+const defaultRecentCategoryWindow = 14 * 24 * time.Hour
+
+// defaultSpotRecommendCapWindow is the window SpotRecommendCap counts in.
+const defaultSpotRecommendCapWindow = 30 * 24 * time.Hour
+
 func New(dbPath, hostname string) (*Server, error) {
+	logCfg, err := logConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, logCfg)))
+
 	_, thisFile, _, _ := runtime.Caller(0)
 	baseDir := filepath.Dir(thisFile)
 	srv := &Server{
 		Hostname:     hostname,
 		TemplatesDir: filepath.Join(baseDir, "templates"),
+		PromptsDir:   filepath.Join(baseDir, "prompts"),
 		StaticDir:    filepath.Join(baseDir, "static"),
+		LLM:          newGatewayLLM(),
+		Log:          logCfg,
+		Locale:       defaultLocale,
+		Distance:     DistanceEstimator{RadiusKm: defaultEarthRadiusKm, Mode: GreatCircle},
+
+		LLMHealthWindow:        defaultLLMHealthWindow,
+		LLMSuccessThreshold:    defaultLLMSuccessThreshold,
+		DuplicateRadiusKm:      defaultDuplicateRadiusKm,
+		MaxSpotMoveKm:          defaultMaxSpotMoveKm,
+		CoordinatePrecision:    defaultCoordinatePrecision,
+		CacheKeyPrecision:      defaultCacheKeyPrecision,
+		RecommendCooldownKm:    defaultRecommendCooldownKm,
+		AccessibilityStrict:    true,
+		FreshnessBoost:         defaultFreshnessBoost,
+		RecentPenalty:          defaultRecentPenalty,
+		SpotRecommendCapWindow: defaultSpotRecommendCapWindow,
+		RevisitCooldown:        defaultRevisitCooldown,
+		MaxHistoryLimit:        defaultMaxHistoryLimit,
+		RecentCategoryWindow:   defaultRecentCategoryWindow,
+		MaxRelaxedDistanceKm:   defaultMaxRelaxedDistanceKm,
+		CategoryRatingWeight:   defaultCategoryRatingWeight,
+		RouteReachDivisor:      defaultRouteReachDivisor,
+		RouteReachMode:         ReachOneWay,
+		MinRecommendations:     defaultMinRecommendations,
+		MaxRecommendations:     defaultMaxRecommendations,
+		FallbackOrder:          FallbackRanked,
+		PromptCandidateOrder:   CandidateByScore,
+		MaxCandidateSpots:      defaultMaxCandidateSpots,
+		PromptDescriptionMax:   defaultPromptDescriptionMax,
+		MaxPromptChars:         defaultMaxPromptChars,
+		PastDeparture:          PastDepartureAsIs,
+		TimeZone:               defaultTimeZone,
+	}
+	if srv.prompts, err = srv.loadPrompts(); err != nil {
+		return nil, err
 	}
 	if err := srv.setUpDatabase(dbPath); err != nil {
 		return nil, err
@@ -67,33 +404,142 @@ func (s *Server) setUpDatabase(dbPath string) error {
 		return fmt.Errorf("failed to open db: %w", err)
 	}
 	s.DB = wdb
+	s.Queries = dbgen.New(wdb)
 	if err := db.RunMigrations(wdb); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 	return nil
 }
 
+// Serve listens on addr and serves requests. addr is a TCP address such as
+// ":8000", or "unix:/path/to.sock" for a Unix socket. If TLSCertFile and
+// TLSKeyFile are set, the server speaks HTTPS.
 func (s *Server) Serve(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("starting server", "addr", addr, "tls", s.TLSCertFile != "")
+	return s.serveListener(ctx, ln)
+}
+
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// Remove a stale socket left behind by a previous run
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("listen on unix socket %s: %w", path, err)
+		}
+		return ln, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// shutdownTimeout bounds how long in-flight requests get to finish.
+const shutdownTimeout = 10 * time.Second
+
+// serveListener serves on ln until ctx is done, then shuts down gracefully
+// and waits for background jobs to stop.
+func (s *Server) serveListener(ctx context.Context, ln net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var jobs sync.WaitGroup
+	if s.HistoryRetention > 0 || s.Audit.Retention > 0 {
+		jobs.Go(func() { s.runHistoryPruner(ctx, pruneInterval) })
+	}
+
+	httpServer := &http.Server{Handler: s.Handler()}
+	errc := make(chan error, 1)
+	go func() {
+		if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+			errc <- httpServer.ServeTLS(ln, s.TLSCertFile, s.TLSKeyFile)
+			return
+		}
+		errc <- httpServer.Serve(ln)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		slog.Info("shutting down")
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		err = httpServer.Shutdown(shutdownCtx)
+	}
+	cancel()
+	jobs.Wait()
+	return err
+}
+
+// Handler returns the HTTP handler with all routes registered.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /{$}", s.HandleRoot)
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.StaticDir))))
 
 	// API routes
+	mux.HandleFunc("GET /api/config", s.HandleConfig)
+	mux.HandleFunc("POST /api/token", s.HandleMintToken)
 	mux.HandleFunc("GET /api/spots", s.HandleGetSpots)
+	mux.HandleFunc("POST /api/spots", s.HandleCreateSpot)
+	mux.HandleFunc("GET /api/spots/mine", s.HandleMySpots)
+	mux.HandleFunc("GET /api/spots/{id}", s.HandleGetSpot)
+	mux.HandleFunc("GET /api/spots/{id}/eta", s.HandleSpotETA)
+	mux.HandleFunc("GET /api/spots/{id}/similar", s.HandleSimilarSpots)
+	mux.HandleFunc("PUT /api/spots/{id}", s.HandleUpdateSpot)
+	mux.HandleFunc("POST /api/spots/{id}/images", s.HandleAddSpotImage)
+	mux.HandleFunc("DELETE /api/spots/{id}/images/{image_id}", s.HandleDeleteSpotImage)
 	mux.HandleFunc("POST /api/recommend", s.HandleRecommend)
+	mux.HandleFunc("POST /api/recommend/batch", s.HandleRecommendBatch)
+	mux.HandleFunc("POST /api/recommend/message", s.HandleRecommendMessage)
 	mux.HandleFunc("POST /api/route", s.HandleGenerateRoute)
 	mux.HandleFunc("POST /api/route/modify", s.HandleModifyRoute)
+	mux.HandleFunc("POST /api/route/compare", s.HandleCompareRoutes)
+	mux.HandleFunc("POST /api/route/{id}/explain", s.HandleExplainRoute)
+	mux.HandleFunc("POST /api/route/{id}/regenerate", s.HandleRegenerateRoute)
+	mux.HandleFunc("GET /api/route/{id}/kml", s.HandleRouteKML)
 	mux.HandleFunc("POST /api/alternatives", s.HandleGetAlternatives)
+	mux.HandleFunc("POST /api/reachable", s.HandleReachable)
+	mux.HandleFunc("GET /api/reachable/summary", s.HandleReachableSummary)
+	mux.HandleFunc("GET /api/isochrone", s.HandleIsochrone)
 	mux.HandleFunc("POST /api/feedback", s.HandleFeedback)
 	mux.HandleFunc("GET /api/history", s.HandleGetHistory)
+	mux.HandleFunc("GET /api/user/export", s.HandleExportUser)
+	mux.HandleFunc("GET /api/stats/categories", s.HandleCategoryTrends)
+	mux.HandleFunc("GET /api/stats/llm", s.HandleLLMStats)
 	mux.HandleFunc("POST /api/accept", s.HandleAcceptRecommendation)
+	mux.HandleFunc("POST /api/accept/batch", s.HandleAcceptRecommendationBatch)
+
+	// Debug routes (DebugMode only)
+	mux.HandleFunc("GET /api/debug/sizes", s.requireDebug(s.HandleDebugSizes))
 
-	slog.Info("starting server", "addr", addr)
-	return http.ListenAndServe(addr, mux)
+	// Admin routes
+	mux.HandleFunc("GET /api/admin/activity", s.requireAdmin(s.HandleAdminActivity))
+	mux.HandleFunc("GET /api/admin/spots", s.requireAdmin(s.HandleAdminSpots))
+	mux.HandleFunc("POST /api/admin/spots/{id}/approve", s.requireAdmin(s.HandleApproveSpot))
+	mux.HandleFunc("POST /api/admin/spots/{id}/reject", s.requireAdmin(s.HandleRejectSpot))
+	mux.HandleFunc("POST /api/admin/prune", s.requireAdmin(s.HandleAdminPrune))
+	mux.HandleFunc("POST /api/admin/import/overpass", s.requireAdmin(s.HandleAdminImportOverpass))
+
+	return mux
 }
 
-// Get user ID from cookie or create new one
+// Get user ID from a bearer token or cookie, or create new one
 func (s *Server) getUserID(w http.ResponseWriter, r *http.Request) string {
+	if userID, ok := s.tokenUserID(r); ok {
+		return userID
+	}
 	cookie, err := r.Cookie("user_id")
 	if err == nil && cookie.Value != "" {
 		return cookie.Value
@@ -112,24 +558,26 @@ func (s *Server) getUserID(w http.ResponseWriter, r *http.Request) string {
 	return userID
 }
 
-func (s *Server) HandleGetSpots(w http.ResponseWriter, r *http.Request) {
-	q := dbgen.New(s.DB)
-	spots, err := q.GetAllSpots(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(spots)
-}
-
 // SpotWithDistance includes distance and time info
 type SpotWithDistance struct {
 	dbgen.Spot
-	DistanceKm    float64 `json:"distance_km"`
+	DistanceKm     float64 `json:"distance_km"`
 	DrivingTimeMin int     `json:"driving_time_min"`
-	RoundTripKm   float64 `json:"round_trip_km"`
-	RoundTripMin  int     `json:"round_trip_min"`
+	RoundTripKm    float64 `json:"round_trip_km"`
+	RoundTripMin   int     `json:"round_trip_min"`
+}
+
+// newSpotWithDistance annotates spot with its one-way distance distKm from
+// the origin and the estimated driving times.
+func newSpotWithDistance(spot dbgen.Spot, distKm float64) SpotWithDistance {
+	drivingMin := drivingMinutes(distKm)
+	return SpotWithDistance{
+		Spot:           spot,
+		DistanceKm:     math.Round(distKm*10) / 10,
+		DrivingTimeMin: drivingMin,
+		RoundTripKm:    math.Round(distKm*2*10) / 10,
+		RoundTripMin:   drivingMin * 2,
+	}
 }
 
 // RecommendRequest is the request body for recommendations
@@ -139,88 +587,185 @@ type RecommendRequest struct {
 	MaxDistanceKm float64 `json:"max_distance_km"`
 	MaxTimeHours  float64 `json:"max_time_hours"`
 	Category      string  `json:"category"` // optional filter
+
+	// SpatialDiversity spreads the picks across compass directions from
+	// the origin instead of letting them cluster in one area.
+	SpatialDiversity bool `json:"spatial_diversity"`
+
+	// Weather is the current weather at the origin ("clear", "cloudy",
+	// "rain", "snow" or "storm"). In bad weather indoor spots are preferred.
+	Weather string `json:"weather"`
+
+	// Accessibility restricts picks to spots with these attributes.
+	Accessibility AccessibilityNeeds `json:"accessibility"`
+
+	// MaxDifficulty excludes spots with harder roads (DifficultyEasy to
+	// DifficultyHard); zero allows any.
+	MaxDifficulty int `json:"max_difficulty"`
+
+	// MaxSpotFee excludes spots whose entry fee is higher, in yen; 0 keeps
+	// only free spots. Spots with an unknown fee are kept; nil allows any.
+	MaxSpotFee *int64 `json:"max_spot_fee"`
+
+	// IncludeCandidates adds the candidates ranked for the AI to the
+	// response, for showing what was considered.
+	IncludeCandidates bool `json:"include_candidates"`
 }
 
 // RecommendResponse is the response from AI recommendations
 type RecommendResponse struct {
-	Spots      []SpotWithDistance `json:"spots"`
-	Message    string             `json:"message"`
-	UserStats  *UserStatsInfo     `json:"user_stats,omitempty"`
+	Spots     []SpotWithDistance `json:"spots"`
+	Message   string             `json:"message"`
+	UserStats *UserStatsInfo     `json:"user_stats,omitempty"`
+
+	// InvalidIDsDropped counts spot IDs the AI returned that weren't among
+	// the candidates, for spotting prompt/model regressions.
+	InvalidIDsDropped int `json:"invalid_ids_dropped,omitempty"`
+
+	// Note explains a response repeated from the recommendation cooldown;
+	// its distances are from the previous origin.
+	Note string `json:"note,omitempty"`
+
+	// Candidates are the spots ranked for the AI, at most
+	// maxPromptCandidates, and CandidateCount how many passed the filters
+	// in all. A prompt over MaxPromptChars offers only the first of them
+	// (see renderRecommendPrompt). Only set when the request asks for them.
+	Candidates     []SpotWithDistance `json:"candidates,omitempty"`
+	CandidateCount int                `json:"candidate_count,omitempty"`
 }
 
 type UserStatsInfo struct {
-	TotalVisits      int     `json:"total_visits"`
-	FavoriteCategory string  `json:"favorite_category"`
+	TotalVisits      int    `json:"total_visits"`
+	FavoriteCategory string `json:"favorite_category"`
 }
 
 func (s *Server) HandleRecommend(w http.ResponseWriter, r *http.Request) {
 	userID := s.getUserID(w, r)
-	
+
 	var req RecommendRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	if req.MaxDistanceKm == 0 {
-		req.MaxDistanceKm = 100 // default 100km
+	if err := validateMaxDifficulty(req.MaxDifficulty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if req.MaxTimeHours == 0 {
-		req.MaxTimeHours = 3 // default 3 hours one way
+	if err := validateMaxSpotFee(req.MaxSpotFee); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if resp, ok := s.cooledRecommendation(userID, req); ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
 	}
 
-	q := dbgen.New(s.DB)
+	q := s.Queries
 
 	// Ensure user exists
 	_, _ = q.GetOrCreateUser(r.Context(), userID)
 
-	// Get user's visit history
-	visitedIDs, _ := q.GetUserVisitedSpotIDs(r.Context(), userID)
-	visitedSet := make(map[int64]bool)
-	for _, id := range visitedIDs {
-		visitedSet[id] = true
+	in, err := retryTransient(r.Context(), func() (recommendInputs, error) {
+		return s.loadRecommendInputs(r.Context(), q, userID, s.recommendArea(req), recommendQueryConcurrency)
+	})
+	if err != nil {
+		writeDBError(w, err)
+		return
 	}
 
-	// Get recent recommendations to avoid repetition
-	recentRecs, _ := q.GetRecentRecommendations(r.Context(), userID)
-	recentSet := make(map[int64]bool)
-	for _, id := range recentRecs {
-		recentSet[id] = true
+	resp := s.recommend(r.Context(), userID, req, in)
+	s.rememberRecommendation(userID, req, resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recommend runs the recommendation pipeline for one origin using the
+// already loaded inputs, and records the picks in the user's history.
+func (s *Server) recommend(ctx context.Context, userID string, req RecommendRequest, in recommendInputs) RecommendResponse {
+	if req.MaxDistanceKm == 0 {
+		req.MaxDistanceKm = defaultMaxDistanceKm
+	}
+	if req.MaxTimeHours == 0 {
+		req.MaxTimeHours = defaultMaxTimeHours
 	}
+	recentSet, userStats, history := in.recentSet, in.userStats, in.history
 
-	// Get user stats for personalization
-	var userStats *UserStatsInfo
-	stats, err := q.GetUserStats(r.Context(), userID)
-	if err == nil && stats.TotalVisits > 0 {
-		userStats = &UserStatsInfo{
-			TotalVisits:      int(stats.TotalVisits),
-			FavoriteCategory: stats.FavoriteCategory,
+	candidates, relaxedKm := s.candidatePool(ctx, req, in)
+
+	s.rankCandidates(candidates, ScoreContext{
+		Request:         req,
+		UserStats:       userStats,
+		History:         history,
+		Recent:          recentSet,
+		CategoryRatings: in.categoryRatings,
+		Now:             time.Now(),
+	})
+
+	if len(candidates) == 0 {
+		return RecommendResponse{
+			Spots:   []SpotWithDistance{},
+			Message: "条件に合うスポットが見つかりませんでした。距離や時間の条件を緩めてみてください。",
 		}
 	}
 
-	// Get visit history for AI context
-	history, _ := q.GetUserVisitHistory(r.Context(), dbgen.GetUserVisitHistoryParams{
-		UserID: userID,
-		Limit:  20,
+	// Call AI to get recommendations
+	recommended, message, invalidDropped := s.getAIRecommendations(ctx, candidates, history, userStats, recentSet, req)
+
+	if req.SpatialDiversity {
+		recommended = spreadByBearing(recommended, candidates, req.Lat, req.Lng)
+	}
+	if relaxedKm > 0 {
+		message += relaxedNote(relaxedKm)
+	}
+
+	// Record recommendations, all or none, so the recent-picks penalty
+	// sees the response as it was served
+	err := s.WithTx(ctx, func(q *dbgen.Queries) error {
+		for _, spot := range recommended {
+			falseVal := false
+			if _, err := q.AddRecommendationHistory(ctx, dbgen.AddRecommendationHistoryParams{
+				UserID:      userID,
+				SpotID:      spot.ID,
+				WasAccepted: &falseVal,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
-
-	// Get all spots
-	allSpots, err := q.GetAllSpots(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		slog.Warn("record recommendations", "user", userID, "error", err)
 	}
 
+	resp := RecommendResponse{
+		Spots:             recommended,
+		Message:           message,
+		UserStats:         userStats,
+		InvalidIDsDropped: invalidDropped,
+	}
+	if req.IncludeCandidates {
+		resp.Candidates = s.promptCandidates(candidates)
+		resp.CandidateCount = len(candidates)
+	}
+	return resp
+}
+
+// filterCandidates returns in's spots that pass req's filters, with their
+// distances from the origin.
+func (s *Server) filterCandidates(req RecommendRequest, in recommendInputs) []SpotWithDistance {
 	// Filter and calculate distances
 	var candidates []SpotWithDistance
-	for _, spot := range allSpots {
-		// Skip visited spots
-		if visitedSet[spot.ID] {
+	for _, spot := range in.allSpots {
+		// Skip visited spots, and those recommended too often
+		if in.visitedSet[spot.ID] || in.cappedSet[spot.ID] {
 			continue
 		}
 
 		// Calculate distance
-		dist := haversine(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
+		dist := s.distanceKm(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
 		if dist > req.MaxDistanceKm {
 			continue
 		}
@@ -230,108 +775,85 @@ func (s *Server) HandleRecommend(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Estimate driving time (assume 40km/h average for scenic routes)
-		drivingMin := int(dist / 40 * 60)
-		if float64(drivingMin)/60 > req.MaxTimeHours {
+		if !s.meetsAccessibility(spot, req.Accessibility) || !withinDifficulty(spot, req.MaxDifficulty) || !withinFee(spot, req.MaxSpotFee) {
 			continue
 		}
 
-		candidates = append(candidates, SpotWithDistance{
-			Spot:           spot,
-			DistanceKm:     math.Round(dist*10) / 10,
-			DrivingTimeMin: drivingMin,
-			RoundTripKm:    math.Round(dist*2*10) / 10,
-			RoundTripMin:   drivingMin * 2,
-		})
-	}
-
-	if len(candidates) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(RecommendResponse{
-			Spots:   []SpotWithDistance{},
-			Message: "条件に合うスポットが見つかりませんでした。距離や時間の条件を緩めてみてください。",
-		})
-		return
-	}
-
-	// Call AI to get recommendations
-	recommended, message := s.getAIRecommendations(candidates, history, userStats, recentSet, req)
+		candidate := newSpotWithDistance(spot, dist)
+		if float64(candidate.DrivingTimeMin)/60 > req.MaxTimeHours {
+			continue
+		}
 
-	// Record recommendations
-	for _, spot := range recommended {
-		falseVal := false
-		q.AddRecommendationHistory(r.Context(), dbgen.AddRecommendationHistoryParams{
-			UserID:      userID,
-			SpotID:      spot.ID,
-			WasAccepted: &falseVal,
-		})
+		candidates = append(candidates, candidate)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(RecommendResponse{
-		Spots:     recommended,
-		Message:   message,
-		UserStats: userStats,
-	})
+	return candidates
 }
 
-func (s *Server) getAIRecommendations(candidates []SpotWithDistance, history []dbgen.GetUserVisitHistoryRow, userStats *UserStatsInfo, recentSet map[int64]bool, req RecommendRequest) ([]SpotWithDistance, string) {
+func (s *Server) getAIRecommendations(ctx context.Context, candidates []SpotWithDistance, history []dbgen.GetUserVisitHistoryRow, userStats *UserStatsInfo, recentSet map[int64]bool, req RecommendRequest) ([]SpotWithDistance, string, int) {
 	// Build context for AI
-	var historyContext string
-	if len(history) > 0 {
-		historyContext = "ユーザーの訪問履歴:\n"
-		for _, h := range history {
-			ratingStr := "未評価"
-			if h.Rating != nil {
-				ratingStr = fmt.Sprintf("%d点", *h.Rating)
-			}
-			historyContext += fmt.Sprintf("- %s (%s): %s\n", h.SpotName, h.SpotCategory, ratingStr)
+	data := recommendPromptData{Count: s.recommendCountLabel()}
+	for _, h := range history {
+		visit := promptVisit{Name: h.SpotName, Category: h.SpotCategory}
+		if h.Rating != nil {
+			visit.Rating = *h.Rating
 		}
+		data.History = append(data.History, visit)
 	}
-
-	var prefContext string
 	if userStats != nil && userStats.FavoriteCategory != "" {
-		catLabel := map[string]string{"drive": "ドライブスポット", "restaurant": "食事", "rest": "休憩所"}[userStats.FavoriteCategory]
-		prefContext = fmt.Sprintf("ユーザーの好み: %sを好む傾向があります（%d箇所訪問済み）\n", catLabel, userStats.TotalVisits)
+		data.Preference = &promptPreference{Label: s.categoryLabel(userStats.FavoriteCategory), Visits: userStats.TotalVisits}
 	}
 
 	// Build candidate list for AI
-	var candidateList string
-	for i, c := range candidates {
-		if i >= 30 { // Limit to 30 candidates for AI
-			break
-		}
-		recentTag := ""
+	now := time.Now()
+	hasFresh := false
+	for _, c := range s.promptCandidates(candidates) {
+		tags := ""
 		if recentSet[c.ID] {
-			recentTag = " [最近おすすめ済み]"
+			tags = " [最近おすすめ済み]"
 		}
-		desc := ""
-		if c.Description != nil {
-			desc = *c.Description
+		if c.Indoor != nil {
+			tags += map[bool]string{true: " [屋内]", false: " [屋外]"}[*c.Indoor]
 		}
-		candidateList += fmt.Sprintf("%d. [ID:%d] %s (%s) - %.1fkm/片道%d分 - %s%s\n",
-			i+1, c.ID, c.Name, c.Category, c.DistanceKm, c.DrivingTimeMin, desc, recentTag)
+		tags += accessibilityTags(c.Spot) + difficultyTag(c.Spot) + feeTag(c.Spot)
+		if s.isFresh(c, now) {
+			tags += " [新着]"
+			hasFresh = true
+		}
+		data.Candidates = append(data.Candidates, recommendCandidate{
+			ID:          c.ID,
+			Name:        c.Name,
+			Category:    s.categoryLabel(c.Category),
+			DistanceKm:  c.DistanceKm,
+			DrivingMin:  c.DrivingTimeMin,
+			Description: s.promptDescription(c.Description),
+			Tags:        tags,
+		})
 	}
 
-	prompt := fmt.Sprintf(`あなたはドライブスポットのレコメンドAIです。
-以下の情報をもとに、ユーザーに最適なドライブスポットを3〜5件選んでください。
-
-%s%s
-候補スポット:
-%s
-
-選択基準:
-1. ユーザーの好みに合ったカテゴリを優先
-2. 最近おすすめ済みのスポットは避ける
-3. バラエティを持たせる（同じカテゴリばかりにしない）
-4. 距離と所要時間のバランス
-
-以下のJSON形式で回答してください:
-{"spot_ids": [選択したスポットのID配列], "message": "おすすめ理由を簡潔に説明"}
-`, prefContext, historyContext, candidateList)
+	if req.SpatialDiversity {
+		data.Rules = append(data.Rules, "現在地から見て異なる方角のスポットを選ぶ（同じエリアに偏らせない）")
+	}
+	if badWeather[req.Weather] {
+		data.Rules = append(data.Rules, "天気が悪いため[屋内]のスポットを優先し、[屋外]のスポットは避ける")
+	}
+	if need := accessibilityRule(req.Accessibility); need != "" {
+		data.Rules = append(data.Rules, "同行者のため"+need+"のスポットを選ぶ")
+	}
+	if rule := difficultyRule(req.MaxDifficulty); rule != "" {
+		data.Rules = append(data.Rules, rule)
+	}
+	if hasFresh {
+		data.Rules = append(data.Rules, "[新着]のスポットを積極的に含める")
+	}
 
-	// Call Claude API
-	spotIDs, message := callClaudeAPI(prompt)
+	// Call Claude API; without a prompt, fall back to the ranked candidates
+	var spotIDs []int64
+	var message string
+	if prompt, err := s.renderRecommendPrompt(data); err != nil {
+		slog.Error("recommend prompt", "error", err)
+	} else {
+		spotIDs, message = s.callClaudeAPI(ctx, prompt)
+	}
 
 	// Map IDs back to spots
 	idToSpot := make(map[int64]SpotWithDistance)
@@ -340,16 +862,28 @@ func (s *Server) getAIRecommendations(candidates []SpotWithDistance, history []d
 	}
 
 	var result []SpotWithDistance
+	var invalidIDs []int64
 	for _, id := range spotIDs {
 		if spot, ok := idToSpot[id]; ok {
 			result = append(result, spot)
+		} else {
+			invalidIDs = append(invalidIDs, id)
 		}
 	}
+	if len(invalidIDs) > 0 {
+		// The model returned IDs we never offered; a rising count usually
+		// means a prompt or model regression.
+		slog.Warn("AI returned unknown spot IDs", "invalid_ids", invalidIDs, "returned", len(spotIDs), "candidates", len(candidates))
+	}
+
+	if len(result) > s.MaxRecommendations {
+		result = result[:s.MaxRecommendations]
+	}
 
 	// Fallback if AI didn't return enough results
-	if len(result) < 3 {
-		for _, c := range candidates {
-			if len(result) >= 5 {
+	if len(result) < s.MinRecommendations {
+		for _, c := range s.fallbackOrder(candidates) {
+			if len(result) >= s.MaxRecommendations {
 				break
 			}
 			alreadyIncluded := false
@@ -359,7 +893,10 @@ func (s *Server) getAIRecommendations(candidates []SpotWithDistance, history []d
 					break
 				}
 			}
-			if !alreadyIncluded && !recentSet[c.ID] {
+			// Unless FallbackOrder says otherwise, candidates are ranked,
+			// so recently recommended spots only come in once the fresher
+			// ones run out.
+			if !alreadyIncluded {
 				result = append(result, c)
 			}
 		}
@@ -368,64 +905,27 @@ func (s *Server) getAIRecommendations(candidates []SpotWithDistance, history []d
 		}
 	}
 
-	return result, message
+	return result, message, len(invalidIDs)
 }
 
-func callClaudeAPI(prompt string) ([]int64, string) {
-	reqBody := map[string]interface{}{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 500,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
+// recommendCountLabel is how many spots the recommendation prompt asks for.
+func (s *Server) recommendCountLabel() string {
+	if s.MinRecommendations == s.MaxRecommendations {
+		return fmt.Sprintf("%d件", s.MaxRecommendations)
 	}
+	return fmt.Sprintf("%d〜%d件", s.MinRecommendations, s.MaxRecommendations)
+}
 
-	jsonBody, _ := json.Marshal(reqBody)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, _ := http.NewRequest("POST", "http://169.254.169.254/gateway/llm/_/gateway/anthropic/v1/messages", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := client.Do(req)
+func (s *Server) callClaudeAPI(ctx context.Context, prompt string) ([]int64, string) {
+	text, err := s.complete(ctx, prompt, 500)
 	if err != nil {
 		slog.Error("Claude API error", "error", err)
 		return nil, ""
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		slog.Error("Parse Claude response", "error", err, "body", string(body))
-		return nil, ""
-	}
-
-	if len(result.Content) == 0 {
-		return nil, ""
-	}
-
-	// Parse the JSON response from Claude
-	text := result.Content[0].Text
-	
 	// Find JSON in response
-	start := -1
-	end := -1
-	for i, c := range text {
-		if c == '{' && start == -1 {
-			start = i
-		}
-		if c == '}' {
-			end = i + 1
-		}
-	}
-
-	if start == -1 || end == -1 {
+	raw, ok := extractJSONObject(text)
+	if !ok {
 		return nil, ""
 	}
 
@@ -433,7 +933,7 @@ func callClaudeAPI(prompt string) ([]int64, string) {
 		SpotIDs []int64 `json:"spot_ids"`
 		Message string  `json:"message"`
 	}
-	if err := json.Unmarshal([]byte(text[start:end]), &aiResp); err != nil {
+	if err := json.Unmarshal([]byte(raw), &aiResp); err != nil {
 		slog.Error("Parse AI JSON", "error", err, "text", text)
 		return nil, ""
 	}
@@ -441,39 +941,168 @@ func callClaudeAPI(prompt string) ([]int64, string) {
 	return aiResp.SpotIDs, aiResp.Message
 }
 
-
 // RouteRequest is the request for route generation
 type RouteRequest struct {
 	Lat               float64 `json:"lat"`
 	Lng               float64 `json:"lng"`
 	DepartureTime     string  `json:"departure_time"`     // "HH:MM"
 	ReturnTime        string  `json:"return_time"`        // "HH:MM" optional
-	IncludeRestaurant bool    `json:"include_restaurant"`
-	IncludeRest       bool    `json:"include_rest"`
+	MustReturnBy      string  `json:"must_return_by"`     // "HH:MM" optional hard deadline; see withMustReturnBy
+	IncludeRestaurant *bool   `json:"include_restaurant"` // nil uses Server.DefaultIncludeRestaurant
+	IncludeRest       *bool   `json:"include_rest"`       // nil uses Server.DefaultIncludeRest
 	AvoidUrban        bool    `json:"avoid_urban"`
+	MinLegKm          float64 `json:"min_leg_km"`      // optional; overrides Server.MinLegKm
+	RequireLoop       bool    `json:"require_loop"`    // don't retrace the outbound leg on the way back
+	ExcludeVisited    bool    `json:"exclude_visited"` // leave out drive spots the user has visited
+
+	// DiversifyFromHistory plays down the categories the user visited in
+	// the last Server.RecentCategoryWindow by scaling their CategoryWeights
+	// by recentCategoryWeight.
+	DiversifyFromHistory bool `json:"diversify_from_history"`
+
+	// recentCategories is loaded by generateRoute for DiversifyFromHistory.
+	recentCategories map[string]bool
+
+	// nextDay is set by resolvePastDeparture when the route is for tomorrow.
+	nextDay bool
+
+	// Seed, if set, seeds every random choice in building the route
+	// instead of Server.Rand, so the same seed and inputs give the same
+	// route, e.g. to share or debug one.
+	Seed *uint64 `json:"seed"`
+	rand *rand.Rand
+
+	// RoutingProfile is passed to the Server.Router for every leg:
+	// "fastest" (the default), "scenic" or "no-highway".
+	RoutingProfile string `json:"routing_profile"`
+
+	// MinTotalKm and MaxTotalKm bound the route's total distance; zero
+	// leaves that end open. Routes outside the range are not returned.
+	MinTotalKm float64 `json:"min_total_km"`
+	MaxTotalKm float64 `json:"max_total_km"`
+
+	// Accessibility restricts stops to spots with these attributes.
+	Accessibility AccessibilityNeeds `json:"accessibility"`
+
+	// MaxDifficulty excludes spots with harder roads (DifficultyEasy to
+	// DifficultyHard); zero allows any.
+	MaxDifficulty int `json:"max_difficulty"`
+
+	// MaxSpotFee excludes spots whose entry fee is higher, in yen; 0 keeps
+	// only free spots. Spots with an unknown fee are kept; nil allows any.
+	MaxSpotFee *int64 `json:"max_spot_fee"`
+
+	// Objective reorders the AI's stops for the fewest kilometres
+	// ("distance") or the earliest return ("time"); empty keeps its order.
+	Objective string `json:"objective"`
+
+	// CategoryWeights favors categories (> 1) or plays them down (< 1) when
+	// picking stops, e.g. {"drive": 2} for a scenic trip or
+	// {"restaurant": 2} for a foodie one. Missing categories weigh 1.
+	CategoryWeights map[string]float64 `json:"category_weights"`
+
+	// FuelEfficiencyKmL and FuelPrice override the server's fuel cost
+	// settings for this vehicle; zero uses the server's.
+	FuelEfficiencyKmL float64 `json:"fuel_efficiency_km_l"`
+	FuelPrice         float64 `json:"fuel_price"`
 }
 
-// RouteStop represents a stop in the route
+// RouteStop represents a stop in the route.
+//
+// Omitted fields mean "not applicable", never zero: distance_from_prev is
+// absent only on the start, so a 0 is a real zero-distance leg, and
+// stay_duration is absent only on the start and end. Fields whose zero value
+// already means "none" (description, best_time, wait_minutes, crowd_level)
+// are omitted when empty; arrival_time is always present.
 type RouteStop struct {
-	ID               int64   `json:"id"`
-	Name             string  `json:"name"`
-	Description      string  `json:"description,omitempty"`
-	Category         string  `json:"category"`
-	Lat              float64 `json:"lat"`
-	Lng              float64 `json:"lng"`
-	DistanceFromPrev float64 `json:"distance_from_prev,omitempty"`
-	ArrivalTime      string  `json:"arrival_time,omitempty"`
-	StayDuration     int     `json:"stay_duration,omitempty"` // minutes
+	ID               int64    `json:"id"`
+	Name             string   `json:"name"`
+	Description      string   `json:"description,omitempty"`
+	Category         string   `json:"category"`
+	Lat              float64  `json:"lat"`
+	Lng              float64  `json:"lng"`
+	DistanceFromPrev *float64 `json:"distance_from_prev,omitempty"` // km
+	ArrivalTime      string   `json:"arrival_time"`
+	DepartureTime    string   `json:"departure_time,omitempty"` // arrival plus any wait and the stay; empty for the end
+	StayDuration     *int     `json:"stay_duration,omitempty"`  // minutes
+	BestTime         string   `json:"best_time,omitempty"`      // "HH:MM-HH:MM"
+	InBestTime       *bool    `json:"in_best_time,omitempty"`   // nil without a best time
+	WaitMinutes      int      `json:"wait_minutes,omitempty"`   // waiting for opening before the stay
+	EntryFee         *int64   `json:"entry_fee,omitempty"`      // yen; nil when unknown
+	CrowdLevel       string   `json:"crowd_level,omitempty"`    // "low", "moderate" or "high" on arrival; empty without crowd data
+}
+
+// stayMinutes is the stop's stay, 0 for the start and end.
+func (stop RouteStop) stayMinutes() int {
+	if stop.StayDuration == nil {
+		return 0
+	}
+	return *stop.StayDuration
+}
+
+// legKm is a leg's distance as reported in RouteStop.DistanceFromPrev,
+// rounded to 100m.
+func legKm(km float64) *float64 {
+	rounded := math.Round(km*10) / 10
+	return &rounded
 }
 
 // RouteResponse is the response containing the full route
 type RouteResponse struct {
+	RouteID         int64       `json:"route_id,omitempty"`
 	Stops           []RouteStop `json:"stops"`
+	Polyline        string      `json:"polyline,omitempty"` // encoded polyline of the stops, start to return (see Server.ExcludeOriginInExports)
 	TotalDistanceKm float64     `json:"total_distance_km"`
 	TotalTimeMin    float64     `json:"total_time_min"`
-	DepartureTime   string      `json:"departure_time"`
-	EstimatedReturn string      `json:"estimated_return"`
-	Message         string      `json:"message"`
+	// EstimatedFuelCost is the fuel cost for TotalDistanceKm, in the
+	// currency of the fuel price; omitted unless fuel cost is configured.
+	EstimatedFuelCost *float64 `json:"estimated_fuel_cost,omitempty"`
+	DepartureTime     string   `json:"departure_time"`
+	EstimatedReturn   string   `json:"estimated_return"`
+	Message           string   `json:"message"`
+
+	// TotalEntryFee adds up the stops' entry fees in yen; UnknownFeeStops
+	// counts the stops left out because their fee is unknown.
+	TotalEntryFee   int64 `json:"total_entry_fee"`
+	UnknownFeeStops int   `json:"unknown_fee_stops,omitempty"`
+
+	// Suggestion is set on an empty route when a drive spot exists beyond
+	// reach.
+	Suggestion *RouteSuggestion `json:"suggestion,omitempty"`
+
+	// TrimmedStops is how many of the AI's stops were cut off the end to
+	// fit the time available. OverBudget is set when even a single drive
+	// spot doesn't fit, so EstimatedReturn is past the requested return.
+	TrimmedStops int  `json:"trimmed_stops,omitempty"`
+	OverBudget   bool `json:"over_budget,omitempty"`
+
+	// DepartsNextDay is set when the requested departure time had already
+	// passed, so the route is scheduled for tomorrow (see PastDeparture).
+	DepartsNextDay bool `json:"departs_next_day,omitempty"`
+}
+
+// validateRouteRequest checks req's options, for new and regenerated
+// routes alike.
+func validateRouteRequest(req RouteRequest) error {
+	if err := validateCategoryWeights(req.CategoryWeights); err != nil {
+		return err
+	}
+	if err := validateObjective(req.Objective); err != nil {
+		return err
+	}
+	if err := validateTripRange(req); err != nil {
+		return err
+	}
+	if err := validateMaxDifficulty(req.MaxDifficulty); err != nil {
+		return err
+	}
+	if err := validateMaxSpotFee(req.MaxSpotFee); err != nil {
+		return err
+	}
+	if err := validateMustReturnBy(req); err != nil {
+		return err
+	}
+	return validateRoutingProfile(req.RoutingProfile)
 }
 
 // HandleGenerateRoute creates a drive route with multiple stops
@@ -485,9 +1114,47 @@ func (s *Server) HandleGenerateRoute(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	req, err := s.resolvePastDeparture(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateRouteRequest(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.generateRoute(r.Context(), userID, req, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
+// maxRouteAttempts bounds how often generateRoute asks the AI again when the
+// result matches the route it was told to avoid.
+const maxRouteAttempts = 3
+
+// generateRoute builds a route for req and saves it to the user's history.
+// If avoidHash is set, routes with that hash are retried up to
+// maxRouteAttempts times. A route shorter than req.MinTotalKm is retried
+// once with spots from farther away; one still outside the requested
+// distance range is not returned.
+func (s *Server) generateRoute(ctx context.Context, userID string, req RouteRequest, avoidHash string) (RouteResponse, error) {
 	if req.DepartureTime == "" {
-		req.DepartureTime = "10:00"
+		req.DepartureTime = defaultDepartureTime
+	}
+	req = req.withMustReturnBy()
+	if req.IncludeRestaurant == nil {
+		include := s.DefaultIncludeRestaurant
+		req.IncludeRestaurant = &include
+	}
+	if req.IncludeRest == nil {
+		include := s.DefaultIncludeRest
+		req.IncludeRest = &include
 	}
 
 	// Calculate available time
@@ -501,94 +1168,198 @@ func (s *Server) HandleGenerateRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Max distance based on available time (avg 40km/h, half time for stops)
-	maxDistanceKm := availableHours * 40 * 0.5
+	maxDistanceKm := availableHours * avgSpeedKmh * 0.5
 
-	q := dbgen.New(s.DB)
-	_, _ = q.GetOrCreateUser(r.Context(), userID)
+	q := s.Queries
+	_, _ = q.GetOrCreateUser(ctx, userID)
 
 	// Get recent route hashes to avoid repetition
-	recentHashes, _ := q.GetRecentRouteHashes(r.Context(), userID)
+	recentHashes, _ := q.GetRecentRouteHashes(ctx, userID)
 	recentHashSet := make(map[string]bool)
 	for _, h := range recentHashes {
 		recentHashSet[h] = true
 	}
-
-	// Get all spots
-	allSpots, err := q.GetAllSpots(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if avoidHash != "" {
+		recentHashSet[avoidHash] = true
 	}
 
-	// Shuffle spots to add randomness
-	shuffleSpots(allSpots)
+	visitedSet := make(map[int64]bool)
+	if req.ExcludeVisited {
+		visitedIDs, err := q.GetUserVisitedSpotIDs(ctx, userID)
+		if err != nil {
+			slog.Warn("load visited spots", "user", userID, "error", err)
+		}
+		for _, id := range visitedIDs {
+			visitedSet[id] = true
+		}
+	}
 
-	// Filter by distance
-	maxOneWayDist := maxDistanceKm / 3
+	if req.DiversifyFromHistory {
+		req.recentCategories = s.recentVisitCategories(ctx, userID)
+	}
+	if req.Seed != nil {
+		req.rand = rand.New(rand.NewPCG(*req.Seed, 0))
+	}
 
-	var driveSpots, restaurants, restSpots []dbgen.Spot
 	depMinutes := parseTimeToMinutes(req.DepartureTime)
+	maxOneWayDist := req.tripReach(maxDistanceKm / s.routeReachDivisor())
+	deadline, hasDeadline := s.returnDeadline(req, depMinutes)
+
+	var route builtRoute
+	var message string
+	var ids []int64
+	for expanded := false; ; expanded = true {
+		// Get the spots within reach
+		allSpots, err := s.loadSpots(ctx, q, s.areaAround(req.Lat, req.Lng, s.loadReach(maxOneWayDist)))
+		if err != nil {
+			return RouteResponse{}, err
+		}
 
-	for _, spot := range allSpots {
-		dist := haversine(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
-		if dist > maxOneWayDist {
-			continue
+		// Shuffle spots to add randomness
+		s.shuffleSpots(req, allSpots)
+
+		// Keep the spots the route may visit, then those within reach;
+		// under ReachRoundTrip, only spots it may visit share the drive
+		// out to their neighbors.
+		var eligible []dbgen.Spot
+		for _, spot := range allSpots {
+			if !s.meetsAccessibility(spot, req.Accessibility) || !withinDifficulty(spot, req.MaxDifficulty) || !withinFee(spot, req.MaxSpotFee) {
+				continue
+			}
+			switch spot.Category {
+			case "drive":
+				if visitedSet[spot.ID] {
+					continue
+				}
+			case "restaurant":
+				if !*req.IncludeRestaurant {
+					continue
+				}
+			case "rest":
+				if !*req.IncludeRest {
+					continue
+				}
+			default:
+				continue
+			}
+			eligible = append(eligible, spot)
 		}
+		reaches := s.spotReaches(eligible, maxOneWayDist)
+		legs := s.routeLegs(ctx, req.RoutingProfile)
 
-		switch spot.Category {
-		case "drive":
-			driveSpots = append(driveSpots, spot)
-		case "restaurant":
-			if req.IncludeRestaurant {
-				restaurants = append(restaurants, spot)
+		var driveSpots, restaurants, restSpots []dbgen.Spot
+		for _, spot := range eligible {
+			dist := s.distanceKm(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
+			if dist > reaches[spot.ID] {
+				continue
+			}
+			if hasDeadline && !s.returnsInTime(legs, req.Lat, req.Lng, spot, depMinutes, deadline) {
+				continue
 			}
-		case "rest":
-			if req.IncludeRest {
+
+			switch spot.Category {
+			case "drive":
+				driveSpots = append(driveSpots, spot)
+			case "restaurant":
+				restaurants = append(restaurants, spot)
+			case "rest":
 				restSpots = append(restSpots, spot)
 			}
 		}
+
+		if len(driveSpots) == 0 {
+			suggestion, hint := s.suggestReach(ctx, req, depMinutes, availableHours)
+			return RouteResponse{
+				Stops:      []RouteStop{},
+				Message:    "条件に合うドライブスポットが見つかりませんでした。" + hint,
+				Suggestion: suggestion,
+			}, nil
+		}
+
+		// Use AI to build optimal route
+		for attempt := 1; ; attempt++ {
+			route, message = s.buildRouteWithAI(ctx, req.Lat, req.Lng, driveSpots, restaurants, restSpots, req, depMinutes, availableHours, recentHashSet)
+			ids = ids[:0]
+			for _, stop := range route.Stops {
+				if stop.ID > 0 {
+					ids = append(ids, stop.ID)
+				}
+			}
+			if avoidHash == "" || computeRouteHash(ids) != avoidHash || attempt == maxRouteAttempts {
+				break
+			}
+			slog.Info("AI returned the route to avoid; retrying", "user", userID, "attempt", attempt)
+		}
+
+		if expanded || !req.tripTooShort(route.TotalDistanceKm) {
+			break
+		}
+		maxOneWayDist *= tripReachGrowth
+		slog.Info("route shorter than requested; retrying farther out", "user", userID, "km", route.TotalDistanceKm, "reach_km", maxOneWayDist)
 	}
 
-	if len(driveSpots) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(RouteResponse{
+	if req.missesMustReturnBy(depMinutes, route) {
+		return RouteResponse{
 			Stops:   []RouteStop{},
-			Message: "条件に合うドライブスポットが見つかりませんでした。",
-		})
-		return
+			Message: fmt.Sprintf("%sまでに帰れるルートを作れませんでした。出発を早めるか、帰着の期限を遅らせてください。", req.MustReturnBy),
+		}, nil
 	}
 
-	// Use AI to build optimal route
-	route, message := s.buildRouteWithAI(req.Lat, req.Lng, driveSpots, restaurants, restSpots, req, depMinutes, availableHours, recentHashSet)
-
-	// Save route hash to history
-	if len(route.Stops) > 2 {
-		var ids []int64
-		for _, stop := range route.Stops {
-			if stop.ID > 0 {
-				ids = append(ids, stop.ID)
-			}
-		}
-		if len(ids) > 0 {
-			hash := computeRouteHash(ids)
-			idsJSON, _ := json.Marshal(ids)
-			q.AddRouteHistory(r.Context(), dbgen.AddRouteHistoryParams{
-				UserID:    userID,
-				RouteHash: hash,
-				SpotIds:   string(idsJSON),
-			})
+	if req.tripTooShort(route.TotalDistanceKm) || req.tripTooLong(route.TotalDistanceKm) {
+		return RouteResponse{
+			Stops:   []RouteStop{},
+			Message: fmt.Sprintf("総距離%sのルートを作れませんでした（%.1fkm）。条件を変えてお試しください。", req.tripRangeLabel(), route.TotalDistanceKm),
+		}, nil
+	}
+
+	resp := RouteResponse{
+		Stops:             route.Stops,
+		Polyline:          s.routePolyline(route.Stops),
+		TotalDistanceKm:   route.TotalDistanceKm,
+		TotalTimeMin:      route.TotalTimeMin,
+		EstimatedFuelCost: s.fuelCost(route.TotalDistanceKm, req.FuelEfficiencyKmL, req.FuelPrice),
+		DepartureTime:     req.DepartureTime,
+		EstimatedReturn:   route.EstimatedReturn,
+		Message:           message,
+		TrimmedStops:      route.TrimmedStops,
+		OverBudget:        route.OverBudget,
+		DepartsNextDay:    req.nextDay,
+	}
+	resp.TotalEntryFee, resp.UnknownFeeStops = routeEntryFees(route.Stops)
+
+	// Save route to history
+	if len(route.Stops) > 2 && len(ids) > 0 {
+		hash := computeRouteHash(ids)
+		idsJSON, _ := json.Marshal(ids)
+		routeJSON, _ := json.Marshal(resp)
+		routeJSONStr := string(routeJSON)
+		requestJSON, _ := json.Marshal(req)
+		requestJSONStr := string(requestJSON)
+		routeID, err := q.AddRouteHistory(ctx, dbgen.AddRouteHistoryParams{
+			UserID:      userID,
+			RouteHash:   hash,
+			SpotIds:     string(idsJSON),
+			RouteJson:   &routeJSONStr,
+			RequestJson: &requestJSONStr,
+		})
+		if err != nil {
+			slog.Warn("save route history", "user", userID, "error", err)
+		} else {
+			resp.RouteID = routeID
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(RouteResponse{
-		Stops:           route.Stops,
-		TotalDistanceKm: route.TotalDistanceKm,
-		TotalTimeMin:    route.TotalTimeMin,
-		DepartureTime:   req.DepartureTime,
-		EstimatedReturn: route.EstimatedReturn,
-		Message:         message,
-	})
+	return resp, nil
+}
+
+// routeReachDivisor returns RouteReachDivisor, falling back to the default
+// when it has been misconfigured.
+func (s *Server) routeReachDivisor() float64 {
+	if s.RouteReachDivisor <= 0 {
+		slog.Warn("invalid RouteReachDivisor; using default", "value", s.RouteReachDivisor, "default", defaultRouteReachDivisor)
+		return defaultRouteReachDivisor
+	}
+	return s.RouteReachDivisor
 }
 
 func parseTimeToMinutes(t string) int {
@@ -607,25 +1378,23 @@ func minutesToTime(m int) string {
 	return fmt.Sprintf("%02d:%02d", h, min)
 }
 
-func shuffleSpots(spots []dbgen.Spot) {
-	for i := len(spots) - 1; i > 0; i-- {
-		j := int(time.Now().UnixNano()) % (i + 1)
-		spots[i], spots[j] = spots[j], spots[i]
-	}
-}
-
+// computeRouteHash identifies a route by its set of spots, ignoring their
+// order: the number of IDs, then the sorted IDs comma-separated, e.g.
+// "3:1,5,12". 018-route-hash-format converts hashes stored before this
+// format.
 func computeRouteHash(ids []int64) string {
-	// Sort and create hash
-	sorted := make([]int64, len(ids))
-	copy(sorted, ids)
-	for i := 0; i < len(sorted)-1; i++ {
-		for j := i + 1; j < len(sorted); j++ {
-			if sorted[i] > sorted[j] {
-				sorted[i], sorted[j] = sorted[j], sorted[i]
-			}
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(len(sorted)))
+	b.WriteByte(':')
+	for i, id := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
 		}
+		b.WriteString(strconv.FormatInt(id, 10))
 	}
-	return fmt.Sprintf("%v", sorted)
+	return b.String()
 }
 
 type builtRoute struct {
@@ -633,75 +1402,69 @@ type builtRoute struct {
 	TotalDistanceKm float64
 	TotalTimeMin    float64
 	EstimatedReturn string
+	TrimmedStops    int
+	OverBudget      bool
 }
 
-func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restaurants, restSpots []dbgen.Spot, req RouteRequest, depMinutes int, availableHours float64, recentHashes map[string]bool) (builtRoute, string) {
+func (s *Server) buildRouteWithAI(ctx context.Context, startLat, startLng float64, driveSpots, restaurants, restSpots []dbgen.Spot, req RouteRequest, depMinutes int, availableHours float64, recentHashes map[string]bool) (builtRoute, string) {
 	// Build candidate list for AI with randomness indicator
-	randomSeed := time.Now().UnixNano() % 1000
-	
-	var candidateList string
-	candidateList += "ドライブスポット:\n"
-	for i, spot := range driveSpots {
-		if i >= 20 {
-			break
-		}
-		dist := haversine(startLat, startLng, spot.Latitude, spot.Longitude)
-		dir := getDirection(startLat, startLng, spot.Latitude, spot.Longitude)
-		desc := ""
-		if spot.Description != nil {
-			desc = *spot.Description
+	randomSeed := int64(s.routeIntN(req, 1000))
+
+	// List candidates by category, heaviest weighted first, with more
+	// candidates offered for favored categories
+	data := routePromptData{
+		Lat:           startLat,
+		Lng:           startLng,
+		DepartureTime: req.DepartureTime,
+		Hours:         availableHours,
+		Seed:          randomSeed,
+		ReturnTime:    req.ReturnTime,
+		AvoidRecent:   len(recentHashes) > 0,
+		AvoidUrban:    req.AvoidUrban,
+		RequireLoop:   req.RequireLoop,
+		DriveStay:     s.defaultStay("drive"),
+		MealStay:      s.defaultStay("restaurant"),
+		RestStay:      s.defaultStay("rest"),
+	}
+	spotsByCategory := map[string][]dbgen.Spot{"drive": driveSpots, "restaurant": restaurants, "rest": restSpots}
+	for _, cat := range req.weightedCategories() {
+		spots := spotsByCategory[cat]
+		if len(spots) == 0 {
+			continue
 		}
-		candidateList += fmt.Sprintf("  [ID:%d] %s (%.1fkm, %s) - %s\n", spot.ID, spot.Name, dist, dir, desc)
-	}
-
-	if len(restaurants) > 0 {
-		candidateList += "\n食事スポット:\n"
-		for i, spot := range restaurants {
-			if i >= 15 {
+		group := routeCandidateGroup{Label: s.categoryLabel(cat)}
+		for i, spot := range spots {
+			if i >= req.candidateCap(cat) {
 				break
 			}
-			dist := haversine(startLat, startLng, spot.Latitude, spot.Longitude)
+			dist := s.distanceKm(startLat, startLng, spot.Latitude, spot.Longitude)
 			dir := getDirection(startLat, startLng, spot.Latitude, spot.Longitude)
-			desc := ""
-			if spot.Description != nil {
-				desc = *spot.Description
+			desc := s.promptDescription(spot.Description)
+			if bt := bestTimeLabel(spot); bt != "" {
+				desc += " [おすすめ時間帯 " + bt + "]"
 			}
-			candidateList += fmt.Sprintf("  [ID:%d] %s (%.1fkm, %s) - %s\n", spot.ID, spot.Name, dist, dir, desc)
-		}
-	}
-
-	if len(restSpots) > 0 {
-		candidateList += "\n休憩スポット:\n"
-		for i, spot := range restSpots {
-			if i >= 15 {
-				break
-			}
-			dist := haversine(startLat, startLng, spot.Latitude, spot.Longitude)
-			dir := getDirection(startLat, startLng, spot.Latitude, spot.Longitude)
-			desc := ""
-			if spot.Description != nil {
-				desc = *spot.Description
+			if spot.SuggestedStayMin != nil {
+				desc += fmt.Sprintf(" [滞在目安 %d分]", s.spotStay(spot))
 			}
-			candidateList += fmt.Sprintf("  [ID:%d] %s (%.1fkm, %s) - %s\n", spot.ID, spot.Name, dist, dir, desc)
+			desc += accessibilityTags(spot) + difficultyTag(spot) + feeTag(spot)
+			group.Spots = append(group.Spots, routeCandidate{ID: spot.ID, Name: spot.Name, DistanceKm: dist, Direction: dir, Description: desc})
 		}
+		data.CandidateGroups = append(data.CandidateGroups, group)
 	}
 
-	// Build list of recent routes to avoid
-	var avoidList string
-	if len(recentHashes) > 0 {
-		avoidList = "\n※最近提案したルートと同じ組み合わせは避けてください。\n"
+	// Request-specific sections
+	data.Extra = s.categoryWeightPrompt(req) + req.tripRangePrompt()
+	if need := accessibilityRule(req.Accessibility); need != "" {
+		data.Extra += fmt.Sprintf(`
+【同行者への配慮】
+- 候補はすべて%sのスポットです。ルートでもこの条件を満たす場所だけを選ぶこと
+`, need)
 	}
-
-	// Urban avoidance preference
-	var urbanPref string
-	if req.AvoidUrban {
-		urbanPref = `
-【重要】都市部を避けるモード:
-- 郊外・山間部・海岸沿いなど自然豊かなエリアを優先
-- 市街地・繁華街・交通量の多いエリアは避ける
-- 景色の良いワインディングロードや山道を優先
-- 現在地から離れた郊外のスポットを選ぶ
-`
+	if rule := difficultyRule(req.MaxDifficulty); rule != "" {
+		data.Extra += fmt.Sprintf(`
+【道の難しさ】
+- %s
+`, rule)
 	}
 
 	// Calculate recommended number of stops based on available time
@@ -719,52 +1482,20 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 	if availableHours >= 7 {
 		numDriveSpots = 3
 	}
+	if req.weight("drive") >= 2 {
+		numDriveSpots++
+	}
+	data.NumDrive, data.IncludeMeal, data.IncludeRest = numDriveSpots, includeMeal, includeRest
 
-	// Calculate return time constraint
-	returnConstraint := ""
-	if req.ReturnTime != "" {
-		returnConstraint = fmt.Sprintf(`
-【時間制約 - 最重要】
-**%sまでに必ず帰着すること！**
-- 移動時間は平址2分/kmで計算
-- 全スポットの滞在時間と移動時間の合計が%.1f時間以内に収まるように
-- 帰着時間を超えるルートは絶対にNG
-`, req.ReturnTime, availableHours)
-	}
-
-	prompt := fmt.Sprintf(`あなたはドライブルートのプランナーAIです。
-現在地から出発して、複数のスポットを経由して現在地に戻る充実した周遊ドライブルートを作成してください。
-
-【基本情報】
-現在地: 緯度%.4f, 経度%.4f
-出発時刻: %s
-使える時間: 約%.1f時間
-ランダムシード: %d
-%s%s%s
-【候補スポット】
-%s
-【重要な要件】
-1. **同じ方角のスポットを選ぶ**: 北、南、東、西のいずれか一方向にまとめる。方角がバラバラなルートは絶対にNG
-2. **周回ルート**: 出発→遠くのスポット→近くのスポット→帰着、のように流れるようなルート
-3. ドライブスポットを **%d箇所以上** 選ぶ
-4. 食事スポットを **%s** （**食事は必ず1箇所のみ、絶対に2箇所以上連続させない**）
-5. 休憩・カフェスポットを **%s** （**休憩も最大1箇所**）
-6. 各スポットの滞在時間: ドライブ30-40分、食事45-50分、休憩15-20分
-7. **同じカテゴリのスポットを連続させない**（食事→食事、休憩→休憩はNG）
-
-【出力形式】JSON形式で回答:
-{
-  "route_ids": [訪問順のスポットID配列],
-  "stay_durations": [各スポットの滞在時間（分）],
-  "message": "このルートの見どころを2文で"
-}
-`, startLat, startLng, req.DepartureTime, availableHours, randomSeed, returnConstraint, avoidList, urbanPref, candidateList,
-		numDriveSpots,
-		map[bool]string{true: "1箇所含める", false: "含めない"}[includeMeal],
-		map[bool]string{true: "1箇所含める", false: "含めない"}[includeRest])
-
-	// Call Claude API
-	routeIDs, stayDurations, message := callClaudeAPIForRouteV2(prompt)
+	// Call Claude API; without a prompt, fall back to a single drive spot
+	var routeIDs []int64
+	var stayDurations []int
+	var message string
+	if prompt, err := s.renderPrompt("route.tmpl", data); err != nil {
+		slog.Error("route prompt", "error", err)
+	} else {
+		routeIDs, stayDurations, message = s.callClaudeAPIForRouteV2(ctx, prompt)
+	}
 	slog.Info("AI route response", "routeIDs", routeIDs, "stayDurations", stayDurations, "message", message)
 
 	// Build spot map
@@ -779,8 +1510,23 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 		spotMap[sp.ID] = sp
 	}
 
+	s.clampStays(routeIDs, stayDurations, spotMap)
+
 	// Validate and fix route: remove consecutive same-category spots (especially restaurant/rest)
-	routeIDs = validateRouteCategories(routeIDs, stayDurations, spotMap)
+	routeIDs, stayDurations = s.validateRouteCategories(routeIDs, stayDurations, spotMap)
+
+	// Drop stops that are practically on top of the previous one
+	minLegKm := s.MinLegKm
+	if req.MinLegKm > 0 {
+		minLegKm = req.MinLegKm
+	}
+	routeIDs, stayDurations = s.dropCloseStops(routeIDs, stayDurations, spotMap, minLegKm)
+
+	// Don't come back the way we went out
+	loopOK := true
+	if req.RequireLoop {
+		routeIDs, stayDurations, loopOK = requireLoop(startLat, startLng, routeIDs, stayDurations, spotMap)
+	}
 
 	// Rebuild spot map (already done above, just for clarity)
 	spotMap = make(map[int64]dbgen.Spot)
@@ -794,6 +1540,30 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 		spotMap[sp.ID] = sp
 	}
 
+	var keepLoop func([]dbgen.Spot) bool
+	if req.RequireLoop && loopOK {
+		keepLoop = func(order []dbgen.Spot) bool { return loopAngle(startLat, startLng, order) >= minLoopAngle }
+	}
+
+	// Reorder for the shortest or quickest trip, if asked, without undoing
+	// the loop
+	legs := s.routeLegs(ctx, req.RoutingProfile)
+	routeIDs, stayDurations = s.optimizeOrder(legs, req.Objective, startLat, startLng, depMinutes, routeIDs, stayDurations, spotMap, keepLoop)
+
+	// Visit spots like sunset viewpoints at their best time of day
+	routeIDs, stayDurations = s.scheduleBestTimes(legs, startLat, startLng, depMinutes, routeIDs, stayDurations, spotMap, keepLoop)
+
+	// Don't trust the AI's schedule: cut stops off the end until the trip
+	// fits the time available
+	routeIDs, stayDurations, trimmed, overBudget := s.fitTimeBudget(legs, startLat, startLng, depMinutes, int(availableHours*60), routeIDs, stayDurations, spotMap)
+	if trimmed > 0 {
+		slog.Info("trimmed route to the time budget", "trimmed", trimmed, "hours", availableHours)
+		message += fmt.Sprintf("（時間内に収めるため、最後の%d箇所を省きました）", trimmed)
+	}
+	if overBudget {
+		message += "（ドライブスポット1箇所でも予定の時間を超えます）"
+	}
+
 	// Build route with times
 	var stops []RouteStop
 	var totalDist float64
@@ -801,12 +1571,13 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 
 	// Start point
 	stops = append(stops, RouteStop{
-		ID:          0,
-		Name:        "現在地",
-		Category:    "start",
-		Lat:         startLat,
-		Lng:         startLng,
-		ArrivalTime: minutesToTime(currentTime),
+		ID:            0,
+		Name:          s.originLabel(),
+		Category:      "start",
+		Lat:           startLat,
+		Lng:           startLng,
+		ArrivalTime:   minutesToTime(currentTime),
+		DepartureTime: minutesToTime(currentTime),
 	})
 
 	prevLat, prevLng := startLat, startLng
@@ -816,12 +1587,10 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 		if !ok {
 			continue
 		}
-		dist := haversine(prevLat, prevLng, spot.Latitude, spot.Longitude)
+		leg := legs.leg(prevLat, prevLng, spot.Latitude, spot.Longitude)
+		dist := leg.Km
 		totalDist += dist
-
-		// Travel time (40km/h average)
-		travelMin := int(dist / 40 * 60)
-		currentTime += travelMin
+		currentTime += leg.Minutes
 
 		desc := ""
 		if spot.Description != nil {
@@ -829,20 +1598,20 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 		}
 
 		// Get stay duration
-		stayMin := 30 // default
+		stayMin := s.spotStay(spot)
 		if i < len(stayDurations) {
 			stayMin = stayDurations[i]
-		} else {
-			switch spot.Category {
-			case "restaurant":
-				stayMin = 50
-			case "rest":
-				stayMin = 20
-			case "drive":
-				stayMin = 40
-			}
 		}
 
+		var inBestTime *bool
+		if start, end, ok := bestTimeWindow(spot); ok {
+			in := minutesOutside(currentTime, start, end) == 0
+			inBestTime = &in
+		}
+
+		// Arriving before opening means waiting outside first
+		wait := openingWait(spot, currentTime)
+
 		stops = append(stops, RouteStop{
 			ID:               spot.ID,
 			Name:             spot.Name,
@@ -850,28 +1619,34 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 			Category:         spot.Category,
 			Lat:              spot.Latitude,
 			Lng:              spot.Longitude,
-			DistanceFromPrev: math.Round(dist*10) / 10,
+			DistanceFromPrev: legKm(dist),
 			ArrivalTime:      minutesToTime(currentTime),
-			StayDuration:     stayMin,
+			StayDuration:     &stayMin,
+			BestTime:         bestTimeLabel(spot),
+			InBestTime:       inBestTime,
+			DepartureTime:    minutesToTime(currentTime + wait + stayMin),
+			WaitMinutes:      wait,
+			EntryFee:         spot.EntryFee,
+			CrowdLevel:       crowdLabel(spot, currentTime),
 		})
 
-		currentTime += stayMin
+		currentTime += wait + stayMin
 		prevLat, prevLng = spot.Latitude, spot.Longitude
 	}
 
 	// Return to start
-	returnDist := haversine(prevLat, prevLng, startLat, startLng)
+	returnLeg := legs.leg(prevLat, prevLng, startLat, startLng)
+	returnDist := returnLeg.Km
 	totalDist += returnDist
-	returnTravelMin := int(returnDist / 40 * 60)
-	currentTime += returnTravelMin
+	currentTime += returnLeg.Minutes
 
 	stops = append(stops, RouteStop{
 		ID:               0,
-		Name:             "現在地",
+		Name:             s.originLabel(),
 		Category:         "end",
 		Lat:              startLat,
 		Lng:              startLng,
-		DistanceFromPrev: math.Round(returnDist*10) / 10,
+		DistanceFromPrev: legKm(returnDist),
 		ArrivalTime:      minutesToTime(currentTime),
 	})
 
@@ -880,95 +1655,57 @@ func (s *Server) buildRouteWithAI(startLat, startLng float64, driveSpots, restau
 	// Fallback if AI didn't return valid route
 	if len(stops) <= 2 && len(driveSpots) > 0 {
 		// Pick a random drive spot
-		idx := int(time.Now().UnixNano()) % len(driveSpots)
+		idx := s.routeIntN(req, len(driveSpots))
 		spot := driveSpots[idx]
-		dist := haversine(startLat, startLng, spot.Latitude, spot.Longitude)
+		out := legs.leg(startLat, startLng, spot.Latitude, spot.Longitude)
+		back := legs.leg(spot.Latitude, spot.Longitude, startLat, startLng)
 
 		desc := ""
 		if spot.Description != nil {
 			desc = *spot.Description
 		}
 
-		travelMin := int(dist / 40 * 60)
-		arriveTime := depMinutes + travelMin
-		stayMin := 40
-		returnTime := arriveTime + stayMin + travelMin
+		arriveTime := depMinutes + out.Minutes
+		stayMin := s.spotStay(spot)
+		returnTime := arriveTime + stayMin + back.Minutes
 
 		stops = []RouteStop{
-			{ID: 0, Name: "現在地", Category: "start", Lat: startLat, Lng: startLng, ArrivalTime: minutesToTime(depMinutes)},
-			{ID: spot.ID, Name: spot.Name, Description: desc, Category: spot.Category, Lat: spot.Latitude, Lng: spot.Longitude, DistanceFromPrev: math.Round(dist*10) / 10, ArrivalTime: minutesToTime(arriveTime), StayDuration: stayMin},
-			{ID: 0, Name: "現在地", Category: "end", Lat: startLat, Lng: startLng, DistanceFromPrev: math.Round(dist*10) / 10, ArrivalTime: minutesToTime(returnTime)},
+			{ID: 0, Name: s.originLabel(), Category: "start", Lat: startLat, Lng: startLng, ArrivalTime: minutesToTime(depMinutes), DepartureTime: minutesToTime(depMinutes)},
+			{ID: spot.ID, Name: spot.Name, Description: desc, Category: spot.Category, Lat: spot.Latitude, Lng: spot.Longitude, DistanceFromPrev: legKm(out.Km), ArrivalTime: minutesToTime(arriveTime), DepartureTime: minutesToTime(arriveTime + stayMin), StayDuration: &stayMin, EntryFee: spot.EntryFee, CrowdLevel: crowdLabel(spot, arriveTime)},
+			{ID: 0, Name: s.originLabel(), Category: "end", Lat: startLat, Lng: startLng, DistanceFromPrev: legKm(back.Km), ArrivalTime: minutesToTime(returnTime)},
 		}
-		totalDist = dist * 2
+		totalDist = out.Km + back.Km
 		totalTimeMin = float64(returnTime - depMinutes)
 		message = "おすすめのドライブスポットを選びました。"
 		currentTime = returnTime
 	}
 
+	// A single stop, including the fallback above, is always out-and-back
+	if req.RequireLoop && (!loopOK || len(stops) <= 3) {
+		message = loopInfeasibleMessage
+	}
+
 	return builtRoute{
 		Stops:           stops,
 		TotalDistanceKm: math.Round(totalDist*10) / 10,
 		TotalTimeMin:    math.Round(totalTimeMin),
 		EstimatedReturn: minutesToTime(currentTime),
+		TrimmedStops:    trimmed,
+		OverBudget:      overBudget,
 	}, message
 }
 
-func callClaudeAPIForRouteV2(prompt string) ([]int64, []int, string) {
-	reqBody := map[string]interface{}{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 600,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	}
-
-	jsonBody, _ := json.Marshal(reqBody)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, _ := http.NewRequest("POST", "http://169.254.169.254/gateway/llm/_/gateway/anthropic/v1/messages", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := client.Do(req)
+func (s *Server) callClaudeAPIForRouteV2(ctx context.Context, prompt string) ([]int64, []int, string) {
+	text, err := s.complete(ctx, prompt, 600)
 	if err != nil {
 		slog.Error("Claude API error", "error", err)
 		return nil, nil, ""
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		slog.Error("Parse Claude response", "error", err, "body", string(body))
-		return nil, nil, ""
-	}
-
-	if len(result.Content) == 0 {
-		slog.Error("No content in Claude response", "body", string(body))
-		return nil, nil, ""
-	}
-
-	text := result.Content[0].Text
 	slog.Info("Claude raw response", "text", text)
 
 	// Find JSON in response
-	start := -1
-	end := -1
-	for i, c := range text {
-		if c == '{' && start == -1 {
-			start = i
-		}
-		if c == '}' {
-			end = i + 1
-		}
-	}
-
-	if start == -1 || end == -1 {
+	raw, ok := extractJSONObject(text)
+	if !ok {
 		return nil, nil, ""
 	}
 
@@ -977,7 +1714,7 @@ func callClaudeAPIForRouteV2(prompt string) ([]int64, []int, string) {
 		StayDurations []int   `json:"stay_durations"`
 		Message       string  `json:"message"`
 	}
-	if err := json.Unmarshal([]byte(text[start:end]), &aiResp); err != nil {
+	if err := json.Unmarshal([]byte(raw), &aiResp); err != nil {
 		slog.Error("Parse AI route JSON", "error", err, "text", text)
 		return nil, nil, ""
 	}
@@ -985,18 +1722,92 @@ func callClaudeAPIForRouteV2(prompt string) ([]int64, []int, string) {
 	return aiResp.RouteIDs, aiResp.StayDurations, aiResp.Message
 }
 
+// dropCloseStops removes stops closer than minLegKm to the previous kept stop,
+// keeping stayDurations aligned with the remaining IDs.
+func (s *Server) dropCloseStops(routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot, minLegKm float64) ([]int64, []int) {
+	if minLegKm <= 0 {
+		return routeIDs, stayDurations
+	}
+
+	var keptIDs []int64
+	var keptStays []int
+	var prev *dbgen.Spot
+	for i, id := range routeIDs {
+		spot, ok := spotMap[id]
+		if !ok {
+			continue
+		}
+		if prev != nil {
+			if dist := s.distanceKm(prev.Latitude, prev.Longitude, spot.Latitude, spot.Longitude); dist < minLegKm {
+				slog.Info("Removing stop too close to previous", "id", id, "prev", prev.ID, "distance_km", dist)
+				continue
+			}
+		}
+		keptIDs = append(keptIDs, id)
+		if i < len(stayDurations) {
+			keptStays = append(keptStays, stayDurations[i])
+		}
+		prev = &spot
+	}
+	return keptIDs, keptStays
+}
+
+// defaultMaxStops caps meal and rest stops per route; drive spots are the
+// point of the trip and are never capped.
+var defaultMaxStops = map[string]int{
+	"restaurant": 1,
+	"rest":       1,
+}
+
+// maxStops returns the cap for category, preferring s.MaxStops over the
+// defaults.
+func (s *Server) maxStops(category string) (int, bool) {
+	if category == "drive" {
+		return 0, false
+	}
+	if n, ok := s.MaxStops[category]; ok {
+		return n, true
+	}
+	n, ok := defaultMaxStops[category]
+	return n, ok
+}
+
+// ParseMaxStops parses "category=n" pairs separated by commas, e.g.
+// "restaurant=1,rest=2".
+func ParseMaxStops(v string) (map[string]int, error) {
+	caps := make(map[string]int)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cat, n, ok := strings.Cut(part, "=")
+		cat = strings.TrimSpace(cat)
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || err != nil || limit < 0 {
+			return nil, fmt.Errorf("max stops %q: want category=n", part)
+		}
+		if cat != "restaurant" && cat != "rest" {
+			return nil, fmt.Errorf("max stops %q: only restaurant and rest stops can be capped", part)
+		}
+		caps[cat] = limit
+	}
+	return caps, nil
+}
+
 // validateRouteCategories removes consecutive same-category spots (restaurant/rest)
-func validateRouteCategories(routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) []int64 {
+// and stops beyond their category's cap. Stay durations follow their stops.
+func (s *Server) validateRouteCategories(routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) ([]int64, []int) {
 	if len(routeIDs) == 0 {
-		return routeIDs
+		return routeIDs, stayDurations
 	}
 
 	var validIDs []int64
+	var validStays []int
 	var lastCategory string
-	restaurantCount := 0
-	restCount := 0
+	counts := make(map[string]int)
 
-	for _, id := range routeIDs {
+	for i, id := range routeIDs {
 		spot, ok := spotMap[id]
 		if !ok {
 			continue
@@ -1008,42 +1819,33 @@ func validateRouteCategories(routeIDs []int64, stayDurations []int, spotMap map[
 			continue
 		}
 
-		// Limit restaurant to 1
-		if spot.Category == "restaurant" {
-			if restaurantCount >= 1 {
-				slog.Info("Removing extra restaurant", "id", id)
-				continue
-			}
-			restaurantCount++
-		}
-
-		// Limit rest to 1
-		if spot.Category == "rest" {
-			if restCount >= 1 {
-				slog.Info("Removing extra rest spot", "id", id)
-				continue
-			}
-			restCount++
+		if limit, ok := s.maxStops(spot.Category); ok && counts[spot.Category] >= limit {
+			slog.Info("Removing stop over category cap", "id", id, "category", spot.Category, "cap", limit)
+			continue
 		}
+		counts[spot.Category]++
 
 		validIDs = append(validIDs, id)
+		if i < len(stayDurations) {
+			validStays = append(validStays, stayDurations[i])
+		}
 		lastCategory = spot.Category
 	}
 
-	return validIDs
+	return validIDs, validStays
 }
 
 // getDirection returns the direction from point 1 to point 2
 func getDirection(lat1, lon1, lat2, lon2 float64) string {
 	dLat := lat2 - lat1
 	dLon := lon2 - lon1
-	
+
 	// Calculate angle
 	angle := math.Atan2(dLon, dLat) * 180 / math.Pi
 	if angle < 0 {
 		angle += 360
 	}
-	
+
 	// Convert to direction
 	if angle >= 337.5 || angle < 22.5 {
 		return "北"
@@ -1064,16 +1866,51 @@ func getDirection(lat1, lon1, lat2, lon2 float64) string {
 	}
 }
 
-// Haversine formula for distance calculation
-func haversine(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth's radius in km
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
+// avgSpeedKmh is the assumed average driving speed on scenic routes.
+const avgSpeedKmh = 40
+
+// drivingMinutes estimates the driving time for distKm at avgSpeedKmh.
+func drivingMinutes(distKm float64) int {
+	return int(distKm / avgSpeedKmh * 60)
+}
+
+// spreadByBearing swaps picks that share a compass direction from the origin
+// for candidates in directions not yet covered, keeping the number of picks.
+func spreadByBearing(picks, candidates []SpotWithDistance, lat, lng float64) []SpotWithDistance {
+	covered := make(map[string]bool)
+	used := make(map[int64]bool)
+	var result []SpotWithDistance
+	add := func(sp SpotWithDistance) {
+		covered[getDirection(lat, lng, sp.Latitude, sp.Longitude)] = true
+		used[sp.ID] = true
+		result = append(result, sp)
+	}
+
+	// Keep the first pick in each direction, in the original order
+	for _, p := range picks {
+		if !covered[getDirection(lat, lng, p.Latitude, p.Longitude)] {
+			add(p)
+		}
+	}
+	// Fill with candidates from directions nobody covers yet
+	for _, c := range candidates {
+		if len(result) >= len(picks) {
+			break
+		}
+		if !used[c.ID] && !covered[getDirection(lat, lng, c.Latitude, c.Longitude)] {
+			add(c)
+		}
+	}
+	// Top up with the remaining picks if there weren't enough directions
+	for _, p := range picks {
+		if len(result) >= len(picks) {
+			break
+		}
+		if !used[p.ID] {
+			add(p)
+		}
+	}
+	return result
 }
 
 // HandleFeedback records user feedback after visiting a spot
@@ -1090,13 +1927,28 @@ func (s *Server) HandleFeedback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	q := dbgen.New(s.DB)
-	rating := int64(req.Rating)
-	_, err := q.AddVisitHistory(r.Context(), dbgen.AddVisitHistoryParams{
-		UserID:  userID,
-		SpotID:  req.SpotID,
-		Rating:  &rating,
-		Comment: &req.Comment,
+	// Record the visit and fold the rating into the spot's aggregate together,
+	// so avg_rating/rating_count never drift from visit_history.
+	err := s.WithTx(r.Context(), func(q *dbgen.Queries) error {
+		if _, err := q.GetOrCreateUser(r.Context(), userID); err != nil {
+			return err
+		}
+		rating := int64(req.Rating)
+		if _, err := q.AddVisitHistory(r.Context(), dbgen.AddVisitHistoryParams{
+			UserID:  userID,
+			SpotID:  req.SpotID,
+			Rating:  &rating,
+			Comment: &req.Comment,
+		}); err != nil {
+			return err
+		}
+		if req.Rating >= 1 && req.Rating <= 5 {
+			return q.AddSpotRating(r.Context(), dbgen.AddSpotRatingParams{
+				Rating: float64(req.Rating),
+				ID:     req.SpotID,
+			})
+		}
+		return nil
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1119,7 +1971,7 @@ func (s *Server) HandleAcceptRecommendation(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	q := dbgen.New(s.DB)
+	q := s.Queries
 	q.UpdateRecommendationAccepted(r.Context(), dbgen.UpdateRecommendationAcceptedParams{
 		UserID: userID,
 		SpotID: req.SpotID,
@@ -1129,29 +1981,84 @@ func (s *Server) HandleAcceptRecommendation(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// HandleGetHistory returns user's visit history
+// HandleGetHistory returns a page of the user's visit history, newest
+// first. Pass next_cursor back as ?cursor= with the same filters for the
+// following page. Optional filters: category, and from/to (YYYY-MM-DD,
+// inclusive). limit defaults to defaultHistoryLimit and is capped at
+// MaxHistoryLimit; invalid or non-positive limits get the default.
 func (s *Server) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
 	userID := s.getUserID(w, r)
 
-	limit := int64(20)
+	maxLimit := int64(s.MaxHistoryLimit)
+	if maxLimit <= 0 {
+		maxLimit = defaultMaxHistoryLimit
+	}
+	limit := min(defaultHistoryLimit, maxLimit)
 	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.ParseInt(l, 10, 64); err == nil {
-			limit = parsed
+		if parsed, err := strconv.ParseInt(l, 10, 64); err == nil && parsed > 0 {
+			limit = min(parsed, maxLimit)
 		}
 	}
 
-	q := dbgen.New(s.DB)
-	history, err := q.GetUserVisitHistory(r.Context(), dbgen.GetUserVisitHistoryParams{
+	params := dbgen.GetUserVisitHistoryPageParams{
 		UserID: userID,
-		Limit:  limit,
-	})
+		Limit:  limit + 1, // one extra to know whether there is a next page
+	}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		at, id, err := decodeHistoryCursor(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.BeforeAt, params.BeforeID = &at, id
+	}
+	if c := r.URL.Query().Get("category"); c != "" {
+		category, ok := normalizeCategory(c)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown category %q", c), http.StatusBadRequest)
+			return
+		}
+		params.Category = &category
+	}
+	from, hasFrom, err := parseDateParam(r, "from")
+	if err != nil {
+		http.Error(w, "invalid from date (want YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if hasFrom {
+		since := from.Format(time.DateTime)
+		params.Since = &since
+	}
+	to, hasTo, err := parseDateParam(r, "to")
+	if err != nil {
+		http.Error(w, "invalid to date (want YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	if hasTo {
+		if hasFrom && to.Before(from) {
+			http.Error(w, "to is before from", http.StatusBadRequest)
+			return
+		}
+		until := to.AddDate(0, 0, 1).Format(time.DateTime)
+		params.Until = &until
+	}
+
+	q := s.Queries
+	history, err := q.GetUserVisitHistoryPage(r.Context(), params)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	page := HistoryPage{Visits: history}
+	if int64(len(history)) > limit {
+		page.Visits = history[:limit]
+		last := page.Visits[limit-1]
+		page.NextCursor = encodeHistoryCursor(last.VisitedAt, last.ID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(history)
+	json.NewEncoder(w).Encode(page)
 }
 
 // AlternativesRequest is the request for getting alternative spots
@@ -1180,8 +2087,8 @@ func (s *Server) HandleGetAlternatives(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	q := dbgen.New(s.DB)
-	allSpots, err := q.GetAllSpots(r.Context())
+	q := s.Queries
+	allSpots, err := q.GetApprovedSpots(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1203,7 +2110,7 @@ func (s *Server) HandleGetAlternatives(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		dist := haversine(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
+		dist := s.distanceKm(req.Lat, req.Lng, spot.Latitude, spot.Longitude)
 		if dist > 50 { // max 50km
 			continue
 		}
@@ -1239,6 +2146,13 @@ type ModifyRouteRequest struct {
 	Action   string `json:"action"` // "skip" or "replace"
 	TargetID int64  `json:"target_id"`
 	NewID    int64  `json:"new_id"` // only for "replace"
+
+	// Fuel settings as in RouteRequest.
+	FuelEfficiencyKmL float64 `json:"fuel_efficiency_km_l"`
+	FuelPrice         float64 `json:"fuel_price"`
+
+	// RoutingProfile as in RouteRequest.
+	RoutingProfile string `json:"routing_profile"`
 }
 
 // HandleModifyRoute modifies an existing route
@@ -1248,9 +2162,15 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateRoutingProfile(req.RoutingProfile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	q := dbgen.New(s.DB)
-	allSpots, err := q.GetAllSpots(r.Context())
+	// Unapproved spots are left out like unknown ones, so a replace
+	// can't put a spot under moderation into the route.
+	q := s.Queries
+	allSpots, err := q.GetApprovedSpots(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1270,15 +2190,17 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 
 	// Start point
 	stops = append(stops, RouteStop{
-		ID:          0,
-		Name:        "現在地",
-		Category:    "start",
-		Lat:         req.Lat,
-		Lng:         req.Lng,
-		ArrivalTime: minutesToTime(currentTime),
+		ID:            0,
+		Name:          s.originLabel(),
+		Category:      "start",
+		Lat:           req.Lat,
+		Lng:           req.Lng,
+		ArrivalTime:   minutesToTime(currentTime),
+		DepartureTime: minutesToTime(currentTime),
 	})
 
 	prevLat, prevLng := req.Lat, req.Lng
+	legs := s.routeLegs(r.Context(), req.RoutingProfile)
 
 	for _, stop := range req.CurrentRoute {
 		// Skip start/end
@@ -1302,10 +2224,10 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		dist := haversine(prevLat, prevLng, spot.Latitude, spot.Longitude)
+		leg := legs.leg(prevLat, prevLng, spot.Latitude, spot.Longitude)
+		dist := leg.Km
 		totalDist += dist
-		travelMin := int(dist / 40 * 60)
-		currentTime += travelMin
+		currentTime += leg.Minutes
 
 		desc := ""
 		if spot.Description != nil {
@@ -1314,7 +2236,7 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 
 		stayMin := stop.StayDuration
 		if stayMin == 0 {
-			stayMin = 30
+			stayMin = s.spotStay(spot)
 		}
 
 		stops = append(stops, RouteStop{
@@ -1324,9 +2246,12 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 			Category:         spot.Category,
 			Lat:              spot.Latitude,
 			Lng:              spot.Longitude,
-			DistanceFromPrev: math.Round(dist*10) / 10,
+			DistanceFromPrev: legKm(dist),
 			ArrivalTime:      minutesToTime(currentTime),
-			StayDuration:     stayMin,
+			DepartureTime:    minutesToTime(currentTime + stayMin),
+			StayDuration:     &stayMin,
+			EntryFee:         spot.EntryFee,
+			CrowdLevel:       crowdLabel(spot, currentTime),
 		})
 
 		currentTime += stayMin
@@ -1334,30 +2259,35 @@ func (s *Server) HandleModifyRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return to start
-	returnDist := haversine(prevLat, prevLng, req.Lat, req.Lng)
+	returnLeg := legs.leg(prevLat, prevLng, req.Lat, req.Lng)
+	returnDist := returnLeg.Km
 	totalDist += returnDist
-	returnTravelMin := int(returnDist / 40 * 60)
-	currentTime += returnTravelMin
+	currentTime += returnLeg.Minutes
 
 	stops = append(stops, RouteStop{
 		ID:               0,
-		Name:             "現在地",
+		Name:             s.originLabel(),
 		Category:         "end",
 		Lat:              req.Lat,
 		Lng:              req.Lng,
-		DistanceFromPrev: math.Round(returnDist*10) / 10,
+		DistanceFromPrev: legKm(returnDist),
 		ArrivalTime:      minutesToTime(currentTime),
 	})
 
 	totalTimeMin := float64(currentTime - depMinutes)
 
+	resp := RouteResponse{
+		Stops:             stops,
+		Polyline:          s.routePolyline(stops),
+		TotalDistanceKm:   math.Round(totalDist*10) / 10,
+		TotalTimeMin:      math.Round(totalTimeMin),
+		EstimatedFuelCost: s.fuelCost(math.Round(totalDist*10)/10, req.FuelEfficiencyKmL, req.FuelPrice),
+		DepartureTime:     req.DepartureTime,
+		EstimatedReturn:   minutesToTime(currentTime),
+		Message:           "ルートを更新しました",
+	}
+	resp.TotalEntryFee, resp.UnknownFeeStops = routeEntryFees(stops)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(RouteResponse{
-		Stops:           stops,
-		TotalDistanceKm: math.Round(totalDist*10) / 10,
-		TotalTimeMin:    math.Round(totalTimeMin),
-		DepartureTime:   req.DepartureTime,
-		EstimatedReturn: minutesToTime(currentTime),
-		Message:         "ルートを更新しました",
-	})
+	json.NewEncoder(w).Encode(resp)
 }
@@ -1,14 +1,119 @@
 package srv
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
 )
 
+// stubLLM records prompts and replies with a canned response. Queued
+// responses, if any, are used first, one per call.
+type stubLLM struct {
+	mu        sync.Mutex
+	prompts   []string
+	responses []string
+	response  string
+	err       error
+}
+
+func (l *stubLLM) Complete(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prompts = append(l.prompts, prompt)
+	if len(l.responses) > 0 {
+		resp := l.responses[0]
+		l.responses = l.responses[1:]
+		return resp, l.err
+	}
+	return l.response, l.err
+}
+
+func (l *stubLLM) calls() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.prompts)
+}
+
+func (l *stubLLM) lastPrompt() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.prompts) == 0 {
+		return ""
+	}
+	return l.prompts[len(l.prompts)-1]
+}
+
+// newTestServer returns a server backed by a fresh database and a stub LLM.
+func newTestServer(t *testing.T) (*Server, *stubLLM) {
+	t.Helper()
+	server, err := New(filepath.Join(t.TempDir(), "test.sqlite3"), "test-hostname")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	t.Cleanup(func() { server.DB.Close() })
+	llm := &stubLLM{}
+	server.LLM = llm
+	return server, llm
+}
+
+// seedSpot inserts a spot and returns it.
+func seedSpot(t *testing.T, s *Server, name, category string, lat, lng float64) dbgen.Spot {
+	t.Helper()
+	spot, err := dbgen.New(s.DB).CreateSpot(context.Background(), dbgen.CreateSpotParams{
+		Name:      name,
+		Category:  category,
+		Latitude:  lat,
+		Longitude: lng,
+		Status:    SpotApproved,
+	})
+	if err != nil {
+		t.Fatalf("seed spot %q: %v", name, err)
+	}
+	return spot
+}
+
+// asUser attaches the user_id cookie to req.
+func asUser(req *http.Request, userID string) *http.Request {
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: userID})
+	return req
+}
+
+// postJSON sends body as JSON to path on the server's handler as userID.
+func postJSON(t *testing.T, s *Server, path, userID string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := asUser(httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b)), userID)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
 func TestServerSetupAndHandlers(t *testing.T) {
 	tempDB := filepath.Join(t.TempDir(), "test_server.sqlite3")
 	t.Cleanup(func() { os.Remove(tempDB) })
@@ -18,8 +123,7 @@ func TestServerSetupAndHandlers(t *testing.T) {
 		t.Fatalf("failed to create server: %v", err)
 	}
 
-	// Test root endpoint without auth
-	t.Run("root endpoint unauthenticated", func(t *testing.T) {
+	t.Run("root endpoint", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		w := httptest.NewRecorder()
 
@@ -28,90 +132,567 @@ func TestServerSetupAndHandlers(t *testing.T) {
 		if w.Code != http.StatusOK {
 			t.Errorf("expected status 200, got %d", w.Code)
 		}
+		if got := w.Header().Get("Permissions-Policy"); got != "geolocation=(self)" {
+			t.Errorf("expected geolocation permissions policy, got %q", got)
+		}
 
 		body := w.Body.String()
-		if !strings.Contains(body, "test-hostname") {
-			t.Errorf("expected page to show hostname, got body: %s", body)
-		}
-		if !strings.Contains(body, "Go Template Project") {
+		if !strings.Contains(body, "ドライブルートプランナー") {
 			t.Errorf("expected page to contain headline, got body: %s", body)
 		}
-		if strings.Contains(body, "Signed in as") {
-			t.Errorf("expected page to not be logged in, got body: %s", body)
+	})
+}
+
+func TestFeedbackUpdatesSpotRating(t *testing.T) {
+	server, _ := newTestServer(t)
+	spot := seedSpot(t, server, "富士見台", "drive", 35.3, 138.7)
+
+	for i, rating := range []int{5, 4, 3, 0} {
+		w := postJSON(t, server, "/api/feedback", fmt.Sprintf("user-%d", i), map[string]any{
+			"spot_id": spot.ID,
+			"rating":  rating,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("feedback %d: expected 200, got %d: %s", rating, w.Code, w.Body.String())
+		}
+	}
+
+	got, err := dbgen.New(server.DB).GetSpotByID(context.Background(), spot.ID)
+	if err != nil {
+		t.Fatalf("get spot: %v", err)
+	}
+	// The unrated (0) feedback is recorded as a visit but not counted.
+	if got.RatingCount != 3 {
+		t.Errorf("expected rating_count 3, got %d", got.RatingCount)
+	}
+	if math.Abs(got.AvgRating-4) > 1e-9 {
+		t.Errorf("expected avg_rating 4, got %v", got.AvgRating)
+	}
+}
+
+func TestGenerateRouteDropsCloseStops(t *testing.T) {
+	server, llm := newTestServer(t)
+	origin := [2]float64{35.0, 139.0}
+	a := seedSpot(t, server, "展望台A", "drive", 35.10, 139.00)
+	b := seedSpot(t, server, "展望台Aの駐車場", "drive", 35.1005, 139.0005) // ~70m from A
+	c := seedSpot(t, server, "海岸線", "drive", 35.20, 139.10)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d, %d], "stay_durations": [30, 20, 40], "message": "ok"}`, a.ID, b.ID, c.ID)
+
+	generate := func(minLegKm float64) RouteResponse {
+		w := postJSON(t, server, "/api/route", "user-a", map[string]any{
+			"lat":            origin[0],
+			"lng":            origin[1],
+			"departure_time": "09:00",
+			"min_leg_km":     minLegKm,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
 		}
-		if !strings.Contains(body, "Not signed in") {
-			t.Errorf("expected page to show 'Not signed in', got body: %s", body)
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
 		}
-	})
+		return resp
+	}
 
-	// Test root endpoint with auth headers
-	t.Run("root endpoint authenticated", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodGet, "/", nil)
-		req.Header.Set("X-ExeDev-UserID", "user123")
-		req.Header.Set("X-ExeDev-Email", "test@example.com")
-		w := httptest.NewRecorder()
+	if resp := generate(0); len(resp.Stops) != 5 {
+		t.Fatalf("expected all 3 spots without min_leg_km, got %d stops", len(resp.Stops))
+	}
 
-		server.HandleRoot(w, req)
+	resp := generate(1)
+	if len(resp.Stops) != 4 {
+		t.Fatalf("expected the near-duplicate stop to be dropped, got %d stops", len(resp.Stops))
+	}
+	if resp.Stops[1].ID != a.ID || resp.Stops[2].ID != c.ID {
+		t.Errorf("expected route A -> C, got %d -> %d", resp.Stops[1].ID, resp.Stops[2].ID)
+	}
+	// C keeps its own stay duration and its arrival follows A's 30 minute stay.
+	if resp.Stops[2].stayMinutes() != 40 {
+		t.Errorf("expected C to keep its 40 minute stay, got %d", resp.Stops[2].stayMinutes())
+	}
+	legMin := drivingMinutes(haversine(a.Latitude, a.Longitude, c.Latitude, c.Longitude))
+	want := minutesToTime(parseTimeToMinutes(resp.Stops[1].ArrivalTime) + 30 + legMin)
+	if resp.Stops[2].ArrivalTime != want {
+		t.Errorf("expected C arrival %s, got %s", want, resp.Stops[2].ArrivalTime)
+	}
+}
 
+func TestGenerateRouteCapsStopsPerCategory(t *testing.T) {
+	server, llm := newTestServer(t)
+	d1 := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	r1 := seedSpot(t, server, "蕎麦屋", "restaurant", 35.10, 139.00)
+	d2 := seedSpot(t, server, "海岸線", "drive", 35.10, 139.05)
+	r2 := seedSpot(t, server, "海鮮丼", "restaurant", 35.10, 139.10)
+	d3 := seedSpot(t, server, "湖畔", "drive", 35.05, 139.10)
+	r3 := seedSpot(t, server, "カフェ", "restaurant", 35.00, 139.10)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d, %d, %d, %d, %d], "stay_durations": [31, 51, 32, 52, 33, 53], "message": "ok"}`,
+		d1.ID, r1.ID, d2.ID, r2.ID, d3.ID, r3.ID)
+
+	include := true
+	generate := func() []RouteStop {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00", IncludeRestaurant: &include})
 		if w.Code != http.StatusOK {
-			t.Errorf("expected status 200, got %d", w.Code)
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
 		}
+		return resp.Stops[1 : len(resp.Stops)-1]
+	}
+	summary := func(stops []RouteStop) string {
+		var parts []string
+		for _, stop := range stops {
+			parts = append(parts, fmt.Sprintf("%d/%d", stop.ID, stop.stayMinutes()))
+		}
+		return strings.Join(parts, " ")
+	}
 
-		body := w.Body.String()
-		if !strings.Contains(body, "Signed in as") {
-			t.Errorf("expected page to show logged in state, got body: %s", body)
+	stops := generate()
+	want := fmt.Sprintf("%d/31 %d/51 %d/32 %d/33", d1.ID, r1.ID, d2.ID, d3.ID)
+	if got := summary(stops); got != want {
+		t.Errorf("expected one restaurant with stays following their stops: want %s, got %s", want, got)
+	}
+	// Times are computed from the trimmed route.
+	last := stops[len(stops)-1]
+	leg := drivingMinutes(haversine(d2.Latitude, d2.Longitude, d3.Latitude, d3.Longitude))
+	if wantAt := minutesToTime(parseTimeToMinutes(stops[2].ArrivalTime) + 32 + leg); last.ArrivalTime != wantAt {
+		t.Errorf("expected last arrival %s, got %s", wantAt, last.ArrivalTime)
+	}
+
+	server.MaxStops = map[string]int{"restaurant": 2}
+	want = fmt.Sprintf("%d/31 %d/51 %d/32 %d/52 %d/33", d1.ID, r1.ID, d2.ID, r2.ID, d3.ID)
+	if got := summary(generate()); got != want {
+		t.Errorf("expected two restaurants with a cap of 2: want %s, got %s", want, got)
+	}
+}
+
+func TestGenerateRouteIncludeDefaults(t *testing.T) {
+	server, llm := newTestServer(t)
+	drive := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	meal := seedSpot(t, server, "蕎麦屋", "restaurant", 35.05, 139.05)
+	rest := seedSpot(t, server, "道の駅", "rest", 35.00, 139.05)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d, %d], "stay_durations": [30, 50, 20], "message": "ok"}`,
+		drive.ID, meal.ID, rest.ID)
+
+	categories := func(body map[string]any) string {
+		t.Helper()
+		body["lat"], body["lng"] = 35.0, 139.0
+		w := postJSON(t, server, "/api/route", "user-a", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
 		}
-		if !strings.Contains(body, "test@example.com") {
-			t.Error("expected page to show user email")
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
 		}
-	})
+		var cats []string
+		for _, stop := range resp.Stops[1 : len(resp.Stops)-1] {
+			cats = append(cats, stop.Category)
+		}
+		return strings.Join(cats, " ")
+	}
 
-	// Test view counter functionality
-	t.Run("view counter increments", func(t *testing.T) {
-		// Make first request
-		req1 := httptest.NewRequest(http.MethodGet, "/", nil)
-		req1.Header.Set("X-ExeDev-UserID", "counter-test")
-		req1.RemoteAddr = "192.168.1.100:12345"
-		w1 := httptest.NewRecorder()
-		server.HandleRoot(w1, req1)
-
-		// Should show "1 times" or similar
-		body1 := w1.Body.String()
-		if !strings.Contains(body1, "1</strong> times") {
-			t.Error("expected first visit to show 1 time")
-		}
-
-		// Make second request with same user
-		req2 := httptest.NewRequest(http.MethodGet, "/", nil)
-		req2.Header.Set("X-ExeDev-UserID", "counter-test")
-		req2.RemoteAddr = "192.168.1.100:12345"
-		w2 := httptest.NewRecorder()
-		server.HandleRoot(w2, req2)
-
-		// Should show "2 times" or similar
-		body2 := w2.Body.String()
-		if !strings.Contains(body2, "2</strong> times") {
-			t.Error("expected second visit to show 2 times")
+	if got := categories(map[string]any{}); got != "drive" {
+		t.Errorf("expected a bare drive route by default, got %q", got)
+	}
+	server.DefaultIncludeRestaurant = true
+	server.DefaultIncludeRest = true
+	if got := categories(map[string]any{}); got != "drive restaurant rest" {
+		t.Errorf("expected omitted flags to use the configured defaults, got %q", got)
+	}
+	if got := categories(map[string]any{"include_restaurant": false}); got != "drive rest" {
+		t.Errorf("expected include_restaurant=false to drop the meal stop, got %q", got)
+	}
+	if got := categories(map[string]any{"include_restaurant": false, "include_rest": false}); got != "drive" {
+		t.Errorf("expected explicit false to override both defaults, got %q", got)
+	}
+}
+
+func TestGenerateRouteExcludeVisited(t *testing.T) {
+	server, llm := newTestServer(t)
+	seen := seedSpot(t, server, "行ったことのある滝", "drive", 35.05, 139.00)
+	fresh := seedSpot(t, server, "初めての岬", "drive", 35.00, 139.05)
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id) VALUES ('user-a', ?)", seen.ID)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, seen.ID, fresh.ID)
+
+	route := func(user string, exclude bool) []int64 {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", user, RouteRequest{Lat: 35.0, Lng: 139.0, ExcludeVisited: exclude})
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("route: %d %s", w.Code, w.Body.String())
 		}
-	})
+		var ids []int64
+		for _, stop := range spotStops(resp) {
+			ids = append(ids, stop.ID)
+		}
+		return ids
+	}
+
+	if got := route("user-a", false); len(got) != 2 {
+		t.Errorf("expected visited spots kept by default, got %v", got)
+	}
+	if got := route("user-a", true); len(got) != 1 || got[0] != fresh.ID {
+		t.Errorf("expected the visited spot excluded, got %v", got)
+	}
+	if prompt := llm.lastPrompt(); strings.Contains(prompt, seen.Name) {
+		t.Errorf("expected the visited spot left out of the prompt, got:\n%s", prompt)
+	}
+	if got := route("user-b", true); len(got) != 2 {
+		t.Errorf("expected another user's visits not to matter, got %v", got)
+	}
 }
 
-func TestUtilityFunctions(t *testing.T) {
-	t.Run("mainDomainFromHost function", func(t *testing.T) {
-		tests := []struct {
-			input    string
-			expected string
-		}{
-			{"example.exe.cloud:8080", "exe.cloud:8080"},
-			{"example.exe.dev", "exe.dev"},
-			{"example.exe.cloud", "exe.cloud"},
+func TestRouteStopJSONShape(t *testing.T) {
+	server, llm := newTestServer(t)
+	here := seedSpot(t, server, "駐車場の展望台", "drive", 35.0, 139.0) // at the origin
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, here.ID)
+
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Stops []map[string]any `json:"stops"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Stops) != 3 {
+		t.Fatalf("expected start, spot and end, got %v", resp.Stops)
+	}
+	start, spot, end := resp.Stops[0], resp.Stops[1], resp.Stops[2]
+
+	if _, ok := start["distance_from_prev"]; ok {
+		t.Errorf("start has no previous stop, got distance_from_prev %v", start["distance_from_prev"])
+	}
+	if d, ok := spot["distance_from_prev"]; !ok || d != 0.0 {
+		t.Errorf("expected a zero-distance leg to report distance_from_prev 0, got %v (present %v)", d, ok)
+	}
+	if d, ok := end["distance_from_prev"]; !ok || d != 0.0 {
+		t.Errorf("expected the zero-distance return leg to report 0, got %v (present %v)", d, ok)
+	}
+	for _, stop := range []map[string]any{start, end} {
+		if _, ok := stop["stay_duration"]; ok {
+			t.Errorf("%v: expected no stay_duration, got %v", stop["category"], stop["stay_duration"])
 		}
+	}
+	if spot["stay_duration"] != 30.0 {
+		t.Errorf("expected stay_duration 30, got %v", spot["stay_duration"])
+	}
+	for _, stop := range resp.Stops {
+		if _, ok := stop["arrival_time"]; !ok {
+			t.Errorf("%v: expected arrival_time", stop["category"])
+		}
+		if _, ok := stop["wait_minutes"]; ok {
+			t.Errorf("%v: expected no wait_minutes without a wait", stop["category"])
+		}
+	}
+}
+
+func TestRouteStopDepartureTimes(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.Router = &stubEstimator{} // 30 minute legs
+	lake := seedSpot(t, server, "湖畔", "drive", 35.05, 139.0)
+	market := seedSpot(t, server, "朝市", "drive", 35.05, 139.05)
+	mustExec(t, server, "UPDATE spots SET opening_time = '10:45' WHERE id = ?", market.ID)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "stay_durations": [30, 40], "message": "ok"}`, lake.ID, market.ID)
 
-		for _, test := range tests {
-			result := mainDomainFromHost(test.input)
-			if result != test.expected {
-				t.Errorf("mainDomainFromHost(%q) = %q, expected %q", test.input, result, test.expected)
+	// Each stop's departure is its arrival, any wait and its stay, and the
+	// next arrival follows from it.
+	check := func(stops []RouteStop) {
+		t.Helper()
+		for i, stop := range stops {
+			if stop.Category == "end" {
+				if stop.DepartureTime != "" {
+					t.Errorf("expected no departure from the end, got %s", stop.DepartureTime)
+				}
+				continue
+			}
+			want := minutesToTime(parseTimeToMinutes(stop.ArrivalTime) + stop.WaitMinutes + stop.stayMinutes())
+			if stop.DepartureTime != want {
+				t.Errorf("stop %d (%s): arrived %s, waited %d, stayed %d, expected departure %s, got %s",
+					i, stop.Name, stop.ArrivalTime, stop.WaitMinutes, stop.stayMinutes(), want, stop.DepartureTime)
 			}
 		}
+	}
+
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, DepartureTime: "09:00"})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("route: %d %s", w.Code, w.Body.String())
+	}
+	check(resp.Stops)
+	var times []string
+	for _, stop := range resp.Stops {
+		times = append(times, stop.ArrivalTime+"-"+stop.DepartureTime)
+	}
+	if got := strings.Join(times, " "); got != "09:00-09:00 09:30-10:00 10:30-11:25 11:55-" {
+		t.Errorf("unexpected timeline %s", got)
+	}
+
+	w = postJSON(t, server, "/api/route/modify", "user-a", map[string]any{
+		"lat": 35.0, "lng": 139.0, "departure_time": "09:00", "action": "skip", "target_id": market.ID,
+		"current_route": []map[string]any{{"id": lake.ID, "stay_duration": 45}, {"id": market.ID, "stay_duration": 40}},
 	})
+	resp = RouteResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("modify: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Stops) != 3 {
+		t.Fatalf("expected the skipped stop gone, got %+v", resp.Stops)
+	}
+	check(resp.Stops)
+}
+
+func TestGetSpotsSortedByDistance(t *testing.T) {
+	server, _ := newTestServer(t)
+	far := seedSpot(t, server, "遠い岬", "drive", 36.0, 139.0)
+	near := seedSpot(t, server, "近所の公園", "rest", 35.01, 139.0)
+	mid := seedSpot(t, server, "中くらいの峠", "drive", 35.3, 139.0)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/api/spots?lat=35.0&lng=139.0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var spots []SpotWithDistance
+	if err := json.Unmarshal(w.Body.Bytes(), &spots); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	wantOrder := []int64{near.ID, mid.ID, far.ID}
+	if len(spots) != len(wantOrder) {
+		t.Fatalf("expected %d spots, got %d", len(wantOrder), len(spots))
+	}
+	for i, id := range wantOrder {
+		if spots[i].ID != id {
+			t.Errorf("position %d: expected spot %d, got %d", i, id, spots[i].ID)
+		}
+	}
+	if spots[2].DistanceKm < 110 || spots[2].DistanceKm > 112 {
+		t.Errorf("expected ~111km to the far spot, got %v", spots[2].DistanceKm)
+	}
+
+	w = get("/api/spots?lat=35.0&lng=139.0&limit=2")
+	spots = nil
+	json.Unmarshal(w.Body.Bytes(), &spots)
+	if len(spots) != 2 || spots[1].ID != mid.ID {
+		t.Errorf("expected the nearest 2 spots, got %+v", spots)
+	}
+
+	w = get("/api/spots")
+	var plain []map[string]any
+	json.Unmarshal(w.Body.Bytes(), &plain)
+	if len(plain) != 3 {
+		t.Errorf("expected all spots without coordinates, got %d", len(plain))
+	}
+	if _, ok := plain[0]["distance_km"]; ok {
+		t.Errorf("expected no distance without coordinates")
+	}
+
+	if w := get("/api/spots?lat=abc&lng=139"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid lat, got %d", w.Code)
+	}
+}
+
+func TestRouteReachDivisor(t *testing.T) {
+	server, llm := newTestServer(t)
+	// With the default 8 hour budget the driving distance budget is 160km.
+	spot := seedSpot(t, server, "60km先の高原", "drive", 35.0+60/111.2, 139.0)
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [40], "message": "ok"}`, spot.ID)
+
+	reachable := func(divisor float64) bool {
+		server.RouteReachDivisor = divisor
+		w := postJSON(t, server, "/api/route", "user-a", map[string]any{"lat": 35.0, "lng": 139.0})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return len(resp.Stops) > 0
+	}
+
+	if !reachable(2) { // 80km reach
+		t.Error("expected a smaller divisor to reach the 60km spot")
+	}
+	if reachable(4) { // 40km reach
+		t.Error("expected a larger divisor to exclude the 60km spot")
+	}
+	if reachable(0) { // invalid: falls back to the default 53km reach
+		t.Error("expected an invalid divisor to fall back to the default")
+	}
+}
+
+func TestRecommendDropsInvalidAIIDs(t *testing.T) {
+	server, llm := newTestServer(t)
+	a := seedSpot(t, server, "渓谷", "drive", 35.1, 139.0)
+	b := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	c := seedSpot(t, server, "道の駅", "rest", 35.3, 139.0)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, 424242, %d, %d, 777], "message": "おすすめです"}`, a.ID, b.ID, c.ID)
+
+	w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp RecommendResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.InvalidIDsDropped != 2 {
+		t.Errorf("expected 2 invalid IDs dropped, got %d", resp.InvalidIDsDropped)
+	}
+	if len(resp.Spots) != 3 {
+		t.Fatalf("expected the 3 valid spots, got %d", len(resp.Spots))
+	}
+	for i, id := range []int64{a.ID, b.ID, c.ID} {
+		if resp.Spots[i].ID != id {
+			t.Errorf("position %d: expected %d, got %d", i, id, resp.Spots[i].ID)
+		}
+	}
+	if resp.Message != "おすすめです" {
+		t.Errorf("expected the AI message, got %q", resp.Message)
+	}
+}
+
+func TestRecommendSpatialDiversity(t *testing.T) {
+	server, llm := newTestServer(t)
+	n1 := seedSpot(t, server, "北の展望台1", "drive", 35.10, 139.00)
+	n2 := seedSpot(t, server, "北の展望台2", "drive", 35.12, 139.01)
+	n3 := seedSpot(t, server, "北の展望台3", "drive", 35.11, 138.99)
+	seedSpot(t, server, "東の海岸", "drive", 35.00, 139.15)
+	seedSpot(t, server, "南の港", "drive", 34.88, 139.00)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d, %d, %d], "message": "ok"}`, n1.ID, n2.ID, n3.ID)
+
+	directions := func(diverse bool) map[string]int {
+		w := postJSON(t, server, "/api/recommend", fmt.Sprintf("user-%v", diverse), RecommendRequest{
+			Lat: 35.0, Lng: 139.0, SpatialDiversity: diverse,
+		})
+		var resp RecommendResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Spots) != 3 {
+			t.Fatalf("expected 3 picks, got %d", len(resp.Spots))
+		}
+		if resp.Spots[0].ID != n1.ID {
+			t.Errorf("expected the AI's first pick to stay first, got %d", resp.Spots[0].ID)
+		}
+		dirs := make(map[string]int)
+		for _, sp := range resp.Spots {
+			dirs[getDirection(35.0, 139.0, sp.Latitude, sp.Longitude)]++
+		}
+		return dirs
+	}
+
+	if dirs := directions(false); len(dirs) != 1 {
+		t.Errorf("expected the AI's clustered picks without the flag, got %v", dirs)
+	}
+	if dirs := directions(true); len(dirs) != 3 {
+		t.Errorf("expected picks spread across 3 directions, got %v", dirs)
+	}
+	if !strings.Contains(llm.lastPrompt(), "異なる方角") {
+		t.Errorf("expected the prompt to ask for different directions")
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and
+// returns the cert/key paths and a pool trusting it.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "drive-app test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestServeTLS(t *testing.T) {
+	server, _ := newTestServer(t)
+	certFile, keyFile, pool := writeSelfSignedCert(t)
+	server.TLSCertFile = certFile
+	server.TLSKeyFile = keyFile
+
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go server.serveListener(context.Background(), ln)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/api/spots")
+	if err != nil {
+		t.Fatalf("https request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("expected 200 over TLS, got %d (tls=%v)", resp.StatusCode, resp.TLS != nil)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	server, _ := newTestServer(t)
+	// Keep the path short; Unix socket paths are limited to ~100 bytes.
+	dir, err := os.MkdirTemp("", "drv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "s.sock")
+
+	ln, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go server.serveListener(context.Background(), ln)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://unix/api/spots")
+	if err != nil {
+		t.Fatalf("request over unix socket: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "[") {
+		t.Errorf("expected spots JSON, got %d %q", resp.StatusCode, body)
+	}
 }
@@ -0,0 +1,74 @@
+package srv
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+)
+
+const (
+	defaultSimilarRadiusKm = 20
+	maxSimilarRadiusKm     = 100
+	defaultSimilarLimit    = 10
+	maxSimilarLimit        = 50
+)
+
+// similarityScore ranks a spot found within radius of the seed spot:
+// closeness and rating count equally, each from 0 to 1. Unrated spots
+// count as middling.
+func similarityScore(spot SpotWithDistance, radius float64) float64 {
+	rating := 0.5
+	if spot.RatingCount > 0 {
+		rating = spot.AvgRating / 5
+	}
+	return (1 - spot.DistanceKm/radius) + rating
+}
+
+// HandleSimilarSpots serves GET /api/spots/{id}/similar[?radius_km=][&limit=]:
+// approved spots of the same category within radius_km of the spot, the
+// nearest and best rated first. Spots have no tags, so the category is all
+// that is compared.
+func (s *Server) HandleSimilarSpots(w http.ResponseWriter, r *http.Request) {
+	radius, err := floatParam(r, "radius_km", defaultSimilarRadiusKm)
+	if err != nil || radius <= 0 || radius > maxSimilarRadiusKm {
+		http.Error(w, "invalid radius_km", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultSimilarLimit)
+	if err != nil || limit <= 0 || limit > maxSimilarLimit {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	seed, ok := s.loadSpot(w, r)
+	if !ok {
+		return
+	}
+
+	spots, err := s.loadSpots(r.Context(), s.Queries, s.areaAround(seed.Latitude, seed.Longitude, radius))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	similar := []SpotWithDistance{}
+	for _, spot := range spots {
+		if spot.ID == seed.ID || spot.Category != seed.Category {
+			continue
+		}
+		if dist := s.distanceKm(seed.Latitude, seed.Longitude, spot.Latitude, spot.Longitude); dist <= radius {
+			similar = append(similar, newSpotWithDistance(spot, dist))
+		}
+	}
+	slices.SortStableFunc(similar, func(a, b SpotWithDistance) int {
+		if c := cmp.Compare(similarityScore(b, radius), similarityScore(a, radius)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.DistanceKm, b.DistanceKm)
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(similar)
+}
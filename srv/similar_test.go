@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimilarSpots(t *testing.T) {
+	server, _ := newTestServer(t)
+	seed := seedSpot(t, server, "芦ノ湖", "drive", 35.2, 139.0)
+	near := seedSpot(t, server, "近くの湖", "drive", 35.21, 139.0)  // 1km
+	rated := seedSpot(t, server, "評判の峠", "drive", 35.25, 139.0) // 6km, rated 5
+	seedSpot(t, server, "湖畔の食堂", "restaurant", 35.2, 139.001)   // another category
+	seedSpot(t, server, "遠い岬", "drive", 35.6, 139.0)            // 44km
+	mustExec(t, server, "UPDATE spots SET avg_rating = 5, rating_count = 3 WHERE id = ?", rated.ID)
+
+	get := func(path string) (*httptest.ResponseRecorder, []SpotWithDistance) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var spots []SpotWithDistance
+		json.Unmarshal(w.Body.Bytes(), &spots)
+		return w, spots
+	}
+	names := func(spots []SpotWithDistance) string {
+		var got []string
+		for _, spot := range spots {
+			got = append(got, spot.Name)
+		}
+		return fmt.Sprint(got)
+	}
+
+	w, spots := get(fmt.Sprintf("/api/spots/%d/similar", seed.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("similar: %d %s", w.Code, w.Body.String())
+	}
+	// The rating outweighs 5km within a 20km radius
+	if got := names(spots); got != "[評判の峠 近くの湖]" {
+		t.Errorf("expected nearby drive spots, rated first and without the seed, got %s", got)
+	}
+	if spots[1].ID != near.ID || spots[1].DistanceKm < 1 || spots[1].DistanceKm > 1.2 {
+		t.Errorf("expected the distance from the seed spot, got %+v", spots[1])
+	}
+
+	if _, spots := get(fmt.Sprintf("/api/spots/%d/similar?radius_km=50&limit=3", seed.ID)); names(spots) != "[評判の峠 近くの湖 遠い岬]" {
+		t.Errorf("expected a wider radius to reach the far cape, got %s", names(spots))
+	}
+	if _, spots := get(fmt.Sprintf("/api/spots/%d/similar?limit=1", seed.ID)); len(spots) != 1 {
+		t.Errorf("expected the limit applied, got %s", names(spots))
+	}
+
+	for path, code := range map[string]int{
+		"/api/spots/9999/similar":                                 http.StatusNotFound,
+		fmt.Sprintf("/api/spots/%d/similar?radius_km=0", seed.ID): http.StatusBadRequest,
+		fmt.Sprintf("/api/spots/%d/similar?limit=500", seed.ID):   http.StatusBadRequest,
+	} {
+		if w, _ := get(path); w.Code != code {
+			t.Errorf("%s: expected %d, got %d", path, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// maxSpotImages caps the size of one spot's gallery.
+const maxSpotImages = 20
+
+// SpotDetail is a spot with its photo gallery. SuggestedStayMin is filled
+// in from the category default when the spot has none.
+type SpotDetail struct {
+	dbgen.Spot
+	SuggestedStayMin int               `json:"suggested_stay_min"`
+	Images           []dbgen.SpotImage `json:"images"` // in display order
+}
+
+// AddSpotImageRequest adds a photo to a spot's gallery. SortOrder places it
+// among the others; nil appends it.
+type AddSpotImageRequest struct {
+	URL       string  `json:"url"`
+	Caption   *string `json:"caption"`
+	SortOrder *int64  `json:"sort_order"`
+}
+
+// validateImageURL accepts absolute http(s) URLs only, so a gallery can't
+// point at javascript: or data: URLs or at paths on this server.
+func validateImageURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("image url %q must be an absolute http or https URL", raw)
+	}
+	return nil
+}
+
+// HandleGetSpot returns one spot with its gallery.
+func (s *Server) HandleGetSpot(w http.ResponseWriter, r *http.Request) {
+	spot, ok := s.loadSpot(w, r)
+	if !ok {
+		return
+	}
+	images, err := s.Queries.ListSpotImages(r.Context(), spot.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if images == nil {
+		images = []dbgen.SpotImage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SpotDetail{Spot: spot, SuggestedStayMin: s.spotStay(spot), Images: images})
+}
+
+// HandleAddSpotImage adds a photo to a spot's gallery. Like editing the
+// spot, only its creator and admins may.
+func (s *Server) HandleAddSpotImage(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var req AddSpotImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := validateImageURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Caption != nil {
+		if caption := strings.TrimSpace(*req.Caption); caption != "" {
+			req.Caption = &caption
+		} else {
+			req.Caption = nil
+		}
+	}
+
+	spot, ok := s.loadSpot(w, r)
+	if !ok || !s.canEditSpot(w, r, userID, spot) {
+		return
+	}
+
+	q := s.Queries
+	images, err := q.ListSpotImages(r.Context(), spot.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(images) >= maxSpotImages {
+		http.Error(w, fmt.Sprintf("a spot can have at most %d images", maxSpotImages), http.StatusConflict)
+		return
+	}
+	order := int64(0)
+	if req.SortOrder != nil {
+		order = *req.SortOrder
+	} else if order, err = q.NextSpotImageOrder(r.Context(), spot.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A new photo changes what the spot shows, so it goes back for review
+	// like any other edit.
+	var image dbgen.SpotImage
+	err = s.WithTx(r.Context(), func(q *dbgen.Queries) error {
+		var err error
+		image, err = q.AddSpotImage(r.Context(), dbgen.AddSpotImageParams{
+			SpotID:    spot.ID,
+			Url:       req.URL,
+			Caption:   req.Caption,
+			SortOrder: order,
+		})
+		if err != nil {
+			return err
+		}
+		if status := s.editedStatus(r, spot); status != spot.Status {
+			_, err = q.SetSpotStatus(r.Context(), dbgen.SetSpotStatusParams{Status: status, ID: spot.ID})
+		}
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+// HandleDeleteSpotImage removes a photo from a spot's gallery.
+func (s *Server) HandleDeleteSpotImage(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+	imageID, err := strconv.ParseInt(r.PathValue("image_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid image id", http.StatusBadRequest)
+		return
+	}
+	spot, ok := s.loadSpot(w, r)
+	if !ok || !s.canEditSpot(w, r, userID, spot) {
+		return
+	}
+
+	n, err := s.Queries.DeleteSpotImage(r.Context(), dbgen.DeleteSpotImageParams{ID: imageID, SpotID: spot.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "image not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestSpotGallery(t *testing.T) {
+	server, _ := newTestServer(t)
+	lat, lng := 35.2044, 139.0250
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "箱根神社", Category: "drive", Latitude: &lat, Longitude: &lng})
+	var spot dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	imagesPath := fmt.Sprintf("/api/spots/%d/images", spot.ID)
+
+	add := func(userID string, body AddSpotImageRequest) dbgen.SpotImage {
+		t.Helper()
+		w := postJSON(t, server, imagesPath, userID, body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("add %s: expected 201, got %d: %s", body.URL, w.Code, w.Body.String())
+		}
+		var image dbgen.SpotImage
+		json.Unmarshal(w.Body.Bytes(), &image)
+		return image
+	}
+	detail := func() SpotDetail {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/spots/%d", spot.ID), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("detail: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var d SpotDetail
+		if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	urls := func(d SpotDetail) []string {
+		var got []string
+		for _, image := range d.Images {
+			got = append(got, image.Url)
+		}
+		return got
+	}
+
+	if d := detail(); d.ID != spot.ID || d.Name != "箱根神社" || d.Images == nil || len(d.Images) != 0 {
+		t.Fatalf("expected the spot with an empty gallery, got %+v", d)
+	}
+
+	caption := " 鳥居 "
+	torii := add("user-a", AddSpotImageRequest{URL: "https://example.com/torii.jpg", Caption: &caption})
+	if torii.Caption == nil || *torii.Caption != "鳥居" || torii.SortOrder != 0 {
+		t.Errorf("unexpected first image %+v", torii)
+	}
+	add("user-a", AddSpotImageRequest{URL: "https://example.com/lake.jpg"})
+	first := int64(-1)
+	add("user-a", AddSpotImageRequest{URL: "http://example.com/gate.jpg", SortOrder: &first})
+
+	want := []string{"http://example.com/gate.jpg", "https://example.com/torii.jpg", "https://example.com/lake.jpg"}
+	if got := urls(detail()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected all images in sort order %v, got %v", want, got)
+	}
+
+	for _, bad := range []string{"", "example.com/a.jpg", "/static/a.jpg", "javascript:alert(1)", "data:image/png;base64,AA==", "ftp://example.com/a.jpg"} {
+		if w := postJSON(t, server, imagesPath, "user-a", AddSpotImageRequest{URL: bad}); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", bad, w.Code)
+		}
+	}
+	if w := postJSON(t, server, imagesPath, "user-b", AddSpotImageRequest{URL: "https://example.com/b.jpg"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another user, got %d", w.Code)
+	}
+
+	remove := func(userID string, imageID int64) int {
+		req := asUser(httptest.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d", imagesPath, imageID), nil), userID)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := remove("user-b", torii.ID); code != http.StatusForbidden {
+		t.Errorf("expected 403 removing as another user, got %d", code)
+	}
+	if code := remove("user-a", torii.ID); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := remove("user-a", torii.ID); code != http.StatusNotFound {
+		t.Errorf("expected 404 removing twice, got %d", code)
+	}
+	want = []string{"http://example.com/gate.jpg", "https://example.com/lake.jpg"}
+	if got := urls(detail()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v after removing one, got %v", want, got)
+	}
+}
@@ -0,0 +1,383 @@
+package srv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// validCategories are the spot categories the rest of the app understands.
+var validCategories = map[string]bool{
+	"drive":      true,
+	"restaurant": true,
+	"rest":       true,
+}
+
+// maxSuggestedStayMin caps a spot's suggested stay at a full day out.
+const maxSuggestedStayMin = 8 * 60
+
+// CreateSpotRequest is the request body for adding a spot. Latitude and
+// Longitude may be omitted, in which case the address (or name) is geocoded.
+type CreateSpotRequest struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	Category    string   `json:"category"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	Address     *string  `json:"address"`
+	ImageUrl    *string  `json:"image_url"`
+	Indoor      *bool    `json:"indoor"` // nil when unknown
+
+	// Accessibility attributes; nil when unknown.
+	WheelchairAccessible *bool `json:"wheelchair_accessible"`
+	KidFriendly          *bool `json:"kid_friendly"`
+	HasRestroom          *bool `json:"has_restroom"`
+
+	// Difficulty is how hard the roads to the spot are to drive,
+	// DifficultyEasy to DifficultyHard; nil when unknown (treated as easy).
+	Difficulty *int64 `json:"difficulty"`
+
+	// SuggestedStayMin is how long to spend at the spot, in minutes; nil
+	// uses the category default.
+	SuggestedStayMin *int64 `json:"suggested_stay_min"`
+
+	// EntryFee is what it costs one adult to get in, in yen; 0 for free
+	// spots, nil when unknown.
+	EntryFee *int64 `json:"entry_fee"`
+
+	// BestTimeStart and BestTimeEnd ("HH:MM") give the best time of day to
+	// arrive, e.g. around sunset. End before start wraps past midnight.
+	BestTimeStart *string `json:"best_time_start"`
+	BestTimeEnd   *string `json:"best_time_end"`
+
+	// CrowdByHour gives how crowded the spot usually is each hour of the
+	// day: 24 comma-separated levels, CrowdLow to CrowdHigh, starting at
+	// 00:00. Nil when unknown.
+	CrowdByHour *string `json:"crowd_by_hour"`
+
+	// Force inserts the spot even if it is within DuplicateRadiusKm of an
+	// existing one or its coordinates fail Server.VerifyCoordinates.
+	Force bool `json:"force"`
+}
+
+// SpotConflict is the 409 response when a new spot is suspiciously close to
+// an existing one.
+type SpotConflict struct {
+	Error      string     `json:"error"`
+	DistanceKm float64    `json:"distance_km"`
+	Conflict   dbgen.Spot `json:"conflict"`
+}
+
+// validate checks the fields shared by creating and updating a spot,
+// trimming the name and normalizing the category.
+func (req *CreateSpotRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	category, ok := normalizeCategory(req.Category)
+	if !ok {
+		return fmt.Errorf("unknown category %q; use drive, restaurant or rest", req.Category)
+	}
+	req.Category = category
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return errors.New("latitude and longitude must be given together")
+	}
+	if req.Latitude != nil && (math.Abs(*req.Latitude) > 90 || math.Abs(*req.Longitude) > 180) {
+		return fmt.Errorf("coordinates %v, %v are out of range", *req.Latitude, *req.Longitude)
+	}
+	if (req.BestTimeStart == nil) != (req.BestTimeEnd == nil) {
+		return errors.New("best_time_start and best_time_end must be given together")
+	}
+	for _, v := range []*string{req.BestTimeStart, req.BestTimeEnd} {
+		if v == nil {
+			continue
+		}
+		if _, ok := parseClock(*v); !ok {
+			return fmt.Errorf("best time %q must be HH:MM", *v)
+		}
+	}
+	if req.Difficulty != nil {
+		if err := validateDifficulty("difficulty", int(*req.Difficulty)); err != nil {
+			return err
+		}
+	}
+	if req.CrowdByHour != nil {
+		if _, err := parseCrowdByHour(*req.CrowdByHour); err != nil {
+			return err
+		}
+	}
+	if req.EntryFee != nil && *req.EntryFee < 0 {
+		return errors.New("entry_fee must be >= 0")
+	}
+	if req.SuggestedStayMin != nil && (*req.SuggestedStayMin <= 0 || *req.SuggestedStayMin > maxSuggestedStayMin) {
+		return fmt.Errorf("suggested_stay_min must be between 1 and %d", maxSuggestedStayMin)
+	}
+	return nil
+}
+
+// HandleCreateSpot adds a spot, resolving its coordinates server-side via
+// Server.Geocoder when the client doesn't supply them. Spots added by users
+// other than admins await moderation before they become candidates.
+func (s *Server) HandleCreateSpot(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var req CreateSpotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var geocoded bool
+	if req.Latitude == nil {
+		if s.Geocoder == nil {
+			http.Error(w, "coordinates are required (geocoding is not configured)", http.StatusUnprocessableEntity)
+			return
+		}
+		query := req.Name
+		if req.Address != nil && strings.TrimSpace(*req.Address) != "" {
+			query = *req.Address
+		}
+		lat, lng, err := s.Geocoder.Geocode(r.Context(), query)
+		if err != nil {
+			slog.Warn("geocode spot", "query", query, "error", err)
+			http.Error(w, "could not resolve coordinates for "+query, http.StatusUnprocessableEntity)
+			return
+		}
+		req.Latitude, req.Longitude = &lat, &lng
+		geocoded = true
+	}
+	lat, lng := s.roundCoords(*req.Latitude, *req.Longitude)
+	req.Latitude, req.Longitude = &lat, &lng
+
+	// Coordinates geocoded from the spot's own name or address need no
+	// second opinion.
+	var verified *bool
+	if !geocoded {
+		var place string
+		verified, place = s.verifyCoordinates(r.Context(), req, lat, lng)
+		if verified != nil && !*verified && !req.Force {
+			writeCoordinateMismatch(w, place)
+			return
+		}
+	}
+
+	q := s.Queries
+	if !req.Force && s.DuplicateRadiusKm > 0 {
+		// Any status, like the Overpass import: a place already submitted
+		// but not yet reviewed is still a duplicate.
+		area := s.areaAround(*req.Latitude, *req.Longitude, s.DuplicateRadiusKm)
+		existing, err := q.GetSpotsInAreaAnyStatus(r.Context(), dbgen.GetSpotsInAreaAnyStatusParams{
+			MinLat: area.MinLat,
+			MaxLat: area.MaxLat,
+			MinLng: area.MinLng,
+			MaxLng: area.MaxLng,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if nearest, dist, ok := s.nearestSpot(existing, *req.Latitude, *req.Longitude); ok && dist <= s.DuplicateRadiusKm {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(SpotConflict{
+				Error:      "a spot already exists nearby; resend with force to add it anyway",
+				DistanceKm: math.Round(dist*1000) / 1000,
+				Conflict:   nearest,
+			})
+			return
+		}
+	}
+
+	spot, err := q.CreateSpot(r.Context(), dbgen.CreateSpotParams{
+		Name:                 req.Name,
+		Description:          req.Description,
+		Category:             req.Category,
+		Latitude:             *req.Latitude,
+		Longitude:            *req.Longitude,
+		Address:              req.Address,
+		ImageUrl:             req.ImageUrl,
+		CreatedBy:            &userID,
+		Indoor:               req.Indoor,
+		BestTimeStart:        req.BestTimeStart,
+		BestTimeEnd:          req.BestTimeEnd,
+		WheelchairAccessible: req.WheelchairAccessible,
+		KidFriendly:          req.KidFriendly,
+		HasRestroom:          req.HasRestroom,
+		Difficulty:           req.Difficulty,
+		SuggestedStayMin:     req.SuggestedStayMin,
+		Status:               s.submissionStatus(r),
+		CoordinatesVerified:  verified,
+		EntryFee:             req.EntryFee,
+		CrowdByHour:          req.CrowdByHour,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(spot)
+}
+
+// HandleMySpots lists the spots the user submitted, newest first.
+func (s *Server) HandleMySpots(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	spots, err := s.Queries.GetSpotsByCreator(r.Context(), &userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if spots == nil {
+		spots = []dbgen.Spot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spots)
+}
+
+// nearestSpot returns the spot closest to (lat, lng) and its distance.
+func (s *Server) nearestSpot(spots []dbgen.Spot, lat, lng float64) (dbgen.Spot, float64, bool) {
+	var nearest dbgen.Spot
+	best := math.Inf(1)
+	for _, sp := range spots {
+		if d := s.distanceKm(lat, lng, sp.Latitude, sp.Longitude); d < best {
+			nearest, best = sp, d
+		}
+	}
+	return nearest, best, len(spots) > 0
+}
+
+// UpdateSpotRequest replaces a spot's details. Fields are validated as for
+// CreateSpotRequest; omitted coordinates keep the spot where it is. Force
+// allows moving the spot farther than Server.MaxSpotMoveKm and saving
+// coordinates that fail Server.VerifyCoordinates.
+type UpdateSpotRequest CreateSpotRequest
+
+// SpotMoveConflict is the 409 response when an update would move a spot
+// implausibly far.
+type SpotMoveConflict struct {
+	Error      string  `json:"error"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// HandleUpdateSpot replaces the details of a spot. Only the user who added
+// it and admins may edit it, and the user's edits go back for review.
+func (s *Server) HandleUpdateSpot(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	var req UpdateSpotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := (*CreateSpotRequest)(&req).validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current, ok := s.loadSpot(w, r)
+	if !ok || !s.canEditSpot(w, r, userID, current) {
+		return
+	}
+	id := current.ID
+
+	lat, lng := current.Latitude, current.Longitude
+	if req.Latitude != nil {
+		lat, lng = s.roundCoords(*req.Latitude, *req.Longitude)
+	}
+	if moved := s.distanceKm(current.Latitude, current.Longitude, lat, lng); !req.Force && s.MaxSpotMoveKm > 0 && moved > s.MaxSpotMoveKm {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(SpotMoveConflict{
+			Error:      fmt.Sprintf("this would move the spot %.1fkm; resend with force if that is intended", moved),
+			DistanceKm: math.Round(moved*1000) / 1000,
+		})
+		return
+	}
+
+	verified, place := s.verifyCoordinates(r.Context(), CreateSpotRequest(req), lat, lng)
+	if verified != nil && !*verified && !req.Force {
+		writeCoordinateMismatch(w, place)
+		return
+	}
+	// Keep the last verdict if the check can't run and nothing it looked
+	// at changed.
+	if verified == nil && lat == current.Latitude && lng == current.Longitude && req.Name == current.Name && equalPtr(req.Address, current.Address) {
+		verified = current.CoordinatesVerified
+	}
+
+	spot, err := s.Queries.UpdateSpot(r.Context(), dbgen.UpdateSpotParams{
+		Name:                 req.Name,
+		Description:          req.Description,
+		Category:             req.Category,
+		Latitude:             lat,
+		Longitude:            lng,
+		Address:              req.Address,
+		ImageUrl:             req.ImageUrl,
+		Indoor:               req.Indoor,
+		BestTimeStart:        req.BestTimeStart,
+		BestTimeEnd:          req.BestTimeEnd,
+		WheelchairAccessible: req.WheelchairAccessible,
+		KidFriendly:          req.KidFriendly,
+		HasRestroom:          req.HasRestroom,
+		Difficulty:           req.Difficulty,
+		SuggestedStayMin:     req.SuggestedStayMin,
+		CoordinatesVerified:  verified,
+		EntryFee:             req.EntryFee,
+		CrowdByHour:          req.CrowdByHour,
+		Status:               s.editedStatus(r, current),
+		ID:                   id,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spot)
+}
+
+// loadSpot loads the spot named by the {id} path value, writing the error
+// response if it can't.
+func (s *Server) loadSpot(w http.ResponseWriter, r *http.Request) (dbgen.Spot, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid spot id", http.StatusBadRequest)
+		return dbgen.Spot{}, false
+	}
+	spot, err := s.Queries.GetSpotByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "spot not found", http.StatusNotFound)
+		return dbgen.Spot{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return dbgen.Spot{}, false
+	}
+	return spot, true
+}
+
+// canEditSpot reports whether userID may change spot: only the user who
+// added it and admins may. It writes a 403 otherwise.
+func (s *Server) canEditSpot(w http.ResponseWriter, r *http.Request, userID string, spot dbgen.Spot) bool {
+	if (spot.CreatedBy == nil || *spot.CreatedBy != userID) && !s.isAdmin(r) {
+		http.Error(w, "only the spot's creator can edit it", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,355 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// fakeGeocoder resolves queries from a fixed table.
+type fakeGeocoder struct {
+	places  map[string][2]float64
+	queries []string
+}
+
+func (g *fakeGeocoder) Geocode(ctx context.Context, query string) (float64, float64, error) {
+	g.queries = append(g.queries, query)
+	p, ok := g.places[query]
+	if !ok {
+		return 0, 0, ErrPlaceNotFound
+	}
+	return p[0], p[1], nil
+}
+
+func TestCreateSpot(t *testing.T) {
+	server, _ := newTestServer(t)
+	geo := &fakeGeocoder{places: map[string][2]float64{
+		"神奈川県足柄下郡箱根町元箱根": {35.2044, 139.0250},
+	}}
+	server.Geocoder = geo
+
+	t.Run("with coordinates", func(t *testing.T) {
+		lat, lng := 35.36, 138.73
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{
+			Name: "富士山五合目", Category: "drive", Latitude: &lat, Longitude: &lng,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var spot dbgen.Spot
+		json.Unmarshal(w.Body.Bytes(), &spot)
+		if spot.Latitude != lat || spot.CreatedBy == nil || *spot.CreatedBy != "user-a" {
+			t.Errorf("unexpected spot %+v", spot)
+		}
+		if len(geo.queries) != 0 {
+			t.Errorf("expected no geocoding when coordinates are given")
+		}
+	})
+
+	t.Run("geocoded from address", func(t *testing.T) {
+		addr := "神奈川県足柄下郡箱根町元箱根"
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{
+			Name: "箱根神社", Category: "drive", Address: &addr,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var spot dbgen.Spot
+		json.Unmarshal(w.Body.Bytes(), &spot)
+		if spot.Latitude != 35.2044 || spot.Longitude != 139.0250 {
+			t.Errorf("expected geocoded coordinates, got %v,%v", spot.Latitude, spot.Longitude)
+		}
+		stored, err := dbgen.New(server.DB).GetSpotByID(context.Background(), spot.ID)
+		if err != nil || stored.Latitude != 35.2044 {
+			t.Errorf("expected stored geocoded spot, got %+v (%v)", stored, err)
+		}
+	})
+
+	t.Run("geocoding fails", func(t *testing.T) {
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "どこにもない場所", Category: "rest"})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", w.Code)
+		}
+		if last := geo.queries[len(geo.queries)-1]; last != "どこにもない場所" {
+			t.Errorf("expected the name to be geocoded without an address, got %q", last)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		if w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "x", Category: "bar"}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for unknown category, got %d", w.Code)
+		}
+		if w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Category: "rest"}); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for missing name, got %d", w.Code)
+		}
+	})
+}
+
+func TestCreateSpotNearExisting(t *testing.T) {
+	server, _ := newTestServer(t)
+	existing := seedSpot(t, server, "箱根神社", "drive", 35.2044, 139.0250)
+
+	create := func(name string, lat, lng float64, force bool) *httptest.ResponseRecorder {
+		t.Helper()
+		return postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{
+			Name: name, Category: "drive", Latitude: &lat, Longitude: &lng, Force: force,
+		})
+	}
+
+	// About 30m away from the existing spot.
+	w := create("箱根神社 鳥居", 35.2046, 139.0252, false)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var conflict SpotConflict
+	if err := json.Unmarshal(w.Body.Bytes(), &conflict); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if conflict.Conflict.ID != existing.ID || conflict.DistanceKm <= 0 || conflict.DistanceKm > 0.05 {
+		t.Errorf("unexpected conflict %+v", conflict)
+	}
+
+	if w := create("箱根神社 鳥居", 35.2046, 139.0252, true); w.Code != http.StatusCreated {
+		t.Errorf("expected force to insert anyway, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create("芦ノ湖スカイライン", 35.2200, 138.9900, false); w.Code != http.StatusCreated {
+		t.Errorf("expected a distant spot to be created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Submissions still under review are duplicates too.
+	if w := create("大涌谷", 35.2440, 139.0210, false); w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Fatalf("expected a pending submission, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create("大涌谷 展望台", 35.2442, 139.0212, false); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 next to a pending spot, got %d: %s", w.Code, w.Body.String())
+	}
+
+	server.DuplicateRadiusKm = 0
+	if w := create("箱根神社 本殿", 35.2045, 139.0251, false); w.Code != http.StatusCreated {
+		t.Errorf("expected no check with a zero radius, got %d", w.Code)
+	}
+}
+
+func TestUpdateSpot(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	lat, lng := 35.2044, 139.0250
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "箱根神社", Category: "drive", Latitude: &lat, Longitude: &lng})
+	var spot dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	update := func(userID, email string, body UpdateSpotRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		req := asUser(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/spots/%d", spot.ID), bytes.NewReader(b)), userID)
+		if email != "" {
+			req.Header.Set("X-ExeDev-Email", email)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+	at := func(lat, lng float64) (*float64, *float64) { return &lat, &lng }
+
+	t.Run("validation", func(t *testing.T) {
+		badLat, badLng := at(135, 139)
+		start := "16:30"
+		for name, body := range map[string]UpdateSpotRequest{
+			"missing name":      {Category: "drive"},
+			"unknown category":  {Name: "箱根神社", Category: "bar"},
+			"half a coordinate": {Name: "箱根神社", Category: "drive", Latitude: &lat},
+			"out of range":      {Name: "箱根神社", Category: "drive", Latitude: badLat, Longitude: badLng},
+			"half a best time":  {Name: "箱根神社", Category: "drive", BestTimeStart: &start},
+		} {
+			if w := update("user-a", "", body); w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", name, w.Code)
+			}
+		}
+	})
+
+	t.Run("small move", func(t *testing.T) {
+		newLat, newLng := at(35.2050, 139.0260)
+		w := update("user-a", "", UpdateSpotRequest{Name: " 箱根神社 本殿 ", Category: "drive", Latitude: newLat, Longitude: newLng})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var got dbgen.Spot
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if got.Name != "箱根神社 本殿" || got.Latitude != 35.2050 || got.CreatedBy == nil || *got.CreatedBy != "user-a" {
+			t.Errorf("unexpected updated spot %+v", got)
+		}
+	})
+
+	t.Run("large move", func(t *testing.T) {
+		// Tokyo is about 80km away.
+		tokyoLat, tokyoLng := at(35.6586, 139.7454)
+		body := UpdateSpotRequest{Name: "箱根神社", Category: "drive", Latitude: tokyoLat, Longitude: tokyoLng}
+		w := update("user-a", "", body)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+		}
+		var conflict SpotMoveConflict
+		if err := json.Unmarshal(w.Body.Bytes(), &conflict); err != nil || conflict.DistanceKm < 70 {
+			t.Errorf("unexpected conflict %+v", conflict)
+		}
+		got, _ := dbgen.New(server.DB).GetSpotByID(context.Background(), spot.ID)
+		if got.Latitude == 35.6586 {
+			t.Errorf("expected the spot to stay put without force")
+		}
+
+		body.Force = true
+		if w := update("user-a", "", body); w.Code != http.StatusOK {
+			t.Errorf("expected force to move the spot, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("omitted coordinates keep the location", func(t *testing.T) {
+		w := update("user-a", "", UpdateSpotRequest{Name: "箱根神社", Category: "rest"})
+		var got dbgen.Spot
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if w.Code != http.StatusOK || got.Latitude != 35.6586 || got.Category != "rest" {
+			t.Errorf("unexpected update %d %+v", w.Code, got)
+		}
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		body := UpdateSpotRequest{Name: "箱根神社", Category: "drive"}
+		if w := update("user-b", "", body); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403 for another user, got %d", w.Code)
+		}
+		if w := update("user-b", "admin@example.com", body); w.Code != http.StatusOK {
+			t.Errorf("expected admins to edit any spot, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestCreateSpotNormalizesCategory(t *testing.T) {
+	server, _ := newTestServer(t)
+	for i, c := range []struct{ in, want string }{{"Drive", "drive"}, {"食事", "restaurant"}, {"REST", "rest"}} {
+		lat, lng := 35.0+0.1*float64(i), 139.0
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "スポット", Category: c.in, Latitude: &lat, Longitude: &lng})
+		var spot dbgen.Spot
+		if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("%s: %d %s", c.in, w.Code, w.Body.String())
+		}
+		if spot.Category != c.want {
+			t.Errorf("expected %q to be stored as %q, got %q", c.in, c.want, spot.Category)
+		}
+	}
+}
+
+func TestMySpots(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.DuplicateRadiusKm = 0
+	create := func(user, name string, lat float64) {
+		t.Helper()
+		lng := 139.0
+		w := postJSON(t, server, "/api/spots", user, CreateSpotRequest{Name: name, Category: "drive", Latitude: &lat, Longitude: &lng})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	create("user-a", "滝見台", 35.1)
+	create("user-b", "棚田", 35.2)
+	create("user-a", "湖の桟橋", 35.3)
+	seedSpot(t, server, "取り込んだ岬", "drive", 35.4, 139.0) // no submitter
+
+	mine := func(user string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, asUser(httptest.NewRequest(http.MethodGet, "/api/spots/mine", nil), user))
+		var spots []dbgen.Spot
+		if err := json.Unmarshal(w.Body.Bytes(), &spots); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("mine: %d %s", w.Code, w.Body.String())
+		}
+		var names []string
+		for _, spot := range spots {
+			if spot.CreatedBy == nil || *spot.CreatedBy != user {
+				by := "nobody"
+				if spot.CreatedBy != nil {
+					by = *spot.CreatedBy
+				}
+				t.Errorf("%s: got %s's spot %q", user, by, spot.Name)
+			}
+			names = append(names, spot.Name)
+		}
+		return names
+	}
+	if got := fmt.Sprint(mine("user-a")); got != "[湖の桟橋 滝見台]" {
+		t.Errorf("expected user-a's spots newest first, got %v", got)
+	}
+	if got := mine("user-b"); len(got) != 1 || got[0] != "棚田" {
+		t.Errorf("expected user-b's one spot, got %v", got)
+	}
+	if got := mine("user-c"); len(got) != 0 {
+		t.Errorf("expected no spots, got %v", got)
+	}
+}
+
+func TestSpotCoordinatePrecision(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.AdminEmails = []string{"admin@example.com"}
+	server.DuplicateRadiusKm = 0
+
+	lat, lng := 35.123456789, 139.987654321
+	w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "展望台", Category: "drive", Latitude: &lat, Longitude: &lng})
+	var spot dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if spot.Latitude != 35.123457 || spot.Longitude != 139.987654 {
+		t.Errorf("expected coordinates rounded to 6 places, got %v, %v", spot.Latitude, spot.Longitude)
+	}
+
+	// The same place typed with less precision is stored identically.
+	lat2, lng2 := 35.1234571, 139.9876539
+	w = postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "展望台", Category: "drive", Latitude: &lat2, Longitude: &lng2})
+	var again dbgen.Spot
+	json.Unmarshal(w.Body.Bytes(), &again)
+	if again.Latitude != spot.Latitude || again.Longitude != spot.Longitude {
+		t.Errorf("expected the same stored coordinates, got %v, %v", again.Latitude, again.Longitude)
+	}
+
+	lat3, lng3 := 35.12000049, 139.98000051
+	body, _ := json.Marshal(UpdateSpotRequest{Name: "展望台", Category: "drive", Latitude: &lat3, Longitude: &lng3})
+	req := asUser(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/spots/%d", spot.ID), bytes.NewReader(body)), "user-a")
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	if spot.Latitude != 35.12 || spot.Longitude != 139.980001 {
+		t.Errorf("expected updated coordinates rounded, got %v, %v", spot.Latitude, spot.Longitude)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/import/overpass", strings.NewReader(`{"elements": [
+		{"type": "node", "id": 1, "lat": 36.00000012345, "lon": 138.99999987654, "tags": {"tourism": "viewpoint", "name": "峠"}}
+	]}`))
+	req.Header.Set("X-ExeDev-Email", "admin@example.com")
+	w = httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	var res ImportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res.Imported) != 1 {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+	if got := res.Imported[0]; got.Latitude != 36 || got.Longitude != 139 {
+		t.Errorf("expected imported coordinates rounded, got %v, %v", got.Latitude, got.Longitude)
+	}
+
+	// Zero keeps coordinates as given.
+	server.CoordinatePrecision = 0
+	w = postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{Name: "湖", Category: "drive", Latitude: &lat, Longitude: &lng})
+	json.Unmarshal(w.Body.Bytes(), &spot)
+	if spot.Latitude != lat || spot.Longitude != lng {
+		t.Errorf("expected unrounded coordinates, got %v, %v", spot.Latitude, spot.Longitude)
+	}
+}
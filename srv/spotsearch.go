@@ -0,0 +1,226 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Sort orders accepted by GET /api/spots.
+const (
+	sortDistance   = "distance"
+	sortPopularity = "popularity" // most ratings, then best rated
+	sortName       = "name"
+	sortNewest     = "newest"
+)
+
+// spotSearch is a parsed GET /api/spots query.
+//
+// Filters never override one another: a spot is returned only if it passes
+// all of them, so category, bbox and radius_km together give the spots of
+// those categories inside both the box and the circle. lat/lng only set the
+// origin; radius_km and sort=distance need one. Without an origin the
+// response is plain spots, newest first by default; with one, every spot
+// carries its distance and the default order is nearest first.
+type spotSearch struct {
+	categories []string
+	origin     bool
+	lat, lng   float64
+	radiusKm   float64  // 0 when unbounded
+	area       spotArea // bbox and the radius's box, intersected
+	sort       string
+	limit      int // negative when unlimited
+	offset     int
+}
+
+// parseSpotSearch reads the filters, sort and page from the query string:
+//
+//	category=drive,rest        (repeatable; any category when absent)
+//	bbox=min_lng,min_lat,max_lng,max_lat
+//	lat=..&lng=..&radius_km=..
+//	sort=distance|popularity|name|newest
+//	limit=..&offset=..         (a negative or absent limit returns every spot)
+func (s *Server) parseSpotSearch(r *http.Request) (spotSearch, error) {
+	query := r.URL.Query()
+	search := spotSearch{area: everywhere}
+
+	for _, v := range query["category"] {
+		for _, c := range strings.Split(v, ",") {
+			category, ok := normalizeCategory(c)
+			if !ok {
+				return spotSearch{}, fmt.Errorf("unknown category %q; use drive, restaurant or rest", c)
+			}
+			search.categories = append(search.categories, category)
+		}
+	}
+
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		var err error
+		if search.lat, err = strconv.ParseFloat(query.Get("lat"), 64); err != nil {
+			return spotSearch{}, fmt.Errorf("invalid lat")
+		}
+		if search.lng, err = strconv.ParseFloat(query.Get("lng"), 64); err != nil {
+			return spotSearch{}, fmt.Errorf("invalid lng")
+		}
+		search.origin = true
+		search.area.Lat, search.area.Lng = search.lat, search.lng
+	}
+
+	if v := query.Get("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		var box [4]float64
+		if len(parts) != 4 {
+			return spotSearch{}, fmt.Errorf("bbox must be min_lng,min_lat,max_lng,max_lat")
+		}
+		for i, p := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return spotSearch{}, fmt.Errorf("bbox must be min_lng,min_lat,max_lng,max_lat")
+			}
+			box[i] = f
+		}
+		if box[0] > box[2] || box[1] > box[3] {
+			return spotSearch{}, fmt.Errorf("bbox minimums must not exceed its maximums")
+		}
+		search.area = search.area.intersect(spotArea{MinLng: box[0], MinLat: box[1], MaxLng: box[2], MaxLat: box[3]})
+	}
+
+	if v := query.Get("radius_km"); v != "" {
+		km, err := strconv.ParseFloat(v, 64)
+		if err != nil || km <= 0 {
+			return spotSearch{}, fmt.Errorf("radius_km must be a positive number")
+		}
+		if !search.origin {
+			return spotSearch{}, fmt.Errorf("radius_km needs lat and lng")
+		}
+		search.radiusKm = km
+		search.area = search.area.intersect(s.areaAround(search.lat, search.lng, km))
+	}
+
+	search.sort = query.Get("sort")
+	switch search.sort {
+	case "":
+		search.sort = sortNewest
+		if search.origin {
+			search.sort = sortDistance
+		}
+	case sortDistance:
+		if !search.origin {
+			return spotSearch{}, fmt.Errorf("sort=distance needs lat and lng")
+		}
+	case sortPopularity, sortName, sortNewest:
+	default:
+		return spotSearch{}, fmt.Errorf("unknown sort %q; use distance, popularity, name or newest", search.sort)
+	}
+
+	var err error
+	if search.limit, err = intParam(r, "limit", -1); err != nil {
+		return spotSearch{}, fmt.Errorf("invalid limit")
+	}
+	if search.offset, err = intParam(r, "offset", 0); err != nil || search.offset < 0 {
+		return spotSearch{}, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return search, nil
+}
+
+// HandleGetSpots lists approved spots matching the filters in the query
+// string; see spotSearch. The X-Total-Count header gives the number of
+// matches before limit and offset apply.
+func (s *Server) HandleGetSpots(w http.ResponseWriter, r *http.Request) {
+	search, err := s.parseSpotSearch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spots, _, total, err := s.searchSpots(r.Context(), search)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	json.NewEncoder(w).Encode(spots)
+}
+
+// searchSpots runs search and returns the page of spots HandleGetSpots
+// responds with: []dbgen.Spot without an origin, []SpotWithDistance with
+// one. n is how many spots the page holds and total how many matched.
+func (s *Server) searchSpots(ctx context.Context, search spotSearch) (spots any, n int, total int64, err error) {
+	// The database pages the results unless the circle of radius_km or
+	// sort=distance, both worked out here, decide which spots make a page.
+	paged := search.radiusKm == 0 && search.sort != sortDistance
+	params := dbgen.SearchSpotsParams{
+		Categories: strings.Join(search.categories, ","),
+		Sort:       search.sort,
+		MinLat:     search.area.MinLat,
+		MaxLat:     search.area.MaxLat,
+		MinLng:     search.area.MinLng,
+		MaxLng:     search.area.MaxLng,
+		Limit:      -1,
+	}
+	if paged {
+		params.Limit, params.Offset = int64(search.limit), int64(search.offset)
+	}
+	found, err := s.Queries.SearchSpots(ctx, params)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	total = int64(len(found))
+	if paged {
+		total, err = s.Queries.CountSearchSpots(ctx, dbgen.CountSearchSpotsParams{
+			Categories: params.Categories,
+			MinLat:     params.MinLat,
+			MaxLat:     params.MaxLat,
+			MinLng:     params.MinLng,
+			MaxLng:     params.MaxLng,
+		})
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if !search.origin {
+		// Without an origin there's no circle or distance sort to apply.
+		return found, len(found), total, nil
+	}
+
+	dists := make(map[int64]float64, len(found))
+	result := make([]SpotWithDistance, 0, len(found))
+	for _, spot := range found {
+		dist := s.distanceKm(search.lat, search.lng, spot.Latitude, spot.Longitude)
+		if search.radiusKm > 0 && dist > search.radiusKm {
+			continue
+		}
+		dists[spot.ID] = dist
+		result = append(result, newSpotWithDistance(spot, dist))
+	}
+	if search.sort == sortDistance {
+		sort.SliceStable(result, func(i, j int) bool {
+			return dists[result[i].ID] < dists[result[j].ID]
+		})
+	}
+	if !paged {
+		total = int64(len(result))
+		result = page(result, search.offset, search.limit)
+	}
+	return result, len(result), total, nil
+}
+
+// page returns the items after skipping offset, at most limit of them when
+// limit is non-negative. It never returns nil, so JSON gets [] not null.
+func page[T any](items []T, offset, limit int) []T {
+	items = items[min(offset, len(items)):]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return items
+}
@@ -0,0 +1,91 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchSpots(t *testing.T) {
+	server, _ := newTestServer(t)
+	// Along a line north of the origin, about 11km apart.
+	pass := seedSpot(t, server, "峠", "drive", 35.1, 139.0)
+	soba := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	cape := seedSpot(t, server, "岬", "drive", 35.3, 139.0)
+	station := seedSpot(t, server, "道の駅", "rest", 35.4, 139.0)
+	east := seedSpot(t, server, "海岸", "drive", 35.1, 139.5)
+	for i, sp := range []int64{pass.ID, soba.ID, cape.ID, station.ID, east.ID} {
+		mustExec(t, server, "UPDATE spots SET created_at = datetime('2026-01-01', ?) WHERE id = ?", fmt.Sprintf("+%d days", i), sp)
+	}
+	mustExec(t, server, "UPDATE spots SET rating_count = 10, avg_rating = 4 WHERE id = ?", cape.ID)
+	mustExec(t, server, "UPDATE spots SET rating_count = 10, avg_rating = 5 WHERE id = ?", soba.ID)
+	mustExec(t, server, "UPDATE spots SET rating_count = 3, avg_rating = 5 WHERE id = ?", east.ID)
+
+	search := func(query string) ([]int64, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/spots"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var spots []SpotWithDistance
+		if err := json.Unmarshal(w.Body.Bytes(), &spots); err != nil {
+			t.Fatalf("%s: decode: %v", query, err)
+		}
+		ids := []int64{}
+		for _, sp := range spots {
+			ids = append(ids, sp.ID)
+		}
+		return ids, w.Header().Get("X-Total-Count")
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []int64
+		total string
+	}{
+		{"", []int64{east.ID, station.ID, cape.ID, soba.ID, pass.ID}, "5"}, // newest first
+		{"?category=drive", []int64{east.ID, cape.ID, pass.ID}, "3"},
+		{"?category=drive,rest&sort=name", []int64{cape.ID, pass.ID, east.ID, station.ID}, "4"},
+		{"?category=restaurant&category=REST", []int64{station.ID, soba.ID}, "2"},
+		{"?sort=popularity", []int64{soba.ID, cape.ID, east.ID, station.ID, pass.ID}, "5"},
+		{"?lat=35.0&lng=139.0", []int64{pass.ID, soba.ID, cape.ID, station.ID, east.ID}, "5"}, // nearest first
+		{"?lat=35.0&lng=139.0&radius_km=25", []int64{pass.ID, soba.ID}, "2"},
+		{"?lat=35.0&lng=139.0&radius_km=35&category=drive", []int64{pass.ID, cape.ID}, "2"},
+		{"?lat=35.0&lng=139.0&radius_km=35&sort=popularity", []int64{soba.ID, cape.ID, pass.ID}, "3"},
+		{"?bbox=138.9,35.15,139.1,35.5", []int64{station.ID, cape.ID, soba.ID}, "3"},
+		// Box and radius intersect rather than one replacing the other.
+		{"?bbox=138.9,35.15,139.1,35.5&lat=35.0&lng=139.0&radius_km=35", []int64{soba.ID, cape.ID}, "2"},
+		{"?bbox=139.4,35.0,139.6,35.2&category=rest", []int64{}, "0"},
+		{"?lat=35.0&lng=139.0&limit=2&offset=1", []int64{soba.ID, cape.ID}, "5"},
+		{"?sort=name&limit=2&offset=4", []int64{station.ID}, "5"},
+		{"?lat=35.0&lng=139.0&sort=name&limit=2&offset=1", []int64{pass.ID, east.ID}, "5"},
+		{"?category=drive&limit=1", []int64{east.ID}, "3"},
+		{"?offset=10", []int64{}, "5"},
+	} {
+		got, total := search(tc.query)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) || total != tc.total {
+			t.Errorf("%s: want %v (total %s), got %v (total %s)", tc.query, tc.want, tc.total, got, total)
+		}
+	}
+
+	for _, query := range []string{
+		"?category=bar",
+		"?radius_km=10",
+		"?sort=distance",
+		"?sort=rating",
+		"?lat=35.0&lng=139.0&radius_km=-1",
+		"?bbox=139.1,35.0,138.9,35.5",
+		"?bbox=1,2,3",
+		"?limit=ten",
+		"?offset=-1",
+	} {
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/spots"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
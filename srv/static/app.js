@@ -25,12 +25,25 @@ const categoryLabels = {
 
 // Initialize
 document.addEventListener('DOMContentLoaded', () => {
+    loadConfig();
     initMap();
     getCurrentLocation();
     setupEventListeners();
     setDefaultTimes();
 });
 
+// Use the server's category labels so the UI matches the AI's wording
+async function loadConfig() {
+    try {
+        const response = await fetch('/api/config');
+        if (!response.ok) return;
+        const config = await response.json();
+        Object.assign(categoryLabels, config.category_labels);
+    } catch (error) {
+        console.error('Failed to load config:', error);
+    }
+}
+
 function initMap() {
     map = L.map('map').setView([35.6762, 139.6503], 10);
     L.tileLayer('https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png', {
@@ -284,7 +297,7 @@ function renderRoute() {
                     <div class="timeline-header">
                         <span class="timeline-time">${stop.arrival_time || ''}</span>
                         <span class="timeline-label">${label}</span>
-                        ${stop.distance_from_prev ? `<span class="timeline-distance">${stop.distance_from_prev.toFixed(1)}km</span>` : ''}
+                        ${stop.distance_from_prev != null ? `<span class="timeline-distance">${stop.distance_from_prev.toFixed(1)}km</span>` : ''}
                         ${editable ? '<span class="edit-hint">タップで編集</span>' : ''}
                     </div>
                     <div class="timeline-name">${escapeHtml(stop.name)}</div>
@@ -349,7 +362,7 @@ function renderRouteOnMap() {
             .bindPopup(`
                 <strong>${stop.arrival_time || ''} ${escapeHtml(stop.name)}</strong><br>
                 ${icon} ${label}
-                ${stop.distance_from_prev ? `<br>前の地点から ${stop.distance_from_prev.toFixed(1)}km` : ''}
+                ${stop.distance_from_prev != null ? `<br>前の地点から ${stop.distance_from_prev.toFixed(1)}km` : ''}
             `);
         
         routeMarkers.push(marker);
@@ -0,0 +1,140 @@
+package srv
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// StayRange is the allowed stay at a stop, in minutes.
+type StayRange struct {
+	Min int
+	Max int
+}
+
+// defaultStayLimits keeps AI-supplied stays plausible: nobody spends ten
+// hours at a rest stop.
+var defaultStayLimits = map[string]StayRange{
+	"drive":      {Min: 10, Max: 180},
+	"restaurant": {Min: 30, Max: 120},
+	"rest":       {Min: 10, Max: 60},
+}
+
+// fallbackStay is the stay in minutes at a stop of a category with no
+// default.
+const fallbackStay = 30
+
+// defaultStays is the stay in minutes at a stop the AI gave no duration,
+// by category.
+var defaultStays = map[string]int{
+	"drive":      40,
+	"restaurant": 50,
+	"rest":       20,
+}
+
+// defaultStay returns the stay for a stop of category the AI gave no
+// duration, preferring s.DefaultStays over the defaults.
+func (s *Server) defaultStay(category string) int {
+	if n, ok := s.DefaultStays[category]; ok {
+		return n
+	}
+	if n, ok := defaultStays[category]; ok {
+		return n
+	}
+	return fallbackStay
+}
+
+// spotStay is the stay in minutes at spot for a stop the AI gave no
+// duration: the spot's suggested stay, or its category's default.
+func (s *Server) spotStay(spot dbgen.Spot) int {
+	if spot.SuggestedStayMin != nil && *spot.SuggestedStayMin > 0 {
+		return int(*spot.SuggestedStayMin)
+	}
+	return s.defaultStay(spot.Category)
+}
+
+// stayLimit returns the allowed stay for category, preferring
+// s.StayLimits over the defaults.
+func (s *Server) stayLimit(category string) (StayRange, bool) {
+	if r, ok := s.StayLimits[category]; ok {
+		return r, true
+	}
+	r, ok := defaultStayLimits[category]
+	return r, ok
+}
+
+// clampStays clamps each AI-supplied stay to its stop's category range,
+// logging the values it changes. stayDurations is modified in place.
+func (s *Server) clampStays(routeIDs []int64, stayDurations []int, spotMap map[int64]dbgen.Spot) {
+	for i, id := range routeIDs {
+		if i >= len(stayDurations) {
+			break
+		}
+		spot, ok := spotMap[id]
+		if !ok {
+			continue
+		}
+		r, ok := s.stayLimit(spot.Category)
+		if !ok {
+			continue
+		}
+		if stay := min(max(stayDurations[i], r.Min), r.Max); stay != stayDurations[i] {
+			slog.Warn("Clamping AI stay duration", "id", id, "category", spot.Category, "stay", stayDurations[i], "clamped", stay)
+			stayDurations[i] = stay
+		}
+	}
+}
+
+// ParseStayLimits parses "category=min-max" pairs separated by commas, e.g.
+// "rest=10-45,restaurant=30-90".
+func ParseStayLimits(v string) (map[string]StayRange, error) {
+	limits := make(map[string]StayRange)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cat, bounds, ok := strings.Cut(part, "=")
+		lo, hi, ok2 := strings.Cut(bounds, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("stay limit %q: want category=min-max", part)
+		}
+		minStay, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		maxStay, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || minStay < 0 || minStay > maxStay {
+			return nil, fmt.Errorf("stay limit %q: want 0 <= min <= max minutes", part)
+		}
+		cat = strings.TrimSpace(cat)
+		if !validCategories[cat] {
+			return nil, fmt.Errorf("stay limit %q: unknown category %q", part, cat)
+		}
+		limits[cat] = StayRange{Min: minStay, Max: maxStay}
+	}
+	return limits, nil
+}
+
+// ParseDefaultStays parses "category=minutes" pairs separated by commas,
+// e.g. "drive=60,rest=15".
+func ParseDefaultStays(v string) (map[string]int, error) {
+	stays := make(map[string]int)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cat, n, ok := strings.Cut(part, "=")
+		cat = strings.TrimSpace(cat)
+		stay, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || err != nil || stay <= 0 {
+			return nil, fmt.Errorf("default stay %q: want category=minutes", part)
+		}
+		if !validCategories[cat] {
+			return nil, fmt.Errorf("default stay %q: unknown category %q", part, cat)
+		}
+		stays[cat] = stay
+	}
+	return stays, nil
+}
@@ -0,0 +1,182 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRouteClampsStayDurations(t *testing.T) {
+	server, llm := newTestServer(t)
+	drive := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	rest := seedSpot(t, server, "道の駅", "rest", 35.05, 139.05)
+	lake := seedSpot(t, server, "湖畔", "drive", 35.00, 139.05)
+
+	include := true
+	route := func(stays []int) []RouteStop {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{
+			"route_ids":      []int64{drive.ID, rest.ID, lake.ID},
+			"stay_durations": stays,
+			"message":        "ok",
+		})
+		llm.response = string(b)
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, IncludeRest: &include})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Stops) != 5 {
+			t.Fatalf("expected 3 stops, got %+v", resp.Stops)
+		}
+		return resp.Stops[1:4]
+	}
+	stays := func(stops []RouteStop) [3]int {
+		return [3]int{stops[0].stayMinutes(), stops[1].stayMinutes(), stops[2].stayMinutes()}
+	}
+
+	if got := stays(route([]int{600, 600, -5})); got != [3]int{180, 60, 10} {
+		t.Errorf("expected the default limits to clamp to [180 60 10], got %v", got)
+	}
+	if got := stays(route([]int{45, 20, 90})); got != [3]int{45, 20, 90} {
+		t.Errorf("expected in-range stays unchanged, got %v", got)
+	}
+
+	server.StayLimits = map[string]StayRange{"rest": {Min: 5, Max: 15}}
+	if got := stays(route([]int{600, 600, 1})); got != [3]int{180, 15, 10} {
+		t.Errorf("expected the configured rest limit, got %v", got)
+	}
+}
+
+func TestParseStayLimits(t *testing.T) {
+	got, err := ParseStayLimits(" rest=10-45, restaurant=30-90 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["rest"] != (StayRange{10, 45}) || got["restaurant"] != (StayRange{30, 90}) || len(got) != 2 {
+		t.Errorf("unexpected limits %v", got)
+	}
+	for _, bad := range []string{"rest", "rest=10", "rest=45-10", "museum=10-20", "rest=a-b"} {
+		if _, err := ParseStayLimits(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRouteUsesSuggestedStay(t *testing.T) {
+	server, llm := newTestServer(t)
+	onsen := seedSpot(t, server, "日帰り温泉", "drive", 35.05, 139.00)
+	mustExec(t, server, "UPDATE spots SET suggested_stay_min = 90 WHERE id = ?", onsen.ID)
+	lookout := seedSpot(t, server, "展望台", "drive", 35.00, 139.05)
+
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, onsen.ID, lookout.ID)
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("route: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Stops) != 4 {
+		t.Fatalf("expected 2 stops, got %+v", resp.Stops)
+	}
+	if got := resp.Stops[1].stayMinutes(); got != 90 {
+		t.Errorf("expected the spot's suggested 90 minute stay, got %d", got)
+	}
+	if got := resp.Stops[2].stayMinutes(); got != server.defaultStay("drive") {
+		t.Errorf("expected the category default without a suggestion, got %d", got)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, "[滞在目安 90分]") {
+		t.Errorf("expected the suggested stay in the prompt, got:\n%s", prompt)
+	}
+
+	// The AI's own durations still win
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [45], "message": "ok"}`, onsen.ID)
+	w = postJSON(t, server, "/api/route", "user-b", RouteRequest{Lat: 35.0, Lng: 139.0})
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Stops) != 3 || resp.Stops[1].stayMinutes() != 45 {
+		t.Errorf("expected the AI's 45 minute stay, got %s", w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		spot int64
+		want int
+	}{{onsen.ID, 90}, {lookout.ID, server.defaultStay("drive")}} {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/spots/%d", tc.spot), nil)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		var detail SpotDetail
+		if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil || detail.SuggestedStayMin != tc.want {
+			t.Errorf("spot %d: expected suggested_stay_min %d, got %s", tc.spot, tc.want, w.Body.String())
+		}
+	}
+
+	for _, stay := range []int{0, -10, maxSuggestedStayMin + 1} {
+		w := postJSON(t, server, "/api/spots", "user-a", map[string]any{"name": "滝", "category": "drive", "latitude": 35.1, "longitude": 139.1, "suggested_stay_min": stay})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("suggested_stay_min %d: expected 400, got %d", stay, w.Code)
+		}
+	}
+}
+
+func TestConfiguredDefaultStays(t *testing.T) {
+	server, llm := newTestServer(t)
+	server.DefaultStays = map[string]int{"drive": 65, "rest": 12}
+	lookout := seedSpot(t, server, "展望台", "drive", 35.05, 139.00)
+	cafe := seedSpot(t, server, "カフェ", "rest", 35.00, 139.05)
+
+	if got := server.defaultStay("drive"); got != 65 {
+		t.Errorf("expected the configured drive default, got %d", got)
+	}
+	if got := server.defaultStay("restaurant"); got != defaultStays["restaurant"] {
+		t.Errorf("expected the built-in restaurant default, got %d", got)
+	}
+
+	include := true
+	llm.response = fmt.Sprintf(`{"route_ids": [%d, %d], "message": "ok"}`, lookout.ID, cafe.ID)
+	w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, IncludeRest: &include})
+	var resp RouteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("route: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Stops) != 4 {
+		t.Fatalf("expected 2 stops, got %+v", resp.Stops)
+	}
+	if got := [2]int{resp.Stops[1].stayMinutes(), resp.Stops[2].stayMinutes()}; got != [2]int{65, 12} {
+		t.Errorf("expected the configured stays [65 12], got %v", got)
+	}
+	if prompt := llm.lastPrompt(); !strings.Contains(prompt, "ドライブ65分") || !strings.Contains(prompt, "休憩12分") {
+		t.Errorf("expected the configured stays in the prompt, got:\n%s", prompt)
+	}
+
+	// A route edit without durations falls back to the same values
+	w = postJSON(t, server, "/api/route/modify", "user-a", map[string]any{
+		"lat": 35.0, "lng": 139.0, "action": "skip", "target_id": lookout.ID,
+		"current_route": []map[string]any{{"id": lookout.ID}, {"id": cafe.ID}},
+	})
+	resp = RouteResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("modify: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Stops) != 3 || resp.Stops[1].stayMinutes() != 12 {
+		t.Errorf("expected the configured rest stay after the edit, got %+v", resp.Stops)
+	}
+}
+
+func TestParseDefaultStays(t *testing.T) {
+	got, err := ParseDefaultStays(" drive=60, rest=15 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["drive"] != 60 || got["rest"] != 15 || len(got) != 2 {
+		t.Errorf("unexpected stays %v", got)
+	}
+	for _, bad := range []string{"drive", "drive=0", "drive=-5", "museum=10", "rest=a"} {
+		if _, err := ParseDefaultStays(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// nearestSpotSample is how many roughly nearest spots are measured exactly
+// to find the nearest one.
+const nearestSpotSample = 20
+
+// RouteSuggestion describes the nearest drive spot when none is in reach,
+// and what would bring it in reach.
+type RouteSuggestion struct {
+	SpotID     int64   `json:"spot_id"`
+	SpotName   string  `json:"spot_name"`
+	DistanceKm float64 `json:"distance_km"`
+
+	// ReturnTime ("HH:MM") is the earliest return time that reaches the
+	// spot; omitted when time isn't the limit or a day trip can't reach it.
+	ReturnTime string `json:"return_time,omitempty"`
+
+	// MaxTotalKm is the smallest max_total_km that reaches the spot;
+	// omitted unless the request's limit is in the way.
+	MaxTotalKm float64 `json:"max_total_km,omitempty"`
+}
+
+// suggestReach finds the nearest drive spot meeting req's accessibility and
+// difficulty limits and works out how to reach it, for a route request that
+// found no drive spot. It returns nil and a hint if there's nothing to
+// suggest.
+func (s *Server) suggestReach(ctx context.Context, req RouteRequest, depMinutes int, availableHours float64) (*RouteSuggestion, string) {
+	spots, err := s.Queries.GetNearestSpotsByCategory(ctx, dbgen.GetNearestSpotsByCategoryParams{
+		Lat:      req.Lat,
+		Lng:      req.Lng,
+		Category: "drive",
+		Limit:    nearestSpotSample,
+	})
+	if err != nil {
+		slog.Warn("find nearest drive spot", "error", err)
+		return nil, ""
+	}
+	var accessible []dbgen.Spot
+	for _, spot := range spots {
+		if s.meetsAccessibility(spot, req.Accessibility) && withinDifficulty(spot, req.MaxDifficulty) {
+			accessible = append(accessible, spot)
+		}
+	}
+	nearest, dist, ok := s.nearestSpot(accessible, req.Lat, req.Lng)
+	if !ok {
+		if len(spots) > 0 {
+			return nil, "バリアフリーや道の難しさの条件を緩めてみてください。"
+		}
+		return nil, ""
+	}
+
+	sug := &RouteSuggestion{SpotID: nearest.ID, SpotName: nearest.Name, DistanceKm: math.Round(dist*10) / 10}
+	hint := fmt.Sprintf("最寄りのドライブスポット「%s」は約%.1fkm先です。", nearest.Name, sug.DistanceKm)
+
+	// Invert the reach in generateRoute: half the time is driving, and the
+	// farthest stop is 1/RouteReachDivisor of the driving distance away.
+	neededHours := dist * s.routeReachDivisor() / (avgSpeedKmh * 0.5)
+	legs := s.routeLegs(ctx, req.RoutingProfile)
+	if deadline, ok := s.returnDeadline(req, depMinutes); ok && !s.returnsInTime(legs, req.Lat, req.Lng, nearest, depMinutes, deadline) {
+		// The round trip itself doesn't fit before the return deadline.
+		tripHours := float64(s.roundTripMinutes(legs, req.Lat, req.Lng, nearest)) / 60
+		neededHours = math.Max(neededHours, tripHours)
+		availableHours = math.Min(availableHours, float64(deadline-depMinutes)/60)
+	}
+	if neededHours > availableHours {
+		// Round up to the half hour
+		returnMin := depMinutes + int(math.Ceil(neededHours*2))*30
+		if returnMin < 24*60 {
+			sug.ReturnTime = minutesToTime(returnMin)
+			hint += fmt.Sprintf("帰着時刻を%s以降にすると候補に入ります。", sug.ReturnTime)
+		} else {
+			hint += "日帰りで行ける距離ではありません。"
+		}
+	}
+	if req.MaxTotalKm > 0 && dist > req.MaxTotalKm/2 {
+		sug.MaxTotalKm = math.Ceil(dist * 2)
+		hint += fmt.Sprintf("総距離の上限を%.0fkm以上にすると候補に入ります。", sug.MaxTotalKm)
+	}
+	return sug, hint
+}
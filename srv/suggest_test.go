@@ -0,0 +1,71 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEmptyRouteSuggestion(t *testing.T) {
+	server, llm := newTestServer(t)
+	generate := func(req RouteRequest) RouteResponse {
+		t.Helper()
+		req.Lat, req.Lng, req.DepartureTime = 35.0, 139.0, "09:00"
+		w := postJSON(t, server, "/api/route", "user-a", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if resp := generate(RouteRequest{}); len(resp.Stops) != 0 || resp.Suggestion != nil {
+		t.Errorf("expected no suggestion without any drive spot, got %+v", resp)
+	}
+
+	// The default 8 hours reach 53km; a closer restaurant doesn't count.
+	seedSpot(t, server, "近所の食堂", "restaurant", 35.01, 139.0)
+	far := seedSpot(t, server, "高原の展望台", "drive", 35.0+59.4/111.195, 139.0)
+	seedSpot(t, server, "もっと遠くの岬", "drive", 36.0, 139.0)
+	resp := generate(RouteRequest{})
+	if len(resp.Stops) != 0 {
+		t.Fatalf("expected an empty route, got %+v", resp.Stops)
+	}
+	want := RouteSuggestion{SpotID: far.ID, SpotName: far.Name, DistanceKm: 59.4, ReturnTime: "18:00"}
+	if resp.Suggestion == nil || *resp.Suggestion != want {
+		t.Errorf("want suggestion %+v, got %+v", want, resp.Suggestion)
+	}
+	for _, s := range []string{"高原の展望台", "約59.4km", "18:00"} {
+		if !strings.Contains(resp.Message, s) {
+			t.Errorf("expected the message to mention %q, got %q", s, resp.Message)
+		}
+	}
+
+	// A total distance cap in the way is suggested too.
+	resp = generate(RouteRequest{ReturnTime: "18:00", MaxTotalKm: 100})
+	if resp.Suggestion == nil || resp.Suggestion.MaxTotalKm != 119 || resp.Suggestion.ReturnTime != "" {
+		t.Errorf("expected only a 119km cap suggested, got %+v", resp.Suggestion)
+	}
+	if !strings.Contains(resp.Message, "119km") {
+		t.Errorf("expected the message to mention 119km, got %q", resp.Message)
+	}
+
+	// Following the suggestion reaches the spot.
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, far.ID)
+	resp = generate(RouteRequest{ReturnTime: "18:00"})
+	if len(resp.Stops) != 3 || resp.Stops[1].ID != far.ID || resp.Suggestion != nil {
+		t.Errorf("expected a route to the suggested spot, got %+v", resp)
+	}
+
+	// Past midnight a day trip can't get there.
+	server.RouteReachDivisor = 9
+	resp = generate(RouteRequest{})
+	if resp.Suggestion == nil || resp.Suggestion.ReturnTime != "" || !strings.Contains(resp.Message, "日帰り") {
+		t.Errorf("expected no return time within the day, got %+v", resp)
+	}
+}
@@ -0,0 +1,122 @@
+package srv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tokenTTL is how long a minted user token is valid.
+const tokenTTL = 90 * 24 * time.Hour
+
+// jwtHeader is the fixed header of the HS256 tokens we mint.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Sub string `json:"sub"`
+	Iat int64  `json:"iat"`
+	Exp int64  `json:"exp"`
+}
+
+// signToken returns an HS256 JWT identifying userID until now+tokenTTL.
+func (s *Server) signToken(userID string, now time.Time) (string, time.Time, error) {
+	exp := now.Add(tokenTTL)
+	claims, err := json.Marshal(tokenClaims{Sub: userID, Iat: now.Unix(), Exp: exp.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + s.tokenSignature(unsigned), exp, nil
+}
+
+func (s *Server) tokenSignature(unsigned string) string {
+	mac := hmac.New(sha256.New, s.TokenSecret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyToken returns the user ID of a token signed with TokenSecret.
+func (s *Server) verifyToken(token string, now time.Time) (string, error) {
+	header, rest, ok := strings.Cut(token, ".")
+	payload, sig, ok2 := strings.Cut(rest, ".")
+	if !ok || !ok2 {
+		return "", errors.New("malformed token")
+	}
+	// Only accept the header we mint, which pins the algorithm.
+	if header != jwtHeader {
+		return "", errors.New("unsupported token header")
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.tokenSignature(header+"."+payload))) {
+		return "", errors.New("bad token signature")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("decode token claims: %w", err)
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", fmt.Errorf("parse token claims: %w", err)
+	}
+	if claims.Sub == "" {
+		return "", errors.New("token has no subject")
+	}
+	if now.Unix() >= claims.Exp {
+		return "", errors.New("token expired")
+	}
+	return claims.Sub, nil
+}
+
+// tokenUserID returns the user named by a valid "Authorization: Bearer"
+// token, if tokens are enabled and the request carries one.
+func (s *Server) tokenUserID(r *http.Request) (string, bool) {
+	if len(s.TokenSecret) == 0 {
+		return "", false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	userID, err := s.verifyToken(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		slog.Debug("ignoring bearer token", "error", err)
+		return "", false
+	}
+	return userID, true
+}
+
+// TokenResponse is a freshly minted user token.
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandleMintToken serves POST /api/token, returning a bearer token for the
+// current user (from a token or cookie), or for a new user. Clients that
+// can't keep cookies send it as "Authorization: Bearer <token>".
+func (s *Server) HandleMintToken(w http.ResponseWriter, r *http.Request) {
+	if len(s.TokenSecret) == 0 {
+		http.Error(w, "token authentication is not enabled", http.StatusNotFound)
+		return
+	}
+	userID := s.getUserID(w, r)
+	if _, err := s.Queries.GetOrCreateUser(r.Context(), userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token, exp, err := s.signToken(userID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, UserID: userID, ExpiresAt: exp.UTC()})
+}
@@ -0,0 +1,106 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBearerTokenIdentity(t *testing.T) {
+	server, _ := newTestServer(t)
+	do := func(method, path, token, cookieUser string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookieUser != "" {
+			req = asUser(req, cookieUser)
+		}
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/token", "", "user-a"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a secret, got %d", w.Code)
+	}
+
+	server.TokenSecret = []byte("test-secret")
+	w := do(http.MethodPost, "/api/token", "", "user-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var minted TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &minted); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if minted.UserID != "user-a" || minted.Token == "" {
+		t.Fatalf("expected a token for the cookie user, got %+v", minted)
+	}
+
+	// The token identifies the user without a cookie, and wins over one.
+	identify := func(token, cookieUser string) (string, bool) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cookieUser != "" {
+			req = asUser(req, cookieUser)
+		}
+		w := httptest.NewRecorder()
+		id := server.getUserID(w, req)
+		return id, len(w.Result().Cookies()) > 0
+	}
+	if id, newCookie := identify(minted.Token, ""); id != "user-a" || newCookie {
+		t.Errorf("expected user-a from the token without a new cookie, got %q (new cookie %v)", id, newCookie)
+	}
+	if id, _ := identify(minted.Token, "user-b"); id != "user-a" {
+		t.Errorf("expected the token to win over the cookie, got %q", id)
+	}
+
+	// Without a usable token, the cookie is used as before.
+	if id, _ := identify("", "user-b"); id != "user-b" {
+		t.Errorf("expected the cookie user, got %q", id)
+	}
+	tampered := minted.Token[:len(minted.Token)-2] + "xx"
+	if id, _ := identify(tampered, "user-b"); id != "user-b" {
+		t.Errorf("expected a tampered token to be ignored, got %q", id)
+	}
+	if id, newCookie := identify("garbage", ""); !strings.HasPrefix(id, "user_") || !newCookie {
+		t.Errorf("expected a new cookie user for a bad token, got %q", id)
+	}
+
+	// A new user without cookie or token gets a token too.
+	w = do(http.MethodPost, "/api/token", "", "")
+	var fresh TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &fresh); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if id, _ := identify(fresh.Token, ""); id != fresh.UserID || id == "user-a" {
+		t.Errorf("expected the new user's token to identify them, got %q for %q", id, fresh.UserID)
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.TokenSecret = []byte("secret-1")
+	now := time.Now()
+	token, _, err := server.signToken("user-a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := server.verifyToken(token, now.Add(time.Hour)); err != nil || id != "user-a" {
+		t.Errorf("expected a valid token, got %q, %v", id, err)
+	}
+	if _, err := server.verifyToken(token, now.Add(tokenTTL)); err == nil {
+		t.Error("expected an expired token to be rejected")
+	}
+	server.TokenSecret = []byte("secret-2")
+	if _, err := server.verifyToken(token, now); err == nil {
+		t.Error("expected a token signed with another secret to be rejected")
+	}
+}
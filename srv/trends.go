@@ -0,0 +1,180 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+const (
+	defaultTrendWindowDays = 180
+	defaultTrendBucketDays = 30
+	maxTrendWindowDays     = 730
+)
+
+// CategoryTrends is the user's visits per category over a rolling window,
+// split into equal buckets, oldest first.
+type CategoryTrends struct {
+	WindowDays int              `json:"window_days"`
+	BucketDays int              `json:"bucket_days"`
+	Buckets    []CategoryBucket `json:"buckets"`
+	// Shifting is set when the favorite category of the most recent bucket
+	// with visits differs from that of the oldest one.
+	Shifting bool `json:"shifting"`
+}
+
+type CategoryBucket struct {
+	Start      string          `json:"start"` // YYYY-MM-DD, inclusive
+	End        string          `json:"end"`   // YYYY-MM-DD, exclusive
+	Categories []CategoryCount `json:"categories"`
+	// Favorite and LeastFavorite compare average ratings, then visits;
+	// empty without visits.
+	Favorite      string `json:"favorite,omitempty"`
+	LeastFavorite string `json:"least_favorite,omitempty"`
+}
+
+type CategoryCount struct {
+	Category  string   `json:"category"`
+	Label     string   `json:"label"`
+	Visits    int64    `json:"visits"`
+	AvgRating *float64 `json:"avg_rating"` // nil when no visit was rated
+}
+
+// HandleCategoryTrends serves GET /api/stats/categories?window_days=&bucket_days=.
+func (s *Server) HandleCategoryTrends(w http.ResponseWriter, r *http.Request) {
+	userID := s.getUserID(w, r)
+
+	windowDays, err := intParam(r, "window_days", defaultTrendWindowDays)
+	if err != nil || windowDays < 1 || windowDays > maxTrendWindowDays {
+		http.Error(w, "window_days must be between 1 and 730", http.StatusBadRequest)
+		return
+	}
+	bucketDays, err := intParam(r, "bucket_days", min(defaultTrendBucketDays, windowDays))
+	if err != nil || bucketDays < 1 || bucketDays > windowDays {
+		http.Error(w, "bucket_days must be between 1 and window_days", http.StatusBadRequest)
+		return
+	}
+
+	trends, err := s.categoryTrends(r.Context(), s.Queries, userID, windowDays, bucketDays, time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trends)
+}
+
+func (s *Server) categoryTrends(ctx context.Context, q *dbgen.Queries, userID string, windowDays, bucketDays int, now time.Time) (CategoryTrends, error) {
+	since := now.AddDate(0, 0, -windowDays)
+	rows, err := q.GetCategoryTrends(ctx, dbgen.GetCategoryTrendsParams{
+		Since:      since.Format(time.DateTime),
+		BucketDays: int64(bucketDays),
+		UserID:     userID,
+		Until:      now.Format(time.DateTime),
+	})
+	if err != nil {
+		return CategoryTrends{}, err
+	}
+
+	trends := CategoryTrends{WindowDays: windowDays, BucketDays: bucketDays}
+	for start := since; start.Before(now); start = start.AddDate(0, 0, bucketDays) {
+		end := start.AddDate(0, 0, bucketDays)
+		if end.After(now) {
+			end = now
+		}
+		trends.Buckets = append(trends.Buckets, CategoryBucket{
+			Start:      start.Format(time.DateOnly),
+			End:        end.Format(time.DateOnly),
+			Categories: []CategoryCount{},
+		})
+	}
+	for _, row := range rows {
+		if row.Bucket < 0 || int(row.Bucket) >= len(trends.Buckets) {
+			continue
+		}
+		b := &trends.Buckets[row.Bucket]
+		b.Categories = append(b.Categories, CategoryCount{
+			Category:  row.Category,
+			Label:     s.categoryLabel(row.Category),
+			Visits:    row.Visits,
+			AvgRating: row.AvgRating,
+		})
+	}
+
+	var first, last string
+	for i := range trends.Buckets {
+		b := &trends.Buckets[i]
+		for _, c := range b.Categories {
+			if b.Favorite == "" || preferCategory(c, categoryCount(b.Categories, b.Favorite)) {
+				b.Favorite = c.Category
+			}
+			if b.LeastFavorite == "" || preferCategory(categoryCount(b.Categories, b.LeastFavorite), c) {
+				b.LeastFavorite = c.Category
+			}
+		}
+		if b.Favorite != "" {
+			if first == "" {
+				first = b.Favorite
+			}
+			last = b.Favorite
+		}
+	}
+	trends.Shifting = first != last
+	return trends, nil
+}
+
+// preferCategory reports whether a is liked more than b: a higher average
+// rating (rated beats unrated), then more visits.
+func preferCategory(a, b CategoryCount) bool {
+	switch {
+	case a.AvgRating != nil && b.AvgRating == nil:
+		return true
+	case a.AvgRating == nil && b.AvgRating != nil:
+		return false
+	case a.AvgRating != nil && *a.AvgRating != *b.AvgRating:
+		return *a.AvgRating > *b.AvgRating
+	}
+	return a.Visits > b.Visits
+}
+
+func categoryCount(counts []CategoryCount, category string) CategoryCount {
+	for _, c := range counts {
+		if c.Category == category {
+			return c
+		}
+	}
+	return CategoryCount{}
+}
+
+// intParam returns the named query parameter as an int, or def if absent.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// floatParam returns the named query parameter as a float64, or def if
+// absent.
+func floatParam(r *http.Request, name string, def float64) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// boolParam returns the named query parameter as a bool, or def if absent.
+func boolParam(r *http.Request, name string, def bool) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(v)
+}
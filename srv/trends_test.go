@@ -0,0 +1,86 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCategoryTrends(t *testing.T) {
+	server, _ := newTestServer(t)
+	drive := seedSpot(t, server, "展望台", "drive", 35.1, 139.0)
+	meal := seedSpot(t, server, "蕎麦屋", "restaurant", 35.2, 139.0)
+	for _, u := range []string{"user-a", "user-b"} {
+		mustExec(t, server, "INSERT INTO users (id) VALUES (?)", u)
+	}
+	visit := func(user string, spotID int64, daysAgo int, rating any) {
+		mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at, rating) VALUES (?, ?, datetime('now', ?), ?)",
+			user, spotID, fmt.Sprintf("-%d days", daysAgo), rating)
+	}
+	visit("user-a", drive.ID, 100, 5) // outside the window
+	visit("user-a", drive.ID, 80, 5)
+	visit("user-a", meal.ID, 75, 2)
+	visit("user-a", drive.ID, 45, nil)
+	visit("user-a", meal.ID, 10, 5)
+	visit("user-a", meal.ID, 8, 4)
+	visit("user-a", drive.ID, 5, 3)
+	visit("user-b", drive.ID, 5, 1)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/api/stats/categories"+query, nil), "user-a")
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, req)
+		return w
+	}
+	w := get("?window_days=90&bucket_days=30")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var trends CategoryTrends
+	if err := json.Unmarshal(w.Body.Bytes(), &trends); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(trends.Buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got %+v", trends.Buckets)
+	}
+
+	type visits map[string]int64
+	counts := func(b CategoryBucket) visits {
+		out := visits{}
+		for _, c := range b.Categories {
+			out[c.Category] = c.Visits
+		}
+		return out
+	}
+	want := []struct {
+		visits                  visits
+		favorite, leastFavorite string
+	}{
+		{visits{"drive": 1, "restaurant": 1}, "drive", "restaurant"},
+		{visits{"drive": 1}, "drive", "drive"},
+		{visits{"drive": 1, "restaurant": 2}, "restaurant", "drive"},
+	}
+	for i, b := range trends.Buckets {
+		if got := counts(b); len(got) != len(want[i].visits) || got["drive"] != want[i].visits["drive"] || got["restaurant"] != want[i].visits["restaurant"] {
+			t.Errorf("bucket %d: expected %v, got %v", i, want[i].visits, got)
+		}
+		if b.Favorite != want[i].favorite || b.LeastFavorite != want[i].leastFavorite {
+			t.Errorf("bucket %d: expected favorite %s / least %s, got %s / %s", i, want[i].favorite, want[i].leastFavorite, b.Favorite, b.LeastFavorite)
+		}
+	}
+	last := trends.Buckets[2].Categories
+	if last[1].Category != "restaurant" || last[1].AvgRating == nil || *last[1].AvgRating != 4.5 || last[1].Label != "食事" {
+		t.Errorf("unexpected restaurant entry %+v", last[1])
+	}
+	if !trends.Shifting {
+		t.Errorf("expected the favorite to have shifted from drive to restaurant")
+	}
+
+	for _, bad := range []string{"?window_days=0", "?window_days=1000", "?window_days=30&bucket_days=31", "?bucket_days=x"} {
+		if w := get(bad); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"fmt"
+	"math"
+)
+
+// tripReachGrowth is how much farther generateRoute looks for spots when the
+// AI's route came out shorter than RouteRequest.MinTotalKm.
+const tripReachGrowth = 1.5
+
+func validateTripRange(req RouteRequest) error {
+	if req.MinTotalKm < 0 || req.MaxTotalKm < 0 {
+		return fmt.Errorf("min_total_km and max_total_km must be >= 0")
+	}
+	if req.MaxTotalKm > 0 && req.MinTotalKm > req.MaxTotalKm {
+		return fmt.Errorf("min_total_km (%v) is above max_total_km (%v)", req.MinTotalKm, req.MaxTotalKm)
+	}
+	return nil
+}
+
+// tripTooShort and tripTooLong report whether a route of km falls outside
+// the request's total distance range.
+func (req RouteRequest) tripTooShort(km float64) bool {
+	return req.MinTotalKm > 0 && km < req.MinTotalKm
+}
+
+func (req RouteRequest) tripTooLong(km float64) bool {
+	return req.MaxTotalKm > 0 && km > req.MaxTotalKm
+}
+
+// tripRangeLabel describes the total distance range, e.g. "30〜80km".
+func (req RouteRequest) tripRangeLabel() string {
+	switch {
+	case req.MinTotalKm > 0 && req.MaxTotalKm > 0:
+		return fmt.Sprintf("%.0f〜%.0fkm", req.MinTotalKm, req.MaxTotalKm)
+	case req.MinTotalKm > 0:
+		return fmt.Sprintf("%.0fkm以上", req.MinTotalKm)
+	case req.MaxTotalKm > 0:
+		return fmt.Sprintf("%.0fkm以内", req.MaxTotalKm)
+	}
+	return ""
+}
+
+// tripRangePrompt asks the AI to keep the total distance in range.
+func (req RouteRequest) tripRangePrompt() string {
+	label := req.tripRangeLabel()
+	if label == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+【総距離の指定】
+- 出発から帰着までの総距離を%sにすること
+`, label)
+}
+
+// tripReach caps the candidate radius so no stop alone makes the round trip
+// longer than MaxTotalKm.
+func (req RouteRequest) tripReach(reach float64) float64 {
+	if req.MaxTotalKm > 0 {
+		return math.Min(reach, req.MaxTotalKm/2)
+	}
+	return reach
+}
@@ -0,0 +1,81 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRouteTripRange(t *testing.T) {
+	server, llm := newTestServer(t)
+	// Two hours out gives a 13km reach, 20km once expanded.
+	near := seedSpot(t, server, "近所の公園", "drive", 35.05, 139.00)
+	beside := seedSpot(t, server, "川沿い", "drive", 35.00, 139.06)
+	far := seedSpot(t, server, "遠くの岬", "drive", 35.15, 139.00)
+	routeJSON := func(ids ...int64) string {
+		b, _ := json.Marshal(map[string]any{"route_ids": ids, "message": "ok"})
+		return string(b)
+	}
+	generate := func(req RouteRequest) RouteResponse {
+		t.Helper()
+		req.Lat, req.Lng, req.DepartureTime, req.ReturnTime = 35.0, 139.0, "09:00", "11:00"
+		w := postJSON(t, server, "/api/route", "user-a", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp RouteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("too short expands once", func(t *testing.T) {
+		before := llm.calls()
+		llm.responses = []string{routeJSON(near.ID), routeJSON(far.ID)}
+		resp := generate(RouteRequest{MinTotalKm: 30})
+		if got := llm.calls() - before; got != 2 {
+			t.Fatalf("expected 2 LLM calls, got %d", got)
+		}
+		if len(resp.Stops) != 3 || resp.Stops[1].ID != far.ID || resp.RouteID == 0 {
+			t.Errorf("expected the farther route to be saved, got %+v", resp)
+		}
+		if prompt := llm.lastPrompt(); !strings.Contains(prompt, far.Name) || !strings.Contains(prompt, "30km以上") {
+			t.Errorf("expected the expanded candidates and range in the prompt, got:\n%s", prompt)
+		}
+	})
+
+	t.Run("still too short", func(t *testing.T) {
+		before := llm.calls()
+		llm.responses = []string{routeJSON(near.ID), routeJSON(near.ID)}
+		resp := generate(RouteRequest{MinTotalKm: 30})
+		if got := llm.calls() - before; got != 2 {
+			t.Errorf("expected a single retry, got %d LLM calls", got)
+		}
+		if len(resp.Stops) != 0 || resp.RouteID != 0 {
+			t.Errorf("expected the short route to be rejected, got %+v", resp)
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		before := llm.calls()
+		llm.responses = []string{routeJSON(near.ID, beside.ID)}
+		resp := generate(RouteRequest{MaxTotalKm: 15})
+		if got := llm.calls() - before; got != 1 {
+			t.Errorf("expected no retry, got %d LLM calls", got)
+		}
+		if len(resp.Stops) != 0 || resp.RouteID != 0 || !strings.Contains(resp.Message, "15km以内") {
+			t.Errorf("expected the long route to be rejected, got %+v", resp)
+		}
+		if strings.Contains(llm.lastPrompt(), far.Name) {
+			t.Errorf("expected spots beyond half the maximum to be left out")
+		}
+	})
+
+	for _, req := range []RouteRequest{{MinTotalKm: -1}, {MinTotalKm: 50, MaxTotalKm: 20}} {
+		if w := postJSON(t, server, "/api/route", "user-a", req); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %v-%vkm, got %d", req.MinTotalKm, req.MaxTotalKm, w.Code)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// WithTx runs fn with queries bound to a new transaction, committing if fn
+// returns nil and rolling back otherwise. Use it for handlers that write
+// more than once, so a failure part way leaves nothing behind.
+func (s *Server) WithTx(ctx context.Context, fn func(q *dbgen.Queries) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(s.Queries.WithTx(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
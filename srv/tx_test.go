@@ -0,0 +1,64 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestWithTx(t *testing.T) {
+	server, _ := newTestServer(t)
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		err := server.WithTx(ctx, func(q *dbgen.Queries) error {
+			_, err := q.GetOrCreateUser(ctx, "user-commit")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WithTx: %v", err)
+		}
+		if n := countRows(t, server, "users WHERE id = 'user-commit'"); n != 1 {
+			t.Errorf("expected the user to be committed, got %d rows", n)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		err := server.WithTx(ctx, func(q *dbgen.Queries) error {
+			if _, err := q.GetOrCreateUser(ctx, "user-rollback"); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("expected fn's error back, got %v", err)
+		}
+		if n := countRows(t, server, "users WHERE id = 'user-rollback'"); n != 0 {
+			t.Errorf("expected the user to be rolled back, got %d rows", n)
+		}
+	})
+
+	t.Run("feedback rolls back on failure", func(t *testing.T) {
+		// An unknown spot fails the visit insert after the user was created.
+		w := postJSON(t, server, "/api/feedback", "user-feedback", map[string]any{"spot_id": 999, "rating": 5})
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+		}
+		if n := countRows(t, server, "users WHERE id = 'user-feedback'"); n != 0 {
+			t.Errorf("expected no user left behind, got %d rows", n)
+		}
+
+		spot := seedSpot(t, server, "峠", "drive", 35.0, 139.0)
+		if w := postJSON(t, server, "/api/feedback", "user-feedback", map[string]any{"spot_id": spot.ID, "rating": 4}); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		got, err := dbgen.New(server.DB).GetSpotByID(context.Background(), spot.ID)
+		if err != nil || got.RatingCount != 1 || got.AvgRating != 4 {
+			t.Errorf("expected the rating to be committed with the visit, got %+v (%v)", got, err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// CoordinateMismatch is the 409 response when a spot's coordinates resolve
+// to a place that doesn't match its name or address.
+type CoordinateMismatch struct {
+	Error         string `json:"error"`
+	ResolvedPlace string `json:"resolved_place"`
+}
+
+// placeMatches reports whether any component of a reverse-geocoded place
+// ("芦ノ湖, 箱根町, 足柄下郡, 神奈川県, 250-0522, 日本") other than the
+// country and postcode appears in what the user typed.
+func placeMatches(place, typed string) bool {
+	typed = strings.ToLower(typed)
+	parts := strings.Split(place, ",")
+	if len(parts) > 1 {
+		parts = parts[:len(parts)-1] // the country matches too much
+	}
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if utf8.RuneCountInString(part) < 2 || strings.ContainsAny(part, "0123456789") {
+			continue
+		}
+		if strings.Contains(typed, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCoordinates reverse geocodes (lat, lng) and compares the place
+// with the spot's name and address. verified is nil when the check can't
+// run: VerifyCoordinates is off, the Geocoder can't reverse geocode, or the
+// lookup fails. On a mismatch, place is the resolved place.
+func (s *Server) verifyCoordinates(ctx context.Context, req CreateSpotRequest, lat, lng float64) (verified *bool, place string) {
+	rg, ok := s.Geocoder.(ReverseGeocoder)
+	if !s.VerifyCoordinates || !ok {
+		return nil, ""
+	}
+	place, err := rg.ReverseGeocode(ctx, lat, lng)
+	if err != nil {
+		slog.Warn("reverse geocode spot", "lat", lat, "lng", lng, "error", err)
+		return nil, ""
+	}
+	typed := req.Name
+	if req.Address != nil {
+		typed += " " + *req.Address
+	}
+	match := placeMatches(place, typed)
+	return &match, place
+}
+
+// writeCoordinateMismatch writes the 409 for coordinates that resolved to
+// place.
+func writeCoordinateMismatch(w http.ResponseWriter, place string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(CoordinateMismatch{
+		Error:         "the coordinates don't match the spot's name or address; resend with force to save them anyway",
+		ResolvedPlace: place,
+	})
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,104 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// reverseGeocoder names every coordinate place.
+type reverseGeocoder struct {
+	fakeGeocoder
+	place string
+}
+
+func (g *reverseGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	return g.place, nil
+}
+
+func TestVerifyCoordinates(t *testing.T) {
+	server, _ := newTestServer(t)
+	geo := &reverseGeocoder{place: "大通公園, 中央区, 札幌市, 石狩振興局, 北海道, 060-0042, 日本"}
+	server.Geocoder = geo
+	server.VerifyCoordinates = true
+	server.DuplicateRadiusKm = 0
+
+	addr := "神奈川県足柄下郡箱根町元箱根"
+	lat, lng := 35.2044, 139.0250
+	body := CreateSpotRequest{Name: "箱根神社", Category: "drive", Address: &addr, Latitude: &lat, Longitude: &lng}
+	create := func(body CreateSpotRequest) dbgen.Spot {
+		t.Helper()
+		w := postJSON(t, server, "/api/spots", "user-a", body)
+		var spot dbgen.Spot
+		if err := json.Unmarshal(w.Body.Bytes(), &spot); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create: %d %s", w.Code, w.Body.String())
+		}
+		return spot
+	}
+
+	w := postJSON(t, server, "/api/spots", "user-a", body)
+	var mismatch CoordinateMismatch
+	if err := json.Unmarshal(w.Body.Bytes(), &mismatch); err != nil || w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for coordinates in Sapporo, got %d %s", w.Code, w.Body.String())
+	}
+	if mismatch.ResolvedPlace != geo.place {
+		t.Errorf("expected the resolved place, got %q", mismatch.ResolvedPlace)
+	}
+
+	body.Force = true
+	if spot := create(body); spot.CoordinatesVerified == nil || *spot.CoordinatesVerified {
+		t.Errorf("expected a forced spot stored unverified, got %v", spot.CoordinatesVerified)
+	}
+
+	geo.place = "箱根神社, 元箱根, 箱根町, 足柄下郡, 神奈川県, 250-0522, 日本"
+	body.Force = false
+	spot := create(body)
+	if spot.CoordinatesVerified == nil || !*spot.CoordinatesVerified {
+		t.Errorf("expected matching coordinates verified, got %v", spot.CoordinatesVerified)
+	}
+
+	update := func(body UpdateSpotRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, asUser(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/spots/%d", spot.ID), bytes.NewReader(b)), "user-a"))
+		return w
+	}
+	geo.place = "大通公園, 中央区, 札幌市, 石狩振興局, 北海道, 060-0042, 日本"
+	if w := update(UpdateSpotRequest(body)); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an edit that no longer matches, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Without the check, edits that keep the coordinates keep the verdict
+	// and new spots are left unchecked.
+	server.VerifyCoordinates = false
+	desc := "湖畔の神社"
+	edited := UpdateSpotRequest(body)
+	edited.Description = &desc
+	if w := update(edited); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"coordinates_verified":true`)) {
+		t.Errorf("expected the verdict kept, got %d %s", w.Code, w.Body.String())
+	}
+	if spot := create(body); spot.CoordinatesVerified != nil {
+		t.Errorf("expected no verdict with the check off, got %v", *spot.CoordinatesVerified)
+	}
+}
+
+func TestPlaceMatches(t *testing.T) {
+	place := "芦ノ湖, 箱根町, 足柄下郡, 神奈川県, 250-0522, 日本"
+	for typed, want := range map[string]bool{
+		"芦ノ湖スカイライン":      true,
+		"大涌谷 神奈川県箱根町仙石原": true,
+		"札幌 日本":          false, // the country alone isn't enough
+		"250-0522":       false,
+	} {
+		if got := placeMatches(place, typed); got != want {
+			t.Errorf("placeMatches(%q) = %v, want %v", typed, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package srv
+
+// badWeather lists RecommendRequest.Weather values that favor indoor spots.
+var badWeather = map[string]bool{
+	"rain":  true,
+	"snow":  true,
+	"storm": true,
+}
+
+// weatherScore rates how well a spot suits the weather: in bad weather indoor
+// spots score 1 and outdoor spots -1. Spots with unknown indoor status, and
+// all spots in fine or unknown weather, score 0.
+func weatherScore(spot SpotWithDistance, weather string) int {
+	if !badWeather[weather] || spot.Indoor == nil {
+		return 0
+	}
+	if *spot.Indoor {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,95 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestSpotIndoorRoundTrip(t *testing.T) {
+	server, _ := newTestServer(t)
+	yes, no := true, false
+
+	want := map[string]*bool{"水族館": &yes, "展望台": &no, "謎の場所": nil}
+	lat, lng := 35.0, 139.0
+	for name, indoor := range want {
+		lat += 0.1
+		w := postJSON(t, server, "/api/spots", "user-a", CreateSpotRequest{
+			Name: name, Category: "drive", Latitude: &lat, Longitude: &lng, Indoor: indoor,
+		})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: expected 201, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	// Users' submissions are only listed once approved
+	mustExec(t, server, "UPDATE spots SET status = ?", SpotApproved)
+
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/spots", nil))
+	var spots []dbgen.Spot
+	if err := json.Unmarshal(w.Body.Bytes(), &spots); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(spots) != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(spots))
+	}
+	for _, sp := range spots {
+		got, exp := sp.Indoor, want[sp.Name]
+		if (got == nil) != (exp == nil) || (got != nil && *got != *exp) {
+			t.Errorf("%s: expected indoor %v, got %v", sp.Name, exp, got)
+		}
+	}
+}
+
+func TestRecommendPrefersIndoorInBadWeather(t *testing.T) {
+	server, llm := newTestServer(t)
+	outdoor := seedSpot(t, server, "海辺の展望台", "drive", 35.10, 139.00)
+	unknown := seedSpot(t, server, "古い町並み", "drive", 35.11, 139.01)
+	indoor := seedSpot(t, server, "ガラス美術館", "drive", 35.12, 139.02)
+	mustExec(t, server, "UPDATE spots SET indoor = FALSE WHERE id = ?", outdoor.ID)
+	mustExec(t, server, "UPDATE spots SET indoor = TRUE WHERE id = ?", indoor.ID)
+	llm.response = fmt.Sprintf(`{"spot_ids": [%d], "message": "ok"}`, indoor.ID)
+
+	prompt := func(weather string) string {
+		t.Helper()
+		w := postJSON(t, server, "/api/recommend", "user-a", RecommendRequest{Lat: 35.0, Lng: 139.0, Weather: weather})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return llm.lastPrompt()
+	}
+
+	rainy := prompt("rain")
+	i, u, o := strings.Index(rainy, indoor.Name), strings.Index(rainy, unknown.Name), strings.Index(rainy, outdoor.Name)
+	if !(i < u && u < o) {
+		t.Errorf("expected indoor, unknown, outdoor order in rainy prompt, got positions %d %d %d", i, u, o)
+	}
+	if !strings.Contains(rainy, "[屋内]のスポットを優先") {
+		t.Errorf("expected the bad-weather rule in the prompt")
+	}
+	if strings.Contains(prompt("clear"), "[屋内]のスポットを優先") {
+		t.Errorf("expected no bad-weather rule in clear weather")
+	}
+
+	for _, tc := range []struct {
+		indoor  *bool
+		weather string
+		want    int
+	}{
+		{&[]bool{true}[0], "rain", 1},
+		{&[]bool{false}[0], "snow", -1},
+		{nil, "rain", 0},
+		{&[]bool{false}[0], "clear", 0},
+		{&[]bool{true}[0], "", 0},
+	} {
+		spot := SpotWithDistance{Spot: dbgen.Spot{Indoor: tc.indoor}}
+		if got := weatherScore(spot, tc.weather); got != tc.want {
+			t.Errorf("weatherScore(%v, %q) = %d, want %d", tc.indoor, tc.weather, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// routeCandidateCaps is how many spots of each category the route prompt
+// lists at weight 1.
+var routeCandidateCaps = map[string]int{"drive": 20, "restaurant": 15, "rest": 15}
+
+// maxCategoryWeight keeps a single category from crowding out the prompt.
+const maxCategoryWeight = 3
+
+// recentCategoryWeight scales the weight of categories the user visited
+// lately when a route request sets diversify_from_history.
+const recentCategoryWeight = 0.5
+
+// weight returns the request's weight for category, 1 when unset, played
+// down if the user visited the category lately.
+func (req RouteRequest) weight(category string) float64 {
+	w, ok := req.CategoryWeights[category]
+	if !ok {
+		w = 1
+	}
+	if req.recentCategories[category] {
+		w *= recentCategoryWeight
+	}
+	return w
+}
+
+// recentVisitCategories returns the categories the user visited within
+// RecentCategoryWindow.
+func (s *Server) recentVisitCategories(ctx context.Context, userID string) map[string]bool {
+	cats, err := s.Queries.GetRecentVisitCategories(ctx, dbgen.GetRecentVisitCategoriesParams{
+		UserID: userID,
+		Since:  time.Now().Add(-s.RecentCategoryWindow).UTC().Format(time.DateTime),
+	})
+	if err != nil {
+		slog.Warn("load recent visit categories", "user", userID, "error", err)
+	}
+	recent := make(map[string]bool, len(cats))
+	for _, cat := range cats {
+		recent[cat] = true
+	}
+	return recent
+}
+
+// weightedCategories returns the route categories, heaviest first; equal
+// weights keep the usual drive, restaurant, rest order.
+func (req RouteRequest) weightedCategories() []string {
+	cats := []string{"drive", "restaurant", "rest"}
+	sort.SliceStable(cats, func(i, j int) bool { return req.weight(cats[i]) > req.weight(cats[j]) })
+	return cats
+}
+
+// candidateCap returns how many candidates of category to offer the AI,
+// scaled by its weight but never below one.
+func (req RouteRequest) candidateCap(category string) int {
+	return max(1, int(math.Round(float64(routeCandidateCaps[category])*req.weight(category))))
+}
+
+// validateCategoryWeights checks that weights name known categories and
+// lie in (0, maxCategoryWeight].
+func validateCategoryWeights(weights map[string]float64) error {
+	for cat, w := range weights {
+		if !validCategories[cat] {
+			return fmt.Errorf("category_weights: unknown category %q", cat)
+		}
+		if w <= 0 || w > maxCategoryWeight {
+			return fmt.Errorf("category_weights: %s must be > 0 and <= %d, got %v", cat, maxCategoryWeight, w)
+		}
+	}
+	return nil
+}
+
+// categoryWeightPrompt tells the AI which categories to emphasize; empty
+// when every category weighs the same.
+func (s *Server) categoryWeightPrompt(req RouteRequest) string {
+	var lines string
+	for _, cat := range req.weightedCategories() {
+		w := req.weight(cat)
+		var emphasis string
+		switch {
+		case w >= 2:
+			emphasis = "最優先で多めに選ぶ"
+		case w > 1:
+			emphasis = "優先する"
+		case w < 1:
+			emphasis = "控えめにする"
+		default:
+			continue
+		}
+		if req.recentCategories[cat] {
+			emphasis += "（最近訪れたため）"
+		}
+		lines += fmt.Sprintf("- %s: %s (重み%.1f)\n", s.categoryLabel(cat), emphasis, w)
+	}
+	if lines == "" {
+		return ""
+	}
+	return "\n【カテゴリの重視度】\n" + lines
+}
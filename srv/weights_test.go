@@ -0,0 +1,107 @@
+package srv
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRouteCategoryWeights(t *testing.T) {
+	server, llm := newTestServer(t)
+	var drives, meals []int64
+	for i := range 20 {
+		drives = append(drives, seedSpot(t, server, fmt.Sprintf("展望台%d", i), "drive", 35.0+0.01*float64(i+1), 139.0).ID)
+		meals = append(meals, seedSpot(t, server, fmt.Sprintf("食堂%d", i), "restaurant", 35.0, 139.0+0.01*float64(i+1)).ID)
+	}
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, drives[0])
+
+	include := true
+	prompt := func(weights map[string]float64) string {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, IncludeRestaurant: &include, CategoryWeights: weights})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return llm.lastPrompt()
+	}
+	listed := func(p, prefix string) int { return strings.Count(p, "] "+prefix) }
+
+	plain := prompt(nil)
+	if strings.Contains(plain, "カテゴリの重視度") {
+		t.Errorf("expected no weighting section by default")
+	}
+	if listed(plain, "展望台") != 20 || listed(plain, "食堂") != 15 {
+		t.Errorf("expected 20 drive and 15 restaurant candidates, got %d and %d", listed(plain, "展望台"), listed(plain, "食堂"))
+	}
+	if strings.Index(plain, "ドライブスポット:") > strings.Index(plain, "食事:") {
+		t.Errorf("expected drive spots listed first by default")
+	}
+
+	foodie := prompt(map[string]float64{"restaurant": 2, "drive": 0.5})
+	if listed(foodie, "展望台") != 10 || listed(foodie, "食堂") != 20 {
+		t.Errorf("expected 10 drive and 20 restaurant candidates, got %d and %d", listed(foodie, "展望台"), listed(foodie, "食堂"))
+	}
+	if strings.Index(foodie, "食事:") > strings.Index(foodie, "ドライブスポット:") {
+		t.Errorf("expected restaurants listed first for a foodie trip")
+	}
+	if !strings.Contains(foodie, "- 食事: 最優先で多めに選ぶ (重み2.0)") || !strings.Contains(foodie, "- ドライブスポット: 控えめにする (重み0.5)") {
+		t.Errorf("expected the weights in the prompt, got:\n%s", foodie)
+	}
+
+	scenic := prompt(map[string]float64{"drive": 2})
+	if !strings.Contains(scenic, "- ドライブスポット: 最優先で多めに選ぶ") || strings.Contains(scenic, "- 食事:") {
+		t.Errorf("expected only drive spots emphasized, got:\n%s", scenic)
+	}
+	if !strings.Contains(scenic, "ドライブスポットを **4箇所以上**") {
+		t.Errorf("expected an extra drive stop for a scenic trip")
+	}
+
+	for _, bad := range []map[string]float64{{"museum": 1}, {"drive": 0}, {"rest": 5}} {
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, CategoryWeights: bad})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestRouteDiversifyFromHistory(t *testing.T) {
+	server, llm := newTestServer(t)
+	var drives []int64
+	for i := range 20 {
+		drives = append(drives, seedSpot(t, server, fmt.Sprintf("展望台%d", i), "drive", 35.0+0.01*float64(i+1), 139.0).ID)
+		seedSpot(t, server, fmt.Sprintf("食堂%d", i), "restaurant", 35.0, 139.0+0.01*float64(i+1))
+	}
+	llm.response = fmt.Sprintf(`{"route_ids": [%d], "stay_durations": [30], "message": "ok"}`, drives[0])
+	mustExec(t, server, "INSERT INTO users (id) VALUES ('user-a')")
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) VALUES ('user-a', ?, datetime('now', '-3 days'))", drives[5])
+	// Visits before the window don't count
+	mustExec(t, server, "INSERT INTO visit_history (user_id, spot_id, visited_at) SELECT 'user-a', id, datetime('now', '-60 days') FROM spots WHERE name = '食堂3'")
+
+	include := true
+	prompt := func(diversify bool) string {
+		t.Helper()
+		w := postJSON(t, server, "/api/route", "user-a", RouteRequest{Lat: 35.0, Lng: 139.0, IncludeRestaurant: &include, DiversifyFromHistory: diversify})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return llm.lastPrompt()
+	}
+	listed := func(p, prefix string) int { return strings.Count(p, "] "+prefix) }
+
+	plain := prompt(false)
+	if listed(plain, "展望台") != 20 || strings.Index(plain, "\nドライブスポット:\n") > strings.Index(plain, "\n食事:\n") {
+		t.Errorf("expected drive spots to lead without the flag, got:\n%s", plain)
+	}
+
+	diverse := prompt(true)
+	if listed(diverse, "展望台") != 10 || listed(diverse, "食堂") != 15 {
+		t.Errorf("expected 10 drive and 15 restaurant candidates, got %d and %d", listed(diverse, "展望台"), listed(diverse, "食堂"))
+	}
+	if strings.Index(diverse, "\n食事:\n") > strings.Index(diverse, "\nドライブスポット:\n") {
+		t.Errorf("expected restaurants to lead after a recent drive")
+	}
+	if !strings.Contains(diverse, "- ドライブスポット: 控えめにする（最近訪れたため） (重み0.5)") || strings.Contains(diverse, "- 食事:") {
+		t.Errorf("expected only drive spots played down, got:\n%s", diverse)
+	}
+}